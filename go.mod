@@ -2,4 +2,7 @@ module github.com/timehop/jimmy
 
 go 1.22
 
-require github.com/gomodule/redigo v1.9.3
+require (
+	github.com/gomodule/redigo v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,224 @@
+package redis_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestACL(t *testing.T) {
+	fs := newFakeACLServer(t, map[string]string{"default": "defaultpass", "alice": "secret"})
+
+	newPool := func(url string, config redis.Config) redis.Pool {
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	t.Run("authenticates as the URL's user", func(t *testing.T) {
+		fs.reset()
+		p := newPool("redis://alice:secret@"+fs.addr+"/10", redis.DefaultConfig)
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := fs.authCommands(); len(got) != 1 || got[0] != "AUTH alice secret" {
+			t.Errorf("expected AUTH alice secret but got %q", got)
+		}
+	})
+
+	t.Run("falls back to the default user for unknown users", func(t *testing.T) {
+		fs.reset()
+		p := newPool("redis://h:defaultpass@"+fs.addr, redis.DefaultConfig)
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := fs.authCommands(); len(got) != 2 || got[1] != "AUTH defaultpass" {
+			t.Errorf("expected AUTH defaultpass after AUTH h defaultpass but got %q", got)
+		}
+	})
+
+	t.Run("fails with the wrong password", func(t *testing.T) {
+		fs.reset()
+		p := newPool("redis://alice:wrong@"+fs.addr, redis.DefaultConfig)
+		if _, err := p.Exists("key"); err == nil || !strings.HasPrefix(err.Error(), "WRONGPASS") {
+			t.Errorf("expected WRONGPASS but got %v", err)
+		}
+	})
+
+	t.Run("authenticates again as the same user", func(t *testing.T) {
+		fs.reset()
+		p := newPool("redis://alice:secret@"+fs.addr, redis.DefaultConfig)
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+
+		fs.deauth()
+		if _, err := c.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := fs.authCommands(); len(got) != 2 || got[1] != "AUTH alice secret" {
+			t.Errorf("expected AUTH alice secret again but got %q", got)
+		}
+	})
+
+	t.Run("authenticates and names connections with HELLO", func(t *testing.T) {
+		fs.reset()
+		config := redis.DefaultConfig
+		config.Protocol = 3
+		config.ClientName = "jimmy"
+		p := newPool("redis://alice:secret@"+fs.addr, config)
+
+		if _, err := p.Get("key"); err != redis.ErrNil {
+			t.Fatalf("expected ErrNil but got %v", err)
+		}
+		if got := fs.authCommands(); len(got) != 1 || got[0] != "HELLO 3 AUTH alice secret SETNAME jimmy" {
+			t.Errorf("expected HELLO 3 AUTH alice secret SETNAME jimmy but got %q", got)
+		}
+	})
+
+	t.Run("takes the protocol and client name from the URL", func(t *testing.T) {
+		fs.reset()
+		p := newPool("redis://:defaultpass@"+fs.addr+"?protocol=2&client_name=url", redis.DefaultConfig)
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := fs.authCommands(); len(got) != 1 || got[0] != "HELLO 2 AUTH default defaultpass SETNAME url" {
+			t.Errorf("expected HELLO 2 AUTH default defaultpass SETNAME url but got %q", got)
+		}
+	})
+}
+
+func TestRESP3(t *testing.T) {
+	config := redis.DefaultConfig
+	config.Protocol = 3
+	p, err := redis.NewPool("redis://localhost:6379/10", config)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	key := "_tests:jimmy:redis:resp3"
+	p.Del(key)
+	defer p.Del(key)
+
+	t.Run("reads maps as hashes", func(t *testing.T) {
+		p.Del(key)
+		p.HSet(key, "field", "value")
+		if m, err := p.HGetAll(key); err != nil || m["field"] != "value" {
+			t.Errorf("expected field: value but got %v, %v", m, err)
+		}
+	})
+
+	t.Run("reads null as ErrNil", func(t *testing.T) {
+		p.Del(key)
+		if _, err := p.Get(key); err != redis.ErrNil {
+			t.Errorf("expected ErrNil but got %v", err)
+		}
+	})
+
+	t.Run("reads members and scores paired as Z", func(t *testing.T) {
+		p.Del(key)
+		p.ZAdd(key, 1, "a", 2.5, "b")
+		z, err := p.ZRangeWithScores(key, 0, -1)
+		if err != nil || len(z) != 2 || z[1] != (redis.Z{Value: "b", Score: 2.5}) {
+			t.Errorf("expected [{a 1} {b 2.5}] but got %v, %v", z, err)
+		}
+	})
+}
+
+// fakeACLServer is a stand-in for a Redis server with ACL users, which records how connections
+// authenticate. It answers EXISTS with 0 and GET with nil, in RESP3 once switched to it by HELLO.
+type fakeACLServer struct {
+	addr  string
+	users map[string]string
+
+	mu    sync.Mutex
+	auths []string
+	// Bumped by deauth, so that connections authenticated before are asked to authenticate again.
+	epoch int
+}
+
+func newFakeACLServer(t *testing.T, users map[string]string) *fakeACLServer {
+	fs := &fakeACLServer{users: users}
+	fs.addr = newFakeServer(t, fs.serve)
+	return fs
+}
+
+// serve returns the handler of the commands of a connection.
+func (fs *fakeACLServer) serve(c *fakeConn) func([]string) {
+	authed, resp3 := -1, false
+	return func(args []string) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		name := strings.ToUpper(args[0])
+		if name == "AUTH" || name == "HELLO" {
+			fs.auths = append(fs.auths, strings.Join(args, " "))
+		}
+
+		switch {
+		case name == "AUTH":
+			user, pass := "default", args[len(args)-1]
+			if len(args) == 3 {
+				user = args[1]
+			}
+			if fs.users[user] != pass {
+				c.write(respError("WRONGPASS invalid username-password pair or user is disabled."))
+				break
+			}
+			authed = fs.epoch
+			c.write(respStatus("OK"))
+		case name == "HELLO":
+			if len(args) >= 5 && strings.EqualFold(args[2], "AUTH") {
+				if fs.users[args[3]] != args[4] {
+					c.write(respError("WRONGPASS invalid username-password pair or user is disabled."))
+					break
+				}
+				authed = fs.epoch
+			}
+			resp3 = args[1] == "3"
+			if resp3 {
+				c.write(respRaw("%1\r\n+proto\r\n:3\r\n"))
+			} else {
+				c.write([]interface{}{"proto", 2})
+			}
+		case authed != fs.epoch:
+			c.write(respError("NOAUTH Authentication required."))
+		case name == "GET" && resp3:
+			c.write(respRaw("_\r\n"))
+		case name == "GET":
+			c.write(nil)
+		case name == "EXISTS":
+			c.write(0)
+		default:
+			c.write(respStatus("OK"))
+		}
+	}
+}
+
+func (fs *fakeACLServer) reset() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.auths = nil
+}
+
+// authCommands returns the AUTH and HELLO commands received since reset.
+func (fs *fakeACLServer) authCommands() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.auths...)
+}
+
+// deauth makes every connection authenticate again, as if the server restarted.
+func (fs *fakeACLServer) deauth() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.epoch++
+}
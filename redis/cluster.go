@@ -0,0 +1,516 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	netURL "net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// ClusterSlots is the number of hash slots Redis Cluster distributes keys over.
+const ClusterSlots = 16384
+
+var (
+	errClusterShutdown = errors.New("redis: cluster pool is shut down")
+
+	// How many times a command is redirected by MOVED or ASK before the redirection is returned as
+	// its error.
+	clusterMaxRedirects = 5
+)
+
+// ClusterPool is a Pool for Redis Cluster. It keeps a Pool for each node, and sends each command to
+// the node serving the hash slot of its key. Del, Exists, Touch and Unlink are split between the
+// slots of their keys, but the keys of other multi-key commands, and of a transaction, must share a
+// slot (see HashSlot), or the command fails with ErrCrossShard. Pipelines are split into a pipeline
+// per node, and their replies merged back in the order the commands were queued. A transaction is
+// sent whole to the node serving the first key queued in it, or watched before it.
+//
+// Commands without keys, such as Scan and Publish, are sent to a single node. FLUSHDB, FLUSHALL and
+// SCRIPT LOAD and FLUSH are sent to every master.
+//
+// When a slot has moved, the node a command is sent to redirects it with MOVED. The command is
+// retried on the node the slot moved to, and the slot map reloaded in the background. Commands
+// redirected with ASK, while a slot is being migrated, are retried on the node importing the slot.
+// Commands queued in a transaction can't be retried on their own, so a transaction sent to the
+// wrong node fails with the redirection error.
+type ClusterPool interface {
+	Pool
+
+	// ForEachMaster calls f with the Pool of each master node, stopping at the first error, e.g.
+	// to scan the keys of every node. The pools must not be shut down.
+	ForEachMaster(f func(Pool) error) error
+
+	// ReloadSlots fetches the map of which node serves each slot from the cluster.
+	ReloadSlots() error
+}
+
+// NewClusterPool returns a ClusterPool for the cluster that the nodes at urls belong to. The nodes
+// are asked for the slot map in turn, until one replies. The connections to each node the pool
+// discovers are configured as those to the first URL, and pooled according to config.
+func NewClusterPool(urls []string, config Config) (ClusterPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("redis: cluster pool needs the URL of at least one node")
+	}
+
+	seeds := make([]*netURL.URL, len(urls))
+	for i, url := range urls {
+		parsedURL, err := netURL.Parse(url)
+		if err != nil {
+			return nil, err
+		}
+		seeds[i] = parsedURL
+	}
+
+	c := &cluster{seeds: seeds, config: config, nodes: map[string]*pool{}}
+	if err := c.reloadSlots(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	username, password := credentials(seeds[0])
+	p := &clusterPool{pool: &pool{p: c, url: seeds[0], username: username, password: password, options: config.urlOptions()}, cluster: c}
+	if err := p.setUp(config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// HashSlot returns the cluster hash slot of a key. If the key contains a hash tag, a non-empty
+// substring between its first { and the next }, only the tag is hashed, so keys with the same tag
+// are served by the same node.
+func HashSlot(key string) int {
+	return int(crc16(hashTag(key))) % ClusterSlots
+}
+
+// crc16 is the CCITT (XMODEM) variant of CRC16, which Redis Cluster hashes keys with.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type clusterPool struct {
+	*pool
+
+	cluster *cluster
+}
+
+func (s *clusterPool) WithContext(ctx context.Context) Pool {
+	p := *s
+	p.pool = s.pool.WithContext(ctx).(*pool)
+	return &p
+}
+
+func (s *clusterPool) ForEachMaster(f func(Pool) error) error {
+	for _, addr := range s.cluster.masters() {
+		node, err := s.cluster.node(addr)
+		if err != nil {
+			return err
+		}
+		if err := f(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *clusterPool) ReloadSlots() error {
+	return s.cluster.reloadSlots()
+}
+
+// cluster is the connSource of a ClusterPool.
+type cluster struct {
+	seeds  []*netURL.URL
+	config Config
+
+	mu sync.RWMutex
+	// The address of the master serving each slot, or "" if it isn't known.
+	slots [ClusterSlots]string
+	// The sorted addresses of the masters in slots.
+	masterAddrs []string
+	nodes       map[string]*pool
+	shutdown    bool
+
+	reloading atomic.Bool
+}
+
+func (c *cluster) Get() redigo.Conn {
+	return newRoutedConn(nil, c)
+}
+
+func (c *cluster) GetContext(ctx context.Context) (redigo.Conn, error) {
+	return newRoutedConn(ctx, c), nil
+}
+
+func (c *cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.shutdown = true
+	for _, node := range c.nodes {
+		node.Shutdown()
+	}
+	c.nodes = map[string]*pool{}
+	return nil
+}
+
+func (c *cluster) stats() PoolStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var stats PoolStats
+	for _, node := range c.nodes {
+		stats = stats.add(node.Stats())
+	}
+	return stats
+}
+
+// node returns the pool of the node at addr, creating it if needed.
+func (c *cluster) node(addr string) (*pool, error) {
+	c.mu.RLock()
+	node := c.nodes[addr]
+	shutdown := c.shutdown
+	c.mu.RUnlock()
+
+	if node != nil {
+		return node, nil
+	}
+	if shutdown {
+		return nil, errClusterShutdown
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.shutdown {
+		return nil, errClusterShutdown
+	}
+	if node = c.nodes[addr]; node == nil {
+		url := *c.seeds[0]
+		url.Host = addr
+		node = NewPoolWithURL(&url, c.config).(*pool)
+		c.nodes[addr] = node
+	}
+	return node, nil
+}
+
+// addr returns the address of the node serving slot, or of any node if that isn't known.
+func (c *cluster) addr(slot int) string {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+
+	if addr == "" {
+		return c.anyAddr()
+	}
+	return addr
+}
+
+// anyAddr returns the address of the node keyless commands are sent to. The same node is picked
+// each time, so that a sequence of commands such as a scan stays on one node.
+func (c *cluster) anyAddr() string {
+	if masters := c.masters(); len(masters) > 0 {
+		return masters[0]
+	}
+	return c.seeds[0].Host
+}
+
+// masters returns the sorted addresses of the masters serving slots.
+func (c *cluster) masters() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.masterAddrs
+}
+
+// setSlots replaces the slot map, and shuts down the pools of nodes which no longer serve any
+// slots. c.mu must be held.
+func (c *cluster) setSlots(slots *[ClusterSlots]string) {
+	c.slots = *slots
+
+	serving := map[string]bool{}
+	for _, addr := range c.slots {
+		if addr != "" {
+			serving[addr] = true
+		}
+	}
+	c.masterAddrs = sortedKeys(serving)
+
+	for addr, node := range c.nodes {
+		if !serving[addr] {
+			node.Shutdown()
+			delete(c.nodes, addr)
+		}
+	}
+}
+
+// reloadSlots asks the known masters, then the nodes the cluster was created with, for the slot
+// map, until one replies. Pools of nodes which no longer serve any slots are shut down.
+func (c *cluster) reloadSlots() error {
+	addrs := c.masters()
+	for _, seed := range c.seeds {
+		addrs = append(addrs, seed.Host)
+	}
+
+	var err error
+	for _, addr := range addrs {
+		var slots *[ClusterSlots]string
+		slots, err = c.fetchSlots(addr)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		c.setSlots(slots)
+		c.mu.Unlock()
+
+		return nil
+	}
+	return err
+}
+
+// fetchSlots asks the node at addr for the slot map, with CLUSTER SHARDS, or with CLUSTER SLOTS if
+// the node predates Redis 7 and doesn't know it.
+func (c *cluster) fetchSlots(addr string) (*[ClusterSlots]string, error) {
+	host, _, _ := net.SplitHostPort(addr)
+
+	reply, err := c.do(nil, addr, false, "CLUSTER", "SHARDS")
+	if err == nil {
+		return clusterShards(reply, host, c.seeds[0].Scheme == "rediss")
+	}
+	var redisErr redigo.Error
+	if !errors.As(err, &redisErr) {
+		return nil, err
+	}
+
+	reply, err = c.do(nil, addr, false, "CLUSTER", "SLOTS")
+	if err != nil {
+		return nil, err
+	}
+	return clusterSlots(reply, host)
+}
+
+// moved records that slot is now served by the node at addr, and reloads the rest of the slot map
+// in the background, as other slots have probably moved too.
+func (c *cluster) moved(slot int, addr string) {
+	c.mu.Lock()
+	slots := c.slots
+	slots[slot] = addr
+	c.setSlots(&slots)
+	c.mu.Unlock()
+
+	if c.reloading.CompareAndSwap(false, true) {
+		go func() {
+			defer c.reloading.Store(false)
+			c.reloadSlots()
+		}()
+	}
+}
+
+// do runs a command on a connection of its own to the node at addr, preceded by ASKING if asking.
+func (c *cluster) do(ctx context.Context, addr string, asking bool, command string, args ...interface{}) (interface{}, error) {
+	node, err := c.node(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := node.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if asking {
+		if err := conn.Send("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return do(ctx, conn, command, args...)
+}
+
+// follow retries a command for as long as it is redirected, up to clusterMaxRedirects times.
+func (c *cluster) follow(ctx context.Context, reply interface{}, err error, command string, args []interface{}) (interface{}, error) {
+	for i := 0; i < clusterMaxRedirects; i++ {
+		redirect, ok := redirection(err)
+		if !ok {
+			break
+		}
+		if !redirect.Ask {
+			c.moved(redirect.Slot, redirect.Addr)
+		}
+		reply, err = c.do(ctx, redirect.Addr, redirect.Ask, command, args...)
+	}
+	return reply, err
+}
+
+func (c *cluster) shard(key string) int {
+	return HashSlot(key)
+}
+
+func (c *cluster) addrs() []string {
+	return c.masters()
+}
+
+// queued records the moves of the slots of commands queued in a transaction, so that the
+// transaction is sent to the right node if it's retried.
+func (c *cluster) queued(err error) {
+	if redirect, ok := redirection(err); ok && !redirect.Ask {
+		c.moved(redirect.Slot, redirect.Addr)
+	}
+}
+
+// clusterShards converts a CLUSTER SHARDS reply into the address of the master serving each slot.
+// Masters are addressed as nodeAddr does, by their TLS port if tls is set and they have one.
+func clusterShards(reply interface{}, host string, tls bool) (*[ClusterSlots]string, error) {
+	shards, err := redigo.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots [ClusterSlots]string
+	for _, shard := range shards {
+		fields, err := redigo.Values(shard, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var ranges []int
+		var master string
+		for i := 0; i+1 < len(fields); i += 2 {
+			name, _ := redigo.String(fields[i], nil)
+			switch name {
+			case "slots":
+				if ranges, err = redigo.Ints(fields[i+1], nil); err != nil {
+					return nil, err
+				}
+			case "nodes":
+				nodes, err := redigo.Values(fields[i+1], nil)
+				if err != nil {
+					return nil, err
+				}
+				for _, node := range nodes {
+					addr, err := shardMaster(node, host, tls)
+					if err != nil {
+						return nil, err
+					}
+					if addr != "" {
+						master = addr
+					}
+				}
+			}
+		}
+		if len(ranges)%2 != 0 {
+			return nil, fmt.Errorf("redis: expected CLUSTER SHARDS slots in pairs but got %d", len(ranges))
+		}
+		// A shard without a master, in the midst of failing over, serves no slots for now.
+		if master == "" {
+			continue
+		}
+
+		for i := 0; i < len(ranges); i += 2 {
+			for slot := ranges[i]; slot <= ranges[i+1] && slot < ClusterSlots; slot++ {
+				slots[slot] = master
+			}
+		}
+	}
+	return &slots, nil
+}
+
+// shardMaster returns the address of a node of a CLUSTER SHARDS reply if it's a master, or "".
+func shardMaster(node interface{}, host string, tls bool) (string, error) {
+	fields, err := redigo.Values(node, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var endpoint, role string
+	var port, tlsPort int
+	for i := 0; i+1 < len(fields); i += 2 {
+		name, _ := redigo.String(fields[i], nil)
+		switch name {
+		case "endpoint":
+			endpoint, err = redigo.String(fields[i+1], nil)
+		case "role":
+			role, err = redigo.String(fields[i+1], nil)
+		case "port":
+			port, err = redigo.Int(fields[i+1], nil)
+		case "tls-port":
+			tlsPort, err = redigo.Int(fields[i+1], nil)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if role != "master" {
+		return "", nil
+	}
+	if tlsPort != 0 && (tls || port == 0) {
+		port = tlsPort
+	}
+	return nodeAddr(endpoint, port, host), nil
+}
+
+// nodeAddr returns the address of a node announced by endpoint, an IP address or a hostname, and
+// port. Nodes whose endpoint is unknown, announced as "" or "?", are presumed to be on host, the
+// node that announced them.
+func nodeAddr(endpoint string, port int, host string) string {
+	if endpoint == "" || endpoint == "?" {
+		endpoint = host
+	}
+	return net.JoinHostPort(endpoint, strconv.Itoa(port))
+}
+
+// clusterSlots converts a CLUSTER SLOTS reply into the address of the master serving each slot,
+// addressed as nodeAddr does.
+func clusterSlots(reply interface{}, host string) (*[ClusterSlots]string, error) {
+	ranges, err := redigo.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var slots [ClusterSlots]string
+	for _, r := range ranges {
+		fields, err := redigo.Values(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("redis: expected CLUSTER SLOTS range of at least 3 values but got %d", len(fields))
+		}
+
+		var start, end int
+		if _, err := redigo.Scan(fields, &start, &end); err != nil {
+			return nil, err
+		}
+
+		master, err := redigo.Values(fields[2], nil)
+		if err != nil {
+			return nil, err
+		}
+		var endpoint string
+		var port int
+		if _, err := redigo.Scan(master, &endpoint, &port); err != nil {
+			return nil, err
+		}
+
+		addr := nodeAddr(endpoint, port, host)
+		for slot := start; slot <= end && slot < ClusterSlots; slot++ {
+			slots[slot] = addr
+		}
+	}
+	return &slots, nil
+}
@@ -0,0 +1,581 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestHashSlot(t *testing.T) {
+	for key, slot := range map[string]int{
+		"123456789":            12739,
+		"foo":                  12182,
+		"{user1000}.following": redis.HashSlot("user1000"),
+		"foo{}{bar}":           redis.HashSlot("foo{}{bar}"),
+		"foo{{bar}}zap":        redis.HashSlot("{bar"),
+		"foo{bar}{zap}":        redis.HashSlot("bar"),
+	} {
+		if got := redis.HashSlot(key); got != slot {
+			t.Errorf("expected slot of %q to be %d but got %d", key, slot, got)
+		}
+	}
+	if redis.HashSlot("foo{}{bar}") == redis.HashSlot("bar") {
+		t.Error("expected an empty hash tag to be ignored")
+	}
+}
+
+func TestClusterPool(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	p, err := redis.NewClusterPool([]string{"redis://" + fc.nodes[0].addr}, redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create cluster pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	reset := func() {
+		fc.reset()
+		if err := p.ReloadSlots(); err != nil {
+			t.Fatalf("failed to reload slots: %v", err)
+		}
+	}
+
+	// keys returns a key served by each node, in the order of the nodes.
+	keys := func(prefix string) []string {
+		keys := make([]string, len(fc.nodes))
+		for i := range fc.nodes {
+			for n := 0; keys[i] == ""; n++ {
+				key := fmt.Sprintf("%v:%d", prefix, n)
+				if fc.owner(redis.HashSlot(key)) == fc.nodes[i] {
+					keys[i] = key
+				}
+			}
+		}
+		return keys
+	}
+
+	t.Run("routes commands to the node serving their key", func(t *testing.T) {
+		reset()
+		for _, key := range keys("route") {
+			if err := p.Set(key, key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		for _, node := range fc.nodes {
+			if fc.len(node) != 1 {
+				t.Errorf("expected node %v to have 1 key but it has %d", node.addr, fc.len(node))
+			}
+		}
+		if redirected := fc.redirected(); redirected != 0 {
+			t.Errorf("expected no redirections but got %d", redirected)
+		}
+	})
+
+	t.Run("splits pipelines per node and merges their replies in order", func(t *testing.T) {
+		reset()
+		keys := keys("pipeline")
+
+		var gets []*redis.StringFuture
+		replies, err := p.Pipelined(func(p redis.Pipeline) {
+			for i := len(keys) - 1; i >= 0; i-- {
+				p.Set(keys[i], strconv.Itoa(i))
+			}
+			for _, key := range keys {
+				gets = append(gets, p.Get(key))
+			}
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(replies) != 2*len(keys) {
+			t.Fatalf("expected %d replies but got %d", 2*len(keys), len(replies))
+		}
+		for i, get := range gets {
+			if get.Val() != strconv.Itoa(i) {
+				t.Errorf("expected value of %v to be %d but got %q", keys[i], i, get.Val())
+			}
+		}
+	})
+
+	t.Run("runs transactions on the node serving the first key", func(t *testing.T) {
+		reset()
+
+		var incr *redis.IntFuture
+		_, err := p.Transaction(func(t redis.Transaction) {
+			t.Set("{tx}:a", "1")
+			incr = t.Incr("{tx}:b")
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if incr.Val() != 1 {
+			t.Errorf("expected incr to be 1 but got %d", incr.Val())
+		}
+		if node := fc.owner(redis.HashSlot("tx")); fc.len(node) != 2 {
+			t.Errorf("expected both keys on node %v but it has %d", node.addr, fc.len(node))
+		}
+	})
+
+	t.Run("runs check-and-set on the node watched", func(t *testing.T) {
+		reset()
+
+		_, err := p.CheckAndSet([]string{"{cas}:a"}, 0, func(c redis.Connection) error {
+			_, err := c.Get("{cas}:a")
+			if err == redis.ErrNil {
+				err = nil
+			}
+			return err
+		}, func(t redis.Transaction) {
+			t.Set("{cas}:a", "1")
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := p.Get("{cas}:a"); v != "1" {
+			t.Errorf("expected 1 but got %q", v)
+		}
+	})
+
+	t.Run("follows MOVED and updates the slot map", func(t *testing.T) {
+		reset()
+		key := keys("moved")[0]
+		if err := p.Set(key, "moved"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fc.move(redis.HashSlot(key), fc.nodes[1])
+
+		if v, err := p.Get(key); err != nil || v != "moved" {
+			t.Fatalf("expected moved but got %q, %v", v, err)
+		}
+		if redirected := fc.redirected(); redirected != 1 {
+			t.Errorf("expected 1 redirection but got %d", redirected)
+		}
+		if v, err := p.Get(key); err != nil || v != "moved" {
+			t.Fatalf("expected moved but got %q, %v", v, err)
+		}
+		if redirected := fc.redirected(); redirected != 1 {
+			t.Errorf("expected no more redirections but got %d", redirected-1)
+		}
+	})
+
+	t.Run("follows MOVED in pipelines", func(t *testing.T) {
+		reset()
+		keys := keys("moved-pipeline")
+		fc.move(redis.HashSlot(keys[0]), fc.nodes[2])
+
+		replies, err := p.Pipelined(func(p redis.Pipeline) {
+			for _, key := range keys {
+				p.Set(key, key)
+				p.Get(key)
+			}
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, key := range keys {
+			if v, _ := redis.String(replies[2*i+1], nil); v != key {
+				t.Errorf("expected %v but got %q", key, v)
+			}
+		}
+	})
+
+	t.Run("fails transactions sent to a moved slot, until retried", func(t *testing.T) {
+		reset()
+		key := keys("moved-tx")[0]
+		fc.move(redis.HashSlot(key), fc.nodes[1])
+
+		transaction := func() error {
+			_, err := p.Transaction(func(t redis.Transaction) {
+				t.Set(key, "1")
+			})
+			return err
+		}
+		if err := transaction(); err == nil || !strings.HasPrefix(err.Error(), "MOVED ") {
+			t.Fatalf("expected MOVED error but got %v", err)
+		}
+		if err := transaction(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("follows ASK without updating the slot map", func(t *testing.T) {
+		reset()
+		keys := keys("ask")
+		slot := redis.HashSlot(keys[0])
+		fc.migrate(slot, fc.nodes[1])
+
+		// Keys already migrated are served by the importing node.
+		fc.set(fc.nodes[1], keys[0], "migrated")
+		if v, err := p.Get(keys[0]); err != nil || v != "migrated" {
+			t.Fatalf("expected migrated but got %q, %v", v, err)
+		}
+		if redirected := fc.redirected(); redirected != 1 {
+			t.Errorf("expected 1 redirection but got %d", redirected)
+		}
+		if v, err := p.Get(keys[0]); err != nil || v != "migrated" {
+			t.Fatalf("expected migrated but got %q, %v", v, err)
+		}
+		if redirected := fc.redirected(); redirected != 2 {
+			t.Errorf("expected another redirection but got %d", redirected-1)
+		}
+	})
+
+	t.Run("loads the slot map from nodes announced by hostname or an unknown endpoint", func(t *testing.T) {
+		for _, endpoint := range []string{"localhost", "?"} {
+			for _, slotsOnly := range []bool{false, true} {
+				reset()
+				fc.announce(endpoint, slotsOnly)
+				if err := p.ReloadSlots(); err != nil {
+					t.Fatalf("failed to reload slots: %v", err)
+				}
+				for _, key := range keys("endpoint") {
+					if err := p.Set(key, endpoint); err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+				}
+				if redirected := fc.redirected(); redirected != 0 {
+					t.Errorf("expected no redirections with endpoint %q, slots only %v but got %d", endpoint, slotsOnly, redirected)
+				}
+			}
+		}
+	})
+
+	t.Run("ForEachMaster visits every master", func(t *testing.T) {
+		reset()
+		var n int
+		err := p.ForEachMaster(func(node redis.Pool) error {
+			n++
+			c, err := node.GetConnection()
+			if err != nil {
+				return err
+			}
+			defer c.Release()
+
+			_, err = c.Do("PING")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != len(fc.nodes) {
+			t.Errorf("expected %d masters but got %d", len(fc.nodes), n)
+		}
+	})
+
+	t.Run("is a ClusterPool bound to a context", func(t *testing.T) {
+		cp, ok := p.WithContext(context.Background()).(redis.ClusterPool)
+		if !ok {
+			t.Fatal("expected a ClusterPool")
+		}
+		if err := cp.ReloadSlots(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := p.WithContext(ctx).Get("foo"); err == nil {
+			t.Error("expected an error from a canceled context")
+		}
+	})
+
+	t.Run("broadcasts FLUSHDB", func(t *testing.T) {
+		reset()
+		for _, key := range keys("flush") {
+			p.Set(key, key)
+		}
+		p.Do(func(c redis.Connection) { c.Do("FLUSHDB") })
+		for _, node := range fc.nodes {
+			if fc.len(node) != 0 {
+				t.Errorf("expected node %v to be flushed but it has %d keys", node.addr, fc.len(node))
+			}
+		}
+	})
+}
+
+// fakeCluster is a stand-in for Redis Cluster, of nodes speaking enough RESP to serve CLUSTER
+// SHARDS and SLOTS, strings and transactions. Like Redis, nodes redirect commands for slots they
+// don't serve with MOVED, and for keys they no longer have in slots being migrated with ASK.
+type fakeCluster struct {
+	mu        sync.Mutex
+	nodes     []*fakeClusterNode
+	owners    [redis.ClusterSlots]*fakeClusterNode
+	migrating map[int]*fakeClusterNode
+	redirects int
+
+	// The endpoint nodes announce themselves by, or "" for their IP address, and whether they
+	// only know CLUSTER SLOTS, as nodes older than Redis 7 do.
+	endpoint  string
+	slotsOnly bool
+}
+
+type fakeClusterNode struct {
+	addr string
+	data map[string]string
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	fc := &fakeCluster{}
+	for i := 0; i < n; i++ {
+		node := &fakeClusterNode{}
+		node.addr = newFakeServer(t, func(c *fakeConn) func([]string) { return fc.serve(c, node) })
+		fc.nodes = append(fc.nodes, node)
+	}
+
+	fc.reset()
+	return fc
+}
+
+// reset spreads the slots evenly over the nodes, and empties them.
+func (fc *fakeCluster) reset() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for slot := range fc.owners {
+		fc.owners[slot] = fc.nodes[slot*len(fc.nodes)/redis.ClusterSlots]
+	}
+	for _, node := range fc.nodes {
+		node.data = map[string]string{}
+	}
+	fc.migrating = map[int]*fakeClusterNode{}
+	fc.redirects = 0
+	fc.endpoint, fc.slotsOnly = "", false
+}
+
+// announce sets the endpoint nodes announce themselves by, and whether they only know CLUSTER
+// SLOTS.
+func (fc *fakeCluster) announce(endpoint string, slotsOnly bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.endpoint, fc.slotsOnly = endpoint, slotsOnly
+}
+
+func (fc *fakeCluster) owner(slot int) *fakeClusterNode {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.owners[slot]
+}
+
+func (fc *fakeCluster) len(node *fakeClusterNode) int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(node.data)
+}
+
+func (fc *fakeCluster) set(node *fakeClusterNode, key, value string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	node.data[key] = value
+}
+
+func (fc *fakeCluster) redirected() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.redirects
+}
+
+// move moves a slot, and its keys, to another node.
+func (fc *fakeCluster) move(slot int, to *fakeClusterNode) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	from := fc.owners[slot]
+	for key, value := range from.data {
+		if redis.HashSlot(key) == slot {
+			to.data[key] = value
+			delete(from.data, key)
+		}
+	}
+	fc.owners[slot] = to
+}
+
+// migrate starts migrating a slot to another node.
+func (fc *fakeCluster) migrate(slot int, to *fakeClusterNode) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.migrating[slot] = to
+}
+
+// serve returns the handler of the commands of a connection to node.
+func (fc *fakeCluster) serve(c *fakeConn, node *fakeClusterNode) func([]string) {
+	var asking, multi, aborted bool
+	var queued [][]string
+	return func(args []string) {
+		var reply interface{}
+		name := strings.ToUpper(args[0])
+		switch {
+		case name == "ASKING":
+			asking, reply = true, respStatus("OK")
+		case name == "MULTI":
+			multi, aborted, queued, reply = true, false, nil, respStatus("OK")
+		case name == "EXEC":
+			if aborted {
+				reply = respError("EXECABORT Transaction discarded because of previous errors.")
+			} else {
+				replies := make([]interface{}, len(queued))
+				for i, args := range queued {
+					replies[i] = fc.exec(node, args)
+				}
+				reply = replies
+			}
+			multi, queued = false, nil
+		case multi:
+			if redirect := fc.redirect(node, args, asking); redirect != "" {
+				aborted, reply = true, redirect
+			} else {
+				queued, reply = append(queued, args), respStatus("QUEUED")
+			}
+		default:
+			if redirect := fc.redirect(node, args, asking); redirect != "" {
+				reply = redirect
+			} else {
+				reply = fc.exec(node, args)
+			}
+		}
+		if name != "ASKING" {
+			asking = false
+		}
+		c.write(reply)
+	}
+}
+
+// redirect returns the error redirecting a command for a key node doesn't serve, or "".
+func (fc *fakeCluster) redirect(node *fakeClusterNode, args []string, asking bool) respError {
+	switch strings.ToUpper(args[0]) {
+	case "GET", "SET", "INCR", "DEL", "WATCH":
+	default:
+		return ""
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	slot := redis.HashSlot(args[1])
+	owner, importer := fc.owners[slot], fc.migrating[slot]
+	var redirect respError
+	switch {
+	case owner == node && importer != nil:
+		if _, ok := node.data[args[1]]; !ok {
+			redirect = respError(fmt.Sprintf("ASK %d %v", slot, importer.addr))
+		}
+	case owner != node && !(asking && importer == node):
+		redirect = respError(fmt.Sprintf("MOVED %d %v", slot, owner.addr))
+	}
+	if redirect != "" {
+		fc.redirects++
+	}
+	return redirect
+}
+
+func (fc *fakeCluster) exec(node *fakeClusterNode, args []string) interface{} {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return respStatus("PONG")
+	case "WATCH", "UNWATCH":
+		return respStatus("OK")
+	case "FLUSHDB":
+		node.data = map[string]string{}
+		return respStatus("OK")
+	case "GET":
+		if v, ok := node.data[args[1]]; ok {
+			return v
+		}
+		return nil
+	case "SET":
+		node.data[args[1]] = args[2]
+		return respStatus("OK")
+	case "INCR":
+		n, _ := strconv.Atoi(node.data[args[1]])
+		node.data[args[1]] = strconv.Itoa(n + 1)
+		return n + 1
+	case "DEL":
+		_, ok := node.data[args[1]]
+		delete(node.data, args[1])
+		if ok {
+			return 1
+		}
+		return 0
+	case "CLUSTER":
+		switch strings.ToUpper(args[1]) {
+		case "SHARDS":
+			if !fc.slotsOnly {
+				return fc.shards()
+			}
+		case "SLOTS":
+			var ranges []interface{}
+			for _, r := range fc.ranges() {
+				host, port, _ := net.SplitHostPort(r.owner.addr)
+				ranges = append(ranges, []interface{}{r.start, r.end, []interface{}{fc.announced(host), mustAtoi(port), r.owner.addr}})
+			}
+			return ranges
+		}
+		return respError(fmt.Sprintf("ERR unknown subcommand '%v'", args[1]))
+	}
+	return respError(fmt.Sprintf("ERR unknown command '%v'", args[0]))
+}
+
+type fakeClusterRange struct {
+	start, end int
+	owner      *fakeClusterNode
+}
+
+// ranges returns the ranges of slots served by the same node, in order.
+func (fc *fakeCluster) ranges() []fakeClusterRange {
+	var ranges []fakeClusterRange
+	for start := 0; start < redis.ClusterSlots; {
+		owner := fc.owners[start]
+		end := start
+		for end+1 < redis.ClusterSlots && fc.owners[end+1] == owner {
+			end++
+		}
+		ranges = append(ranges, fakeClusterRange{start, end, owner})
+		start = end + 1
+	}
+	return ranges
+}
+
+// shards returns the reply to CLUSTER SHARDS: a shard for each node, with a replica which is down.
+func (fc *fakeCluster) shards() []interface{} {
+	var shards []interface{}
+	for _, node := range fc.nodes {
+		var slots []interface{}
+		for _, r := range fc.ranges() {
+			if r.owner == node {
+				slots = append(slots, r.start, r.end)
+			}
+		}
+		host, port, _ := net.SplitHostPort(node.addr)
+		shards = append(shards, []interface{}{
+			"slots", slots,
+			"nodes", []interface{}{
+				[]interface{}{"id", node.addr, "port", 1, "ip", host, "endpoint", fc.announced(host), "role", "replica", "health", "failed"},
+				[]interface{}{"id", node.addr, "port", mustAtoi(port), "ip", host, "endpoint", fc.announced(host), "role", "master", "health", "online"},
+			},
+		})
+	}
+	return shards
+}
+
+// announced returns the endpoint a node on host announces itself by.
+func (fc *fakeCluster) announced(host string) string {
+	if fc.endpoint != "" {
+		return fc.endpoint
+	}
+	return host
+}
+
+func mustAtoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -1,12 +1,18 @@
 package redis
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"net"
 	netURL "net/url"
 	"strconv"
+	"time"
 
 	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis/redisurl"
 )
 
 type Connection interface {
@@ -22,6 +28,14 @@ type Connection interface {
 
 	Flush() error
 	Receive() (interface{}, error)
+
+	// WithContext returns a shallow copy of the connection whose commands, pipelines and
+	// transactions honor the deadline and cancellation of ctx while waiting on the socket.
+	// The copy shares the underlying connection, so only one of them should be released.
+	WithContext(ctx context.Context) Connection
+
+	// Context returns the context the connection was bound to with WithContext, or nil.
+	Context() context.Context
 }
 
 type UnpooledConnection interface {
@@ -30,21 +44,33 @@ type UnpooledConnection interface {
 	Close()
 }
 
+// NewConnection dials a connection to the server at url, configured by the URL alone: the
+// timeouts, keepalive, TLS and hooks of a Config aren't applied. See NewConnectionWithConfig.
 func NewConnection(url *netURL.URL) (UnpooledConnection, error) {
+	return newConnection(url, redisurl.Options{}, nil)
+}
 
-	var password string
-	if url.User != nil {
-		password, _ = url.User.Password()
-	}
+// NewConnectionWithConfig dials a connection to the server at url, configured as the connections
+// of a pool created with config are. The options of a pool, such as its size, don't apply.
+func NewConnectionWithConfig(url *netURL.URL, config Config) (UnpooledConnection, error) {
+	return newConnection(url, config.urlOptions(), config.hooks(func() *netURL.URL { return url }))
+}
+
+func newConnection(url *netURL.URL, options redisurl.Options, hooks []Hook) (UnpooledConnection, error) {
 
-	c, err := generateConnection(url)
+	username, password := credentials(url)
+
+	c, err := generateConnection(url, options)
 	if err != nil {
 		return nil, err
 	}
 
 	conn := &connection{
+		username: username,
 		password: password,
 		c:        c,
+		hooks:    hooks,
+		logger:   options.Logger,
 	}
 
 	return conn, nil
@@ -54,7 +80,15 @@ func NewConnection(url *netURL.URL) (UnpooledConnection, error) {
 type connection struct {
 	c        redigo.Conn
 	pool     Pool
+	username string
 	password string
+	ctx      context.Context
+	// The hooks and logger of the pool the connection was taken from.
+	hooks  []Hook
+	logger *slog.Logger
+	// The pool whose RetryPolicy the connection's commands are retried by, if it was taken for one
+	// of the pool's own methods.
+	retryPool *pool
 }
 
 // PooledConnection
@@ -76,55 +110,279 @@ func (s *connection) Close() {
 // Connection
 
 func (s *connection) Send(command string, args ...interface{}) error {
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+	}
 	return s.c.Send(command, args...)
 }
 
 func (s *connection) Do(command string, args ...interface{}) (interface{}, error) {
-	val, err := s.c.Do(command, args...)
-	if err == redigoErrNoAuth && s.password != "" {
-		_, err = s.c.Do("AUTH", s.password)
+	if s.retryPool != nil {
+		return s.doRetrying(command, args...)
+	}
+	return s.doHooked(command, args...)
+}
+
+// doHooked runs a single command through the connection's hooks.
+func (s *connection) doHooked(command string, args ...interface{}) (interface{}, error) {
+	if len(s.hooks) == 0 {
+		return s.call(command, args...)
+	}
+
+	cmd := &Cmd{Name: command, Args: args}
+	err := s.handle(&Call{Kind: CallCommand, Cmds: []*Cmd{cmd}})
+	return cmd.Reply, err
+}
+
+// call runs a single command, authenticating again first if the server asks it to. Its error is an
+// *Error.
+func (s *connection) call(command string, args ...interface{}) (interface{}, error) {
+	val, err := s.do(command, args...)
+	if errorKind(err) == ErrNoAuth && s.password != "" {
+		logger(s.logger).Info("redis: server asks the connection to authenticate again", "command", commandName(command, args))
+		err = redisurl.Auth(s.do, s.username, s.password)
 		if err != nil {
-			return nil, err
+			return nil, commandError(command, args, err)
 		}
-		val, err = s.c.Do(command, args...)
+		val, err = s.do(command, args...)
 	}
-	return val, err
+	return val, commandError(command, args, err)
 }
 
 func (s *connection) Transaction(f func(Transaction)) ([]interface{}, error) {
-	if err := s.Multi(); err != nil {
+	t := &sendOnlyConnection{}
+	f(t)
+
+	err := s.handle(&Call{Kind: CallTransaction, Cmds: t.queued()})
+	t.resolve(err)
+	if err != nil {
 		return nil, err
 	}
 
-	f(asTransaction(s))
-
-	return s.Exec()
+	// Error replies are returned in place of the replies of the commands that failed.
+	replies := make([]interface{}, len(t.queued()))
+	for i, cmd := range t.queued() {
+		if cmd.Err != nil {
+			replies[i] = cmd.Err
+		} else {
+			replies[i] = cmd.Reply
+		}
+	}
+	return replies, nil
 }
 
 func (s *connection) Pipelined(f func(Pipeline)) ([]interface{}, error) {
-	p := asPipeline(s)
+	p := &sendOnlyConnection{evalSHA: true}
 
 	f(p)
 
-	if err := s.Flush(); err != nil {
+	err := s.handle(&Call{Kind: CallPipeline, Cmds: p.queued()})
+	p.resolve(err)
+	if err != nil || len(p.queued()) == 0 {
 		return nil, err
 	}
 
-	return p.receiveAll()
+	replies := make([]interface{}, len(p.queued()))
+	for i, cmd := range p.queued() {
+		replies[i] = cmd.Reply
+	}
+	return replies, nil
 }
 
 func (s *connection) PipelinedDiscarding(f func(Pipeline)) error {
-	f(asPipeline(s))
+	p := &sendOnlyConnection{}
+
+	f(p)
+
+	return s.handle(&Call{Kind: CallPipeline, Cmds: p.queued(), Discard: true})
+}
+
+// sendPipeline sends the commands of a pipeline, and receives their replies unless they're
+// discarded. It returns the first error of any command.
+func (s *connection) sendPipeline(call *Call) error {
+	var sent []*Cmd
+	for _, cmd := range call.Cmds {
+		if cmd.Err = s.c.Send(cmd.Name, cmd.Args...); cmd.Err == nil {
+			sent = append(sent, cmd)
+		}
+	}
+
+	if err := s.Flush(); err != nil {
+		for _, cmd := range sent {
+			cmd.Err = err
+		}
+	} else if !call.Discard {
+		s.receivePipeline(sent)
+		s.evalNoScript(sent)
+	}
+
+	var first error
+	for _, cmd := range call.Cmds {
+		cmd.Err = commandError(cmd.Name, cmd.Args, cmd.Err)
+		if first == nil {
+			first = cmd.Err
+		}
+	}
+	return first
+}
 
-	return s.Flush()
+// receivePipeline receives the replies of the commands of a pipeline which were sent.
+func (s *connection) receivePipeline(sent []*Cmd) {
+	for i, cmd := range sent {
+		cmd.Reply, cmd.Err = receive(s.ctx, s.c)
+		// An error reply fails only its own command, but any other error leaves the connection
+		// unusable, so the remaining replies will never be received.
+		if _, ok := cmd.Err.(redigo.Error); cmd.Err != nil && !ok {
+			for _, rest := range sent[i+1:] {
+				rest.Err = cmd.Err
+			}
+			return
+		}
+	}
+}
+
+// evalNoScript runs the scripts of a pipeline's EVALSHAs which the server didn't have cached again
+// with EVAL, in a pipeline of their own, replacing their replies.
+func (s *connection) evalNoScript(sent []*Cmd) {
+	var missing []*Cmd
+	for _, cmd := range sent {
+		if cmd.script != nil && errorKind(cmd.Err) == ErrNoScript {
+			missing = append(missing, cmd)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	var resent []*Cmd
+	for _, cmd := range missing {
+		args := append(redigo.Args{cmd.script.Source()}, cmd.Args[1:]...)
+		if cmd.Err = s.c.Send("EVAL", args...); cmd.Err == nil {
+			resent = append(resent, cmd)
+		}
+	}
+	if err := s.Flush(); err != nil {
+		for _, cmd := range resent {
+			cmd.Err = err
+		}
+		return
+	}
+	s.receivePipeline(resent)
+}
+
+// sendTransaction sends the commands of a transaction between MULTI and EXEC, and sets their
+// replies to those EXEC returns. It returns the error of EXEC.
+func (s *connection) sendTransaction(call *Call) error {
+	if err := s.Multi(); err != nil {
+		for _, cmd := range call.Cmds {
+			cmd.Err = err
+		}
+		return err
+	}
+
+	var sent []*Cmd
+	for _, cmd := range call.Cmds {
+		if cmd.Err = commandError(cmd.Name, cmd.Args, s.c.Send(cmd.Name, cmd.Args...)); cmd.Err == nil {
+			sent = append(sent, cmd)
+		}
+	}
+
+	replies, err := execReplies(s.call("EXEC"))
+	for i, cmd := range sent {
+		switch {
+		case err != nil:
+			cmd.Err = err
+		case i >= len(replies):
+			cmd.Err = errors.New("redis: EXEC returned fewer replies than commands were queued")
+		default:
+			if replyErr, ok := replies[i].(redigo.Error); ok {
+				cmd.Err = commandError(cmd.Name, cmd.Args, replyErr)
+			} else {
+				cmd.Reply = replies[i]
+			}
+		}
+	}
+	return err
 }
 
 func (s *connection) Flush() error {
+	if s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+	}
 	return s.c.Flush()
 }
 
 func (s *connection) Receive() (interface{}, error) {
-	return s.c.Receive()
+	return receive(s.ctx, s.c)
+}
+
+func (s *connection) WithContext(ctx context.Context) Connection {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+func (s *connection) Context() context.Context {
+	return s.ctx
+}
+
+// do runs a single command on the underlying connection, bounded by the connection's context
+// when it has one.
+func (s *connection) do(command string, args ...interface{}) (interface{}, error) {
+	return do(s.ctx, s.c, command, args...)
+}
+
+// do runs a command on c, bounded by ctx when it is not nil.
+func do(ctx context.Context, c redigo.Conn, command string, args ...interface{}) (interface{}, error) {
+	if ctx == nil {
+		return c.Do(command, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cwc, ok := c.(redigo.ConnWithContext); ok {
+		val, err := cwc.DoContext(ctx, command, args...)
+		return val, contextError(ctx, err)
+	}
+	return c.Do(command, args...)
+}
+
+// receive reads a single reply from c, bounded by ctx when it is not nil.
+func receive(ctx context.Context, c redigo.Conn) (interface{}, error) {
+	if ctx == nil {
+		return c.Receive()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cwc, ok := c.(redigo.ConnWithContext); ok {
+		val, err := cwc.ReceiveContext(ctx)
+		return val, contextError(ctx, err)
+	}
+	return c.Receive()
+}
+
+// redigo enforces context deadlines with socket read deadlines, so a command that runs out of
+// time fails with a network timeout. This reports such timeouts as the context's error instead.
+func contextError(ctx context.Context, err error) error {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
 }
 
 // KeyCommands
@@ -185,7 +443,7 @@ func (s *connection) HGet(key, field string) (string, error) {
 }
 
 func (s *connection) HGetAll(key string) (map[string]string, error) {
-	return stringMap(redigo.Strings(s.Do("HGETALL", key)))
+	return stringMapReply(s.Do("HGETALL", key))
 }
 
 func (s *connection) HIncrBy(key, field string, value int64) (int64, error) {
@@ -200,8 +458,7 @@ func (s *connection) HMGet(key string, fields ...string) (map[string]string, err
 	if len(fields) == 0 {
 		return nil, errors.New("redis: at least once field is required")
 	}
-	vals, err := redigo.Strings(s.Do("HMGET", redigo.Args{key}.AddFlat(fields)...))
-	return spliceMap(fields, vals, err)
+	return splicedMapReply(fields)(s.Do("HMGET", redigo.Args{key}.AddFlat(fields)...))
 }
 
 func (s *connection) HMSet(key string, args map[string]interface{}) error {
@@ -209,14 +466,8 @@ func (s *connection) HMSet(key string, args map[string]interface{}) error {
 		return errors.New("redis: at least one key/value pair is required")
 	}
 
-	result, err := redigo.String(s.Do("HMSET", redigo.Args{key}.AddFlat(mapToSlice(args))...))
-	if err != nil || err == ErrNil {
-		return err
-	}
-	if result != "OK" {
-		return fmt.Errorf("result is %v rather than OK", result)
-	}
-	return nil
+	_, err := ok(s.Do("HMSET", redigo.Args{key}.AddFlat(mapToSlice(args))...))
+	return err
 }
 
 func (s *connection) HDel(key string, field string) (bool, error) {
@@ -335,6 +586,18 @@ func zValuesWithScores(reply interface{}, err error) ([]Z, error) {
 		return nil, err
 	}
 
+	// In RESP3, each member and its score are an array of their own.
+	if len(values) > 0 {
+		if _, nested := values[0].([]interface{}); nested {
+			pairs := values
+			values = make([]interface{}, 0, 2*len(pairs))
+			for _, pair := range pairs {
+				pair, _ := pair.([]interface{})
+				values = append(values, pair...)
+			}
+		}
+	}
+
 	if (len(values)/2)*2 != len(values) {
 		return nil, errors.New("jimmy: sorted set values withscores are odd-numbered")
 	}
@@ -447,14 +710,153 @@ func (s *connection) PFCount(key string) (int, error) {
 }
 
 func (s *connection) PFMerge(mergedKey string, keysToMerge ...string) (bool, error) {
-	result, err := redigo.String(s.Do("PFMERGE", redigo.Args{mergedKey}.AddFlat(keysToMerge)...))
-	if err != nil || err == ErrNil {
-		return false, err
+	return okBool(s.Do("PFMERGE", redigo.Args{mergedKey}.AddFlat(keysToMerge)...))
+}
+
+// PubSubCommands
+
+func (s *connection) Publish(channel, message string) (int, error) {
+	return redigo.Int(s.Do("PUBLISH", channel, message))
+}
+
+// StreamCommands
+
+func (s *connection) XAdd(key, id string, fields map[string]interface{}) (string, error) {
+	if len(fields) == 0 {
+		return "", errors.New("redis: at least one field/value pair is required")
+	}
+	return redigo.String(s.Do("XADD", redigo.Args{key, id}.AddFlat(mapToSlice(fields))...))
+}
+
+func (s *connection) XLen(key string) (int, error) {
+	return redigo.Int(s.Do("XLEN", key))
+}
+
+func (s *connection) XDel(key string, ids ...string) (int, error) {
+	return redigo.Int(s.Do("XDEL", redigo.Args{key}.AddFlat(ids)...))
+}
+
+func (s *connection) XRange(key, start, end string, count int) ([]StreamEntry, error) {
+	if count < 1 {
+		return streamEntries(s.Do("XRANGE", key, start, end))
+	}
+	return streamEntries(s.Do("XRANGE", key, start, end, "COUNT", count))
+}
+
+func (s *connection) XTrim(key string, maxLen int, approximate bool) (int, error) {
+	if approximate {
+		return redigo.Int(s.Do("XTRIM", key, "MAXLEN", "~", maxLen))
+	}
+	return redigo.Int(s.Do("XTRIM", key, "MAXLEN", maxLen))
+}
+
+func (s *connection) XRead(streams map[string]string, count int, block time.Duration) ([]Stream, error) {
+	return streamsReply(s.Do("XREAD", streamReadArgs(streams, count, block)...))
+}
+
+func (s *connection) XReadGroup(group, consumer string, streams map[string]string, count int, block time.Duration) ([]Stream, error) {
+	args := redigo.Args{"GROUP", group, consumer}.Add(streamReadArgs(streams, count, block)...)
+	return streamsReply(s.Do("XREADGROUP", args...))
+}
+
+func (s *connection) XGroupCreate(key, group, start string, mkStream bool) error {
+	args := redigo.Args{"CREATE", key, group, start}
+	if mkStream {
+		args = args.Add("MKSTREAM")
 	}
-	if result != "OK" {
-		return false, fmt.Errorf("result is %v rather than OK", result)
+	_, err := s.Do("XGROUP", args...)
+	return err
+}
+
+func (s *connection) XGroupDestroy(key, group string) (bool, error) {
+	return redigo.Bool(s.Do("XGROUP", "DESTROY", key, group))
+}
+
+func (s *connection) XAck(key, group string, ids ...string) (int, error) {
+	return redigo.Int(s.Do("XACK", redigo.Args{key, group}.AddFlat(ids)...))
+}
+
+func (s *connection) XPending(key, group string) (PendingSummary, error) {
+	return pendingSummary(s.Do("XPENDING", key, group))
+}
+
+func (s *connection) XPendingRange(key, group, start, end string, count int) ([]PendingEntry, error) {
+	if count < 1 {
+		// XPENDING's extended form requires a count.
+		count = math.MaxInt32
 	}
-	return true, nil
+	return pendingEntries(s.Do("XPENDING", key, group, start, end, count))
+}
+
+func (s *connection) XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	args := redigo.Args{key, group, consumer, int64(minIdle / time.Millisecond)}.AddFlat(ids)
+	return streamEntries(s.Do("XCLAIM", args...))
+}
+
+func (s *connection) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int) (string, []StreamEntry, error) {
+	args := redigo.Args{key, group, consumer, int64(minIdle / time.Millisecond), start}
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+	return autoClaimed(s.Do("XAUTOCLAIM", args...))
+}
+
+func (s *connection) XInfoStream(key string) (StreamInfo, error) {
+	return streamInfo(s.Do("XINFO", "STREAM", key))
+}
+
+func (s *connection) XInfoGroups(key string) ([]StreamGroupInfo, error) {
+	return streamGroupInfos(s.Do("XINFO", "GROUPS", key))
+}
+
+func (s *connection) XInfoConsumers(key, group string) ([]StreamConsumerInfo, error) {
+	return streamConsumerInfos(s.Do("XINFO", "CONSUMERS", key, group))
+}
+
+// ScriptingCommands
+
+func (s *connection) Eval(script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := s.Do("EVALSHA", script.args(true, keys, args)...)
+	if isNoScript(err) {
+		reply, err = s.Do("EVAL", script.args(false, keys, args)...)
+	}
+	return reply, err
+}
+
+func (s *connection) ScriptLoad(scripts ...*Script) error {
+	for _, script := range scripts {
+		hash, err := redigo.String(s.Do("SCRIPT", "LOAD", script.Source()))
+		if err != nil {
+			return err
+		}
+		if hash != script.Hash() {
+			return fmt.Errorf("redis: script loaded as %v rather than %v", hash, script.Hash())
+		}
+	}
+	return nil
+}
+
+func (s *connection) ScriptExists(scripts ...*Script) ([]bool, error) {
+	args := redigo.Args{"EXISTS"}
+	for _, script := range scripts {
+		args = args.Add(script.Hash())
+	}
+
+	exists, err := redigo.Ints(s.Do("SCRIPT", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]bool, len(exists))
+	for i, e := range exists {
+		result[i] = e == 1
+	}
+	return result, nil
+}
+
+func (s *connection) ScriptFlush() error {
+	_, err := s.Do("SCRIPT", "FLUSH")
+	return err
 }
 
 func (s *connection) Scan(cursor int, match string, count int) (nextCursor int, matches []string, err error) {
@@ -572,5 +974,32 @@ func (s *connection) Multi() error {
 }
 
 func (s *connection) Exec() ([]interface{}, error) {
-	return redigo.Values(s.Do("EXEC"))
+	return execReplies(s.Do("EXEC"))
+}
+
+// execReplies converts the reply to EXEC into the replies of the transaction's commands, or
+// ErrTxAborted if a watched key was modified.
+func execReplies(reply interface{}, err error) ([]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrTxAborted
+	}
+	return redigo.Values(reply, nil)
+}
+
+func (s *connection) Discard() error {
+	_, err := s.Do("DISCARD")
+	return err
+}
+
+func (s *connection) Watch(keys ...string) error {
+	_, err := s.Do("WATCH", redigo.Args{}.AddFlat(keys)...)
+	return err
+}
+
+func (s *connection) Unwatch() error {
+	_, err := s.Do("UNWATCH")
+	return err
 }
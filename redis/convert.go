@@ -1,6 +1,11 @@
 package redis
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
 
 // Some redis functions, such as HGETALL, return an even-numbered list of strings that represent
 // key-value pairs. This converts such a list into a map. It passes through an error value, similar
@@ -73,3 +78,89 @@ func mapToSlice(m map[string]interface{}) []interface{} {
 
 	return result
 }
+
+// The following convert a raw reply, and pass through an error value, with the same signature as
+// redigo's convenience conversion functions. They are shared by Connection methods and the
+// Futures returned by Pipeline and Transaction methods, so both decode replies identically.
+
+// stringMapReply converts a reply such as HGETALL's into a map, as stringMap does.
+func stringMapReply(reply interface{}, err error) (map[string]string, error) {
+	return stringMap(redigo.Strings(reply, err))
+}
+
+// splicedMapReply returns a converter that splices a reply such as HMGET's with the supplied
+// field names, as spliceMap does.
+func splicedMapReply(keys []string) func(interface{}, error) (map[string]string, error) {
+	return func(reply interface{}, err error) (map[string]string, error) {
+		vals, err := redigo.Strings(reply, err)
+		return spliceMap(keys, vals, err)
+	}
+}
+
+// ok converts a status reply, returning an error unless the status is OK.
+func ok(reply interface{}, err error) (string, error) {
+	result, err := redigo.String(reply, err)
+	if err != nil {
+		return "", err
+	}
+	if result != "OK" {
+		return "", fmt.Errorf("result is %v rather than OK", result)
+	}
+	return result, nil
+}
+
+// okBool converts a status reply to true if the status is OK.
+func okBool(reply interface{}, err error) (bool, error) {
+	_, err = ok(reply, err)
+	return err == nil, err
+}
+
+// Helpers to convert the raw replies of Do and Eval, with the same signature as redigo's
+// convenience conversion functions.
+
+func String(reply interface{}, err error) (string, error) {
+	return redigo.String(reply, err)
+}
+
+func Strings(reply interface{}, err error) ([]string, error) {
+	return redigo.Strings(reply, err)
+}
+
+func Int(reply interface{}, err error) (int, error) {
+	return redigo.Int(reply, err)
+}
+
+func Ints(reply interface{}, err error) ([]int, error) {
+	return redigo.Ints(reply, err)
+}
+
+func Int64(reply interface{}, err error) (int64, error) {
+	return redigo.Int64(reply, err)
+}
+
+func Float64(reply interface{}, err error) (float64, error) {
+	return redigo.Float64(reply, err)
+}
+
+func Bool(reply interface{}, err error) (bool, error) {
+	return redigo.Bool(reply, err)
+}
+
+func Values(reply interface{}, err error) ([]interface{}, error) {
+	return redigo.Values(reply, err)
+}
+
+// StringMap converts a reply of alternating keys and values into a map.
+func StringMap(reply interface{}, err error) (map[string]string, error) {
+	return stringMapReply(reply, err)
+}
+
+// ZValues converts a reply of alternating members and scores into a slice of Z.
+func ZValues(reply interface{}, err error) ([]Z, error) {
+	return zValuesWithScores(reply, err)
+}
+
+// rawReply passes a reply through unconverted.
+func rawReply(reply interface{}, err error) (interface{}, error) {
+	return reply, err
+}
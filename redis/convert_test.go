@@ -92,3 +92,31 @@ func TestSpliceMap(t *testing.T) {
 		}
 	})
 }
+
+func TestOK(t *testing.T) {
+	t.Run("OK status returns no error", func(t *testing.T) {
+		result, err := ok("OK", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result != "OK" {
+			t.Errorf("got %q, want %q", result, "OK")
+		}
+	})
+
+	t.Run("other status returns error", func(t *testing.T) {
+		if _, err := ok("QUEUED", nil); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("non-nil error returns that error", func(t *testing.T) {
+		inputErr := errors.New("The cheese is old and moldy, where is the bathroom?")
+		if _, err := ok(nil, inputErr); err != inputErr {
+			t.Errorf("got %v, want %v", err, inputErr)
+		}
+		if b, err := okBool(nil, inputErr); b || err != inputErr {
+			t.Errorf("got %v, %v, want false, %v", b, err, inputErr)
+		}
+	})
+}
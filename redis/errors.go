@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// The kinds of errors commands fail with, which can be told apart with errors.Is, e.g.
+// errors.Is(err, ErrWrongType). Each is an error replied by the server, named after the code it
+// starts with, but for ErrConnection.
+var (
+	// ErrWrongType (WRONGTYPE) is a command run against a key holding another type of value.
+	ErrWrongType = errors.New("redis: key holds the wrong type of value")
+	// ErrNoScript (NOSCRIPT) is EVALSHA run with a script missing from the script cache.
+	ErrNoScript = errors.New("redis: script not in the script cache")
+	// ErrMoved (MOVED) and ErrAsk (ASK) are cluster nodes redirecting a command to the node
+	// serving its key. See RedirectError.
+	ErrMoved = errors.New("redis: slot moved to another node")
+	ErrAsk   = errors.New("redis: slot migrating to another node")
+	// ErrReadOnly (READONLY) is a write sent to a replica, such as a master demoted by a failover.
+	ErrReadOnly = errors.New("redis: server is a read-only replica")
+	// ErrLoading (LOADING) is a server which is still loading its data, having just started.
+	ErrLoading = errors.New("redis: server is loading its data")
+	// ErrBusy (BUSY) is a server busy running a script or function.
+	ErrBusy = errors.New("redis: server is busy running a script")
+	// ErrExecAbort (EXECABORT) is EXEC discarding a transaction, as one of its commands failed to
+	// be queued.
+	ErrExecAbort = errors.New("redis: transaction discarded because of previous errors")
+	// ErrOOM (OOM) is a write refused as the server is out of memory.
+	ErrOOM = errors.New("redis: server is out of memory")
+	// ErrNoAuth (NOAUTH) is a command sent before authenticating, to a server which requires it,
+	// and ErrWrongPass (WRONGPASS) authenticating with the wrong username or password.
+	ErrNoAuth    = errors.New("redis: authentication required")
+	ErrWrongPass = errors.New("redis: invalid username or password")
+	// ErrConnection is the connection failing, e.g. as the server closed it or can't be reached.
+	ErrConnection = errors.New("redis: connection failed")
+
+	errorCodes = map[string]error{
+		"WRONGTYPE": ErrWrongType,
+		"NOSCRIPT":  ErrNoScript,
+		"MOVED":     ErrMoved,
+		"ASK":       ErrAsk,
+		"READONLY":  ErrReadOnly,
+		"LOADING":   ErrLoading,
+		"BUSY":      ErrBusy,
+		"EXECABORT": ErrExecAbort,
+		"OOM":       ErrOOM,
+		"NOAUTH":    ErrNoAuth,
+		"WRONGPASS": ErrWrongPass,
+	}
+)
+
+// Error is the error of a command, such as an error reply, or the connection failing. Its message
+// is that of Err.
+type Error struct {
+	// Command is the name of the command, in upper case, e.g. "GET" or "SCRIPT LOAD". It's empty
+	// if a connection couldn't be had to send it on.
+	Command string
+	// Key is the first key of the command, if it has any.
+	Key string
+	// Err is the error: a redigo.Error for an error reply.
+	Err error
+}
+
+// commandError returns err as the error of a command, unless it's nil or already is one.
+func commandError(command string, args []interface{}, err error) error {
+	var cmdErr *Error
+	if err == nil || errors.As(err, &cmdErr) {
+		return err
+	}
+
+	e := &Error{Command: commandName(command, args), Err: err}
+	if keys := commandKeys(command, args); len(keys) > 0 {
+		e.Key = keys[0]
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the kind target, such as ErrWrongType.
+func (e *Error) Is(target error) bool {
+	return target != nil && errorKind(e.Err) == target
+}
+
+// As sets target to the redirection of the error, if target is a **RedirectError and the error is
+// a MOVED or ASK reply.
+func (e *Error) As(target interface{}) bool {
+	if redirect, ok := target.(**RedirectError); ok {
+		*redirect, ok = redirection(e.Err)
+		return ok
+	}
+	return false
+}
+
+// errorKind returns which of the kinds of errors err is, e.g. ErrWrongType, or nil if it's none.
+func errorKind(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+
+	var redisErr redigo.Error
+	if errors.As(err, &redisErr) {
+		code, _, _ := strings.Cut(string(redisErr), " ")
+		return errorCodes[code]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrConnection
+	}
+	return nil
+}
+
+// RedirectError is a cluster node redirecting a command to the node serving the slot of its key:
+// for good if the slot has moved, or for the command alone if it's being migrated (ASK). It can be
+// had from an error with errors.As, and is ErrMoved or ErrAsk.
+type RedirectError struct {
+	Ask  bool
+	Slot int
+	Addr string
+}
+
+func (e *RedirectError) Error() string {
+	if e.Ask {
+		return fmt.Sprintf("ASK %d %s", e.Slot, e.Addr)
+	}
+	return fmt.Sprintf("MOVED %d %s", e.Slot, e.Addr)
+}
+
+func (e *RedirectError) Is(target error) bool {
+	return target == ErrAsk && e.Ask || target == ErrMoved && !e.Ask
+}
+
+// redirection parses a MOVED or ASK error reply.
+func redirection(err error) (*RedirectError, bool) {
+	var redisErr redigo.Error
+	if !errors.As(err, &redisErr) {
+		return nil, false
+	}
+
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return nil, false
+	}
+	slot, convErr := strconv.Atoi(fields[1])
+	if convErr != nil {
+		return nil, false
+	}
+	return &RedirectError{Ask: fields[0] == "ASK", Slot: slot, Addr: fields[2]}, true
+}
@@ -0,0 +1,165 @@
+package redis_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestErrors(t *testing.T) {
+	p, err := redis.NewPool("redis://localhost:6379/10", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	key := "_tests:jimmy:redis:errors"
+	defer p.Del(key)
+
+	// newReplyingPool returns a pool of a server which replies reply to every command.
+	newReplyingPool := func(t *testing.T, reply string) redis.Pool {
+		s, err := redistest.NewServer(redistest.ServerOptions{})
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		t.Cleanup(s.Close)
+		s.Inject(redistest.Failure{Error: reply})
+
+		p, err := redis.NewPool(s.URL(), redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	t.Run("carries the command and its first key", func(t *testing.T) {
+		p.Set(key, "value")
+		_, err := p.LPush(key, "value")
+
+		var cmdErr *redis.Error
+		if !errors.As(err, &cmdErr) || cmdErr.Command != "LPUSH" || cmdErr.Key != key {
+			t.Fatalf("expected an error of LPUSH %s but got %#v", key, err)
+		}
+		if !errors.Is(err, redis.ErrWrongType) || errors.Is(err, redis.ErrNoScript) {
+			t.Errorf("expected ErrWrongType alone but got %v", err)
+		}
+		// The error reply is still there to be had, as it's always been.
+		var redisErr redigo.Error
+		if !errors.As(err, &redisErr) || !strings.HasPrefix(err.Error(), "WRONGTYPE ") {
+			t.Errorf("expected the WRONGTYPE reply but got %v", err)
+		}
+	})
+
+	t.Run("carries the command and key of each command of a pipeline", func(t *testing.T) {
+		var set *redis.StatusFuture
+		var push *redis.IntFuture
+		p.Pipelined(func(p redis.Pipeline) {
+			set = p.Set(key, "value")
+			push = p.LPush(key, "value")
+		})
+
+		var cmdErr *redis.Error
+		if set.Err() != nil || !errors.As(push.Err(), &cmdErr) || cmdErr.Command != "LPUSH" || cmdErr.Key != key {
+			t.Errorf("expected an error of LPUSH %s alone but got %v, %#v", key, set.Err(), push.Err())
+		}
+	})
+
+	t.Run("tells EXEC discarding a transaction", func(t *testing.T) {
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+
+		c.Multi()
+		c.Do("SET", key)
+		_, err = c.Exec()
+		var cmdErr *redis.Error
+		if !errors.Is(err, redis.ErrExecAbort) || !errors.As(err, &cmdErr) || cmdErr.Command != "EXEC" {
+			t.Errorf("expected ErrExecAbort of EXEC but got %#v", err)
+		}
+	})
+
+	t.Run("tells scripts missing from the cache", func(t *testing.T) {
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+
+		_, err = c.Do("EVALSHA", strings.Repeat("0", 40), 1, key)
+		var cmdErr *redis.Error
+		if !errors.Is(err, redis.ErrNoScript) || !errors.As(err, &cmdErr) || cmdErr.Command != "EVALSHA" || cmdErr.Key != key {
+			t.Errorf("expected ErrNoScript of EVALSHA %s but got %#v", key, err)
+		}
+	})
+
+	t.Run("tells the codes of error replies", func(t *testing.T) {
+		for _, test := range []struct {
+			reply string
+			want  error
+		}{
+			{"MOVED 866 127.0.0.1:7001", redis.ErrMoved},
+			{"ASK 866 127.0.0.1:7001", redis.ErrAsk},
+			{"READONLY You can't write against a read only replica.", redis.ErrReadOnly},
+			{"LOADING Redis is loading the dataset in memory", redis.ErrLoading},
+			{"BUSY Redis is busy running a script.", redis.ErrBusy},
+			{"OOM command not allowed when used memory > 'maxmemory'.", redis.ErrOOM},
+			{"NOAUTH Authentication required.", redis.ErrNoAuth},
+			{"WRONGPASS invalid username-password pair or user is disabled.", redis.ErrWrongPass},
+		} {
+			_, err := newReplyingPool(t, test.reply).Get("key")
+			var cmdErr *redis.Error
+			if !errors.Is(err, test.want) || !errors.As(err, &cmdErr) || cmdErr.Command != "GET" || cmdErr.Key != "key" {
+				t.Errorf("expected %v of GET key for %q but got %#v", test.want, test.reply, err)
+			}
+		}
+	})
+
+	t.Run("tells where commands are redirected to", func(t *testing.T) {
+		_, err := newReplyingPool(t, "ASK 866 127.0.0.1:7001").Get("key")
+		var redirect *redis.RedirectError
+		if !errors.As(err, &redirect) || !redirect.Ask || redirect.Slot != 866 || redirect.Addr != "127.0.0.1:7001" {
+			t.Errorf("expected to be asked to 127.0.0.1:7001 for slot 866 but got %+v", redirect)
+		}
+		if !errors.Is(redirect, redis.ErrAsk) || errors.Is(redirect, redis.ErrMoved) {
+			t.Errorf("expected the redirection to be ErrAsk alone")
+		}
+	})
+
+	t.Run("tells connections failing", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p, err := redis.NewPool("redis://"+proxy.addr+"/10", redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+		p.Exists(key)
+
+		proxy.drop()
+		_, err = p.Exists(key)
+		var cmdErr *redis.Error
+		if !errors.Is(err, redis.ErrConnection) || !errors.As(err, &cmdErr) || cmdErr.Command != "EXISTS" {
+			t.Errorf("expected ErrConnection of EXISTS but got %#v", err)
+		}
+
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		ln.Close()
+		p, err = redis.NewPool("redis://"+addr, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+
+		if _, err := p.Exists(key); !errors.Is(err, redis.ErrConnection) {
+			t.Errorf("expected ErrConnection dialing but got %#v", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package redis_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newFakeServer starts a server for a test's stand-in for Redis, which is closed once the test is
+// done, and returns its address. serve is called with each connection the server accepts, and
+// returns the handler the commands sent on it are passed to, in order.
+func newFakeServer(t *testing.T, serve func(c *fakeConn) func(args []string)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				handle := serve(&fakeConn{w: bufio.NewWriter(conn)})
+				for {
+					args, err := readRESPCommand(r)
+					if err != nil {
+						return
+					}
+					handle(args)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// fakeConn is a connection to a fake server, which replies are written to. It's written to
+// concurrently by servers pushing messages to subscribers.
+type fakeConn struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// write writes a reply to the connection, as RESP.
+func (c *fakeConn) write(reply interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeRESP(c.w, reply)
+	c.w.Flush()
+}
+
+type respStatus string
+type respError string
+
+// respRaw is written as is, e.g. a reply in RESP3.
+type respRaw string
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readRESPLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		l, err := readRESPLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:l])
+	}
+	return args, nil
+}
+
+func readRESPLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 || line[0] != prefix {
+		return 0, fmt.Errorf("unexpected line %q", line)
+	}
+	return strconv.Atoi(strings.TrimSpace(line[1:]))
+}
+
+func writeRESP(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case respStatus:
+		fmt.Fprintf(w, "+%v\r\n", v)
+	case respError:
+		fmt.Fprintf(w, "-%v\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%v\r\n", len(v), v)
+	case respRaw:
+		w.WriteString(string(v))
+	case nil:
+		fmt.Fprint(w, "$-1\r\n")
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeRESP(w, e)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"errors"
+)
+
+// ErrPending is returned by a Future that is read before the pipeline or transaction its
+// command was queued on has received its replies.
+var ErrPending = errors.New("redis: result is pending until the pipeline or transaction is executed")
+
+// Future is a handle to the result of a command queued on a Pipeline or Transaction. It is
+// resolved when Pipelined or Transaction receives the replies, and decodes the reply the same way
+// the corresponding Connection method does.
+//
+// Futures of pipelines run with PipelinedDiscarding are never resolved.
+type Future[T any] struct {
+	convert  func(interface{}, error) (T, error)
+	resolved bool
+	val      T
+	err      error
+}
+
+type (
+	ReplyFuture     = Future[interface{}]
+	StatusFuture    = Future[string]
+	StringFuture    = Future[string]
+	StringsFuture   = Future[[]string]
+	StringMapFuture = Future[map[string]string]
+	IntFuture       = Future[int]
+	Int64Future     = Future[int64]
+	FloatFuture     = Future[float64]
+	BoolFuture      = Future[bool]
+	ZFuture         = Future[[]Z]
+
+	StreamEntriesFuture = Future[[]StreamEntry]
+)
+
+func newFuture[T any](convert func(interface{}, error) (T, error)) *Future[T] {
+	return &Future[T]{convert: convert}
+}
+
+// Result returns the decoded reply and error of the command, or ErrPending if the command has
+// not been executed yet.
+func (f *Future[T]) Result() (T, error) {
+	if !f.resolved {
+		var zero T
+		return zero, ErrPending
+	}
+	return f.val, f.err
+}
+
+// Val returns the decoded reply of the command, ignoring its error.
+func (f *Future[T]) Val() T {
+	val, _ := f.Result()
+	return val
+}
+
+// Err returns the error of the command, or ErrPending if the command has not been executed yet.
+func (f *Future[T]) Err() error {
+	_, err := f.Result()
+	return err
+}
+
+func (f *Future[T]) resolve(reply interface{}, err error) {
+	f.val, f.err = f.convert(reply, err)
+	f.resolved = true
+}
+
+// Implemented by every Future, whatever its result type.
+type resolver interface {
+	resolve(reply interface{}, err error)
+}
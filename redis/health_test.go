@@ -0,0 +1,204 @@
+package redis_test
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestHealth(t *testing.T) {
+	newPool := func(url string, config redis.Config) redis.Pool {
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	t.Run("replaces idle connections which fail a health check", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.HealthCheckAfter = time.Millisecond
+		p := newPool("redis://"+proxy.addr+"/10", config)
+
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		proxy.drop()
+		time.Sleep(5 * time.Millisecond)
+
+		if _, err := p.Exists("key"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if n := proxy.dials(); n != 2 {
+			t.Errorf("expected 2 dials but got %d", n)
+		}
+	})
+
+	t.Run("fails with dropped connections without a health check", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p := newPool("redis://"+proxy.addr+"/10", redis.DefaultConfig)
+
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		proxy.drop()
+
+		if _, err := p.Exists("key"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("closes connections older than the max lifetime", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.MaxConnLifetime = 10 * time.Millisecond
+		p := newPool("redis://"+proxy.addr+"/10", config)
+
+		p.Exists("key")
+		p.Exists("key")
+		if n := proxy.dials(); n != 1 {
+			t.Errorf("expected 1 dial but got %d", n)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		p.Exists("key")
+		if n := proxy.dials(); n != 2 {
+			t.Errorf("expected 2 dials but got %d", n)
+		}
+	})
+
+	t.Run("dials the minimum number of idle connections", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.MinIdleConnections = 3
+		newPool("redis://"+proxy.addr+"/10", config)
+
+		if !eventually(func() bool { return proxy.dials() == 3 }) {
+			t.Errorf("expected 3 dials but got %d", proxy.dials())
+		}
+	})
+
+	t.Run("tops up idle connections taken from the pool", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.MinIdleConnections = 2
+		p := newPool("redis://"+proxy.addr+"/10", config)
+
+		if !eventually(func() bool { return proxy.dials() == 2 }) {
+			t.Fatalf("expected 2 dials but got %d", proxy.dials())
+		}
+
+		var conns []redis.PooledConnection
+		for i := 0; i < 2; i++ {
+			c, err := p.GetConnection()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			conns = append(conns, c)
+		}
+		if !eventually(func() bool { return proxy.dials() == 4 }) {
+			t.Errorf("expected 4 dials but got %d", proxy.dials())
+		}
+		for _, c := range conns {
+			c.Release()
+		}
+	})
+
+	t.Run("dials no more than the max idle connections", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.MaxIdleConnections = 2
+		config.MinIdleConnections = 5
+		newPool("redis://"+proxy.addr+"/10", config)
+
+		eventually(func() bool { return proxy.dials() == 2 })
+		time.Sleep(20 * time.Millisecond)
+		if n := proxy.dials(); n != 2 {
+			t.Errorf("expected 2 dials but got %d", n)
+		}
+	})
+}
+
+// eventually polls cond for up to a second, and returns whether it became true.
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+// droppingProxy relays connections to the Redis server at localhost:6379, counts them, and can
+// drop them all, as a server restarting would.
+type droppingProxy struct {
+	addr string
+
+	mu    sync.Mutex
+	conns []net.Conn
+	n     int
+}
+
+func newDroppingProxy(t *testing.T) *droppingProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	proxy := &droppingProxy{addr: ln.Addr().String()}
+	t.Cleanup(proxy.drop)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			proxy.mu.Lock()
+			proxy.conns = append(proxy.conns, conn)
+			proxy.n++
+			proxy.mu.Unlock()
+			go relayToRedis(conn)
+		}
+	}()
+	return proxy
+}
+
+// dials returns how many connections have been accepted.
+func (p *droppingProxy) dials() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.n
+}
+
+// drop closes every connection accepted so far.
+func (p *droppingProxy) drop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// relayToRedis relays conn to the Redis server at localhost:6379 until either closes.
+func relayToRedis(conn net.Conn) {
+	defer conn.Close()
+	upstream, err := net.Dial("tcp", "localhost:6379")
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+}
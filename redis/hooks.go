@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"context"
+	netURL "net/url"
+	"strings"
+	"time"
+)
+
+// Hook wraps the Handler which sends a connection's commands to the server, to add behavior such as
+// logging, metrics or tracing around them. A hook can look at the call before passing it to next,
+// and at the replies once next returns, or fail it without calling next at all.
+type Hook func(next Handler) Handler
+
+// Handler sends the commands of a call to the server, and sets their replies and errors. It returns
+// the error the call as a whole failed with, which is what Do, Pipelined or Transaction return.
+//
+// ctx is the context the connection is bound to, or context.Background(). Hooks can derive a context
+// from it for the next handler, e.g. to carry a span, but the commands are bounded by the
+// connection's own context, not the one passed down.
+type Handler func(ctx context.Context, call *Call) error
+
+// CallKind is how the commands of a Call are sent.
+type CallKind int
+
+const (
+	// A single command, sent with Do or any of the commands of Connection or Pool.
+	CallCommand CallKind = iota
+	// The commands queued on a Pipeline, by Pipelined or PipelinedDiscarding.
+	CallPipeline
+	// The commands queued on a Transaction, which are sent between MULTI and EXEC.
+	CallTransaction
+)
+
+// Call is a single command, or the commands of a pipeline or transaction, passed through the hooks
+// of a connection.
+type Call struct {
+	Kind CallKind
+	Cmds []*Cmd
+	// Whether the replies are discarded, for a pipeline run with PipelinedDiscarding.
+	Discard bool
+
+	// How long sending the commands and receiving their replies took, set by the innermost
+	// Handler.
+	Duration time.Duration
+}
+
+// Cmd is a command of a Call, with its reply and error once the call's Handler returns.
+type Cmd struct {
+	Name string
+	Args []interface{}
+
+	Reply interface{}
+	Err   error
+
+	// Whether the innermost Handler tried to send the command.
+	sent bool
+	// The script of an EVALSHA queued in a pipeline, run again with EVAL if the server doesn't
+	// have it cached.
+	script *Script
+}
+
+// hooks returns the hooks of a pool configured by config: its Hooks, then one tracing its calls if
+// it has a Tracer, then one logging those which are slow if it has a Logger and SlowThreshold. url
+// returns the URL of the pool's server at the time of a call.
+func (c Config) hooks(url func() *netURL.URL) []Hook {
+	redact := c.Redactor
+	if redact == nil {
+		redact = RedactValues
+	}
+
+	hooks := c.Hooks[:len(c.Hooks):len(c.Hooks)]
+	if c.Tracer != nil {
+		hooks = append(hooks, traceHook(c.Tracer, redact, url))
+	}
+	if c.Logger != nil && c.SlowThreshold > 0 {
+		hooks = append(hooks, slowLogHook(c.Logger, c.SlowThreshold, redact))
+	}
+	return hooks
+}
+
+// statement returns the commands of call, with their arguments redacted by redact, one per line.
+func statement(call *Call, redact Redactor) string {
+	lines := make([]string, len(call.Cmds))
+	for i, cmd := range call.Cmds {
+		lines[i] = strings.Join(append([]string{strings.ToUpper(cmd.Name)}, redact(cmd.Name, cmd.Args)...), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handle passes call through the hooks of the connection, to be sent by send.
+func (s *connection) handle(call *Call) error {
+	h := s.send
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		h = s.hooks[i](h)
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return h(ctx, call)
+}
+
+// send is the innermost Handler of a connection.
+func (s *connection) send(_ context.Context, call *Call) error {
+	start := time.Now()
+	defer func() { call.Duration = time.Since(start) }()
+
+	for _, cmd := range call.Cmds {
+		cmd.sent = true
+	}
+
+	switch call.Kind {
+	case CallPipeline:
+		return s.sendPipeline(call)
+	case CallTransaction:
+		return s.sendTransaction(call)
+	default:
+		cmd := call.Cmds[0]
+		cmd.Reply, cmd.Err = s.call(cmd.Name, cmd.Args...)
+		return cmd.Err
+	}
+}
@@ -0,0 +1,205 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var calls []redis.Call
+	var order []string
+
+	record := func(name string) redis.Hook {
+		return func(next redis.Handler) redis.Handler {
+			return func(ctx context.Context, call *redis.Call) error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+
+				err := next(ctx, call)
+
+				mu.Lock()
+				if name == "inner" {
+					calls = append(calls, *call)
+				}
+				mu.Unlock()
+				return err
+			}
+		}
+	}
+
+	// Refuses commands on keys under forbidden:, as a policy.
+	errForbidden := errors.New("forbidden")
+	forbid := func(next redis.Handler) redis.Handler {
+		return func(ctx context.Context, call *redis.Call) error {
+			for _, cmd := range call.Cmds {
+				if len(cmd.Args) > 0 && strings.HasPrefix(fmt.Sprint(cmd.Args[0]), "forbidden:") {
+					return errForbidden
+				}
+			}
+			return next(ctx, call)
+		}
+	}
+
+	config := redis.DefaultConfig
+	config.Hooks = []redis.Hook{record("outer"), forbid, record("inner")}
+	l := redistest.LeaseDB(t, "redis://localhost:6379", config)
+	p := l.Pool
+
+	key := "_tests:jimmy:redis:hooks"
+	defer p.Del(key)
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		calls, order = nil, nil
+	}
+	recorded := func() []redis.Call {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]redis.Call(nil), calls...)
+	}
+
+	t.Run("wraps single commands, first hook outermost", func(t *testing.T) {
+		p.Del(key)
+		reset()
+		if err := p.Set(key, "value"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := recorded()
+		if len(got) != 1 || got[0].Kind != redis.CallCommand || len(got[0].Cmds) != 1 {
+			t.Fatalf("expected a single command but got %+v", got)
+		}
+		cmd := got[0].Cmds[0]
+		if cmd.Name != "SET" || len(cmd.Args) != 2 || cmd.Args[0] != key || cmd.Reply != "OK" || cmd.Err != nil {
+			t.Errorf("expected SET %s value replying OK but got %+v", key, cmd)
+		}
+		if got[0].Duration <= 0 {
+			t.Errorf("expected a duration but got %v", got[0].Duration)
+		}
+		if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+			t.Errorf("expected outer then inner but got %v", order)
+		}
+	})
+
+	t.Run("sees error replies", func(t *testing.T) {
+		reset()
+		if _, err := p.LLen(key); err == nil {
+			t.Fatal("expected error")
+		}
+		if got := recorded(); len(got) != 1 || got[0].Cmds[0].Err == nil {
+			t.Errorf("expected the command's error but got %+v", got)
+		}
+	})
+
+	t.Run("wraps pipelines", func(t *testing.T) {
+		reset()
+		var get *redis.StringFuture
+		replies, err := p.Pipelined(func(p redis.Pipeline) {
+			p.Set(key, "piped")
+			get = p.Get(key)
+		})
+		if err != nil || len(replies) != 2 || get.Val() != "piped" {
+			t.Fatalf("expected 2 replies but got %v, %v", replies, err)
+		}
+
+		got := recorded()
+		if len(got) != 1 || got[0].Kind != redis.CallPipeline || got[0].Discard || len(got[0].Cmds) != 2 {
+			t.Fatalf("expected a pipeline of 2 commands but got %+v", got)
+		}
+		if cmd := got[0].Cmds[1]; cmd.Name != "GET" || string(cmd.Reply.([]byte)) != "piped" {
+			t.Errorf("expected GET replying piped but got %+v", cmd)
+		}
+	})
+
+	t.Run("wraps pipelines which discard their replies", func(t *testing.T) {
+		reset()
+		if err := p.PipelinedDiscarding(func(p redis.Pipeline) { p.Set(key, "discarded") }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := recorded(); len(got) != 1 || got[0].Kind != redis.CallPipeline || !got[0].Discard {
+			t.Errorf("expected a discarding pipeline but got %+v", got)
+		}
+	})
+
+	t.Run("wraps transactions", func(t *testing.T) {
+		reset()
+		var incr *redis.IntFuture
+		replies, err := p.Transaction(func(t redis.Transaction) {
+			t.Del(key)
+			incr = t.Incr(key)
+		})
+		if err != nil || len(replies) != 2 || incr.Val() != 1 {
+			t.Fatalf("expected 2 replies but got %v, %v", replies, err)
+		}
+
+		got := recorded()
+		if len(got) != 1 || got[0].Kind != redis.CallTransaction || len(got[0].Cmds) != 2 {
+			t.Fatalf("expected a transaction of 2 commands but got %+v", got)
+		}
+		if cmd := got[0].Cmds[1]; cmd.Name != "INCR" || cmd.Reply != int64(1) {
+			t.Errorf("expected INCR replying 1 but got %+v", cmd)
+		}
+	})
+
+	t.Run("sees pipelined scripts run with EVALSHA, and with EVAL in transactions", func(t *testing.T) {
+		script := redis.NewScript("return 1")
+		if err := p.ScriptLoad(script); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		reset()
+		if _, err := p.Pipelined(func(p redis.Pipeline) { p.Eval(script, nil) }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := p.Transaction(func(t redis.Transaction) { t.Eval(script, nil) }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got := recorded()
+		if len(got) != 2 || got[0].Cmds[0].Name != "EVALSHA" || got[0].Cmds[0].Reply != int64(1) {
+			t.Fatalf("expected EVALSHA replying 1 but got %+v", got)
+		}
+		if cmd := got[1].Cmds[0]; cmd.Name != "EVAL" || cmd.Reply != int64(1) {
+			t.Errorf("expected EVAL replying 1 but got %+v", cmd)
+		}
+	})
+
+	t.Run("fails calls refused by a hook", func(t *testing.T) {
+		reset()
+		if _, err := p.Get("forbidden:key"); err != errForbidden {
+			t.Errorf("expected errForbidden but got %v", err)
+		}
+
+		var set *redis.StatusFuture
+		_, err := p.Pipelined(func(p redis.Pipeline) {
+			set = p.Set(key, "value")
+			p.Get("forbidden:key")
+		})
+		if err != errForbidden {
+			t.Errorf("expected errForbidden but got %v", err)
+		}
+		if set.Err() != errForbidden {
+			t.Errorf("expected errForbidden from the pipeline's other command but got %v", set.Err())
+		}
+
+		if got := recorded(); len(got) != 0 {
+			t.Errorf("expected no calls to reach the server but got %+v", got)
+		}
+	})
+
+	t.Run("conformance", func(t *testing.T) {
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
+			l.Flush()
+			reset()
+			return p
+		})
+	})
+}
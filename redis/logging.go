@@ -0,0 +1,33 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Discards whatever is logged, for pools and connections without a Logger.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(math.MaxInt)}))
+
+func logger(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
+
+// slowLogHook returns a Hook which logs calls that take longer than threshold.
+func slowLogHook(log *slog.Logger, threshold time.Duration, redact Redactor) Hook {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			err := next(ctx, call)
+			if call.Duration > threshold {
+				log.WarnContext(ctx, "redis: slow command",
+					"statement", statement(call, redact), "commands", len(call.Cmds), "duration", call.Duration)
+			}
+			return err
+		}
+	}
+}
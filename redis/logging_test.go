@@ -0,0 +1,182 @@
+package redis_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestLogging(t *testing.T) {
+	newPool := func(url string, config redis.Config) (redis.Pool, *logBuffer) {
+		logs := &logBuffer{}
+		config.Logger = slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p, logs
+	}
+
+	t.Run("logs dials", func(t *testing.T) {
+		p, logs := newPool("redis://localhost:6379/10", redis.DefaultConfig)
+		p.Exists("key")
+
+		if entry := logs.find("redisurl: dialed"); entry == nil || entry["level"] != "DEBUG" || entry["address"] != "localhost:6379" {
+			t.Errorf("expected a dial to be logged but got %v", logs.entries())
+		}
+	})
+
+	t.Run("logs failed dials", func(t *testing.T) {
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		ln.Close()
+
+		p, logs := newPool("redis://"+addr, redis.DefaultConfig)
+		p.Exists("key")
+
+		if entry := logs.find("redisurl: dial failed"); entry == nil || entry["level"] != "ERROR" || entry["address"] != addr || entry["error"] == nil {
+			t.Errorf("expected a failed dial to be logged but got %v", logs.entries())
+		}
+	})
+
+	t.Run("logs falling back to connecting without a password", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p, logs := newPool("redis://:testpass@"+proxy.addr+"/10", redis.DefaultConfig)
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry := logs.find("redis: server has no password set, connecting without it"); entry == nil || entry["address"] != proxy.addr {
+			t.Errorf("expected the fallback to be logged but got %v", logs.entries())
+		}
+	})
+
+	t.Run("logs authenticating again", func(t *testing.T) {
+		fs := newFakeACLServer(t, map[string]string{"alice": "secret"})
+		p, logs := newPool("redis://alice:secret@"+fs.addr, redis.DefaultConfig)
+		p.Exists("key")
+		fs.deauth()
+		if _, err := p.Exists("key"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if entry := logs.find("redis: server asks the connection to authenticate again"); entry == nil || entry["command"] != "EXISTS" {
+			t.Errorf("expected authenticating again to be logged but got %v", logs.entries())
+		}
+	})
+
+	t.Run("logs the pool running out of connections", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.MaxOpenConnections = 1
+		config.Wait = false
+		p, logs := newPool("redis://localhost:6379/10", config)
+
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+		p.Exists("key")
+
+		if entry := logs.find("redis: connection pool exhausted"); entry == nil || entry["level"] != "WARN" || entry["address"] != "localhost:6379" {
+			t.Errorf("expected exhaustion to be logged but got %v", logs.entries())
+		}
+	})
+
+	t.Run("logs slow commands", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.SlowThreshold = 50 * time.Millisecond
+		p, logs := newPool("redis://localhost:6379/10", config)
+
+		p.Do(func(c redis.Connection) {
+			c.Do("PING")
+			c.Do("EVAL", "local t = redis.call('TIME'); while true do local n = redis.call('TIME'); if (n[1] - t[1]) * 1000000 + n[2] - t[2] > 100000 then return 1 end end", 0)
+		})
+
+		entries := logs.entries()
+		var slow []map[string]interface{}
+		for _, entry := range entries {
+			if entry["msg"] == "redis: slow command" {
+				slow = append(slow, entry)
+			}
+		}
+		if len(slow) != 1 || slow[0]["statement"] != "EVAL ? ?" || slow[0]["level"] != "WARN" {
+			t.Errorf("expected the EVAL alone, not the PING, to be logged as slow but got %v", entries)
+		}
+	})
+
+	t.Run("prints nothing without a logger", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("failed to create pipe: %v", err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		defer func() { os.Stdout = stdout }()
+
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		ln.Close()
+
+		p, err := redis.NewPool("redis://:wrong@"+addr, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+		if _, err := p.Exists("key"); err == nil {
+			t.Error("expected error")
+		}
+
+		os.Stdout = stdout
+		w.Close()
+		if printed, _ := io.ReadAll(r); len(printed) > 0 {
+			t.Errorf("expected nothing printed but got %q", printed)
+		}
+	})
+}
+
+// logBuffer collects the entries of a JSON slog handler.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) entries() []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// find returns the first entry logged with msg, or nil.
+func (b *logBuffer) find(msg string) map[string]interface{} {
+	for _, entry := range b.entries() {
+		if entry["msg"] == msg {
+			return entry
+		}
+	}
+	return nil
+}
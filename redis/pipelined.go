@@ -9,293 +9,348 @@ import (
 type Pipeline interface {
 	BatchCommands
 
-	receiveAll() ([]interface{}, error)
+	queued() []*Cmd
 }
 
 type Transaction interface {
 	Pipeline
 }
 
-func asTransaction(c *connection) Transaction {
-	return &sendOnlyConnection{c: c.c}
-}
-
-func asPipeline(c *connection) Pipeline {
-	return &sendOnlyConnection{c: c.c}
-}
-
+// sendOnlyConnection queues the commands of a pipeline or transaction, which are sent once it's
+// done queuing them.
 type sendOnlyConnection struct {
-	c       redigo.Conn
-	counter int
+	cmds []*Cmd
+	// The future of each queued command.
+	futures []resolver
+	// Whether Eval queues EVALSHA, as the pipeline's replies are received, so that scripts the
+	// server doesn't have cached can be run again with EVAL.
+	evalSHA bool
 }
 
 // KeyBatchCommands
 
-func (s *sendOnlyConnection) Del(keys ...string) error {
-	return s.count(s.c.Send("DEL", redigo.Args{}.AddFlat(keys)...))
+func (s *sendOnlyConnection) Del(keys ...string) *IntFuture {
+	return queue(s, redigo.Int, "DEL", redigo.Args{}.AddFlat(keys)...)
 }
 
-func (s *sendOnlyConnection) Exists(key string) error {
-	return s.count(s.c.Send("EXISTS", key))
+func (s *sendOnlyConnection) Exists(key string) *BoolFuture {
+	return queue(s, redigo.Bool, "EXISTS", key)
 }
 
-func (s *sendOnlyConnection) Expire(key string, seconds int) error {
-	return s.count(s.c.Send("EXPIRE", key, seconds))
+func (s *sendOnlyConnection) Expire(key string, seconds int) *BoolFuture {
+	return queue(s, redigo.Bool, "EXPIRE", key, seconds)
 }
 
-func (s *sendOnlyConnection) Rename(key, newKey string) error {
-	return s.count(s.c.Send("RENAME", key, newKey))
+func (s *sendOnlyConnection) Rename(key, newKey string) *StatusFuture {
+	return queue(s, redigo.String, "RENAME", key, newKey)
 }
 
-func (s *sendOnlyConnection) TTL(key string) error {
-	return s.count(s.c.Send("TTL", key))
+func (s *sendOnlyConnection) TTL(key string) *IntFuture {
+	return queue(s, redigo.Int, "TTL", key)
 }
 
-func (s *sendOnlyConnection) RenameNX(key, newKey string) error {
-	return s.count(s.c.Send("RENAMENX", key, newKey))
+func (s *sendOnlyConnection) RenameNX(key, newKey string) *BoolFuture {
+	return queue(s, redigo.Bool, "RENAMENX", key, newKey)
 }
 
 // StringBatchCommands
 
-func (s *sendOnlyConnection) Get(key string) error {
-	return s.count(s.c.Send("GET", key))
+func (s *sendOnlyConnection) Get(key string) *StringFuture {
+	return queue(s, redigo.String, "GET", key)
 }
 
-func (s *sendOnlyConnection) Set(key, value string) error {
-	return s.count(s.c.Send("SET", key, value))
+func (s *sendOnlyConnection) Set(key, value string) *StatusFuture {
+	return queue(s, redigo.String, "SET", key, value)
 }
 
-func (s *sendOnlyConnection) SetEx(key, value string, expire int) error {
-	return s.count(s.c.Send("SETEX", key, expire, value))
+func (s *sendOnlyConnection) SetEx(key, value string, expire int) *StatusFuture {
+	return queue(s, redigo.String, "SETEX", key, expire, value)
 }
 
-func (s *sendOnlyConnection) SetNX(key, value string) error {
-	return s.count(s.c.Send("SETNX", key, value))
+func (s *sendOnlyConnection) SetNX(key, value string) *BoolFuture {
+	return queue(s, redigo.Bool, "SETNX", key, value)
 }
 
-func (s *sendOnlyConnection) Incr(key string) error {
-	return s.count(s.c.Send("INCR", key))
+func (s *sendOnlyConnection) Incr(key string) *IntFuture {
+	return queue(s, redigo.Int, "INCR", key)
 }
 
 // HashBatchCommands
 
-func (s *sendOnlyConnection) HGet(key, field string) error {
-	return s.count(s.c.Send("HGET", key, field))
+func (s *sendOnlyConnection) HGet(key, field string) *StringFuture {
+	return queue(s, redigo.String, "HGET", key, field)
 }
 
-func (s *sendOnlyConnection) HGetAll(key string) error {
-	return s.count(s.c.Send("HGETALL", key))
+func (s *sendOnlyConnection) HGetAll(key string) *StringMapFuture {
+	return queue(s, stringMapReply, "HGETALL", key)
 }
 
-func (s *sendOnlyConnection) HIncrBy(key, field string, value int64) error {
-	return s.count(s.c.Send("HINCRBY", key, field, value))
+func (s *sendOnlyConnection) HIncrBy(key, field string, value int64) *Int64Future {
+	return queue(s, redigo.Int64, "HINCRBY", key, field, value)
 }
 
-func (s *sendOnlyConnection) HSet(key string, field string, value string) error {
-	return s.count(s.c.Send("HSET", key, field, value))
+func (s *sendOnlyConnection) HSet(key string, field string, value string) *BoolFuture {
+	return queue(s, redigo.Bool, "HSET", key, field, value)
 }
 
-func (s *sendOnlyConnection) HMGet(key string, fields ...string) error {
+func (s *sendOnlyConnection) HMGet(key string, fields ...string) *StringMapFuture {
 	if len(fields) == 0 {
-		return errors.New("redis: at least once field is required")
+		return resolvedFuture[map[string]string](nil, errors.New("redis: at least once field is required"))
 	}
-	return s.count(s.c.Send("HMGET", redigo.Args{key}.AddFlat(fields)...))
+	return queue(s, splicedMapReply(fields), "HMGET", redigo.Args{key}.AddFlat(fields)...)
 }
 
-func (s *sendOnlyConnection) HMSet(key string, args map[string]interface{}) error {
-	return s.count(s.c.Send("HMSET", redigo.Args{key}.AddFlat(mapToSlice(args))...))
+func (s *sendOnlyConnection) HMSet(key string, args map[string]interface{}) *StatusFuture {
+	if len(args) == 0 {
+		return resolvedFuture("", errors.New("redis: at least one key/value pair is required"))
+	}
+	return queue(s, ok, "HMSET", redigo.Args{key}.AddFlat(mapToSlice(args))...)
 }
 
-func (s *sendOnlyConnection) HDel(key string, field string) error {
-	return s.count(s.c.Send("HDEL", key, field))
+func (s *sendOnlyConnection) HDel(key string, field string) *BoolFuture {
+	return queue(s, redigo.Bool, "HDEL", key, field)
 }
 
 // ListBatchCommands
 
-func (s *sendOnlyConnection) LPop(key string) error {
-	return s.count(s.c.Send("LPOP", key))
+func (s *sendOnlyConnection) LPop(key string) *StringFuture {
+	return queue(s, redigo.String, "LPOP", key)
 }
 
-func (s *sendOnlyConnection) LPush(key string, values ...string) error {
-	return s.count(s.c.Send("LPUSH", redigo.Args{key}.AddFlat(values)...))
+func (s *sendOnlyConnection) LPush(key string, values ...string) *IntFuture {
+	return queue(s, redigo.Int, "LPUSH", redigo.Args{key}.AddFlat(values)...)
 }
 
-func (s *sendOnlyConnection) LTrim(key string, startIndex int, endIndex int) error {
-	return s.count(s.c.Send("LTRIM", key, startIndex, endIndex))
+func (s *sendOnlyConnection) LTrim(key string, startIndex int, endIndex int) *StatusFuture {
+	return queue(s, redigo.String, "LTRIM", key, startIndex, endIndex)
 }
 
-func (s *sendOnlyConnection) LRange(key string, startIndex int, endIndex int) error {
-	return s.count(s.c.Send("LRANGE", key, startIndex, endIndex))
+func (s *sendOnlyConnection) LRange(key string, startIndex int, endIndex int) *StringsFuture {
+	return queue(s, redigo.Strings, "LRANGE", key, startIndex, endIndex)
 }
 
-func (s *sendOnlyConnection) RPop(key string) error {
-	return s.count(s.c.Send("RPOP", key))
+func (s *sendOnlyConnection) RPop(key string) *StringFuture {
+	return queue(s, redigo.String, "RPOP", key)
 }
 
-func (s *sendOnlyConnection) RPush(key string, values ...string) error {
-	return s.count(s.c.Send("RPUSH", redigo.Args{key}.AddFlat(values)...))
+func (s *sendOnlyConnection) RPush(key string, values ...string) *IntFuture {
+	return queue(s, redigo.Int, "RPUSH", redigo.Args{key}.AddFlat(values)...)
 }
 
 // SetBatchCommands
 
-func (s *sendOnlyConnection) SAdd(key string, member string, members ...string) error {
-	return s.count(s.c.Send("SADD", redigo.Args{key}.Add(member).AddFlat(members)...))
+func (s *sendOnlyConnection) SAdd(key string, member string, members ...string) *IntFuture {
+	return queue(s, redigo.Int, "SADD", redigo.Args{key}.Add(member).AddFlat(members)...)
 }
 
-func (s *sendOnlyConnection) SRem(key string, member string, members ...string) error {
-	return s.count(s.c.Send("SREM", redigo.Args{key}.Add(member).AddFlat(members)...))
+func (s *sendOnlyConnection) SRem(key string, member string, members ...string) *IntFuture {
+	return queue(s, redigo.Int, "SREM", redigo.Args{key}.Add(member).AddFlat(members)...)
 }
 
-func (s *sendOnlyConnection) SPop(key string) error {
-	return s.count(s.c.Send("SPOP", key))
+func (s *sendOnlyConnection) SPop(key string) *StringFuture {
+	return queue(s, redigo.String, "SPOP", key)
 }
 
-func (s *sendOnlyConnection) SMembers(key string) error {
-	return s.count(s.c.Send("SMEMBERS", key))
+func (s *sendOnlyConnection) SMembers(key string) *StringsFuture {
+	return queue(s, redigo.Strings, "SMEMBERS", key)
 }
 
-func (s *sendOnlyConnection) SMove(source, destination, member string) error {
-	return s.count(s.c.Send("SMOVE", source, destination, member))
+func (s *sendOnlyConnection) SMove(source, destination, member string) *BoolFuture {
+	return queue(s, redigo.Bool, "SMOVE", source, destination, member)
 }
 
-func (s *sendOnlyConnection) SRandMember(key string, count int) error {
-	return s.count(s.c.Send("SRANDMEMBER", key, count))
+func (s *sendOnlyConnection) SRandMember(key string, count int) *StringsFuture {
+	return queue(s, redigo.Strings, "SRANDMEMBER", key, count)
 }
 
-func (s *sendOnlyConnection) SDiff(key string, keys ...string) error {
-	return s.count(s.c.Send("SDIFF", redigo.Args{key}.AddFlat(keys)...))
+func (s *sendOnlyConnection) SDiff(key string, keys ...string) *StringsFuture {
+	return queue(s, redigo.Strings, "SDIFF", redigo.Args{key}.AddFlat(keys)...)
 }
 
 // SortedSetBatchCommands
 
-func (s *sendOnlyConnection) ZAdd(key string, args ...interface{}) error {
+func (s *sendOnlyConnection) ZAdd(key string, args ...interface{}) *IntFuture {
 	if len(args) == 0 {
-		return nil
+		return resolvedFuture(0, nil)
 	}
-	return s.count(s.c.Send("ZADD", redigo.Args{key}.AddFlat(args)...))
+	return queue(s, redigo.Int, "ZADD", redigo.Args{key}.AddFlat(args)...)
 }
 
-func (s *sendOnlyConnection) ZCard(key string) error {
-	return s.count(s.c.Send("ZCARD", key))
+func (s *sendOnlyConnection) ZCard(key string) *IntFuture {
+	return queue(s, redigo.Int, "ZCARD", key)
 }
 
-func (s *sendOnlyConnection) ZRange(key string, start, stop int) error {
-	return s.count(s.c.Send("ZRANGE", key, start, stop))
+func (s *sendOnlyConnection) ZRange(key string, start, stop int) *StringsFuture {
+	return queue(s, redigo.Strings, "ZRANGE", key, start, stop)
 }
 
-func (s *sendOnlyConnection) ZRangeWithScores(key string, start, stop int) error {
-	return s.count(s.c.Send("ZRANGE", key, start, stop, "WITHSCORES"))
+func (s *sendOnlyConnection) ZRangeWithScores(key string, start, stop int) *ZFuture {
+	return queue(s, zValuesWithScores, "ZRANGE", key, start, stop, "WITHSCORES")
 }
 
-func (s *sendOnlyConnection) ZRangeByScore(key, min, max string) error {
-	return s.count(s.c.Send("ZRANGEBYSCORE", key, min, max))
+func (s *sendOnlyConnection) ZRangeByScore(key, min, max string) *StringsFuture {
+	return queue(s, redigo.Strings, "ZRANGEBYSCORE", key, min, max)
 }
 
-func (s *sendOnlyConnection) ZRangeByScoreWithScores(key, min, max string) error {
-	return s.count(s.c.Send("ZRANGEBYSCORE", key, min, max, "WITHSCORES"))
+func (s *sendOnlyConnection) ZRangeByScoreWithScores(key, min, max string) *ZFuture {
+	return queue(s, zValuesWithScores, "ZRANGEBYSCORE", key, min, max, "WITHSCORES")
 }
 
-func (s *sendOnlyConnection) ZRangeByScoreWithLimit(key, min, max string, offset, count int) error {
-	return s.count(s.c.Send("ZRANGEBYSCORE", key, min, max, "LIMIT", offset, count))
+func (s *sendOnlyConnection) ZRangeByScoreWithLimit(key, min, max string, offset, count int) *StringsFuture {
+	return queue(s, redigo.Strings, "ZRANGEBYSCORE", key, min, max, "LIMIT", offset, count)
 }
 
-func (s *sendOnlyConnection) ZRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) error {
-	return s.count(s.c.Send("ZRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", offset, count))
+func (s *sendOnlyConnection) ZRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) *ZFuture {
+	return queue(s, zValuesWithScores, "ZRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", offset, count)
 }
 
-func (s *sendOnlyConnection) ZRevRange(key string, start, stop int) error {
-	return s.count(s.c.Send("ZREVRANGE", key, start, stop))
+func (s *sendOnlyConnection) ZRevRange(key string, start, stop int) *StringsFuture {
+	return queue(s, redigo.Strings, "ZREVRANGE", key, start, stop)
 }
 
-func (s *sendOnlyConnection) ZRevRangeWithScores(key string, start, stop int) error {
-	return s.count(s.c.Send("ZREVRANGE", key, start, stop, "WITHSCORES"))
+func (s *sendOnlyConnection) ZRevRangeWithScores(key string, start, stop int) *ZFuture {
+	return queue(s, zValuesWithScores, "ZREVRANGE", key, start, stop, "WITHSCORES")
 }
 
-func (s *sendOnlyConnection) ZRevRangeByScore(key, min, max string) error {
-	return s.count(s.c.Send("ZREVRANGEBYSCORE", key, min, max))
+func (s *sendOnlyConnection) ZRevRangeByScore(key, min, max string) *StringsFuture {
+	return queue(s, redigo.Strings, "ZREVRANGEBYSCORE", key, min, max)
 }
 
-func (s *sendOnlyConnection) ZRevRangeByScoreWithScores(key, min, max string) error {
-	return s.count(s.c.Send("ZREVRANGEBYSCORE", key, min, max, "WITHSCORES"))
+func (s *sendOnlyConnection) ZRevRangeByScoreWithScores(key, min, max string) *ZFuture {
+	return queue(s, zValuesWithScores, "ZREVRANGEBYSCORE", key, min, max, "WITHSCORES")
 }
 
-func (s *sendOnlyConnection) ZRevRangeByScoreWithLimit(key, min, max string, offset, count int) error {
-	return s.count(s.c.Send("ZREVRANGEBYSCORE", key, min, max, "LIMIT", offset, count))
+func (s *sendOnlyConnection) ZRevRangeByScoreWithLimit(key, min, max string, offset, count int) *StringsFuture {
+	return queue(s, redigo.Strings, "ZREVRANGEBYSCORE", key, min, max, "LIMIT", offset, count)
 }
 
-func (s *sendOnlyConnection) ZRevRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) error {
-	return s.count(s.c.Send("ZREVRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", offset, count))
+func (s *sendOnlyConnection) ZRevRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) *ZFuture {
+	return queue(s, zValuesWithScores, "ZREVRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", offset, count)
 }
 
-func (s *sendOnlyConnection) ZRank(key, member string) error {
-	return s.count(s.c.Send("ZRANK", key, member))
+func (s *sendOnlyConnection) ZRank(key, member string) *IntFuture {
+	return queue(s, redigo.Int, "ZRANK", key, member)
 }
 
-func (s *sendOnlyConnection) ZRem(key string, members ...string) error {
+func (s *sendOnlyConnection) ZRem(key string, members ...string) *IntFuture {
 	if len(members) == 0 {
-		return nil
+		return resolvedFuture(0, nil)
 	}
 	args := redigo.Args{}.Add(key).AddFlat(members)
-	return s.count(s.c.Send("ZREM", args...))
+	return queue(s, redigo.Int, "ZREM", args...)
 }
 
-func (s *sendOnlyConnection) ZRemRangeByRank(key string, start, stop int) error {
-	return s.count(s.c.Send("ZREMRANGEBYRANK", key, start, stop))
+func (s *sendOnlyConnection) ZRemRangeByRank(key string, start, stop int) *IntFuture {
+	return queue(s, redigo.Int, "ZREMRANGEBYRANK", key, start, stop)
 }
 
-func (s *sendOnlyConnection) ZScore(key string, member string) (err error) {
+func (s *sendOnlyConnection) ZScore(key string, member string) *FloatFuture {
 	if member == "" {
-		return nil
+		return resolvedFuture(0.0, nil)
 	}
-	return s.count(s.c.Send("ZSCORE", key, member))
+	return queue(s, redigo.Float64, "ZSCORE", key, member)
 }
 
-func (s *sendOnlyConnection) ZIncrBy(key string, score float64, value string) error {
-	return s.count(s.c.Send("ZINCRBY", key, score, value))
+func (s *sendOnlyConnection) ZIncrBy(key string, score float64, value string) *IntFuture {
+	return queue(s, redigo.Int, "ZINCRBY", key, score, value)
 }
 
 // HyperLogLogBatchCommands
 
-func (s *sendOnlyConnection) PFAdd(key string, values ...string) error {
-	return s.count(s.c.Send("PFADD", redigo.Args{key}.AddFlat(values)...))
+func (s *sendOnlyConnection) PFAdd(key string, values ...string) *IntFuture {
+	return queue(s, redigo.Int, "PFADD", redigo.Args{key}.AddFlat(values)...)
 }
 
-func (s *sendOnlyConnection) PFCount(key string) error {
-	return s.count(s.c.Send("PFCOUNT", key))
+func (s *sendOnlyConnection) PFCount(key string) *IntFuture {
+	return queue(s, redigo.Int, "PFCOUNT", key)
 }
 
-func (s *sendOnlyConnection) PFMerge(mergedKey string, keysToMerge ...string) error {
-	return s.count(s.c.Send("PFMERGE", redigo.Args{mergedKey}.AddFlat(keysToMerge)...))
+func (s *sendOnlyConnection) PFMerge(mergedKey string, keysToMerge ...string) *BoolFuture {
+	return queue(s, okBool, "PFMERGE", redigo.Args{mergedKey}.AddFlat(keysToMerge)...)
 }
 
-// Pipeline - only visible to package
+// PubSubBatchCommands
+
+func (s *sendOnlyConnection) Publish(channel, message string) *IntFuture {
+	return queue(s, redigo.Int, "PUBLISH", channel, message)
+}
 
-func (s *sendOnlyConnection) receiveAll() ([]interface{}, error) {
-	if s.counter == 0 {
-		return nil, nil
+// StreamBatchCommands
+
+func (s *sendOnlyConnection) XAdd(key, id string, fields map[string]interface{}) *StringFuture {
+	if len(fields) == 0 {
+		return resolvedFuture("", errors.New("redis: at least one field/value pair is required"))
 	}
+	return queue(s, redigo.String, "XADD", redigo.Args{key, id}.AddFlat(mapToSlice(fields))...)
+}
 
-	replies := make([]interface{}, s.counter)
-	for i := 0; i < s.counter; i++ {
-		r, err := s.c.Receive()
-		if err != nil {
-			return nil, err
-		}
+func (s *sendOnlyConnection) XLen(key string) *IntFuture {
+	return queue(s, redigo.Int, "XLEN", key)
+}
+
+func (s *sendOnlyConnection) XDel(key string, ids ...string) *IntFuture {
+	return queue(s, redigo.Int, "XDEL", redigo.Args{key}.AddFlat(ids)...)
+}
+
+func (s *sendOnlyConnection) XRange(key, start, end string, count int) *StreamEntriesFuture {
+	if count < 1 {
+		return queue(s, streamEntries, "XRANGE", key, start, end)
+	}
+	return queue(s, streamEntries, "XRANGE", key, start, end, "COUNT", count)
+}
 
-		replies[i] = r
+func (s *sendOnlyConnection) XTrim(key string, maxLen int, approximate bool) *IntFuture {
+	if approximate {
+		return queue(s, redigo.Int, "XTRIM", key, "MAXLEN", "~", maxLen)
 	}
+	return queue(s, redigo.Int, "XTRIM", key, "MAXLEN", maxLen)
+}
 
-	s.counter = 0
-	return replies, nil
+func (s *sendOnlyConnection) XAck(key, group string, ids ...string) *IntFuture {
+	return queue(s, redigo.Int, "XACK", redigo.Args{key, group}.AddFlat(ids)...)
 }
 
-// helpers
+// ScriptingBatchCommands
 
-func (s *sendOnlyConnection) count(err error) error {
-	if err != nil {
-		return err
+func (s *sendOnlyConnection) Eval(script *Script, keys []string, args ...interface{}) *ReplyFuture {
+	if !s.evalSHA {
+		return queue(s, rawReply, "EVAL", script.args(false, keys, args)...)
 	}
+	f := queue(s, rawReply, "EVALSHA", script.args(true, keys, args)...)
+	s.cmds[len(s.cmds)-1].script = script
+	return f
+}
+
+// Pipeline - only visible to package
+
+func (s *sendOnlyConnection) queued() []*Cmd {
+	return s.cmds
+}
+
+// resolve resolves the futures of the queued commands with their replies, or with err if they
+// weren't sent, e.g. as a hook failed the call.
+func (s *sendOnlyConnection) resolve(err error) {
+	for i, f := range s.futures {
+		if cmd := s.cmds[i]; cmd.sent || err == nil {
+			f.resolve(cmd.Reply, cmd.Err)
+		} else {
+			f.resolve(nil, err)
+		}
+	}
+}
+
+// helpers
+
+// queue queues a command and returns a future that is resolved with its reply, decoded by
+// convert.
+func queue[T any](s *sendOnlyConnection, convert func(interface{}, error) (T, error), command string, args ...interface{}) *Future[T] {
+	f := newFuture(convert)
+	s.cmds = append(s.cmds, &Cmd{Name: command, Args: args})
+	s.futures = append(s.futures, f)
+	return f
+}
 
-	s.counter++
-	return nil
+// resolvedFuture returns a future for a command that did not need to be sent.
+func resolvedFuture[T any](val T, err error) *Future[T] {
+	return &Future[T]{resolved: true, val: val, err: err}
 }
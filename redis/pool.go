@@ -1,9 +1,14 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"log/slog"
 	netURL "net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	redigo "github.com/gomodule/redigo/redis"
@@ -49,32 +54,144 @@ func (m *hosts) Get(host string) bool {
 	return m.hosts[host]
 }
 
-func generateConnection(url *netURL.URL) (redigo.Conn, error) {
+func generateConnection(url *netURL.URL, options redisurl.Options) (redigo.Conn, error) {
+	// Servers are known by their host, or the path of their unix socket.
+	_, addr := redisurl.Address(url)
+
 	// Then we expect the server to not ask for a password
-	if hostsNotUsingAuth.Get(url.Host) {
+	if hostsNotUsingAuth.Get(addr) {
 		url.User = nil
-		conn, err := redisurl.ConnectToURL(url.String())
-		if errors.Is(err, redigoErrNoAuth) {
-			hostsNotUsingAuth.Remove(url.Host)
-			return generateConnection(url)
+		conn, err := redisurl.ConnectToURLWithOptions(url.String(), options)
+		if errorKind(err) == ErrNoAuth {
+			logger(options.Logger).Info("redis: server asks for a password again, connecting with it", "address", addr)
+			hostsNotUsingAuth.Remove(addr)
+			return generateConnection(url, options)
 		}
 		return conn, err
 	}
 
 	// Then we expect the server to potentially ask for a password
-	conn, err := redisurl.ConnectToURL(url.String())
-	if errors.Is(err, redigoErrSentAuth) || errors.Is(err, redigoErrSentAuth2) {
-		hostsNotUsingAuth.Add(url.Host)
-		return generateConnection(url)
+	conn, err := redisurl.ConnectToURLWithOptions(url.String(), options)
+	if isNoPasswordError(err) {
+		logger(options.Logger).Info("redis: server has no password set, connecting without it", "address", addr)
+		hostsNotUsingAuth.Add(addr)
+		return generateConnection(url, options)
 	}
 	return conn, err
 }
 
+// credentials returns the username and password of url.
+func credentials(url *netURL.URL) (username, password string) {
+	if url.User == nil {
+		return "", ""
+	}
+	password, _ = url.User.Password()
+	return url.User.Username(), password
+}
+
+// isNoPasswordError reports whether err is a server refusing AUTH as it has no password set. Those
+// sent as an ACL user fall back to the default user (see redisurl.Auth), so end up here too.
+func isNoPasswordError(err error) bool {
+	for _, prefix := range noPasswordErrors {
+		if isErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isErrorPrefix(err error, prefix string) bool {
+	var redisErr redigo.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), prefix)
+}
+
 type Config struct {
 	MaxOpenConnections int
 	MaxIdleConnections int
 	IdleTimeout        time.Duration
 	Wait               bool
+
+	// Scripts are loaded into the script cache by NewPool, so the first Eval of each doesn't
+	// need to fall back to sending its source. NewPoolWithURL, which can't report a failure to
+	// load them, leaves them to that fallback. See ParseScripts.
+	Scripts []*Script
+
+	// TLSConfig configures the TLS of connections to rediss:// URLs. The TLS query parameters of
+	// the URL, such as tls_ca_file, are applied on top of it (see redisurl.TLSConfig). It is
+	// ignored for other URLs.
+	TLSConfig *tls.Config
+
+	// Protocol is the version of RESP connections switch to with HELLO, 2 or 3, or 0 for them to
+	// send no HELLO, as servers older than Redis 6 don't know it. ClientName is the name
+	// connections are given. The URL's protocol and client_name query parameters take precedence
+	// (see redisurl.Options).
+	Protocol   int
+	ClientName string
+
+	// DialTimeout bounds connecting, and defaults to 30 seconds. ReadTimeout and WriteTimeout
+	// bound waiting on each reply and command, and default to none, so commands which block, such
+	// as BLPOP or XReadGroup, must block for less than ReadTimeout. KeepAlive is the interval of
+	// TCP keepalive probes, which defaults to 5 minutes, or disables them if negative. The URL's
+	// dial_timeout, read_timeout, write_timeout and keepalive query parameters take precedence.
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	KeepAlive    time.Duration
+
+	// DialOptions are passed to redigo's Dial, after those implied by the URL and the options
+	// above, e.g. redigo.DialContextFunc to connect some other way than over the network.
+	DialOptions []redigo.DialOption
+
+	// Connections which have been idle for longer than HealthCheckAfter are checked with a PING
+	// as they're taken from the pool, and replaced if it fails, e.g. once the server has
+	// restarted. Zero disables the check.
+	HealthCheckAfter time.Duration
+
+	// MaxConnLifetime is how long connections are used for before they're closed, or forever if
+	// it is zero.
+	MaxConnLifetime time.Duration
+
+	// MinIdleConnections is how many idle connections are dialed ahead of being needed: in the
+	// background once the pool is created, and again whenever taking a connection leaves fewer
+	// idle. It's capped by MaxIdleConnections and MaxOpenConnections.
+	MinIdleConnections int
+
+	// Hooks wrap the commands, pipelines and transactions of the pool's connections, the first
+	// outermost. See Hook.
+	Hooks []Hook
+
+	// Tracer, if set, starts a span for each command, pipeline and transaction of the pool,
+	// inside any Hooks.
+	Tracer Tracer
+
+	// Logger is where the pool logs dials, servers asking connections to authenticate again or
+	// not to, the pool running out of connections, and commands, pipelines and transactions which
+	// take longer than SlowThreshold, if it isn't zero. Nothing is logged if it's nil.
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+
+	// Redactor is how the arguments of commands are shown in their spans and logs, and defaults
+	// to RedactValues.
+	Redactor Redactor
+
+	// Retry is how the commands of the pool's own methods are retried when they fail transiently.
+	// They aren't retried by default. See RetryPolicy.
+	Retry RetryPolicy
+}
+
+// urlOptions returns the options connections are dialed with.
+func (c Config) urlOptions() redisurl.Options {
+	return redisurl.Options{
+		TLSConfig:    c.TLSConfig,
+		Protocol:     c.Protocol,
+		ClientName:   c.ClientName,
+		DialTimeout:  c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		KeepAlive:    c.KeepAlive,
+		DialOptions:  c.DialOptions,
+		Logger:       c.Logger,
+	}
 }
 
 type PooledConnection interface {
@@ -87,6 +204,9 @@ type Pool interface {
 	Commands
 
 	GetConnection() (PooledConnection, error)
+	// GetConnectionContext is like GetConnection, but gives up waiting on the pool when ctx is
+	// done. The returned connection is bound to ctx as if by Connection.WithContext.
+	GetConnectionContext(ctx context.Context) (PooledConnection, error)
 	Return(PooledConnection)
 
 	Do(f func(Connection)) error
@@ -94,6 +214,24 @@ type Pool interface {
 	Pipelined(func(Pipeline)) ([]interface{}, error)
 	PipelinedDiscarding(f func(Pipeline)) error
 
+	// CheckAndSet runs an optimistically locked transaction on a single connection. It WATCHes
+	// the keys, calls read so it can inspect them, then runs write as a Transaction. If a watched
+	// key is modified in the meantime, the whole sequence is retried up to retries more times
+	// before giving up with ErrTxAborted. An error returned by read is returned as is.
+	CheckAndSet(keys []string, retries int, read func(Connection) error, write func(Transaction)) ([]interface{}, error)
+
+	// PubSub dials a dedicated subscriber connection to the pool's server.
+	PubSub() (PubSub, error)
+
+	// WithContext returns a view of the pool whose commands, pipelines and transactions honor
+	// the deadline and cancellation of ctx, both while waiting on the pool and on the socket.
+	// The view shares its connections with the original pool, and is of the same kind: the view
+	// of a ClusterPool is a ClusterPool too.
+	WithContext(ctx context.Context) Pool
+
+	// Stats returns a snapshot of the pool's connections, and counts of what has happened to them.
+	Stats() PoolStats
+
 	Shutdown()
 }
 
@@ -103,46 +241,220 @@ func NewPool(url string, config Config) (Pool, error) {
 		return nil, err
 	}
 
-	return NewPoolWithURL(parsedRedisURL, config), nil
+	p := NewPoolWithURL(parsedRedisURL, config)
+	if err := p.(*pool).loadScripts(config); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 func NewPoolWithURL(url *netURL.URL, config Config) Pool {
-	var password string
-	if url.User != nil {
-		password, _ = url.User.Password()
-	}
+	username, password := credentials(url)
 
+	options := config.urlOptions()
 	generator := func() (redigo.Conn, error) {
-		return generateConnection(url)
+		return generateConnection(url, options)
 	}
-	p := redigo.NewPool(generator, config.MaxIdleConnections)
+	counted := &countedPool{}
+	p := redigo.NewPool(counted.dial(generator), config.MaxIdleConnections)
+	counted.Pool = p
 	p.MaxActive = config.MaxOpenConnections
 	p.IdleTimeout = config.IdleTimeout
 	p.Wait = config.Wait
+	p.MaxConnLifetime = config.MaxConnLifetime
+
+	if config.HealthCheckAfter > 0 {
+		p.TestOnBorrow = func(c redigo.Conn, idleSince time.Time) error {
+			if time.Since(idleSince) < config.HealthCheckAfter {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		}
+	}
+
+	var w *warmer
+	if config.MinIdleConnections > 0 {
+		w = &warmer{p: p, minIdle: config.MinIdleConnections}
+		w.topUp()
+	}
+
+	s := &pool{p: counted, url: url, username: username, password: password, options: options, warmer: w}
+	s.configure(config)
+	return s
+}
+
+// setUp configures a pool which has just been created, and loads the scripts of config into it,
+// shutting it down if they fail to load.
+func (s *pool) setUp(config Config) error {
+	s.configure(config)
+	return s.loadScripts(config)
+}
+
+// configure sets the hooks and RetryPolicy of the pool from config.
+func (s *pool) configure(config Config) {
+	s.hooks = config.hooks(s.currentURL)
+	s.retry = config.Retry
+}
+
+// loadScripts loads the scripts of config, shutting the pool down if they fail to load.
+func (s *pool) loadScripts(config Config) error {
+	if len(config.Scripts) == 0 {
+		return nil
+	}
+	if err := s.ScriptLoad(config.Scripts...); err != nil {
+		s.Shutdown()
+		return err
+	}
+	return nil
+}
 
-	return &pool{p: p, password: password}
+// connSource is where a pool gets its connections: a redigo.Pool for a single server, or a
+// cluster, whose connections route each command to the node serving its key.
+type connSource interface {
+	Get() redigo.Conn
+	// GetContext takes a connection, giving up waiting on the pool when ctx is done. The
+	// connSources of several servers don't wait on any pool: their connections take one from the
+	// pool of each server as commands are sent to it, and ctx bounds waiting for those.
+	GetContext(ctx context.Context) (redigo.Conn, error)
+	Close() error
+}
+
+// Implemented by connSources whose server changes, such as the master of a SentinelPool, so that
+// a PubSub dials the server of the moment.
+type urlSource interface {
+	currentURL() *netURL.URL
+}
+
+// Implemented by the pools of this package, which all embed a *pool.
+type basePool interface {
+	base() *pool
 }
 
 type pool struct {
-	p        *redigo.Pool
+	p        connSource
+	url      *netURL.URL
+	username string
 	password string
+	// The options the pool's connections are dialed with, for its PubSubs to be dialed with too.
+	options redisurl.Options
+	hooks   []Hook
+	retry   RetryPolicy
+	// Keeps idle connections dialed, if the pool has a minimum number of them.
+	warmer *warmer
+	ctx    context.Context
+}
+
+func (s *pool) base() *pool {
+	return s
 }
 
 func (s *pool) GetConnection() (PooledConnection, error) {
-	c := s.p.Get()
+	return s.getConnection(s.ctx)
+}
+
+func (s *pool) GetConnectionContext(ctx context.Context) (PooledConnection, error) {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	return s.getConnection(ctx)
+}
+
+func (s *pool) getConnection(ctx context.Context) (PooledConnection, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection{pool: s, c: c, username: s.username, password: s.password, ctx: ctx, hooks: s.hooks, logger: s.options.Logger}, nil
+}
+
+// get takes a connection from the pool, giving up waiting when ctx is done if it is not nil.
+func (s *pool) get(ctx context.Context) (redigo.Conn, error) {
+	var c redigo.Conn
+	var err error
+	if ctx == nil {
+		c = s.p.Get()
 
-	// Force acquisition of an underlying connection:
-	// https://github.com/garyburd/redigo/blob/master/redis/pool.go#L138
-	if err := c.Err(); err != nil {
-		c.Close()
-		if err.Error() == "redigo: connection pool exhausted" {
+		// Force acquisition of an underlying connection:
+		// https://github.com/garyburd/redigo/blob/master/redis/pool.go#L138
+		err = c.Err()
+	} else if err = ctx.Err(); err == nil {
+		c, err = s.p.GetContext(ctx)
+	}
+
+	if err != nil {
+		if c != nil {
+			c.Close()
+		}
+		if errors.Is(err, redigo.ErrPoolExhausted) {
+			_, addr := redisurl.Address(s.currentURL())
+			logger(s.options.Logger).Warn("redis: connection pool exhausted", "address", addr)
 			return nil, ErrPoolExhausted
+		} else if errorKind(err) != nil {
+			// Such as the server refusing the connection, or its password.
+			return nil, &Error{Err: err}
 		} else {
 			return nil, err
 		}
 	}
 
-	return &connection{pool: s, c: c, password: s.password}, nil
+	if s.warmer != nil {
+		s.warmer.topUp()
+	}
+	return c, nil
+}
+
+// warmer keeps a minimum number of idle connections in a pool.
+type warmer struct {
+	p       *redigo.Pool
+	minIdle int
+	running atomic.Bool
+}
+
+// topUp dials connections in the background until the pool has the minimum number idle, unless
+// it already has, or they're already being dialed.
+func (w *warmer) topUp() {
+	if w.p.Stats().IdleCount >= w.minIdle || !w.running.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer w.running.Store(false)
+		w.warm()
+	}()
+}
+
+// warm takes the minimum number of idle connections from the pool at once, dialing those it
+// doesn't have, and returns them to it. It stops at the first which fails to dial.
+func (w *warmer) warm() {
+	n := w.minIdle
+	if w.p.MaxIdle > 0 && n > w.p.MaxIdle {
+		n = w.p.MaxIdle
+	}
+	// Taking connections in use elsewhere would have to wait for them, or exhaust the pool.
+	if w.p.MaxActive > 0 {
+		stats := w.p.Stats()
+		if free := w.p.MaxActive - (stats.ActiveCount - stats.IdleCount); n > free {
+			n = free
+		}
+	}
+
+	conns := make([]redigo.Conn, 0, n)
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		c := w.p.Get()
+		if c.Err() != nil {
+			c.Close()
+			return
+		}
+		conns = append(conns, c)
+	}
 }
 
 func (s *pool) Return(c PooledConnection) {
@@ -199,6 +511,52 @@ func (s *pool) PipelinedDiscarding(f func(Pipeline)) error {
 	return c.PipelinedDiscarding(f)
 }
 
+func (s *pool) CheckAndSet(keys []string, retries int, read func(Connection) error, write func(Transaction)) ([]interface{}, error) {
+	c, err := s.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.Return(c)
+
+	for attempt := 0; ; attempt++ {
+		if err := c.Watch(keys...); err != nil {
+			return nil, err
+		}
+
+		if err := read(c); err != nil {
+			c.Unwatch()
+			return nil, err
+		}
+
+		replies, err := c.Transaction(write)
+		if err != ErrTxAborted || attempt >= retries {
+			return replies, err
+		}
+	}
+}
+
+func (s *pool) PubSub() (PubSub, error) {
+	return newPubSub(s.currentURL(), s.options)
+}
+
+// currentURL returns the URL of the pool's server of the moment.
+func (s *pool) currentURL() *netURL.URL {
+	if u, ok := s.p.(urlSource); ok {
+		return u.currentURL()
+	}
+	return s.url
+}
+
+func (s *pool) WithContext(ctx context.Context) Pool {
+	if ctx == nil {
+		panic("redis: nil context")
+	}
+	p := *s
+	p.ctx = ctx
+	return &p
+}
+
 func (s *pool) Shutdown() {
 	s.p.Close()
 }
@@ -206,7 +564,7 @@ func (s *pool) Shutdown() {
 // Commands - Keys
 
 func (s *pool) Del(keys ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -216,7 +574,7 @@ func (s *pool) Del(keys ...string) (int, error) {
 }
 
 func (s *pool) Exists(key string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -226,7 +584,7 @@ func (s *pool) Exists(key string) (bool, error) {
 }
 
 func (s *pool) Expire(key string, seconds int) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -236,7 +594,7 @@ func (s *pool) Expire(key string, seconds int) (bool, error) {
 }
 
 func (s *pool) TTL(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -246,7 +604,7 @@ func (s *pool) TTL(key string) (int, error) {
 }
 
 func (s *pool) Rename(key, newKey string) error {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return err
 	}
@@ -256,7 +614,7 @@ func (s *pool) Rename(key, newKey string) error {
 }
 
 func (s *pool) RenameNX(key, newKey string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -268,7 +626,7 @@ func (s *pool) RenameNX(key, newKey string) (bool, error) {
 // Commands - Strings
 
 func (s *pool) Get(key string) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -278,7 +636,7 @@ func (s *pool) Get(key string) (string, error) {
 }
 
 func (s *pool) Set(key, value string) error {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return err
 	}
@@ -288,7 +646,7 @@ func (s *pool) Set(key, value string) error {
 }
 
 func (s *pool) SetEx(key, value string, expire int) error {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return err
 	}
@@ -298,7 +656,7 @@ func (s *pool) SetEx(key, value string, expire int) error {
 }
 
 func (s *pool) SetNX(key, value string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -308,7 +666,7 @@ func (s *pool) SetNX(key, value string) (bool, error) {
 }
 
 func (s *pool) Incr(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -320,7 +678,7 @@ func (s *pool) Incr(key string) (int, error) {
 // Commands - Hashes
 
 func (s *pool) HGet(key, field string) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -330,7 +688,7 @@ func (s *pool) HGet(key, field string) (string, error) {
 }
 
 func (s *pool) HGetAll(key string) (map[string]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -340,7 +698,7 @@ func (s *pool) HGetAll(key string) (map[string]string, error) {
 }
 
 func (s *pool) HIncrBy(key, field string, value int64) (int64, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -350,7 +708,7 @@ func (s *pool) HIncrBy(key, field string, value int64) (int64, error) {
 }
 
 func (s *pool) HSet(key string, field string, value string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -360,7 +718,7 @@ func (s *pool) HSet(key string, field string, value string) (bool, error) {
 }
 
 func (s *pool) HMGet(key string, fields ...string) (map[string]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -370,7 +728,7 @@ func (s *pool) HMGet(key string, fields ...string) (map[string]string, error) {
 }
 
 func (s *pool) HMSet(key string, args map[string]interface{}) error {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return err
 	}
@@ -380,7 +738,7 @@ func (s *pool) HMSet(key string, args map[string]interface{}) error {
 }
 
 func (s *pool) HDel(key string, field string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -392,7 +750,7 @@ func (s *pool) HDel(key string, field string) (bool, error) {
 // Commands - Lists
 
 func (s *pool) BLPop(timeout int, keys ...string) (string, string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", "", err
 	}
@@ -402,7 +760,7 @@ func (s *pool) BLPop(timeout int, keys ...string) (string, string, error) {
 }
 
 func (s *pool) BRPop(timeout int, keys ...string) (string, string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", "", err
 	}
@@ -412,7 +770,7 @@ func (s *pool) BRPop(timeout int, keys ...string) (string, string, error) {
 }
 
 func (s *pool) LIndex(key string, index int) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -422,7 +780,7 @@ func (s *pool) LIndex(key string, index int) (string, error) {
 }
 
 func (s *pool) LLen(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -432,7 +790,7 @@ func (s *pool) LLen(key string) (int, error) {
 }
 
 func (s *pool) LPop(key string) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -442,7 +800,7 @@ func (s *pool) LPop(key string) (string, error) {
 }
 
 func (s *pool) LPush(key string, values ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -452,7 +810,7 @@ func (s *pool) LPush(key string, values ...string) (int, error) {
 }
 
 func (s *pool) LTrim(key string, startIndex int, endIndex int) error {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return err
 	}
@@ -462,7 +820,7 @@ func (s *pool) LTrim(key string, startIndex int, endIndex int) error {
 }
 
 func (s *pool) LRange(key string, startIndex int, endIndex int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -472,7 +830,7 @@ func (s *pool) LRange(key string, startIndex int, endIndex int) ([]string, error
 }
 
 func (s *pool) LRem(key string, count int, value string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -482,7 +840,7 @@ func (s *pool) LRem(key string, count int, value string) (int, error) {
 }
 
 func (s *pool) RPop(key string) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -492,7 +850,7 @@ func (s *pool) RPop(key string) (string, error) {
 }
 
 func (s *pool) RPush(key string, values ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -504,7 +862,7 @@ func (s *pool) RPush(key string, values ...string) (int, error) {
 // Commands - Sets
 
 func (s *pool) SAdd(key string, member string, members ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -514,7 +872,7 @@ func (s *pool) SAdd(key string, member string, members ...string) (int, error) {
 }
 
 func (s *pool) SCard(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -524,7 +882,7 @@ func (s *pool) SCard(key string) (int, error) {
 }
 
 func (s *pool) SRem(key string, member string, members ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -534,7 +892,7 @@ func (s *pool) SRem(key string, member string, members ...string) (int, error) {
 }
 
 func (s *pool) SPop(key string) (string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return "", err
 	}
@@ -544,7 +902,7 @@ func (s *pool) SPop(key string) (string, error) {
 }
 
 func (s *pool) SMembers(key string) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -554,7 +912,7 @@ func (s *pool) SMembers(key string) ([]string, error) {
 }
 
 func (s *pool) SRandMember(key string, count int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -564,7 +922,7 @@ func (s *pool) SRandMember(key string, count int) ([]string, error) {
 }
 
 func (s *pool) SDiff(key string, keys ...string) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -574,7 +932,7 @@ func (s *pool) SDiff(key string, keys ...string) ([]string, error) {
 }
 
 func (s *pool) SIsMember(key string, member string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -584,7 +942,7 @@ func (s *pool) SIsMember(key string, member string) (bool, error) {
 }
 
 func (s *pool) SMove(source, destination, member string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -596,7 +954,7 @@ func (s *pool) SMove(source, destination, member string) (bool, error) {
 // Commands - Sorted sets
 
 func (s *pool) ZAdd(key string, args ...interface{}) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -606,7 +964,7 @@ func (s *pool) ZAdd(key string, args ...interface{}) (int, error) {
 }
 
 func (s *pool) ZCard(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -616,7 +974,7 @@ func (s *pool) ZCard(key string) (int, error) {
 }
 
 func (s *pool) ZRange(key string, start, stop int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -626,7 +984,7 @@ func (s *pool) ZRange(key string, start, stop int) ([]string, error) {
 }
 
 func (s *pool) ZRangeWithScores(key string, start, stop int) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -636,7 +994,7 @@ func (s *pool) ZRangeWithScores(key string, start, stop int) ([]Z, error) {
 }
 
 func (s *pool) ZRangeByScore(key, start, stop string) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -646,7 +1004,7 @@ func (s *pool) ZRangeByScore(key, start, stop string) ([]string, error) {
 }
 
 func (s *pool) ZRangeByScoreWithScores(key, start, stop string) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -656,7 +1014,7 @@ func (s *pool) ZRangeByScoreWithScores(key, start, stop string) ([]Z, error) {
 }
 
 func (s *pool) ZRangeByScoreWithLimit(key, start, stop string, offset, count int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -666,7 +1024,7 @@ func (s *pool) ZRangeByScoreWithLimit(key, start, stop string, offset, count int
 }
 
 func (s *pool) ZRangeByScoreWithScoresWithLimit(key, start, stop string, offset, count int) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -676,7 +1034,7 @@ func (s *pool) ZRangeByScoreWithScoresWithLimit(key, start, stop string, offset,
 }
 
 func (s *pool) ZRevRange(key string, start, stop int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -686,7 +1044,7 @@ func (s *pool) ZRevRange(key string, start, stop int) ([]string, error) {
 }
 
 func (s *pool) ZRevRangeWithScores(key string, start, stop int) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -696,7 +1054,7 @@ func (s *pool) ZRevRangeWithScores(key string, start, stop int) ([]Z, error) {
 }
 
 func (s *pool) ZRevRangeByScore(key, start, stop string) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -706,7 +1064,7 @@ func (s *pool) ZRevRangeByScore(key, start, stop string) ([]string, error) {
 }
 
 func (s *pool) ZRevRangeByScoreWithScores(key, start, stop string) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -716,7 +1074,7 @@ func (s *pool) ZRevRangeByScoreWithScores(key, start, stop string) ([]Z, error)
 }
 
 func (s *pool) ZRevRangeByScoreWithLimit(key, start, stop string, offset, count int) ([]string, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -726,7 +1084,7 @@ func (s *pool) ZRevRangeByScoreWithLimit(key, start, stop string, offset, count
 }
 
 func (s *pool) ZRevRangeByScoreWithScoresWithLimit(key, start, stop string, offset, count int) ([]Z, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return nil, err
 	}
@@ -736,7 +1094,7 @@ func (s *pool) ZRevRangeByScoreWithScoresWithLimit(key, start, stop string, offs
 }
 
 func (s *pool) ZRank(key, member string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -746,7 +1104,7 @@ func (s *pool) ZRank(key, member string) (int, error) {
 }
 
 func (s *pool) ZRem(key string, members ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -756,7 +1114,7 @@ func (s *pool) ZRem(key string, members ...string) (int, error) {
 }
 
 func (s *pool) ZRemRangeByRank(key string, start, stop int) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -770,7 +1128,7 @@ func (s *pool) ZScore(key string, member string) (score float64, err error) {
 		return 0, nil
 	}
 
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -780,7 +1138,7 @@ func (s *pool) ZScore(key string, member string) (score float64, err error) {
 }
 
 func (s *pool) ZIncrBy(key string, score float64, value string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -790,7 +1148,7 @@ func (s *pool) ZIncrBy(key string, score float64, value string) (int, error) {
 }
 
 func (s *pool) PFAdd(key string, values ...string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -800,7 +1158,7 @@ func (s *pool) PFAdd(key string, values ...string) (int, error) {
 }
 
 func (s *pool) PFCount(key string) (int, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, err
 	}
@@ -810,7 +1168,7 @@ func (s *pool) PFCount(key string) (int, error) {
 }
 
 func (s *pool) PFMerge(mergedKey string, keysToMerge ...string) (bool, error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return false, err
 	}
@@ -819,8 +1177,234 @@ func (s *pool) PFMerge(mergedKey string, keysToMerge ...string) (bool, error) {
 	return c.PFMerge(mergedKey, keysToMerge...)
 }
 
+// Commands - Pub/Sub
+
+func (s *pool) Publish(channel, message string) (int, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Return(c)
+
+	return c.Publish(channel, message)
+}
+
+// Commands - Streams
+
+func (s *pool) XAdd(key, id string, fields map[string]interface{}) (string, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return "", err
+	}
+	defer s.Return(c)
+
+	return c.XAdd(key, id, fields)
+}
+
+func (s *pool) XLen(key string) (int, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Return(c)
+
+	return c.XLen(key)
+}
+
+func (s *pool) XDel(key string, ids ...string) (int, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Return(c)
+
+	return c.XDel(key, ids...)
+}
+
+func (s *pool) XRange(key, start, end string, count int) ([]StreamEntry, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XRange(key, start, end, count)
+}
+
+func (s *pool) XTrim(key string, maxLen int, approximate bool) (int, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Return(c)
+
+	return c.XTrim(key, maxLen, approximate)
+}
+
+func (s *pool) XRead(streams map[string]string, count int, block time.Duration) ([]Stream, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XRead(streams, count, block)
+}
+
+func (s *pool) XReadGroup(group, consumer string, streams map[string]string, count int, block time.Duration) ([]Stream, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XReadGroup(group, consumer, streams, count, block)
+}
+
+func (s *pool) XGroupCreate(key, group, start string, mkStream bool) error {
+	c, err := s.commandConnection()
+	if err != nil {
+		return err
+	}
+	defer s.Return(c)
+
+	return c.XGroupCreate(key, group, start, mkStream)
+}
+
+func (s *pool) XGroupDestroy(key, group string) (bool, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return false, err
+	}
+	defer s.Return(c)
+
+	return c.XGroupDestroy(key, group)
+}
+
+func (s *pool) XAck(key, group string, ids ...string) (int, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Return(c)
+
+	return c.XAck(key, group, ids...)
+}
+
+func (s *pool) XPending(key, group string) (PendingSummary, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	defer s.Return(c)
+
+	return c.XPending(key, group)
+}
+
+func (s *pool) XPendingRange(key, group, start, end string, count int) ([]PendingEntry, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XPendingRange(key, group, start, end, count)
+}
+
+func (s *pool) XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XClaim(key, group, consumer, minIdle, ids...)
+}
+
+func (s *pool) XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int) (string, []StreamEntry, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return "", nil, err
+	}
+	defer s.Return(c)
+
+	return c.XAutoClaim(key, group, consumer, minIdle, start, count)
+}
+
+func (s *pool) XInfoStream(key string) (StreamInfo, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return StreamInfo{}, err
+	}
+	defer s.Return(c)
+
+	return c.XInfoStream(key)
+}
+
+func (s *pool) XInfoGroups(key string) ([]StreamGroupInfo, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XInfoGroups(key)
+}
+
+func (s *pool) XInfoConsumers(key, group string) ([]StreamConsumerInfo, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.XInfoConsumers(key, group)
+}
+
+// Commands - Scripting
+
+func (s *pool) Eval(script *Script, keys []string, args ...interface{}) (interface{}, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.Eval(script, keys, args...)
+}
+
+func (s *pool) ScriptLoad(scripts ...*Script) error {
+	c, err := s.commandConnection()
+	if err != nil {
+		return err
+	}
+	defer s.Return(c)
+
+	return c.ScriptLoad(scripts...)
+}
+
+func (s *pool) ScriptExists(scripts ...*Script) ([]bool, error) {
+	c, err := s.commandConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Return(c)
+
+	return c.ScriptExists(scripts...)
+}
+
+func (s *pool) ScriptFlush() error {
+	c, err := s.commandConnection()
+	if err != nil {
+		return err
+	}
+	defer s.Return(c)
+
+	return c.ScriptFlush()
+}
+
 func (s *pool) Scan(cursor int, match string, count int) (nextCursor int, matches []string, err error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, nil, err
 	}
@@ -830,7 +1414,7 @@ func (s *pool) Scan(cursor int, match string, count int) (nextCursor int, matche
 }
 
 func (s *pool) SScan(key string, cursor int, match string, count int) (nextCursor int, matches []string, err error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, nil, err
 	}
@@ -840,7 +1424,7 @@ func (s *pool) SScan(key string, cursor int, match string, count int) (nextCurso
 }
 
 func (s *pool) ZScan(key string, cursor int, match string, count int) (nextCursor int, matches []string, scores []float64, err error) {
-	c, err := s.GetConnection()
+	c, err := s.commandConnection()
 	if err != nil {
 		return 0, nil, nil, err
 	}
@@ -1,21 +1,27 @@
 package redis_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
 )
 
 func TestPool(t *testing.T) {
-	redisURL := "redis://:foopass@localhost:6379/10"
-	p, err := redis.NewPool(redisURL, redis.DefaultConfig)
-	if err != nil {
-		t.Fatalf("failed to create pool: %v", err)
-	}
+	// Using an arbitrary password should fallback to using no password
+	l := redistest.LeaseDB(t, "redis://:foopass@localhost:6379", redis.DefaultConfig)
+	p, redisURL := l.Pool, l.URL
 
 	flushDB := func() {
-		p.Do(func(c redis.Connection) { c.Do("FLUSHDB") })
+		if err := l.Flush(); err != nil {
+			t.Fatalf("failed to flush: %v", err)
+		}
 	}
 
 	t.Run("NewPool", func(t *testing.T) {
@@ -92,989 +98,527 @@ func TestPool(t *testing.T) {
 		})
 	})
 
-	t.Run("PFAdd", func(t *testing.T) {
-		t.Run("should indicate HyperLogLog register was altered", func(t *testing.T) {
-			flushDB()
-			i, err := p.PFAdd("_tests:jimmy:redis:foo1", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if i != 1 {
-				t.Errorf("got %d, want 1", i)
-			}
-		})
-
-		t.Run("should indicate HyperLogLog register was not altered", func(t *testing.T) {
+	t.Run("conformance", func(t *testing.T) {
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
 			flushDB()
-			_, err := p.PFAdd("_tests:jimmy:redis:foo2", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			i, err := p.PFAdd("_tests:jimmy:redis:foo2", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if i != 0 {
-				t.Errorf("got %d, want 0", i)
-			}
-		})
-	})
-
-	t.Run("PFCount", func(t *testing.T) {
-		t.Run("should return approximate cardinality", func(t *testing.T) {
-			flushDB()
-			var actualCardinality float64 = 20000
-			for i := 0; float64(i) < actualCardinality; i++ {
-				_, err := p.PFAdd("_tests:jimmy:redis:foo3", fmt.Sprint(i))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
-			}
-			card, err := p.PFCount("_tests:jimmy:redis:foo3")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if float64(card) >= actualCardinality*1.2 {
-				t.Errorf("cardinality %d too high (max %v)", card, actualCardinality*1.2)
-			}
-			if float64(card) <= actualCardinality*0.8 {
-				t.Errorf("cardinality %d too low (min %v)", card, actualCardinality*0.8)
-			}
+			return p
 		})
 	})
 
-	t.Run("PFMerge", func(t *testing.T) {
-		t.Run("should return approximate cardinality of union", func(t *testing.T) {
+	t.Run("WithContext", func(t *testing.T) {
+		t.Run("canceled context fails to get a connection", func(t *testing.T) {
 			flushDB()
-			setA := []int{1, 2, 3, 4, 5}
-			setB := []int{3, 4, 5, 6, 7}
-			setC := []int{8, 9, 10, 11, 12}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
 
-			for _, x := range setA {
-				_, err := p.PFAdd("_tests:jimmy:redis:hll1", fmt.Sprint(x))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
-			}
-			for _, x := range setB {
-				_, err := p.PFAdd("_tests:jimmy:redis:hll2", fmt.Sprint(x))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
+			c, err := p.GetConnectionContext(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want %v", err, context.Canceled)
 			}
-			for _, x := range setC {
-				_, err := p.PFAdd("_tests:jimmy:redis:hll3", fmt.Sprint(x))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
+			if c != nil {
+				t.Error("expected nil connection")
 			}
 
-			for i := 1; i < 4; i++ {
-				card, err := p.PFCount(fmt.Sprintf("_tests:jimmy:redis:hll%d", i))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
-				if card != 5 {
-					t.Errorf("hll%d: got %d, want 5", i, card)
-				}
-			}
-
-			ok, err := p.PFMerge("_tests:jimmy:redis:hll1+2", "_tests:jimmy:redis:hll1", "_tests:jimmy:redis:hll2")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if !ok {
-				t.Error("expected true, got false")
-			}
-
-			card, err := p.PFCount("_tests:jimmy:redis:hll1+2")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if card != 7 {
-				t.Errorf("got %d, want 7", card)
-			}
-
-			ok, err = p.PFMerge("_tests:jimmy:redis:hll1+3", "_tests:jimmy:redis:hll1", "_tests:jimmy:redis:hll3")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if !ok {
-				t.Error("expected true, got false")
-			}
-
-			card, err = p.PFCount("_tests:jimmy:redis:hll1+3")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if card != 10 {
-				t.Errorf("got %d, want 10", card)
-			}
-
-			ok, err = p.PFMerge("_tests:jimmy:redis:hll1+2+3", "_tests:jimmy:redis:hll1", "_tests:jimmy:redis:hll2", "_tests:jimmy:redis:hll3")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if !ok {
-				t.Error("expected true, got false")
-			}
-
-			card, err = p.PFCount("_tests:jimmy:redis:hll1+2+3")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if card != 12 {
-				t.Errorf("got %d, want 12", card)
+			_, err = p.WithContext(ctx).Get("foo")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got %v, want %v", err, context.Canceled)
 			}
 		})
-	})
-
-	t.Run("LTrim", func(t *testing.T) {
-		t.Run("when a list is trimmed", func(t *testing.T) {
-			flushDB()
-			key := "_tests:jimmy:redis:list"
 
-			for i := range 5 {
-				p.LPush(key, fmt.Sprint(i))
-			}
-
-			size, err := p.LLen(key)
+		t.Run("deadline bounds waiting on an exhausted pool", func(t *testing.T) {
+			config := redis.DefaultConfig
+			config.MaxOpenConnections = 1
+			p, err := redis.NewPool(redisURL, config)
 			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if size != 5 {
-				t.Errorf("got %d, want 5", size)
+				t.Fatalf("failed to create pool: %v", err)
 			}
+			defer p.Shutdown()
 
-			// Trim nothing
-			err = p.LTrim(key, 0, 4)
+			held, err := p.GetConnection()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
+			defer p.Return(held)
 
-			size, err = p.LLen(key)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if size != 5 {
-				t.Errorf("got %d, want 5", size)
-			}
-
-			// Trim first element
-			err = p.LTrim(key, 1, 5)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			size, err = p.LLen(key)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if size != 4 {
-				t.Errorf("got %d, want 4", size)
-			}
-
-			item, err := p.LPop(key)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if item != "3" {
-				t.Errorf("got %q, want %q", item, "3")
-			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
 
-			// Trim last element
-			err = p.LTrim(key, -4, -1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			size, err = p.LLen(key)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if size != 3 {
-				t.Errorf("got %d, want 3", size)
-			}
-
-			item, err = p.LPop(key)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if item != "2" {
-				t.Errorf("got %q, want %q", item, "2")
+			_, err = p.GetConnectionContext(ctx)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
 			}
 		})
 
-		t.Run("when a not-list is trimmed returns error", func(t *testing.T) {
+		t.Run("deadline bounds a blocking command", func(t *testing.T) {
 			flushDB()
-			key := "_tests:jimmy:redis:not-list"
-
-			if err := p.Set(key, "yay"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if err := p.LTrim(key, 0, 4); err == nil {
-				t.Error("expected error, got nil")
-			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
 
-			p.Del(key)
-			_, err := p.SAdd(key, "yay")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if err := p.LTrim(key, 0, 4); err == nil {
-				t.Error("expected error, got nil")
+			_, _, err := p.WithContext(ctx).BRPop(0, "_tests:jimmy:redis:empty")
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
 			}
 		})
-	})
 
-	t.Run("LRange", func(t *testing.T) {
-		t.Run("empty list returns nothing", func(t *testing.T) {
+		t.Run("live context runs transactions", func(t *testing.T) {
 			flushDB()
-			key := "_tests:jimmy:redis:list"
-			things, err := p.LRange(key, 0, -1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(things) != 0 {
-				t.Errorf("expected empty, got %v", things)
-			}
-		})
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
 
-		t.Run("list returns items", func(t *testing.T) {
-			flushDB()
-			key := "_tests:jimmy:redis:list"
-			for i := range 5 {
-				_, err := p.LPush(key, fmt.Sprint(i))
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
-				}
-			}
-
-			things, err := p.LRange(key, 0, -1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(things) != 5 {
-				t.Errorf("got len %d, want 5", len(things))
-			}
-
-			things, err = p.LRange(key, 0, 0)
+			replies, err := p.WithContext(ctx).Transaction(func(tx redis.Transaction) {
+				tx.Set("foo", "bar")
+				tx.Incr("counter")
+			})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(things) != 1 {
-				t.Errorf("got len %d, want 1", len(things))
-			}
-			if things[0] != "4" {
-				t.Errorf("got %q, want %q", things[0], "4")
+			if len(replies) != 2 {
+				t.Fatalf("got len %d, want 2", len(replies))
 			}
 
-			things, err = p.LRange(key, -1, -1)
+			val, err := p.Get("foo")
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(things) != 1 {
-				t.Errorf("got len %d, want 1", len(things))
-			}
-			if things[0] != "0" {
-				t.Errorf("got %q, want %q", things[0], "0")
+			if val != "bar" {
+				t.Errorf("got %q, want %q", val, "bar")
 			}
 		})
 	})
 
-	t.Run("SMove", func(t *testing.T) {
-		t.Run("should move member to other set", func(t *testing.T) {
-			flushDB()
-			key := "_tests:jimmy:redis:smove"
-
-			p.SAdd(key+":a", "foobar")
+	t.Run("PubSub", func(t *testing.T) {
+		receive := func(t *testing.T, ps redis.PubSub) redis.Message {
+			t.Helper()
+			select {
+			case m := <-ps.Messages():
+				return m
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for message")
+				return redis.Message{}
+			}
+		}
 
-			moved, err := p.SMove(key+":a", key+":b", "foobar")
+		t.Run("should deliver published messages", func(t *testing.T) {
+			ps, err := p.PubSub()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if !moved {
-				t.Error("expected true, got false")
-			}
-
-			members, _ := p.SMembers(key + ":a")
-			if len(members) != 0 {
-				t.Errorf("got len %d, want 0", len(members))
-			}
-
-			members, _ = p.SMembers(key + ":b")
-			if len(members) != 1 || members[0] != "foobar" {
-				t.Errorf("got %v, want [foobar]", members)
-			}
-		})
-	})
-
-	t.Run("SScan", func(t *testing.T) {
-		t.Run("should scan the set", func(t *testing.T) {
-			flushDB()
-			key := "_tests:jimmy:redis:sscan"
-
-			p.SAdd(key, "a", "b", "c", "d", "e")
-
-			var scanned []string
-			var cursor int
-			var matches []string
-			var err error
+			defer ps.Close()
 
-			cursor, matches, err = p.SScan(key, cursor, "", 1)
-			if err != nil {
+			if err := ps.Subscribe("_tests:jimmy:redis:news"); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			scanned = append(scanned, matches...)
-			for cursor != 0 {
-				cursor, matches, err = p.SScan(key, cursor, "", 1)
-				if err != nil {
-					t.Fatalf("unexpected error: %v", err)
+			// Wait for the subscription to take effect.
+			for i := 0; i < 100; i++ {
+				if n, _ := p.Publish("_tests:jimmy:redis:news", "hello"); n == 1 {
+					break
 				}
-				scanned = append(scanned, matches...)
+				time.Sleep(10 * time.Millisecond)
 			}
 
-			if len(scanned) != 5 {
-				t.Errorf("got len %d, want 5", len(scanned))
+			m := receive(t, ps)
+			if m.Channel != "_tests:jimmy:redis:news" {
+				t.Errorf("got %q, want %q", m.Channel, "_tests:jimmy:redis:news")
 			}
-			for _, want := range []string{"a", "b", "c", "d", "e"} {
-				if !containsString(scanned, want) {
-					t.Errorf("expected %q in %v", want, scanned)
-				}
+			if m.Data != "hello" {
+				t.Errorf("got %q, want %q", m.Data, "hello")
 			}
 		})
-	})
 
-	t.Run("HGet", func(t *testing.T) {
-		t.Run("key exists with field returns value", func(t *testing.T) {
-			flushDB()
-			if _, err := p.HSet("foo", "bar", "baz"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			val, err := p.HGet("foo", "bar")
+		t.Run("should deliver messages matching patterns", func(t *testing.T) {
+			ps, err := p.PubSub()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if val != "baz" {
-				t.Errorf("got %q, want %q", val, "baz")
-			}
-		})
+			defer ps.Close()
 
-		t.Run("key exists without field returns error", func(t *testing.T) {
-			flushDB()
-			if _, err := p.HSet("foo", "blah", "blech"); err != nil {
+			if err := ps.PSubscribe("_tests:jimmy:redis:*"); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			val, err := p.HGet("foo", "bar")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if val != "" {
-				t.Errorf("got %q, want empty string", val)
-			}
-		})
-
-		t.Run("key does not exist returns error", func(t *testing.T) {
-			flushDB()
-			val, err := p.HGet("foo", "bar")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if val != "" {
-				t.Errorf("got %q, want empty string", val)
+			for i := 0; i < 100; i++ {
+				if n, _ := p.Publish("_tests:jimmy:redis:weather", "rain"); n == 1 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
 			}
-		})
 
-		t.Run("key exists but not hash returns error", func(t *testing.T) {
-			flushDB()
-			if err := p.Set("foo", "yo"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			m := receive(t, ps)
+			if m.Pattern != "_tests:jimmy:redis:*" {
+				t.Errorf("got %q, want %q", m.Pattern, "_tests:jimmy:redis:*")
 			}
-			val, err := p.HGet("foo", "bar")
-			if err == nil {
-				t.Error("expected error, got nil")
+			if m.Channel != "_tests:jimmy:redis:weather" {
+				t.Errorf("got %q, want %q", m.Channel, "_tests:jimmy:redis:weather")
 			}
-			if val != "" {
-				t.Errorf("got %q, want empty string", val)
+			if m.Data != "rain" {
+				t.Errorf("got %q, want %q", m.Data, "rain")
 			}
 		})
-	})
 
-	t.Run("HGetAll", func(t *testing.T) {
-		t.Run("key exists with 2 pairs returns pairs", func(t *testing.T) {
-			flushDB()
-			in := map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err := p.HMSet("foo", in)
+		t.Run("should track subscriptions", func(t *testing.T) {
+			ps, err := p.PubSub()
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
-			vals, err := p.HGetAll("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(vals) != 2 {
-				t.Errorf("got len %d, want 2", len(vals))
-			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
+			ps.Subscribe("b", "a")
+			ps.PSubscribe("c*")
+			ps.Unsubscribe("b")
+			if channels := ps.Channels(); len(channels) != 1 || channels[0] != "a" {
+				t.Errorf("got %v, want [a]", channels)
 			}
-			if vals["blah"] != "blech" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "blech")
+			if patterns := ps.Patterns(); len(patterns) != 1 || patterns[0] != "c*" {
+				t.Errorf("got %v, want [c*]", patterns)
 			}
-		})
 
-		t.Run("key does not exist returns empty map", func(t *testing.T) {
-			flushDB()
-			vals, err := p.HGetAll("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			ps.PUnsubscribe()
+			if patterns := ps.Patterns(); len(patterns) != 0 {
+				t.Errorf("got %v, want []", patterns)
 			}
-			if len(vals) != 0 {
-				t.Errorf("got len %d, want 0", len(vals))
-			}
-		})
-	})
 
-	t.Run("HSet", func(t *testing.T) {
-		t.Run("new key returns true", func(t *testing.T) {
-			flushDB()
-			isNew, err := p.HSet("foo", "bar", "baz")
-			if err != nil {
+			if err := ps.Close(); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if !isNew {
-				t.Error("expected true, got false")
-			}
-
-			val, err := p.HGet("foo", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			if _, ok := <-ps.Messages(); ok {
+				t.Error("expected messages channel to be closed")
 			}
-			if val != "baz" {
-				t.Errorf("got %q, want %q", val, "baz")
+			if err := ps.Subscribe("a"); err != redis.ErrPubSubClosed {
+				t.Errorf("got %v, want %v", err, redis.ErrPubSubClosed)
 			}
 		})
+	})
 
-		t.Run("existing key new field returns true", func(t *testing.T) {
-			flushDB()
-			if _, err := p.HSet("foo", "bar", "baz"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			isNew, err := p.HSet("foo", "yo", "oy")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if !isNew {
-				t.Error("expected true, got false")
-			}
-
-			val, err := p.HGet("foo", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if val != "baz" {
-				t.Errorf("got %q, want %q", val, "baz")
-			}
-
-			val, err = p.HGet("foo", "yo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if val != "oy" {
-				t.Errorf("got %q, want %q", val, "oy")
+	t.Run("CheckAndSet", func(t *testing.T) {
+		increment := func(counter *int) func(redis.Connection) error {
+			return func(c redis.Connection) error {
+				val, err := c.Get("counter")
+				if err != nil && err != redis.ErrNil {
+					return err
+				}
+				fmt.Sscan(val, counter)
+				return nil
 			}
-		})
+		}
 
-		t.Run("existing key existing field returns false", func(t *testing.T) {
+		t.Run("should run the write phase with what was read", func(t *testing.T) {
 			flushDB()
-			if _, err := p.HSet("foo", "bar", "baz"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			isNew, err := p.HSet("foo", "bar", "yo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if isNew {
-				t.Error("expected false, got true")
-			}
+			p.Set("counter", "41")
 
-			val, err := p.HGet("foo", "bar")
+			var counter int
+			replies, err := p.CheckAndSet([]string{"counter"}, 0, increment(&counter), func(tx redis.Transaction) {
+				tx.Set("counter", fmt.Sprint(counter+1))
+			})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if val != "yo" {
-				t.Errorf("got %q, want %q", val, "yo")
+			if len(replies) != 1 {
+				t.Errorf("got len %d, want 1", len(replies))
 			}
-		})
 
-		t.Run("existing key not hash returns error", func(t *testing.T) {
-			flushDB()
-			if err := p.Set("foo", "bar"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			isNew, err := p.HSet("foo", "bar", "yo")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if isNew {
-				t.Error("expected false, got true")
-			}
-
-			val, err := p.HGet("foo", "bar")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if val != "" {
-				t.Errorf("got %q, want empty string", val)
-			}
-
-			val, err = p.Get("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if val != "bar" {
-				t.Errorf("got %q, want %q", val, "bar")
+			val, _ := p.Get("counter")
+			if val != "42" {
+				t.Errorf("got %q, want %q", val, "42")
 			}
 		})
-	})
 
-	t.Run("HMGet", func(t *testing.T) {
-		t.Run("key exists with 2 specified keys", func(t *testing.T) {
+		t.Run("should retry when a watched key is modified", func(t *testing.T) {
 			flushDB()
-			in := map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err := p.HMSet("foo", in)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			vals, err := p.HMGet("foo", "bar", "blah")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(vals) != 2 {
-				t.Errorf("got len %d, want 2", len(vals))
-			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
-			}
-			if vals["blah"] != "blech" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "blech")
-			}
-		})
+			p.Set("counter", "1")
 
-		t.Run("key exists with 2 of 3 specified keys", func(t *testing.T) {
-			flushDB()
-			in := map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err := p.HMSet("foo", in)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			var counter, attempts int
+			read := func(c redis.Connection) error {
+				attempts++
+				if attempts == 1 {
+					p.Set("counter", "10")
+				}
+				return increment(&counter)(c)
 			}
-
-			vals, err := p.HMGet("foo", "bar", "yo", "blah")
+			_, err := p.CheckAndSet([]string{"counter"}, 1, read, func(tx redis.Transaction) {
+				tx.Set("counter", fmt.Sprint(counter+1))
+			})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(vals) != 3 {
-				t.Errorf("got len %d, want 3", len(vals))
+			if attempts != 2 {
+				t.Errorf("got %d attempts, want 2", attempts)
 			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
-			}
-			if vals["yo"] != "" {
-				t.Errorf("yo: got %q, want empty string", vals["yo"])
-			}
-			if vals["blah"] != "blech" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "blech")
+
+			val, _ := p.Get("counter")
+			if val != "11" {
+				t.Errorf("got %q, want %q", val, "11")
 			}
 		})
 
-		t.Run("key does not exist", func(t *testing.T) {
+		t.Run("should give up after retries", func(t *testing.T) {
 			flushDB()
-			vals, err := p.HMGet("foo", "bar", "blah")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
+			var attempts int
+			read := func(c redis.Connection) error {
+				attempts++
+				p.Incr("counter")
+				return nil
 			}
-			if len(vals) != 2 {
-				t.Errorf("got len %d, want 2", len(vals))
-			}
-			if vals["bar"] != "" {
-				t.Errorf("bar: got %q, want empty string", vals["bar"])
+			_, err := p.CheckAndSet([]string{"counter"}, 2, read, func(tx redis.Transaction) {
+				tx.Set("counter", "0")
+			})
+			if err != redis.ErrTxAborted {
+				t.Errorf("got %v, want %v", err, redis.ErrTxAborted)
 			}
-			if vals["blah"] != "" {
-				t.Errorf("blah: got %q, want empty string", vals["blah"])
+			if attempts != 3 {
+				t.Errorf("got %d attempts, want 3", attempts)
 			}
 		})
 
-		t.Run("no fields returns error", func(t *testing.T) {
+		t.Run("should return read errors", func(t *testing.T) {
 			flushDB()
-			vals, err := p.HMGet("foo")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if len(vals) != 0 {
-				t.Errorf("got len %d, want 0", len(vals))
+			readErr := errors.New("The cheese is old and moldy, where is the bathroom?")
+			_, err := p.CheckAndSet([]string{"counter"}, 2, func(redis.Connection) error {
+				return readErr
+			}, func(tx redis.Transaction) {
+				t.Error("write phase should not run")
+			})
+			if err != readErr {
+				t.Errorf("got %v, want %v", err, readErr)
 			}
 		})
 	})
 
-	t.Run("HMSet", func(t *testing.T) {
-		t.Run("new key with 2 string pairs", func(t *testing.T) {
-			flushDB()
-			in := map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err := p.HMSet("foo", in)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
+	t.Run("Scripts", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"scripts/getset.lua": {Data: []byte(`local old = redis.call("GET", KEYS[1]); redis.call("SET", KEYS[1], ARGV[1]); return old`)},
+			"scripts/del.lua":    {Data: []byte(`return redis.call("DEL", KEYS[1])`)},
+			"scripts/README.md":  {Data: []byte("Not a script")},
+		}
 
-			vals, err := p.HGetAll("foo")
+		t.Run("should parse scripts from a filesystem", func(t *testing.T) {
+			scripts, err := redis.ParseScripts(fsys, "scripts/*.lua")
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(vals) != 2 {
-				t.Errorf("got len %d, want 2", len(vals))
-			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
+			if len(scripts) != 2 || scripts["getset"] == nil || scripts["del"] == nil {
+				t.Fatalf("got %v, want del and getset scripts", scripts)
 			}
-			if vals["blah"] != "blech" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "blech")
+			if list := scripts.List(); len(list) != 2 || list[0] != scripts["del"] || list[1] != scripts["getset"] {
+				t.Errorf("got %v, want the scripts sorted by name", list)
 			}
 		})
 
-		t.Run("new key with 2 int pairs", func(t *testing.T) {
+		t.Run("should load scripts at pool creation", func(t *testing.T) {
 			flushDB()
-			in := map[string]interface{}{"bar": 18, "blah": 42}
-			err := p.HMSet("foo", in)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
+			p.ScriptFlush()
 
-			vals, err := p.HGetAll("foo")
+			scripts, _ := redis.ParseScripts(fsys, "scripts/*.lua")
+			config := redis.DefaultConfig
+			config.Scripts = scripts.List()
+			p, err := redis.NewPool(redisURL, config)
 			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(vals) != 2 {
-				t.Errorf("got len %d, want 2", len(vals))
+				t.Fatalf("failed to create pool: %v", err)
 			}
-			if vals["bar"] != "18" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "18")
-			}
-			if vals["blah"] != "42" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "42")
-			}
-		})
+			defer p.Shutdown()
 
-		t.Run("existing key with 3 pairs update 2", func(t *testing.T) {
-			flushDB()
-			in := map[string]interface{}{"bar": 18, "blah": 42, "yo": "oy"}
-			err := p.HMSet("foo", in)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			in = map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err = p.HMSet("foo", in)
+			exists, err := p.ScriptExists(scripts["del"], scripts["getset"])
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-
-			vals, err := p.HGetAll("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(vals) != 3 {
-				t.Errorf("got len %d, want 3", len(vals))
-			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
-			}
-			if vals["blah"] != "blech" {
-				t.Errorf("blah: got %q, want %q", vals["blah"], "blech")
-			}
-			if vals["yo"] != "oy" {
-				t.Errorf("yo: got %q, want %q", vals["yo"], "oy")
-			}
-		})
-
-		t.Run("existing key not hash returns error", func(t *testing.T) {
-			flushDB()
-			if err := p.Set("foo", "bar"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-
-			in := map[string]interface{}{"bar": "baz", "blah": "blech"}
-			err := p.HMSet("foo", in)
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-
-			val, err := p.HGet("foo", "bar")
-			if err == nil {
-				t.Error("expected error, got nil")
-			}
-			if val != "" {
-				t.Errorf("got %q, want empty string", val)
-			}
-
-			val, err = p.Get("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if val != "bar" {
-				t.Errorf("got %q, want %q", val, "bar")
-			}
-		})
-
-		t.Run("existing key empty map returns error", func(t *testing.T) {
-			flushDB()
-			if _, err := p.HSet("foo", "bar", "baz"); err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			in := map[string]interface{}{}
-			err := p.HMSet("foo", in)
-			if err == nil {
-				t.Error("expected error, got nil")
+			if len(exists) != 2 || !exists[0] || !exists[1] {
+				t.Errorf("got %v, want [true true]", exists)
 			}
 
-			vals, err := p.HGetAll("foo")
+			p.Set("foo", "bar")
+			old, err := redis.String(p.Eval(scripts["getset"], []string{"foo"}, "baz"))
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(vals) != 1 {
-				t.Errorf("got len %d, want 1", len(vals))
-			}
-			if vals["bar"] != "baz" {
-				t.Errorf("bar: got %q, want %q", vals["bar"], "baz")
+			if old != "bar" {
+				t.Errorf("got %q, want %q", old, "bar")
 			}
 		})
 
-		t.Run("new key empty map returns error", func(t *testing.T) {
-			flushDB()
-			in := map[string]interface{}{}
-			err := p.HMSet("foo", in)
+		t.Run("should fail pool creation with an invalid script", func(t *testing.T) {
+			config := redis.DefaultConfig
+			config.Scripts = []*redis.Script{redis.NewScript("this is not lua")}
+			p, err := redis.NewPool(redisURL, config)
 			if err == nil {
 				t.Error("expected error, got nil")
 			}
-
-			exists, err := p.Exists("foo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if exists {
-				t.Error("expected false, got true")
+			if p != nil {
+				t.Error("expected nil pool")
 			}
 		})
 	})
 
-	t.Run("ZAdd", func(t *testing.T) {
-		t.Run("happy path", func(t *testing.T) {
-			flushDB()
-			added, err := p.ZAdd("foo", 0.123, "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if added != 1 {
-				t.Errorf("got %d, want 1", added)
-			}
-		})
-	})
+	t.Run("StreamWorker", func(t *testing.T) {
+		key := "_tests:jimmy:redis:stream"
+
+		run := func(config redis.StreamWorkerConfig, handler redis.StreamHandler) (stop func()) {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				redis.NewStreamWorker(p, config, handler).Run(ctx)
+			}()
+			return func() {
+				cancel()
+				<-done
+			}
+		}
+
+		t.Run("should handle and acknowledge entries", func(t *testing.T) {
+			flushDB()
+			handled := make(chan redis.StreamEntry, 10)
+			stop := run(redis.StreamWorkerConfig{
+				Stream: key, Group: "workers", Consumer: "alice", Block: 50 * time.Millisecond,
+			}, func(ctx context.Context, entry redis.StreamEntry) error {
+				handled <- entry
+				return nil
+			})
+			defer stop()
 
-	t.Run("ZRank", func(t *testing.T) {
-		t.Run("key exists returns rank", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			rank, err := p.ZRank("foo", "bar")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if rank != 0 {
-				t.Errorf("got %d, want 0", rank)
+			// The group may not exist yet, so the entry is added until it is delivered.
+			select {
+			case entry := <-handled:
+				t.Fatalf("unexpected entry %v", entry)
+			case <-time.After(100 * time.Millisecond):
 			}
-			rank, err = p.ZRank("foo", "barfu")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if rank != 1 {
-				t.Errorf("got %d, want 1", rank)
-			}
-		})
-	})
+			p.XAdd(key, "*", map[string]interface{}{"job": "1"})
 
-	t.Run("ZRemRangeByRank", func(t *testing.T) {
-		t.Run("removes members with lower or equal rank", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			rank, err := p.ZRank("foo", "barfu")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if rank != 1 {
-				t.Errorf("got %d, want 1", rank)
-			}
-			total, err := p.ZRemRangeByRank("foo", 0, 1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if total != 2 {
-				t.Errorf("got %d, want 2", total)
-			}
-			rank, err = p.ZRank("foo", "barfoo")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if rank != 0 {
-				t.Errorf("got %d, want 0", rank)
+			select {
+			case entry := <-handled:
+				if entry.Fields["job"] != "1" {
+					t.Errorf("got %v, want job 1", entry)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for entry")
 			}
-		})
-	})
 
-	t.Run("ZRange", func(t *testing.T) {
-		t.Run("returns elements by range", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRange("foo", 1, 2)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 2 {
-				t.Fatalf("got len %d, want 2", len(values))
-			}
-			if values[0] != "barfu" {
-				t.Errorf("got %q, want %q", values[0], "barfu")
-			}
-			if values[1] != "barfoo" {
-				t.Errorf("got %q, want %q", values[1], "barfoo")
+			for i := 0; i < 100; i++ {
+				if summary, _ := p.XPending(key, "workers"); summary.Count == 0 {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
 			}
+			t.Error("entry was not acknowledged")
 		})
-	})
 
-	t.Run("ZRangeWithScores", func(t *testing.T) {
-		t.Run("returns elements with scores", func(t *testing.T) {
+		t.Run("should claim entries abandoned by dead consumers", func(t *testing.T) {
 			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRangeWithScores("foo", 1, 2)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 2 {
-				t.Fatalf("got len %d, want 2", len(values))
-			}
-			if values[0].Value != "barfu" {
-				t.Errorf("got %q, want %q", values[0].Value, "barfu")
-			}
-			if values[0].Score != 0.127 {
-				t.Errorf("got %v, want %v", values[0].Score, 0.127)
-			}
-			if values[1].Value != "barfoo" {
-				t.Errorf("got %q, want %q", values[1].Value, "barfoo")
-			}
-			if values[1].Score != 0.132 {
-				t.Errorf("got %v, want %v", values[1].Score, 0.132)
-			}
-		})
-	})
+			p.XGroupCreate(key, "workers", "0", true)
+			p.XAdd(key, "1-0", map[string]interface{}{"job": "abandoned"})
+			// A consumer reads the entry, then dies without acknowledging it.
+			p.XReadGroup("workers", "dead", map[string]string{key: ">"}, 0, redis.NoBlock)
 
-	t.Run("ZRangeByScore", func(t *testing.T) {
-		t.Run("returns elements by score range", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRangeByScore("foo", "(0.123", "0.132")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 2 {
-				t.Fatalf("got len %d, want 2", len(values))
-			}
-			if values[0] != "barfu" {
-				t.Errorf("got %q, want %q", values[0], "barfu")
-			}
-			if values[1] != "barfoo" {
-				t.Errorf("got %q, want %q", values[1], "barfoo")
-			}
-		})
-	})
+			handled := make(chan redis.StreamEntry, 10)
+			stop := run(redis.StreamWorkerConfig{
+				Stream: key, Group: "workers", Consumer: "alice",
+				Block: 50 * time.Millisecond, ClaimMinIdle: 50 * time.Millisecond,
+			}, func(ctx context.Context, entry redis.StreamEntry) error {
+				handled <- entry
+				return nil
+			})
+			defer stop()
 
-	t.Run("ZRangeByScoreWithScores", func(t *testing.T) {
-		t.Run("returns elements with scores by range", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRangeByScoreWithScores("foo", "(0.123", "0.132")
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 2 {
-				t.Fatalf("got len %d, want 2", len(values))
-			}
-			if values[0].Value != "barfu" {
-				t.Errorf("got %q, want %q", values[0].Value, "barfu")
-			}
-			if values[0].Score != 0.127 {
-				t.Errorf("got %v, want %v", values[0].Score, 0.127)
-			}
-			if values[1].Value != "barfoo" {
-				t.Errorf("got %q, want %q", values[1].Value, "barfoo")
-			}
-			if values[1].Score != 0.132 {
-				t.Errorf("got %v, want %v", values[1].Score, 0.132)
-			}
-		})
-	})
+			select {
+			case entry := <-handled:
+				if entry.ID != "1-0" {
+					t.Errorf("got %v, want entry 1-0", entry)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for entry")
+			}
+		})
+
+		t.Run("should read entries when claiming fails", func(t *testing.T) {
+			// As on Redis older than 6.2, which has no XAUTOCLAIM.
+			s, err := redistest.NewServer(redistest.ServerOptions{})
+			if err != nil {
+				t.Fatalf("failed to start server: %v", err)
+			}
+			defer s.Close()
+			s.Inject(redistest.Failure{Command: "XAUTOCLAIM", Error: "ERR unknown command 'XAUTOCLAIM'"})
+			p, err := redis.NewPool(s.URL(), redis.DefaultConfig)
+			if err != nil {
+				t.Fatalf("failed to create pool: %v", err)
+			}
+			defer p.Shutdown()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			handled := make(chan redis.StreamEntry, 10)
+			claimErrs := make(chan error, 100)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				redis.NewStreamWorker(p, redis.StreamWorkerConfig{
+					Stream: key, Group: "workers", Consumer: "alice",
+					Block: 50 * time.Millisecond, ClaimMinIdle: 50 * time.Millisecond,
+					OnError: func(err error) {
+						select {
+						case claimErrs <- err:
+						default:
+						}
+					},
+				}, func(ctx context.Context, entry redis.StreamEntry) error {
+					handled <- entry
+					return nil
+				}).Run(ctx)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			p.XGroupCreate(key, "workers", "0", true)
+			p.XAdd(key, "*", map[string]interface{}{"job": "1"})
+			select {
+			case entry := <-handled:
+				if entry.Fields["job"] != "1" {
+					t.Errorf("got %v, want job 1", entry)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for entry")
+			}
+			if err := <-claimErrs; err == nil {
+				t.Error("expected the claim error to be reported")
+			}
+		})
+
+		t.Run("should retry entries the handler failed", func(t *testing.T) {
+			flushDB()
+			var attempts int
+			handled := make(chan redis.StreamEntry, 10)
+			var errs []error
+			var errsMu sync.Mutex
+			stop := run(redis.StreamWorkerConfig{
+				Stream: key, Group: "workers", Consumer: "alice",
+				Block: 50 * time.Millisecond, ClaimMinIdle: 50 * time.Millisecond,
+				OnError: func(err error) {
+					errsMu.Lock()
+					defer errsMu.Unlock()
+					errs = append(errs, err)
+				},
+			}, func(ctx context.Context, entry redis.StreamEntry) error {
+				attempts++
+				if attempts == 1 {
+					return errors.New("The cheese is old and moldy, where is the bathroom?")
+				}
+				handled <- entry
+				return nil
+			})
+			defer stop()
 
-	t.Run("ZRangeByScoreWithLimit", func(t *testing.T) {
-		t.Run("returns limited elements", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRangeByScoreWithLimit("foo", "(0.123", "0.132", 1, 1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 1 {
-				t.Fatalf("got len %d, want 1", len(values))
-			}
-			if values[0] != "barfoo" {
-				t.Errorf("got %q, want %q", values[0], "barfoo")
-			}
-		})
-	})
+			time.Sleep(100 * time.Millisecond)
+			p.XAdd(key, "*", map[string]interface{}{"job": "flaky"})
 
-	t.Run("ZRangeByScoreWithScoresWithLimit", func(t *testing.T) {
-		t.Run("returns limited elements with scores", func(t *testing.T) {
-			flushDB()
-			p.ZAdd("foo", 0.123, "bar")
-			p.ZAdd("foo", 0.127, "barfu")
-			p.ZAdd("foo", 0.132, "barfoo")
-			p.ZAdd("foo", 0.133, "barfubar")
-			values, err := p.ZRangeByScoreWithScoresWithLimit("foo", "(0.123", "0.132", 1, 1)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if len(values) != 1 {
-				t.Fatalf("got len %d, want 1", len(values))
-			}
-			if values[0].Value != "barfoo" {
-				t.Errorf("got %q, want %q", values[0].Value, "barfoo")
+			select {
+			case entry := <-handled:
+				if entry.Fields["job"] != "flaky" {
+					t.Errorf("got %v, want job flaky", entry)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("timed out waiting for entry")
 			}
-			if values[0].Score != 0.132 {
-				t.Errorf("got %v, want %v", values[0].Score, 0.132)
+
+			errsMu.Lock()
+			defer errsMu.Unlock()
+			if len(errs) != 1 {
+				t.Errorf("got %d errors, want 1", len(errs))
 			}
 		})
 	})
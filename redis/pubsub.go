@@ -0,0 +1,265 @@
+package redis
+
+import (
+	"errors"
+	netURL "net/url"
+	"sort"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis/redisurl"
+)
+
+var (
+	// ErrPubSubClosed is returned when subscribing or unsubscribing after a PubSub is closed.
+	ErrPubSubClosed = errors.New("redis: pubsub is closed")
+
+	// How often an idle subscriber pings the server. A connection which receives nothing, not
+	// even the reply to a ping, for twice this long is considered dropped.
+	pubSubPingInterval = 30 * time.Second
+
+	// Bounds of the delay between attempts to reconnect a dropped subscriber.
+	pubSubMinReconnectDelay = 100 * time.Millisecond
+	pubSubMaxReconnectDelay = 5 * time.Second
+)
+
+// NewPubSub dials a dedicated connection for a PubSub. Subscribers can't share connections with
+// other commands, so this is independent of any pool.
+func NewPubSub(url *netURL.URL) (PubSub, error) {
+	return newPubSub(url, redisurl.Options{})
+}
+
+func newPubSub(url *netURL.URL, options redisurl.Options) (PubSub, error) {
+	c, err := generateConnection(url, options)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &pubSub{
+		url:      url,
+		options:  options,
+		conn:     redigo.PubSubConn{Conn: c},
+		channels: map[string]bool{},
+		patterns: map[string]bool{},
+		messages: make(chan Message),
+		done:     make(chan struct{}),
+	}
+
+	go s.receive()
+	go s.ping()
+
+	return s, nil
+}
+
+type pubSub struct {
+	url     *netURL.URL
+	options redisurl.Options
+
+	// mu guards the fields below, and serializes writes to conn. Only the receive goroutine
+	// reads from conn, so reads need no locking.
+	mu       sync.Mutex
+	conn     redigo.PubSubConn
+	channels map[string]bool
+	patterns map[string]bool
+	closed   bool
+
+	messages chan Message
+	done     chan struct{}
+}
+
+// Subscribe records the channels even if the server can't be reached, so they are subscribed to
+// once the connection is re-established.
+func (s *pubSub) Subscribe(channels ...string) error {
+	return s.update(func() error {
+		for _, channel := range channels {
+			s.channels[channel] = true
+		}
+		return s.conn.Subscribe(redigo.Args{}.AddFlat(channels)...)
+	})
+}
+
+// PSubscribe records the patterns even if the server can't be reached, so they are subscribed to
+// once the connection is re-established.
+func (s *pubSub) PSubscribe(patterns ...string) error {
+	return s.update(func() error {
+		for _, pattern := range patterns {
+			s.patterns[pattern] = true
+		}
+		return s.conn.PSubscribe(redigo.Args{}.AddFlat(patterns)...)
+	})
+}
+
+func (s *pubSub) Unsubscribe(channels ...string) error {
+	return s.update(func() error {
+		if len(channels) == 0 {
+			s.channels = map[string]bool{}
+		}
+		for _, channel := range channels {
+			delete(s.channels, channel)
+		}
+		return s.conn.Unsubscribe(redigo.Args{}.AddFlat(channels)...)
+	})
+}
+
+func (s *pubSub) PUnsubscribe(patterns ...string) error {
+	return s.update(func() error {
+		if len(patterns) == 0 {
+			s.patterns = map[string]bool{}
+		}
+		for _, pattern := range patterns {
+			delete(s.patterns, pattern)
+		}
+		return s.conn.PUnsubscribe(redigo.Args{}.AddFlat(patterns)...)
+	})
+}
+
+func (s *pubSub) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.channels)
+}
+
+func (s *pubSub) Patterns() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.patterns)
+}
+
+func (s *pubSub) Messages() <-chan Message {
+	return s.messages
+}
+
+func (s *pubSub) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	return s.conn.Close()
+}
+
+func (s *pubSub) update(f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrPubSubClosed
+	}
+	return f()
+}
+
+// receive delivers messages until the PubSub is closed, reconnecting whenever the connection drops.
+func (s *pubSub) receive() {
+	defer close(s.messages)
+
+	for {
+		switch v := s.conn.ReceiveWithTimeout(2 * pubSubPingInterval).(type) {
+		case redigo.Message:
+			m := Message{Channel: v.Channel, Pattern: v.Pattern, Data: string(v.Data)}
+			select {
+			case s.messages <- m:
+			case <-s.done:
+				return
+			}
+		case error:
+			// Error replies, and the reply to a ping sent while not subscribed to anything,
+			// leave the connection usable.
+			if s.conn.Conn.Err() == nil {
+				continue
+			}
+			if !s.reconnect() {
+				return
+			}
+		}
+	}
+}
+
+// reconnect replaces a dropped connection, retrying with backoff, and re-subscribes to every
+// channel and pattern. It returns false if the PubSub was closed in the meantime.
+func (s *pubSub) reconnect() bool {
+	delay := pubSubMinReconnectDelay
+	for {
+		select {
+		case <-s.done:
+			return false
+		default:
+		}
+
+		if s.resubscribe() {
+			return true
+		}
+
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > pubSubMaxReconnectDelay {
+			delay = pubSubMaxReconnectDelay
+		}
+	}
+}
+
+func (s *pubSub) resubscribe() bool {
+	c, err := generateConnection(s.url, s.options)
+	if err != nil {
+		return false
+	}
+	conn := redigo.PubSubConn{Conn: c}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		conn.Close()
+		return true
+	}
+
+	if len(s.channels) > 0 {
+		err = conn.Subscribe(redigo.Args{}.AddFlat(sortedKeys(s.channels))...)
+	}
+	if err == nil && len(s.patterns) > 0 {
+		err = conn.PSubscribe(redigo.Args{}.AddFlat(sortedKeys(s.patterns))...)
+	}
+	if err != nil {
+		conn.Close()
+		return false
+	}
+
+	s.conn.Close()
+	s.conn = conn
+	return true
+}
+
+// ping keeps an idle connection sending replies, so receive can tell when it has dropped.
+func (s *pubSub) ping() {
+	ticker := time.NewTicker(pubSubPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.conn.Ping("")
+			s.mu.Unlock()
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
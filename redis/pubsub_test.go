@@ -0,0 +1,52 @@
+package redis
+
+import (
+	netURL "net/url"
+	"testing"
+	"time"
+)
+
+func TestPubSubReconnect(t *testing.T) {
+	url, _ := netURL.Parse("redis://localhost:6379")
+	ps, err := NewPubSub(url)
+	if err != nil {
+		t.Fatalf("failed to create pubsub: %v", err)
+	}
+	defer ps.Close()
+
+	conn, err := NewConnection(url)
+	if err != nil {
+		t.Fatalf("failed to create connection: %v", err)
+	}
+	defer conn.Close()
+
+	// Publishing is retried until the message is received, as the subscription may not be in
+	// place yet, so a message can arrive more than once.
+	publish := func(channel, data string) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			conn.Publish(channel, data)
+			select {
+			case m := <-ps.Messages():
+				if m.Data == data {
+					return
+				}
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+		t.Fatalf("timed out waiting for %q", data)
+	}
+
+	ps.Subscribe("_tests:jimmy:redis:channel")
+	ps.PSubscribe("_tests:jimmy:redis:pattern:*")
+	publish("_tests:jimmy:redis:channel", "before")
+
+	// Drop the connection out from under the subscriber.
+	s := ps.(*pubSub)
+	s.mu.Lock()
+	s.conn.Conn.Close()
+	s.mu.Unlock()
+
+	publish("_tests:jimmy:redis:channel", "after")
+	publish("_tests:jimmy:redis:pattern:1", "pattern")
+}
@@ -0,0 +1,401 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Commands which only read, and so can be sent to a replica.
+var readOnlyCommands = map[string]bool{
+	"DBSIZE":           true,
+	"EXISTS":           true,
+	"GET":              true,
+	"GETRANGE":         true,
+	"HEXISTS":          true,
+	"HGET":             true,
+	"HGETALL":          true,
+	"HKEYS":            true,
+	"HLEN":             true,
+	"HMGET":            true,
+	"HSCAN":            true,
+	"HSTRLEN":          true,
+	"HVALS":            true,
+	"KEYS":             true,
+	"LINDEX":           true,
+	"LLEN":             true,
+	"LRANGE":           true,
+	"MGET":             true,
+	"PFCOUNT":          true,
+	"PTTL":             true,
+	"RANDOMKEY":        true,
+	"SCAN":             true,
+	"SCARD":            true,
+	"SDIFF":            true,
+	"SINTER":           true,
+	"SISMEMBER":        true,
+	"SMEMBERS":         true,
+	"SRANDMEMBER":      true,
+	"SSCAN":            true,
+	"STRLEN":           true,
+	"SUNION":           true,
+	"TTL":              true,
+	"TYPE":             true,
+	"XINFO":            true,
+	"XLEN":             true,
+	"XPENDING":         true,
+	"XRANGE":           true,
+	"XREAD":            true,
+	"XREVRANGE":        true,
+	"ZCARD":            true,
+	"ZCOUNT":           true,
+	"ZRANGE":           true,
+	"ZRANGEBYSCORE":    true,
+	"ZRANK":            true,
+	"ZREVRANGE":        true,
+	"ZREVRANGEBYSCORE": true,
+	"ZREVRANK":         true,
+	"ZSCAN":            true,
+	"ZSCORE":           true,
+}
+
+// ReadWritePool is a Pool which sends commands that only read to replicas, and all other commands
+// to the primary. Transactions, and commands sent while keys are watched, always go to the
+// primary. Each connection taken from the pool reads from a single replica, picked by its
+// ReplicaSelector, until it sends a command which isn't a read: its reads then go to the primary
+// too, so that they see its writes.
+//
+// Replicas lag behind the primary, so a read may not see a write made just before it on another
+// connection, or by a method of the pool. Reads which must see them can be sent to the primary
+// with Primary.
+type ReadWritePool interface {
+	Pool
+
+	// Primary returns the pool of the primary, to read from when reads must see earlier writes.
+	Primary() Pool
+}
+
+// NewReadWritePool returns a ReadWritePool which writes to primary and reads from replicas, picked
+// by selector. The pools must have been created by this package, e.g. by NewPool, or be the
+// primary and replicas of a SentinelPool. If there are no replicas, or a replica can't be
+// connected to, reads go to the primary. Shutting the ReadWritePool down shuts down its pools.
+func NewReadWritePool(primary Pool, replicas []Pool, selector ReplicaSelector) (ReadWritePool, error) {
+	rw := &readWrite{selector: selector, outstanding: make([]atomic.Int64, len(replicas))}
+
+	base, ok := primary.(basePool)
+	if !ok {
+		return nil, errors.New("redis: read/write pool needs pools created by this package")
+	}
+	rw.primary = base.base()
+	for _, replica := range replicas {
+		base, ok := replica.(basePool)
+		if !ok {
+			return nil, errors.New("redis: read/write pool needs pools created by this package")
+		}
+		rw.replicas = append(rw.replicas, base.base())
+	}
+
+	// The primary's password is the one sent if a connection is asked to authenticate again, as
+	// that's where writes go. Its hooks wrap the commands of the ReadWritePool too.
+	p := &pool{p: rw, url: rw.primary.url, username: rw.primary.username, password: rw.primary.password, options: rw.primary.options, hooks: rw.primary.hooks, retry: rw.primary.retry}
+	return &readWritePool{pool: p, primary: primary}, nil
+}
+
+// ReplicaSelector picks the replica each connection taken from a ReadWritePool reads from.
+type ReplicaSelector interface {
+	// Select returns the index of the replica to read from, given the number of connections
+	// currently reading from each. It's called concurrently.
+	Select(outstanding []int) int
+}
+
+// NewRoundRobinSelector returns a ReplicaSelector which picks each replica in turn.
+func NewRoundRobinSelector() ReplicaSelector {
+	return &roundRobinSelector{}
+}
+
+// NewLeastOutstandingSelector returns a ReplicaSelector which picks the replica with the fewest
+// connections reading from it, taking turns between those tied.
+func NewLeastOutstandingSelector() ReplicaSelector {
+	return &leastOutstandingSelector{}
+}
+
+// NewRandomSelector returns a ReplicaSelector which picks replicas at random.
+func NewRandomSelector() ReplicaSelector {
+	return randomSelector{}
+}
+
+type roundRobinSelector struct {
+	next atomic.Uint64
+}
+
+func (s *roundRobinSelector) Select(outstanding []int) int {
+	return int((s.next.Add(1) - 1) % uint64(len(outstanding)))
+}
+
+type leastOutstandingSelector struct {
+	next atomic.Uint64
+}
+
+func (s *leastOutstandingSelector) Select(outstanding []int) int {
+	start := int((s.next.Add(1) - 1) % uint64(len(outstanding)))
+
+	least := start
+	for i := range outstanding {
+		j := (start + i) % len(outstanding)
+		if outstanding[j] < outstanding[least] {
+			least = j
+		}
+	}
+	return least
+}
+
+type randomSelector struct{}
+
+func (randomSelector) Select(outstanding []int) int {
+	return rand.Intn(len(outstanding))
+}
+
+type readWritePool struct {
+	*pool
+
+	primary Pool
+}
+
+func (s *readWritePool) WithContext(ctx context.Context) Pool {
+	p := *s
+	p.pool = s.pool.WithContext(ctx).(*pool)
+	return &p
+}
+
+func (s *readWritePool) Primary() Pool {
+	return s.primary
+}
+
+// readWrite is the connSource of a ReadWritePool.
+type readWrite struct {
+	primary  *pool
+	replicas []*pool
+	selector ReplicaSelector
+	// The number of connections reading from each replica.
+	outstanding []atomic.Int64
+}
+
+func (rw *readWrite) Get() redigo.Conn {
+	return &readWriteConn{rw: rw, replica: -1}
+}
+
+func (rw *readWrite) GetContext(ctx context.Context) (redigo.Conn, error) {
+	return &readWriteConn{rw: rw, ctx: ctx, replica: -1}, nil
+}
+
+func (rw *readWrite) stats() PoolStats {
+	stats := rw.primary.Stats()
+	for _, replica := range rw.replicas {
+		stats = stats.add(replica.Stats())
+	}
+	return stats
+}
+
+func (rw *readWrite) Close() error {
+	rw.primary.Shutdown()
+	for _, replica := range rw.replicas {
+		replica.Shutdown()
+	}
+	return nil
+}
+
+// readWriteConn is a redigo.Conn which sends commands that only read to a connection to a
+// replica, and other commands to one to the primary, taking each when it's first needed. Its
+// replies are received as a routedConn's are.
+type readWriteConn struct {
+	rw *readWrite
+	// Bounds waiting on the pools, when it is not nil.
+	ctx context.Context
+
+	primaryConn redigo.Conn
+	replicaConn redigo.Conn
+	// The index of the replica replicaConn is to, or -1.
+	replica int
+
+	// The connection the reply to each command sent will be received from, in order.
+	sent []redigo.Conn
+
+	// Whether a transaction is being sent, keys are watched, or a command which isn't a read has
+	// been sent, so commands go to the primary.
+	multi    bool
+	watching bool
+	wrote    bool
+}
+
+func (c *readWriteConn) Close() error {
+	var err error
+	if c.primaryConn != nil {
+		err = c.primaryConn.Close()
+		c.primaryConn = nil
+	}
+	if c.replicaConn != nil {
+		if replicaErr := c.replicaConn.Close(); err == nil {
+			err = replicaErr
+		}
+		c.rw.outstanding[c.replica].Add(-1)
+		c.replicaConn, c.replica = nil, -1
+	}
+	c.sent = nil
+	c.multi, c.watching, c.wrote = false, false, false
+	return err
+}
+
+func (c *readWriteConn) Err() error {
+	if c.primaryConn != nil {
+		if err := c.primaryConn.Err(); err != nil {
+			return err
+		}
+	}
+	if c.replicaConn != nil {
+		return c.replicaConn.Err()
+	}
+	return nil
+}
+
+func (c *readWriteConn) Do(command string, args ...interface{}) (interface{}, error) {
+	return c.DoContext(nil, command, args...)
+}
+
+func (c *readWriteConn) DoContext(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	if command == "" || len(c.sent) > 0 {
+		return c.doPending(ctx, command, args...)
+	}
+
+	conn, err := c.conn(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return do(ctx, conn, command, args...)
+}
+
+func (c *readWriteConn) doPending(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	if command != "" {
+		if err := c.send(ctx, command, args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+
+	var replies []interface{}
+	var firstErr error
+	for len(c.sent) > 0 {
+		reply, err := c.ReceiveContext(ctx)
+		if _, ok := err.(redigo.Error); err != nil && !ok {
+			c.sent = nil
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		replies = append(replies, reply)
+	}
+
+	if command == "" {
+		return replies, nil
+	}
+	return replies[len(replies)-1], firstErr
+}
+
+func (c *readWriteConn) Send(command string, args ...interface{}) error {
+	return c.send(c.ctx, command, args...)
+}
+
+func (c *readWriteConn) send(ctx context.Context, command string, args ...interface{}) error {
+	conn, err := c.conn(ctx, command)
+	if err != nil {
+		return err
+	}
+	if err := conn.Send(command, args...); err != nil {
+		return err
+	}
+	c.sent = append(c.sent, conn)
+	return nil
+}
+
+func (c *readWriteConn) Flush() error {
+	if c.primaryConn != nil {
+		if err := c.primaryConn.Flush(); err != nil {
+			return err
+		}
+	}
+	if c.replicaConn != nil {
+		return c.replicaConn.Flush()
+	}
+	return nil
+}
+
+func (c *readWriteConn) Receive() (interface{}, error) {
+	return c.ReceiveContext(nil)
+}
+
+func (c *readWriteConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if len(c.sent) == 0 {
+		return nil, errors.New("redis: no replies pending on read/write connection")
+	}
+
+	conn := c.sent[0]
+	c.sent = c.sent[1:]
+	return receive(ctx, conn)
+}
+
+// conn returns the connection a command is sent on, taking it from its pool if needed.
+func (c *readWriteConn) conn(ctx context.Context, command string) (redigo.Conn, error) {
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	name := strings.ToUpper(command)
+	read := readOnlyCommands[name] && !c.multi && !c.watching && !c.wrote
+	if !readOnlyCommands[name] {
+		c.wrote = true
+	}
+
+	switch name {
+	case "MULTI":
+		c.multi = true
+	case "WATCH":
+		c.watching = true
+	case "EXEC", "DISCARD":
+		c.multi, c.watching = false, false
+	case "UNWATCH":
+		c.watching = false
+	}
+
+	if read && len(c.rw.replicas) > 0 {
+		if c.replicaConn != nil {
+			return c.replicaConn, nil
+		}
+
+		outstanding := make([]int, len(c.rw.outstanding))
+		for i := range c.rw.outstanding {
+			outstanding[i] = int(c.rw.outstanding[i].Load())
+		}
+		replica := c.rw.selector.Select(outstanding)
+
+		if conn, err := c.rw.replicas[replica].get(ctx); err == nil {
+			c.rw.outstanding[replica].Add(1)
+			c.replicaConn, c.replica = conn, replica
+			return conn, nil
+		}
+	}
+
+	if c.primaryConn == nil {
+		conn, err := c.rw.primary.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.primaryConn = conn
+	}
+	return c.primaryConn, nil
+}
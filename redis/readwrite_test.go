@@ -0,0 +1,199 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestReplicaSelectors(t *testing.T) {
+	t.Run("round-robin picks each replica in turn", func(t *testing.T) {
+		s := redis.NewRoundRobinSelector()
+		for i := 0; i < 6; i++ {
+			if got := s.Select([]int{5, 0, 0}); got != i%3 {
+				t.Errorf("expected %d but got %d", i%3, got)
+			}
+		}
+	})
+
+	t.Run("least-outstanding picks the least busy replica, taking turns between ties", func(t *testing.T) {
+		s := redis.NewLeastOutstandingSelector()
+		for i := 0; i < 4; i++ {
+			if got := s.Select([]int{3, 1, 2}); got != 1 {
+				t.Errorf("expected 1 but got %d", got)
+			}
+		}
+
+		picked := map[int]bool{}
+		for i := 0; i < 4; i++ {
+			picked[s.Select([]int{1, 0, 0})] = true
+		}
+		if len(picked) != 2 || picked[0] {
+			t.Errorf("expected replicas 1 and 2 to be picked but got %v", picked)
+		}
+	})
+
+	t.Run("random picks replicas in range", func(t *testing.T) {
+		s := redis.NewRandomSelector()
+		for i := 0; i < 20; i++ {
+			if got := s.Select([]int{0, 0}); got < 0 || got > 1 {
+				t.Errorf("expected 0 or 1 but got %d", got)
+			}
+		}
+	})
+}
+
+func TestReadWritePool(t *testing.T) {
+	// The "replicas" are other databases of the same server, so reads from them can be told apart
+	// from reads from the primary.
+	newPool := func(url string) redis.Pool {
+		p, err := redis.NewPool(url, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		return p
+	}
+	primary := newPool("redis://localhost:6379/10")
+	replicas := []redis.Pool{newPool("redis://localhost:6379/11"), newPool("redis://localhost:6379/12")}
+
+	p, err := redis.NewReadWritePool(primary, replicas, redis.NewLeastOutstandingSelector())
+	if err != nil {
+		t.Fatalf("failed to create read/write pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	key := "_tests:jimmy:redis:readwrite"
+	reset := func() {
+		for _, p := range append([]redis.Pool{primary}, replicas...) {
+			p.Do(func(c redis.Connection) { c.Do("FLUSHDB") })
+		}
+		replicas[0].Set(key, "replica")
+		replicas[1].Set(key, "replica")
+	}
+
+	t.Run("writes to the primary and reads from replicas", func(t *testing.T) {
+		reset()
+		if err := p.Set(key, "primary"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := primary.Get(key); v != "primary" {
+			t.Errorf("expected primary to have been written but got %q", v)
+		}
+		if v, _ := p.Get(key); v != "replica" {
+			t.Errorf("expected read from replica but got %q", v)
+		}
+	})
+
+	t.Run("Primary reads from the primary", func(t *testing.T) {
+		reset()
+		p.Set(key, "primary")
+		if v, _ := p.Primary().Get(key); v != "primary" {
+			t.Errorf("expected read from primary but got %q", v)
+		}
+	})
+
+	t.Run("is a ReadWritePool bound to a context", func(t *testing.T) {
+		reset()
+		p.Set(key, "primary")
+		rw, ok := p.WithContext(context.Background()).(redis.ReadWritePool)
+		if !ok {
+			t.Fatal("expected a ReadWritePool")
+		}
+		if v, _ := rw.Primary().Get(key); v != "primary" {
+			t.Errorf("expected read from primary but got %q", v)
+		}
+	})
+
+	t.Run("splits pipelines and merges their replies in order", func(t *testing.T) {
+		reset()
+		var set *redis.StatusFuture
+		var get *redis.StringFuture
+		var ttl *redis.IntFuture
+		_, err := p.Pipelined(func(p redis.Pipeline) {
+			get = p.Get(key)
+			set = p.Set(key, "primary")
+			ttl = p.TTL(key)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if set.Err() != nil || get.Val() != "replica" || ttl.Val() != -1 {
+			t.Errorf("unexpected replies: %v, %q, %d", set.Err(), get.Val(), ttl.Val())
+		}
+	})
+
+	t.Run("reads from the primary once a connection has written", func(t *testing.T) {
+		reset()
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := c.Get(key); v != "replica" {
+			t.Errorf("expected read from replica but got %q", v)
+		}
+		c.Set(key, "primary")
+		if v, _ := c.Get(key); v != "primary" {
+			t.Errorf("expected read from primary but got %q", v)
+		}
+		c.Release()
+
+		if v, _ := p.Get(key); v != "replica" {
+			t.Errorf("expected a connection taken afresh to read from replica but got %q", v)
+		}
+	})
+
+	t.Run("runs transactions on the primary", func(t *testing.T) {
+		reset()
+		p.Set(key, "primary")
+		replies, err := p.Transaction(func(t redis.Transaction) {
+			t.Get(key)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := redis.String(replies[0], nil); v != "primary" {
+			t.Errorf("expected read from primary but got %q", v)
+		}
+	})
+
+	t.Run("reads watched keys from the primary", func(t *testing.T) {
+		reset()
+		p.Set(key, "primary")
+		var read string
+		_, err := p.CheckAndSet([]string{key}, 0, func(c redis.Connection) error {
+			var err error
+			read, err = c.Get(key)
+			return err
+		}, func(t redis.Transaction) {
+			t.Set(key, read+"!")
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := primary.Get(key); v != "primary!" {
+			t.Errorf("expected primary! but got %q", v)
+		}
+	})
+
+	t.Run("spreads reads over the least busy replicas", func(t *testing.T) {
+		reset()
+		replicas[1].Set(key, "replica 1")
+
+		// Each connection keeps reading from the replica it first read from.
+		var reads []string
+		for i := 0; i < 2; i++ {
+			c, err := p.GetConnection()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer c.Release()
+
+			v, _ := c.Get(key)
+			reads = append(reads, v)
+		}
+		if reads[0] == reads[1] {
+			t.Errorf("expected reads from both replicas but got %q", reads)
+		}
+	})
+}
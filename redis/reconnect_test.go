@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	netURL "net/url"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+func TestReconnect(t *testing.T) {
+	t.Run("doesn't return the reply of a failed attempt once it can't reconnect", func(t *testing.T) {
+		source := &dialOnceSource{}
+		p := &pool{p: source, url: &netURL.URL{Scheme: "redis", Host: "fake"}, retry: RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}}
+
+		c, err := p.commandConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+
+		if reply, err := c.Do("GET", "key"); reply != nil || err == nil {
+			t.Errorf("expected no reply and an error but got %v, %v", reply, err)
+		}
+		if source.taken != 3 {
+			t.Errorf("expected a connection to be taken for each attempt but got %d", source.taken)
+		}
+	})
+}
+
+// dialOnceSource is a connSource which dials a single connection, failing to dial any after it, as
+// when the server has gone away. The connection replies to commands with a reply and LOADING, as
+// if it failed after replying.
+type dialOnceSource struct {
+	taken int
+}
+
+func (s *dialOnceSource) Get() redigo.Conn {
+	c, err := s.GetContext(context.Background())
+	if err != nil {
+		return &loadingConn{err: err}
+	}
+	return c
+}
+
+func (s *dialOnceSource) GetContext(ctx context.Context) (redigo.Conn, error) {
+	s.taken++
+	if s.taken > 1 {
+		return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	}
+	return &loadingConn{}, nil
+}
+
+func (s *dialOnceSource) Close() error {
+	return nil
+}
+
+type loadingConn struct {
+	err error
+}
+
+func (c *loadingConn) Close() error { return nil }
+func (c *loadingConn) Err() error   { return c.err }
+func (c *loadingConn) Flush() error { return c.err }
+
+func (c *loadingConn) Do(command string, args ...interface{}) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return "stale", redigo.Error("LOADING Redis is loading the dataset in memory")
+}
+
+func (c *loadingConn) Send(command string, args ...interface{}) error {
+	return errors.New("redis: loadingConn doesn't send")
+}
+
+func (c *loadingConn) Receive() (interface{}, error) {
+	return nil, errors.New("redis: loadingConn doesn't receive")
+}
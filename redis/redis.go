@@ -1,15 +1,25 @@
 package redis
 
 import (
+	"errors"
+	"time"
+
 	redigo "github.com/gomodule/redigo/redis"
 )
 
 var (
 	ErrNil = redigo.ErrNil
 
-	redigoErrNoAuth    = redigo.Error("NOAUTH Authentication required.")
-	redigoErrSentAuth  = redigo.Error("ERR Client sent AUTH, but no password is set")
-	redigoErrSentAuth2 = redigo.Error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	// ErrTxAborted is returned by Exec and Transaction when EXEC returns nil because a key
+	// watched with Watch was modified, so none of the commands in the transaction were executed.
+	ErrTxAborted = errors.New("redis: transaction aborted because a watched key was modified")
+
+	// How servers reply to AUTH when they have no password set, in the words of Redis 5 and older,
+	// and of Redis 6 and newer, whose default user has none.
+	noPasswordErrors = []string{
+		"ERR Client sent AUTH, but no password is set",
+		"ERR AUTH <password> called without any password configured",
+	}
 )
 
 type Z struct {
@@ -27,9 +37,12 @@ type Commands interface {
 	SortedSetCommands
 	HyperLogLogCommands
 	ScanCommands
+	PubSubCommands
+	ScriptingCommands
+	StreamCommands
 }
 
-// Commands with no results, to be used in transactions/pipelining.
+// Commands with results delivered as Futures, to be used in transactions/pipelining.
 type BatchCommands interface {
 	KeyBatchCommands
 	StringBatchCommands
@@ -38,14 +51,20 @@ type BatchCommands interface {
 	SetBatchCommands
 	SortedSetBatchCommands
 	HyperLogLogBatchCommands
+	PubSubBatchCommands
+	ScriptingBatchCommands
+	StreamBatchCommands
 }
 
 type Transactions interface {
 	Multi() error
+
+	// Exec returns ErrTxAborted if the transaction was not executed because a watched key changed.
 	Exec() ([]interface{}, error)
-	// Discard() error
-	// Watch(keys ...string) error
-	// Unwatch() error
+
+	Discard() error
+	Watch(keys ...string) error
+	Unwatch() error
 }
 
 // Keys - http://redis.io/commands#generic
@@ -59,12 +78,12 @@ type KeyCommands interface {
 }
 
 type KeyBatchCommands interface {
-	Del(keys ...string) error
-	Exists(key string) error
-	Expire(key string, seconds int) error
-	Rename(key, newKey string) error
-	RenameNX(key, newKey string) error
-	TTL(key string) error
+	Del(keys ...string) *IntFuture
+	Exists(key string) *BoolFuture
+	Expire(key string, seconds int) *BoolFuture
+	Rename(key, newKey string) *StatusFuture
+	RenameNX(key, newKey string) *BoolFuture
+	TTL(key string) *IntFuture
 }
 
 // Strings - http://redis.io/commands#string
@@ -77,11 +96,11 @@ type StringCommands interface {
 }
 
 type StringBatchCommands interface {
-	Get(key string) error
-	Set(key, value string) error
-	SetEx(key, value string, expire int) error
-	SetNX(key, value string) error
-	Incr(key string) error
+	Get(key string) *StringFuture
+	Set(key, value string) *StatusFuture
+	SetEx(key, value string, expire int) *StatusFuture
+	SetNX(key, value string) *BoolFuture
+	Incr(key string) *IntFuture
 }
 
 // Hashes - http://redis.io/commands#hash
@@ -107,13 +126,13 @@ type HashCommands interface {
 }
 
 type HashBatchCommands interface {
-	HGet(key string, field string) error
-	HGetAll(key string) error
-	HIncrBy(key string, field string, value int64) error
-	HSet(key string, field string, value string) error
-	HMGet(key string, fields ...string) error
-	HMSet(key string, args map[string]interface{}) error
-	HDel(key string, field string) error
+	HGet(key string, field string) *StringFuture
+	HGetAll(key string) *StringMapFuture
+	HIncrBy(key string, field string, value int64) *Int64Future
+	HSet(key string, field string, value string) *BoolFuture
+	HMGet(key string, fields ...string) *StringMapFuture
+	HMSet(key string, args map[string]interface{}) *StatusFuture
+	HDel(key string, field string) *BoolFuture
 }
 
 // Lists - http://redis.io/commands#list
@@ -132,12 +151,12 @@ type ListCommands interface {
 }
 
 type ListBatchCommands interface {
-	LPop(key string) error
-	LPush(key string, values ...string) error
-	LTrim(key string, startIndex int, endIndex int) error
-	LRange(key string, startIndex int, endIndex int) error
-	RPop(key string) error
-	RPush(key string, values ...string) error
+	LPop(key string) *StringFuture
+	LPush(key string, values ...string) *IntFuture
+	LTrim(key string, startIndex int, endIndex int) *StatusFuture
+	LRange(key string, startIndex int, endIndex int) *StringsFuture
+	RPop(key string) *StringFuture
+	RPush(key string, values ...string) *IntFuture
 }
 
 // Sets - http://redis.io/commands#set
@@ -154,13 +173,13 @@ type SetCommands interface {
 }
 
 type SetBatchCommands interface {
-	SAdd(key string, member string, members ...string) error
-	SRem(key string, member string, members ...string) error
-	SPop(key string) error
-	SMembers(key string) error
-	SRandMember(key string, count int) error
-	SDiff(key string, keys ...string) error
-	SMove(source, destination, member string) error
+	SAdd(key string, member string, members ...string) *IntFuture
+	SRem(key string, member string, members ...string) *IntFuture
+	SPop(key string) *StringFuture
+	SMembers(key string) *StringsFuture
+	SRandMember(key string, count int) *StringsFuture
+	SDiff(key string, keys ...string) *StringsFuture
+	SMove(source, destination, member string) *BoolFuture
 }
 
 // Sorted Sets - http://redis.io/commands#sorted_set
@@ -187,25 +206,25 @@ type SortedSetCommands interface {
 }
 
 type SortedSetBatchCommands interface {
-	ZAdd(key string, args ...interface{}) error
-	ZCard(key string) error
-	ZRange(key string, start, stop int) error
-	ZRangeWithScores(key string, start, stop int) error
-	ZRangeByScore(key, min, max string) error
-	ZRangeByScoreWithScores(key, min, max string) error
-	ZRangeByScoreWithLimit(key, min, max string, offset, count int) error
-	ZRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) error
-	ZRevRange(key string, start, stop int) error
-	ZRevRangeWithScores(key string, start, stop int) error
-	ZRevRangeByScore(key, min, max string) error
-	ZRevRangeByScoreWithScores(key, min, max string) error
-	ZRevRangeByScoreWithLimit(key, min, max string, offset, count int) error
-	ZRevRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) error
-	ZRank(key, member string) error
-	ZRem(key string, members ...string) error
-	ZRemRangeByRank(key string, start, stop int) error
-	ZScore(key string, member string) error
-	ZIncrBy(key string, score float64, value string) error
+	ZAdd(key string, args ...interface{}) *IntFuture
+	ZCard(key string) *IntFuture
+	ZRange(key string, start, stop int) *StringsFuture
+	ZRangeWithScores(key string, start, stop int) *ZFuture
+	ZRangeByScore(key, min, max string) *StringsFuture
+	ZRangeByScoreWithScores(key, min, max string) *ZFuture
+	ZRangeByScoreWithLimit(key, min, max string, offset, count int) *StringsFuture
+	ZRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) *ZFuture
+	ZRevRange(key string, start, stop int) *StringsFuture
+	ZRevRangeWithScores(key string, start, stop int) *ZFuture
+	ZRevRangeByScore(key, min, max string) *StringsFuture
+	ZRevRangeByScoreWithScores(key, min, max string) *ZFuture
+	ZRevRangeByScoreWithLimit(key, min, max string, offset, count int) *StringsFuture
+	ZRevRangeByScoreWithScoresWithLimit(key, min, max string, offset, count int) *ZFuture
+	ZRank(key, member string) *IntFuture
+	ZRem(key string, members ...string) *IntFuture
+	ZRemRangeByRank(key string, start, stop int) *IntFuture
+	ZScore(key string, member string) *FloatFuture
+	ZIncrBy(key string, score float64, value string) *IntFuture
 }
 
 // HyperLogLog
@@ -216,9 +235,9 @@ type HyperLogLogCommands interface {
 }
 
 type HyperLogLogBatchCommands interface {
-	PFAdd(key string, values ...string) error
-	PFCount(key string) error
-	PFMerge(mergedKey string, keysToMerge ...string) error
+	PFAdd(key string, values ...string) *IntFuture
+	PFCount(key string) *IntFuture
+	PFMerge(mergedKey string, keysToMerge ...string) *BoolFuture
 }
 
 type ScanCommands interface {
@@ -227,6 +246,106 @@ type ScanCommands interface {
 	ZScan(key string, cursor int, match string, count int) (nextCursor int, matches []string, scores []float64, err error)
 }
 
+// Streams - http://redis.io/commands#stream
+//
+// Where a count is taken, a count less than 1 means no limit.
+type StreamCommands interface {
+	// XAdd appends an entry with the specified ID, or "*" to generate one, and returns its ID.
+	XAdd(key, id string, fields map[string]interface{}) (string, error)
+	XLen(key string) (int, error)
+	XDel(key string, ids ...string) (int, error)
+	XRange(key, start, end string, count int) ([]StreamEntry, error)
+	XTrim(key string, maxLen int, approximate bool) (trimmed int, err error)
+
+	// XRead reads entries after the specified IDs from each stream, keyed by stream name. It blocks
+	// for up to block waiting for entries, indefinitely if block is 0, or not at all if it is
+	// NoBlock. As with BLPop, ErrNil is returned if no entries arrive.
+	XRead(streams map[string]string, count int, block time.Duration) ([]Stream, error)
+
+	// XReadGroup is like XRead, reading as a consumer of a group. The ID ">" reads entries never
+	// delivered to another consumer, other IDs read the consumer's own pending entries.
+	XReadGroup(group, consumer string, streams map[string]string, count int, block time.Duration) ([]Stream, error)
+
+	XGroupCreate(key, group, start string, mkStream bool) error
+	XGroupDestroy(key, group string) (bool, error)
+	XAck(key, group string, ids ...string) (int, error)
+	XPending(key, group string) (PendingSummary, error)
+	XPendingRange(key, group, start, end string, count int) ([]PendingEntry, error)
+	XClaim(key, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error)
+
+	// XAutoClaim claims up to count entries pending for at least minIdle, scanning from start.
+	// It returns the ID to resume scanning from, which is "0-0" once the scan is complete.
+	XAutoClaim(key, group, consumer string, minIdle time.Duration, start string, count int) (next string, entries []StreamEntry, err error)
+
+	XInfoStream(key string) (StreamInfo, error)
+	XInfoGroups(key string) ([]StreamGroupInfo, error)
+	XInfoConsumers(key, group string) ([]StreamConsumerInfo, error)
+}
+
+type StreamBatchCommands interface {
+	XAdd(key, id string, fields map[string]interface{}) *StringFuture
+	XLen(key string) *IntFuture
+	XDel(key string, ids ...string) *IntFuture
+	XRange(key, start, end string, count int) *StreamEntriesFuture
+	XTrim(key string, maxLen int, approximate bool) *IntFuture
+	XAck(key, group string, ids ...string) *IntFuture
+}
+
+// Pub/Sub - http://redis.io/commands#pubsub
+type PubSubCommands interface {
+	// Publish posts a message to a channel and returns the number of clients that received it.
+	Publish(channel, message string) (receivers int, err error)
+}
+
+type PubSubBatchCommands interface {
+	Publish(channel, message string) *IntFuture
+}
+
+// Scripting - http://redis.io/commands#scripting
+type ScriptingCommands interface {
+	// Eval runs a script with EVALSHA, falling back to EVAL if the server doesn't have the
+	// script cached. Its reply can be converted with helpers such as Int or Strings.
+	Eval(script *Script, keys []string, args ...interface{}) (interface{}, error)
+
+	ScriptLoad(scripts ...*Script) error
+	ScriptExists(scripts ...*Script) ([]bool, error)
+	ScriptFlush() error
+}
+
+type ScriptingBatchCommands interface {
+	// Eval runs a script with EVALSHA in a pipeline, which is run again with EVAL once the
+	// pipeline's replies arrive if the server doesn't have the script cached. In a transaction, or
+	// a pipeline whose replies are discarded, it runs the script with EVAL, as those replies only
+	// arrive with EXEC or not at all.
+	Eval(script *Script, keys []string, args ...interface{}) *ReplyFuture
+}
+
+// PubSub is a subscriber holding its own connection, which delivers the messages published to its
+// channels and patterns on a Go channel. If the connection drops, it reconnects and re-subscribes
+// to everything it was subscribed to.
 type PubSub interface {
-	// TBD
+	Subscribe(channels ...string) error
+	PSubscribe(patterns ...string) error
+
+	// Unsubscribe unsubscribes from the specified channels, or from all channels if none are specified.
+	Unsubscribe(channels ...string) error
+	// PUnsubscribe unsubscribes from the specified patterns, or from all patterns if none are specified.
+	PUnsubscribe(patterns ...string) error
+
+	// Channels returns the channels currently subscribed to.
+	Channels() []string
+	// Patterns returns the patterns currently subscribed to.
+	Patterns() []string
+
+	// Messages returns the channel on which messages are delivered. It is closed by Close.
+	Messages() <-chan Message
+
+	Close() error
+}
+
+type Message struct {
+	Channel string
+	// Pattern is the pattern that matched Channel, for messages received through PSubscribe.
+	Pattern string
+	Data    string
 }
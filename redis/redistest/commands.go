@@ -0,0 +1,394 @@
+package redistest
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command is a command a fake runs.
+type command struct {
+	// arity is the number of arguments of the command, its name included, or minus the least
+	// number of them if it takes any more, as COMMAND tells of Redis's.
+	arity int
+	// run runs the command, with the fake locked, and returns its reply.
+	run func(c *client, args []string) interface{}
+}
+
+// commands are the commands a fake runs, by name. It's filled in by init, as EXEC runs commands
+// of its own.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		// Connections and the server
+		"AUTH":     {-2, auth},
+		"HELLO":    {-1, hello},
+		"PING":     {-1, ping},
+		"ECHO":     {2, echo},
+		"SELECT":   {2, selectDB},
+		"QUIT":     {-1, quit},
+		"CLIENT":   {-2, clientCommand},
+		"CONFIG":   {-2, config},
+		"DBSIZE":   {1, dbSize},
+		"FLUSHDB":  {-1, flushDB},
+		"FLUSHALL": {-1, flushAll},
+
+		// Keys
+		"DEL":      {-2, del},
+		"UNLINK":   {-2, del},
+		"EXISTS":   {-2, exists},
+		"EXPIRE":   {-3, expire},
+		"PEXPIRE":  {-3, expire},
+		"TTL":      {2, ttl},
+		"PTTL":     {2, ttl},
+		"PERSIST":  {2, persist},
+		"RENAME":   {3, rename},
+		"RENAMENX": {3, rename},
+		"TYPE":     {2, typeCommand},
+		"KEYS":     {2, keys},
+		"SCAN":     {-2, scan},
+
+		// Strings
+		"GET":    {2, get},
+		"MGET":   {-2, mget},
+		"SET":    {-3, set},
+		"SETEX":  {4, setex},
+		"SETNX":  {3, setnx},
+		"MSET":   {-3, mset},
+		"INCR":   {2, incr},
+		"INCRBY": {3, incr},
+		"DECR":   {2, incr},
+		"DECRBY": {3, incr},
+
+		// Hashes
+		"HGET":    {3, hget},
+		"HGETALL": {2, hgetall},
+		"HINCRBY": {4, hincrby},
+		"HSET":    {-4, hset},
+		"HMSET":   {-4, hset},
+		"HMGET":   {-3, hmget},
+		"HDEL":    {-3, hdel},
+		"HEXISTS": {3, hexists},
+		"HLEN":    {2, hlen},
+
+		// Lists
+		"LPUSH":  {-3, lpush},
+		"RPUSH":  {-3, lpush},
+		"LPOP":   {-2, lpop},
+		"RPOP":   {-2, lpop},
+		"BLPOP":  {-3, blpop},
+		"BRPOP":  {-3, blpop},
+		"LLEN":   {2, llen},
+		"LINDEX": {3, lindex},
+		"LRANGE": {4, lrange},
+		"LTRIM":  {4, ltrim},
+		"LREM":   {4, lrem},
+
+		// Sets
+		"SADD":        {-3, sadd},
+		"SREM":        {-3, srem},
+		"SCARD":       {2, scard},
+		"SPOP":        {-2, spop},
+		"SMEMBERS":    {2, smembers},
+		"SRANDMEMBER": {-2, srandmember},
+		"SDIFF":       {-2, sdiff},
+		"SINTER":      {-2, sdiff},
+		"SUNION":      {-2, sdiff},
+		"SISMEMBER":   {3, sismember},
+		"SMOVE":       {4, smove},
+		"SSCAN":       {-3, sscan},
+
+		// Sorted sets
+		"ZADD":             {-4, zadd},
+		"ZCARD":            {2, zcard},
+		"ZCOUNT":           {4, zcount},
+		"ZINCRBY":          {4, zincrby},
+		"ZRANGE":           {-4, zrange},
+		"ZREVRANGE":        {-4, zrange},
+		"ZRANGEBYSCORE":    {-4, zrange},
+		"ZREVRANGEBYSCORE": {-4, zrange},
+		"ZRANK":            {-3, zrank},
+		"ZREVRANK":         {-3, zrank},
+		"ZREM":             {-3, zrem},
+		"ZREMRANGEBYRANK":  {4, zremrangebyrank},
+		"ZREMRANGEBYSCORE": {4, zremrangebyscore},
+		"ZSCORE":           {3, zscore},
+		"ZSCAN":            {-3, zscan},
+
+		// HyperLogLogs
+		"PFADD":   {-2, pfadd},
+		"PFCOUNT": {-2, pfcount},
+		"PFMERGE": {-2, pfmerge},
+
+		// Pub/Sub
+		"PUBLISH":      {3, publish},
+		"SUBSCRIBE":    {-2, subscribe},
+		"PSUBSCRIBE":   {-2, subscribe},
+		"UNSUBSCRIBE":  {-1, unsubscribe},
+		"PUNSUBSCRIBE": {-1, unsubscribe},
+
+		// Scripting
+		"EVAL":    {-3, eval},
+		"EVALSHA": {-3, eval},
+		"SCRIPT":  {-2, script},
+
+		// Transactions
+		"MULTI":   {1, multi},
+		"EXEC":    {1, exec},
+		"DISCARD": {1, discard},
+		"WATCH":   {-2, watch},
+		"UNWATCH": {1, unwatchCommand},
+
+		// Streams
+		"XADD":       {-5, xadd},
+		"XLEN":       {2, xlen},
+		"XDEL":       {-3, xdel},
+		"XRANGE":     {-4, xrange},
+		"XREVRANGE":  {-4, xrange},
+		"XTRIM":      {-4, xtrim},
+		"XREAD":      {-4, xread},
+		"XREADGROUP": {-7, xread},
+		"XGROUP":     {-2, xgroup},
+		"XACK":       {-4, xack},
+		"XPENDING":   {-3, xpending},
+		"XCLAIM":     {-6, xclaim},
+		"XAUTOCLAIM": {-6, xautoclaim},
+		"XINFO":      {-2, xinfo},
+	}
+}
+
+// Parsing arguments
+
+func parseInt(arg string) (int64, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+// parseFloat parses a float as Redis does, e.g. 1.5, -inf or +inf, but not NaN.
+func parseFloat(arg string) (float64, error) {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil && !math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds.
+func parseTimeout(arg string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, replyError("ERR timeout is not a float or out of range")
+	}
+	if f < 0 {
+		return 0, replyError("ERR timeout is negative")
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// rangeIndexes converts the start and stop indexes of a range of n items, either of which may
+// count back from the end if it's negative, to the bounds of a slice, which are equal if the
+// range is empty.
+func rangeIndexes(start, stop int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return int(start), int(stop) + 1
+}
+
+// Connections and the server - https://redis.io/commands#connection
+
+func ping(c *client, args []string) interface{} {
+	if len(args) > 2 {
+		return wrongArgs(args[0])
+	}
+	// Subscribed clients are replied to with an array in RESP2, which can't be told apart from
+	// messages otherwise.
+	if c.subscribed() && c.protocol == 2 {
+		message := ""
+		if len(args) == 2 {
+			message = args[1]
+		}
+		return []interface{}{"pong", message}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return status("PONG")
+}
+
+func echo(c *client, args []string) interface{} {
+	return args[1]
+}
+
+func selectDB(c *client, args []string) interface{} {
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInteger
+	}
+	if index < 0 || index >= Databases {
+		return replyError("ERR DB index is out of range")
+	}
+	c.db = c.f.dbs[index]
+	return ok
+}
+
+func quit(c *client, args []string) interface{} {
+	c.quit = true
+	return ok
+}
+
+func auth(c *client, args []string) interface{} {
+	switch len(args) {
+	case 2:
+		return c.authenticate("", args[1])
+	case 3:
+		return c.authenticate(args[1], args[2])
+	}
+	return errSyntax
+}
+
+// authenticate authenticates the client as username, or by AUTH's older form if it's "". Only the
+// default user is known, with the fake's password, or with any if it has none, as Redis's is.
+func (c *client) authenticate(username, password string) interface{} {
+	switch {
+	case username == "" && c.f.password == "":
+		return replyError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	case username != "" && username != "default", c.f.password != "" && password != c.f.password:
+		return replyError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.authenticated = true
+	return ok
+}
+
+// hello runs HELLO, which switches the client to RESP2 or RESP3, and may authenticate and name it
+// as it does.
+func hello(c *client, args []string) interface{} {
+	protocol := c.protocol
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return replyError("ERR Protocol version is not an integer or out of range")
+		}
+		if n != 2 && n != 3 {
+			return replyError("NOPROTO sorry, this protocol version is not supported.")
+		}
+		protocol = n
+	}
+
+	name := c.name
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "AUTH" && i+2 < len(args):
+			if err := c.authenticate(args[i+1], args[i+2]); err != ok {
+				return err
+			}
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			name = args[i+1]
+			i++
+		default:
+			return replyError("ERR Syntax error in HELLO option '" + args[i] + "'")
+		}
+	}
+	if !c.authenticated {
+		return replyError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	c.protocol, c.name = protocol, name
+	return respMap{
+		"server", "redis",
+		"version", Version,
+		"proto", c.protocol,
+		"id", c.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", []interface{}{},
+	}
+}
+
+// clientCommand replies to the subcommands of CLIENT which clients send as they connect.
+func clientCommand(c *client, args []string) interface{} {
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "SETNAME" && len(args) == 3:
+		c.name = args[2]
+		return ok
+	case subcommand == "SETINFO" && len(args) == 4:
+		return ok
+	case subcommand == "GETNAME" && len(args) == 2:
+		if c.name == "" {
+			return nil
+		}
+		return c.name
+	case subcommand == "ID" && len(args) == 2:
+		return c.id
+	}
+	return replyError("ERR unknown subcommand or wrong number of arguments for '" + args[1] + "'. Try CLIENT HELP.")
+}
+
+// config runs CONFIG, which gets and sets requirepass, the only parameter the fake has.
+func config(c *client, args []string) interface{} {
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "GET" && len(args) > 2:
+		reply := respMap{}
+		for _, pattern := range args[2:] {
+			if match(pattern, "requirepass") {
+				reply = append(reply, "requirepass", c.f.password)
+				break
+			}
+		}
+		return reply
+	case subcommand == "SET" && len(args) > 3 && len(args)%2 == 0:
+		for i := 2; i < len(args); i += 2 {
+			if !strings.EqualFold(args[i], "requirepass") {
+				return replyError("ERR Unknown option or number of arguments for CONFIG SET - '" + args[i] + "'")
+			}
+		}
+		// As by Redis, clients already connected stay authenticated.
+		for i := 2; i < len(args); i += 2 {
+			c.f.password = args[i+1]
+		}
+		return ok
+	case subcommand == "RESETSTAT" && len(args) == 2:
+		return ok
+	}
+	return replyError("ERR unknown subcommand or wrong number of arguments for '" + args[1] + "'. Try CONFIG HELP.")
+}
+
+func dbSize(c *client, args []string) interface{} {
+	n := 0
+	for key := range c.db.keys {
+		if c.db.get(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func flushDB(c *client, args []string) interface{} {
+	c.db.flush()
+	return ok
+}
+
+func flushAll(c *client, args []string) interface{} {
+	for _, d := range c.f.dbs {
+		d.flush()
+	}
+	return ok
+}
@@ -0,0 +1,1530 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+// Target is an implementation of the redis package's commands, which RunConformance checks: a
+// Pool, ShardedPool or Connection, a pool of a Fake or Server, or any of those wrapped. Its
+// Pipelined and Transaction run the BatchCommands.
+type Target interface {
+	redis.Commands
+
+	Pipelined(func(redis.Pipeline)) ([]interface{}, error)
+	Transaction(func(redis.Transaction)) ([]interface{}, error)
+}
+
+// The keys of the checks share a hash tag, so that they're on the same shard of a ShardedPool.
+const keyPrefix = "_tests:jimmy:redis:{conformance}:"
+
+// The scripts the checks run. A Fake runs them without them being registered, as it can't run Lua.
+var (
+	incrByScript = redis.NewScript(`return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+	errorScript  = redis.NewScript(`return redis.error_reply("nope")`)
+)
+
+func registerConformanceScripts(f *Fake) {
+	f.scripts[incrByScript.Hash()] = func(call *ScriptCall) (interface{}, error) {
+		return call.Call("INCRBY", call.Keys[0], call.Args[0])
+	}
+	f.scripts[errorScript.Hash()] = func(call *ScriptCall) (interface{}, error) {
+		return nil, errors.New("nope")
+	}
+}
+
+// RunConformance checks, in subtests of t, that the Commands and BatchCommands of a target, and
+// the Transactions of its connections, behave as they do for a Pool of a Redis server, so that
+// implementations can be swapped for one another in tests. factory is called for each check, and
+// returns the target, which mustn't have any of the keys the checks use, e.g. as it's flushed.
+//
+// The Transactions checked are the target's if it's a Connection, or those of a connection taken
+// with its GetConnection if it has one, as a Pool has. They're skipped otherwise.
+func RunConformance(t *testing.T, factory func(t *testing.T) Target) {
+	t.Run("Commands", func(t *testing.T) { runCommands(t, factory) })
+	t.Run("BatchCommands", func(t *testing.T) { runBatchCommands(t, factory) })
+	t.Run("Transactions", func(t *testing.T) { runTransactions(t, factory) })
+}
+
+// connection returns a connection of target, which is released once the check is done.
+func connection(t *testing.T, target Target) redis.Connection {
+	switch target := target.(type) {
+	case redis.Connection:
+		return target
+	case interface {
+		GetConnection() (redis.PooledConnection, error)
+	}:
+		c, err := target.GetConnection()
+		if err != nil {
+			t.Fatalf("failed to get a connection: %v", err)
+		}
+		t.Cleanup(c.Release)
+		return c
+	}
+	t.Skipf("%T has no connections", target)
+	return nil
+}
+
+func runCommands(t *testing.T, factory func(t *testing.T) Target) {
+	t.Run("DEL", func(t *testing.T) {
+		t.Run("no key exists returns 0", func(t *testing.T) {
+			c := factory(t)
+			i, err := c.Del(keyPrefix + "doesnotexist")
+			if i != 0 {
+				t.Errorf("got %d, want 0", i)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+
+		t.Run("key exists returns 1", func(t *testing.T) {
+			c := factory(t)
+			c.Set(keyPrefix+"exists", "The best leaders know when to follow.")
+			i, err := c.Del(keyPrefix + "exists")
+			if i != 1 {
+				t.Errorf("got %d, want 1", i)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("without key returns -2", func(t *testing.T) {
+			c := factory(t)
+			i, err := c.TTL(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != -2 {
+				t.Errorf("got %d, want -2", i)
+			}
+		})
+
+		t.Run("key without expiration returns -1", func(t *testing.T) {
+			c := factory(t)
+			c.Set(key, "bar")
+
+			i, err := c.TTL(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != -1 {
+				t.Errorf("got %d, want -1", i)
+			}
+		})
+
+		t.Run("key with expiration returns ttl", func(t *testing.T) {
+			c := factory(t)
+			c.SetEx(key, "baz", 15)
+
+			i, err := c.TTL(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != 15 {
+				t.Errorf("got %d, want 15", i)
+			}
+		})
+	})
+
+	t.Run("SETNX", func(t *testing.T) {
+		t.Run("should not set existing key", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "setnx.existing"
+			c.Set(key, "foo")
+
+			ok, err := c.SetNX(key, "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok {
+				t.Error("expected false, got true")
+			}
+
+			foo, _ := c.Get(key)
+			if foo != "foo" {
+				t.Errorf("got %q, want %q", foo, "foo")
+			}
+		})
+
+		t.Run("should set non-existent key", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "setnx.notexisting"
+
+			ok, err := c.SetNX(key, "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !ok {
+				t.Error("expected true, got false")
+			}
+
+			foo, _ := c.Get(key)
+			if foo != "bar" {
+				t.Errorf("got %q, want %q", foo, "bar")
+			}
+		})
+	})
+
+	t.Run("PFAdd", func(t *testing.T) {
+		t.Run("should indicate HyperLogLog register was altered", func(t *testing.T) {
+			c := factory(t)
+			i, err := c.PFAdd(keyPrefix+"foo1", "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != 1 {
+				t.Errorf("got %d, want 1", i)
+			}
+		})
+
+		t.Run("should indicate HyperLogLog register was not altered", func(t *testing.T) {
+			c := factory(t)
+			_, err := c.PFAdd(keyPrefix+"foo2", "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			i, err := c.PFAdd(keyPrefix+"foo2", "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if i != 0 {
+				t.Errorf("got %d, want 0", i)
+			}
+		})
+	})
+
+	t.Run("PFCount", func(t *testing.T) {
+		t.Run("should return approximate cardinality", func(t *testing.T) {
+			c := factory(t)
+			var actualCardinality float64 = 20000
+			for i := 0; float64(i) < actualCardinality; i++ {
+				_, err := c.PFAdd(keyPrefix+"foo3", fmt.Sprint(i))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			card, err := c.PFCount(keyPrefix + "foo3")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if float64(card) >= actualCardinality*1.2 {
+				t.Errorf("cardinality %d too high (max %v)", card, actualCardinality*1.2)
+			}
+			if float64(card) <= actualCardinality*0.8 {
+				t.Errorf("cardinality %d too low (min %v)", card, actualCardinality*0.8)
+			}
+		})
+	})
+
+	t.Run("PFMerge", func(t *testing.T) {
+		t.Run("should return approximate cardinality of union", func(t *testing.T) {
+			c := factory(t)
+			sets := [][]int{{1, 2, 3, 4, 5}, {3, 4, 5, 6, 7}, {8, 9, 10, 11, 12}}
+
+			for i, set := range sets {
+				for _, x := range set {
+					_, err := c.PFAdd(fmt.Sprintf("%shll%d", keyPrefix, i+1), fmt.Sprint(x))
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+			}
+
+			for i := 1; i < 4; i++ {
+				card, err := c.PFCount(fmt.Sprintf("%shll%d", keyPrefix, i))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if card != 5 {
+					t.Errorf("hll%d: got %d, want 5", i, card)
+				}
+			}
+
+			for _, merge := range []struct {
+				name string
+				keys []string
+				want int
+			}{
+				{"hll1+2", []string{"hll1", "hll2"}, 7},
+				{"hll1+3", []string{"hll1", "hll3"}, 10},
+				{"hll1+2+3", []string{"hll1", "hll2", "hll3"}, 12},
+			} {
+				var keys []string
+				for _, key := range merge.keys {
+					keys = append(keys, keyPrefix+key)
+				}
+				ok, err := c.PFMerge(keyPrefix+merge.name, keys...)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !ok {
+					t.Error("expected true, got false")
+				}
+
+				card, err := c.PFCount(keyPrefix + merge.name)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if card != merge.want {
+					t.Errorf("%s: got %d, want %d", merge.name, card, merge.want)
+				}
+			}
+		})
+	})
+
+	t.Run("LTrim", func(t *testing.T) {
+		t.Run("when a list is trimmed", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "list"
+
+			for i := range 5 {
+				c.LPush(key, fmt.Sprint(i))
+			}
+
+			size, err := c.LLen(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != 5 {
+				t.Errorf("got %d, want 5", size)
+			}
+
+			// Trim nothing
+			err = c.LTrim(key, 0, 4)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			size, err = c.LLen(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != 5 {
+				t.Errorf("got %d, want 5", size)
+			}
+
+			// Trim first element
+			err = c.LTrim(key, 1, 5)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			size, err = c.LLen(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != 4 {
+				t.Errorf("got %d, want 4", size)
+			}
+
+			item, err := c.LPop(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item != "3" {
+				t.Errorf("got %q, want %q", item, "3")
+			}
+
+			// Trim last element
+			err = c.LTrim(key, -4, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			size, err = c.LLen(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if size != 3 {
+				t.Errorf("got %d, want 3", size)
+			}
+
+			item, err = c.LPop(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if item != "2" {
+				t.Errorf("got %q, want %q", item, "2")
+			}
+		})
+
+		t.Run("when a not-list is trimmed returns error", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "not-list"
+
+			if err := c.Set(key, "yay"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.LTrim(key, 0, 4); !errors.Is(err, redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", err, redis.ErrWrongType)
+			}
+
+			c.Del(key)
+			_, err := c.SAdd(key, "yay")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.LTrim(key, 0, 4); !errors.Is(err, redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", err, redis.ErrWrongType)
+			}
+		})
+	})
+
+	t.Run("LRange", func(t *testing.T) {
+		key := keyPrefix + "list"
+
+		t.Run("empty list returns nothing", func(t *testing.T) {
+			c := factory(t)
+			things, err := c.LRange(key, 0, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(things) != 0 {
+				t.Errorf("expected empty, got %v", things)
+			}
+		})
+
+		t.Run("list returns items", func(t *testing.T) {
+			c := factory(t)
+			for i := range 5 {
+				_, err := c.LPush(key, fmt.Sprint(i))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			things, err := c.LRange(key, 0, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(things) != 5 {
+				t.Errorf("got len %d, want 5", len(things))
+			}
+
+			things, err = c.LRange(key, 0, 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(things) != 1 || things[0] != "4" {
+				t.Errorf("got %v, want [4]", things)
+			}
+
+			things, err = c.LRange(key, -1, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(things) != 1 || things[0] != "0" {
+				t.Errorf("got %v, want [0]", things)
+			}
+		})
+	})
+
+	t.Run("SMove", func(t *testing.T) {
+		t.Run("should move member to other set", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "smove"
+
+			c.SAdd(key+":a", "foobar")
+
+			moved, err := c.SMove(key+":a", key+":b", "foobar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !moved {
+				t.Error("expected true, got false")
+			}
+
+			members, _ := c.SMembers(key + ":a")
+			if len(members) != 0 {
+				t.Errorf("got len %d, want 0", len(members))
+			}
+
+			members, _ = c.SMembers(key + ":b")
+			if len(members) != 1 || members[0] != "foobar" {
+				t.Errorf("got %v, want [foobar]", members)
+			}
+		})
+	})
+
+	t.Run("SScan", func(t *testing.T) {
+		t.Run("should scan the set", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "sscan"
+
+			c.SAdd(key, "a", "b", "c", "d", "e")
+
+			var scanned []string
+			for cursor := -1; cursor != 0; {
+				next, matches, err := c.SScan(key, max(cursor, 0), "", 1)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				scanned, cursor = append(scanned, matches...), next
+			}
+
+			if len(scanned) != 5 {
+				t.Errorf("got len %d, want 5", len(scanned))
+			}
+			for _, want := range []string{"a", "b", "c", "d", "e"} {
+				if !slices.Contains(scanned, want) {
+					t.Errorf("expected %q in %v", want, scanned)
+				}
+			}
+		})
+	})
+
+	t.Run("ZScan", func(t *testing.T) {
+		t.Run("should scan the sorted set", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "zscan"
+
+			c.ZAdd(key, 1, "a")
+			c.ZAdd(key, 2, "b")
+			c.ZAdd(key, 3, "c")
+			c.ZAdd(key, 4, "d")
+			c.ZAdd(key, 5, "e")
+
+			var scanned []string
+			var scannedScores []float64
+			for cursor := -1; cursor != 0; {
+				next, matches, scores, err := c.ZScan(key, max(cursor, 0), "", 1)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				scanned, scannedScores, cursor = append(scanned, matches...), append(scannedScores, scores...), next
+			}
+
+			if len(scanned) != 5 {
+				t.Errorf("got len %d, want 5", len(scanned))
+			}
+			for _, want := range []string{"a", "b", "c", "d", "e"} {
+				if !slices.Contains(scanned, want) {
+					t.Errorf("expected %q in %v", want, scanned)
+				}
+			}
+
+			expectedScores := map[string]float64{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+			for i, elem := range scanned {
+				if scannedScores[i] != expectedScores[elem] {
+					t.Errorf("%s: got score %v, want %v", elem, scannedScores[i], expectedScores[elem])
+				}
+			}
+		})
+	})
+
+	t.Run("HGet", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("key exists with field returns value", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.HSet(key, "bar", "baz"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			val, err := c.HGet(key, "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if val != "baz" {
+				t.Errorf("got %q, want %q", val, "baz")
+			}
+		})
+
+		t.Run("key exists without field returns error", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.HSet(key, "blah", "blech"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			val, err := c.HGet(key, "bar")
+			if err != redis.ErrNil {
+				t.Errorf("got %v, want %v", err, redis.ErrNil)
+			}
+			if val != "" {
+				t.Errorf("got %q, want empty string", val)
+			}
+		})
+
+		t.Run("key does not exist returns error", func(t *testing.T) {
+			c := factory(t)
+			val, err := c.HGet(key, "bar")
+			if err != redis.ErrNil {
+				t.Errorf("got %v, want %v", err, redis.ErrNil)
+			}
+			if val != "" {
+				t.Errorf("got %q, want empty string", val)
+			}
+		})
+
+		t.Run("key exists but not hash returns error", func(t *testing.T) {
+			c := factory(t)
+			if err := c.Set(key, "yo"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			val, err := c.HGet(key, "bar")
+			if !errors.Is(err, redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", err, redis.ErrWrongType)
+			}
+			if val != "" {
+				t.Errorf("got %q, want empty string", val)
+			}
+		})
+	})
+
+	t.Run("HGetAll", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("key exists with 2 pairs returns pairs", func(t *testing.T) {
+			c := factory(t)
+			err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 2 || vals["bar"] != "baz" || vals["blah"] != "blech" {
+				t.Errorf("got %v, want map[bar:baz blah:blech]", vals)
+			}
+		})
+
+		t.Run("key does not exist returns empty map", func(t *testing.T) {
+			c := factory(t)
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 0 {
+				t.Errorf("got len %d, want 0", len(vals))
+			}
+		})
+	})
+
+	t.Run("HSet", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("new key returns true", func(t *testing.T) {
+			c := factory(t)
+			isNew, err := c.HSet(key, "bar", "baz")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !isNew {
+				t.Error("expected true, got false")
+			}
+
+			val, err := c.HGet(key, "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if val != "baz" {
+				t.Errorf("got %q, want %q", val, "baz")
+			}
+		})
+
+		t.Run("existing key new field returns true", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.HSet(key, "bar", "baz"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			isNew, err := c.HSet(key, "yo", "oy")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !isNew {
+				t.Error("expected true, got false")
+			}
+
+			if val, err := c.HGet(key, "bar"); err != nil || val != "baz" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "baz")
+			}
+			if val, err := c.HGet(key, "yo"); err != nil || val != "oy" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "oy")
+			}
+		})
+
+		t.Run("existing key existing field returns false", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.HSet(key, "bar", "baz"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			isNew, err := c.HSet(key, "bar", "yo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if isNew {
+				t.Error("expected false, got true")
+			}
+
+			if val, err := c.HGet(key, "bar"); err != nil || val != "yo" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "yo")
+			}
+		})
+
+		t.Run("existing key not hash returns error", func(t *testing.T) {
+			c := factory(t)
+			if err := c.Set(key, "bar"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			isNew, err := c.HSet(key, "bar", "yo")
+			if !errors.Is(err, redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", err, redis.ErrWrongType)
+			}
+			if isNew {
+				t.Error("expected false, got true")
+			}
+
+			if val, err := c.Get(key); err != nil || val != "bar" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "bar")
+			}
+		})
+	})
+
+	t.Run("HMGet", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("key exists with 2 specified keys", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HMGet(key, "bar", "blah")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 2 || vals["bar"] != "baz" || vals["blah"] != "blech" {
+				t.Errorf("got %v, want map[bar:baz blah:blech]", vals)
+			}
+		})
+
+		t.Run("key exists with 2 of 3 specified keys", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HMGet(key, "bar", "yo", "blah")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 3 || vals["bar"] != "baz" || vals["yo"] != "" || vals["blah"] != "blech" {
+				t.Errorf("got %v, want map[bar:baz blah:blech yo:]", vals)
+			}
+		})
+
+		t.Run("key does not exist", func(t *testing.T) {
+			c := factory(t)
+			vals, err := c.HMGet(key, "bar", "blah")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 2 || vals["bar"] != "" || vals["blah"] != "" {
+				t.Errorf("got %v, want map[bar: blah:]", vals)
+			}
+		})
+
+		t.Run("no fields returns error", func(t *testing.T) {
+			c := factory(t)
+			vals, err := c.HMGet(key)
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+			if len(vals) != 0 {
+				t.Errorf("got len %d, want 0", len(vals))
+			}
+		})
+	})
+
+	t.Run("HMSet", func(t *testing.T) {
+		key := keyPrefix + "foo"
+
+		t.Run("new key with 2 string pairs", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 2 || vals["bar"] != "baz" || vals["blah"] != "blech" {
+				t.Errorf("got %v, want map[bar:baz blah:blech]", vals)
+			}
+		})
+
+		t.Run("new key with 2 int pairs", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{"bar": 18, "blah": 42}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 2 || vals["bar"] != "18" || vals["blah"] != "42" {
+				t.Errorf("got %v, want map[bar:18 blah:42]", vals)
+			}
+		})
+
+		t.Run("existing key with 3 pairs update 2", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{"bar": 18, "blah": 42, "yo": "oy"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 3 || vals["bar"] != "baz" || vals["blah"] != "blech" || vals["yo"] != "oy" {
+				t.Errorf("got %v, want map[bar:baz blah:blech yo:oy]", vals)
+			}
+		})
+
+		t.Run("existing key not hash returns error", func(t *testing.T) {
+			c := factory(t)
+			if err := c.Set(key, "bar"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err := c.HMSet(key, map[string]interface{}{"bar": "baz", "blah": "blech"})
+			if !errors.Is(err, redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", err, redis.ErrWrongType)
+			}
+
+			if val, err := c.Get(key); err != nil || val != "bar" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "bar")
+			}
+		})
+
+		t.Run("existing key empty map returns error", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.HSet(key, "bar", "baz"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := c.HMSet(key, map[string]interface{}{}); err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			vals, err := c.HGetAll(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(vals) != 1 || vals["bar"] != "baz" {
+				t.Errorf("got %v, want map[bar:baz]", vals)
+			}
+		})
+
+		t.Run("new key empty map returns error", func(t *testing.T) {
+			c := factory(t)
+			if err := c.HMSet(key, map[string]interface{}{}); err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			exists, err := c.Exists(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists {
+				t.Error("expected false, got true")
+			}
+		})
+	})
+
+	t.Run("ZAdd", func(t *testing.T) {
+		t.Run("happy path", func(t *testing.T) {
+			c := factory(t)
+			added, err := c.ZAdd(keyPrefix+"foo", 0.123, "bar")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if added != 1 {
+				t.Errorf("got %d, want 1", added)
+			}
+		})
+	})
+
+	// zadd adds the members the sorted set checks range over.
+	zadd := func(c Target, key string) {
+		c.ZAdd(key, 0.123, "bar")
+		c.ZAdd(key, 0.127, "barfu")
+		c.ZAdd(key, 0.132, "barfoo")
+		c.ZAdd(key, 0.133, "barfubar")
+	}
+
+	t.Run("ZRank", func(t *testing.T) {
+		t.Run("key exists returns rank", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "foo"
+			zadd(c, key)
+
+			for want, member := range []string{"bar", "barfu"} {
+				rank, err := c.ZRank(key, member)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if rank != want {
+					t.Errorf("%s: got %d, want %d", member, rank, want)
+				}
+			}
+		})
+	})
+
+	t.Run("ZRemRangeByRank", func(t *testing.T) {
+		t.Run("removes members with lower or equal rank", func(t *testing.T) {
+			c := factory(t)
+			key := keyPrefix + "foo"
+			zadd(c, key)
+
+			total, err := c.ZRemRangeByRank(key, 0, 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total != 2 {
+				t.Errorf("got %d, want 2", total)
+			}
+			rank, err := c.ZRank(key, "barfoo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rank != 0 {
+				t.Errorf("got %d, want 0", rank)
+			}
+		})
+	})
+
+	t.Run("ZRange", func(t *testing.T) {
+		key := keyPrefix + "foo"
+		middle := []redis.Z{{Value: "barfu", Score: 0.127}, {Value: "barfoo", Score: 0.132}}
+
+		t.Run("returns elements by range", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRange(key, 1, 2)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, []string{"barfu", "barfoo"}) {
+				t.Errorf("got %v, want [barfu barfoo]", values)
+			}
+		})
+
+		t.Run("returns elements with scores", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRangeWithScores(key, 1, 2)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, middle) {
+				t.Errorf("got %v, want %v", values, middle)
+			}
+		})
+
+		t.Run("returns elements by score range", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRangeByScore(key, "(0.123", "0.132")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, []string{"barfu", "barfoo"}) {
+				t.Errorf("got %v, want [barfu barfoo]", values)
+			}
+		})
+
+		t.Run("returns elements with scores by range", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRangeByScoreWithScores(key, "(0.123", "0.132")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, middle) {
+				t.Errorf("got %v, want %v", values, middle)
+			}
+		})
+
+		t.Run("returns limited elements", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRangeByScoreWithLimit(key, "(0.123", "0.132", 1, 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, []string{"barfoo"}) {
+				t.Errorf("got %v, want [barfoo]", values)
+			}
+		})
+
+		t.Run("returns limited elements with scores", func(t *testing.T) {
+			c := factory(t)
+			zadd(c, key)
+			values, err := c.ZRangeByScoreWithScoresWithLimit(key, "(0.123", "0.132", 1, 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(values, middle[1:]) {
+				t.Errorf("got %v, want %v", values, middle[1:])
+			}
+		})
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		t.Run("should return number of receivers", func(t *testing.T) {
+			c := factory(t)
+			n, err := c.Publish(keyPrefix+"nobody", "hello")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 0 {
+				t.Errorf("got %d, want 0", n)
+			}
+		})
+	})
+
+	t.Run("Eval", func(t *testing.T) {
+		key := keyPrefix + "counter"
+
+		t.Run("falls back to EVAL when the script is not cached", func(t *testing.T) {
+			c := factory(t)
+			if err := c.ScriptFlush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			n, err := redis.Int(c.Eval(incrByScript, []string{key}, 5))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 5 {
+				t.Errorf("got %d, want 5", n)
+			}
+
+			exists, err := c.ScriptExists(incrByScript)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(exists) != 1 || !exists[0] {
+				t.Errorf("got %v, want [true]", exists)
+			}
+		})
+
+		t.Run("loaded script runs with EVALSHA", func(t *testing.T) {
+			c := factory(t)
+			c.ScriptFlush()
+			if err := c.ScriptLoad(incrByScript); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			n, err := redis.Int(c.Eval(incrByScript, []string{key}, 2))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("got %d, want 2", n)
+			}
+		})
+
+		t.Run("flushed script no longer exists", func(t *testing.T) {
+			c := factory(t)
+			c.ScriptLoad(incrByScript)
+			if err := c.ScriptFlush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			exists, err := c.ScriptExists(incrByScript)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(exists) != 1 || exists[0] {
+				t.Errorf("got %v, want [false]", exists)
+			}
+		})
+
+		t.Run("script errors are returned", func(t *testing.T) {
+			c := factory(t)
+			if _, err := c.Eval(errorScript, nil); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	})
+
+	t.Run("Streams", func(t *testing.T) {
+		key := keyPrefix + "stream"
+
+		t.Run("XAdd appends entries read back by XRange", func(t *testing.T) {
+			c := factory(t)
+			id, err := c.XAdd(key, "1-1", map[string]interface{}{"name": "jimmy"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id != "1-1" {
+				t.Errorf("got %q, want %q", id, "1-1")
+			}
+			if _, err := c.XAdd(key, "*", map[string]interface{}{"name": "redis"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := c.XAdd(key, "*", nil); err == nil {
+				t.Error("expected error, got nil")
+			}
+
+			n, err := c.XLen(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("got %d, want 2", n)
+			}
+
+			entries, err := c.XRange(key, "-", "+", 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("got len %d, want 2", len(entries))
+			}
+			if entries[0].ID != "1-1" || entries[0].Fields["name"] != "jimmy" {
+				t.Errorf("got %v, want {1-1 map[name:jimmy]}", entries[0])
+			}
+			if entries[1].Fields["name"] != "redis" {
+				t.Errorf("got %v, want name redis", entries[1])
+			}
+
+			entries, err = c.XRange(key, "-", "+", 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("got len %d, want 1", len(entries))
+			}
+		})
+
+		t.Run("XDel and XTrim remove entries", func(t *testing.T) {
+			c := factory(t)
+			for i := 1; i <= 5; i++ {
+				c.XAdd(key, fmt.Sprintf("%d-0", i), map[string]interface{}{"i": i})
+			}
+
+			n, err := c.XDel(key, "1-0", "9-0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 1 {
+				t.Errorf("got %d, want 1", n)
+			}
+
+			n, err = c.XTrim(key, 2, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("got %d, want 2", n)
+			}
+
+			entries, _ := c.XRange(key, "-", "+", 0)
+			if len(entries) != 2 || entries[0].ID != "4-0" {
+				t.Errorf("got %v, want entries 4-0 and 5-0", entries)
+			}
+		})
+
+		t.Run("XRead reads entries after an ID", func(t *testing.T) {
+			c := factory(t)
+			c.XAdd(key, "1-0", map[string]interface{}{"a": "1"})
+			c.XAdd(key, "2-0", map[string]interface{}{"b": "2"})
+
+			streams, err := c.XRead(map[string]string{key: "1-0"}, 0, redis.NoBlock)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(streams) != 1 || streams[0].Name != key {
+				t.Fatalf("got %v, want stream %q", streams, key)
+			}
+			if len(streams[0].Entries) != 1 || streams[0].Entries[0].ID != "2-0" {
+				t.Errorf("got %v, want entry 2-0", streams[0].Entries)
+			}
+		})
+
+		t.Run("XRead returns ErrNil when blocking times out", func(t *testing.T) {
+			c := factory(t)
+			c.XAdd(key, "1-0", map[string]interface{}{"a": "1"})
+
+			_, err := c.XRead(map[string]string{key: "$"}, 0, 50*time.Millisecond)
+			if err != redis.ErrNil {
+				t.Errorf("got %v, want %v", err, redis.ErrNil)
+			}
+		})
+
+		t.Run("consumer groups track delivered entries", func(t *testing.T) {
+			c := factory(t)
+			if err := c.XGroupCreate(key, "group", "0", true); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c.XAdd(key, "1-0", map[string]interface{}{"a": "1"})
+			c.XAdd(key, "2-0", map[string]interface{}{"b": "2"})
+
+			streams, err := c.XReadGroup("group", "alice", map[string]string{key: ">"}, 0, redis.NoBlock)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(streams) != 1 || len(streams[0].Entries) != 2 {
+				t.Fatalf("got %v, want 2 entries", streams)
+			}
+
+			summary, err := c.XPending(key, "group")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if summary.Count != 2 || summary.Lowest != "1-0" || summary.Highest != "2-0" || summary.Consumers["alice"] != 2 {
+				t.Errorf("got %+v, want 2 entries pending for alice", summary)
+			}
+
+			n, err := c.XAck(key, "group", "1-0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != 1 {
+				t.Errorf("got %d, want 1", n)
+			}
+
+			pending, err := c.XPendingRange(key, "group", "-", "+", 0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pending) != 1 || pending[0].ID != "2-0" || pending[0].Consumer != "alice" || pending[0].DeliveryCount != 1 {
+				t.Errorf("got %+v, want 2-0 pending for alice", pending)
+			}
+
+			claimed, err := c.XClaim(key, "group", "bob", 0, "2-0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(claimed) != 1 || claimed[0].ID != "2-0" || claimed[0].Fields["b"] != "2" {
+				t.Errorf("got %v, want entry 2-0", claimed)
+			}
+
+			next, claimed, err := c.XAutoClaim(key, "group", "carol", 0, "0-0", 10)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if next != "0-0" {
+				t.Errorf("got %q, want %q", next, "0-0")
+			}
+			if len(claimed) != 1 || claimed[0].ID != "2-0" {
+				t.Errorf("got %v, want entry 2-0", claimed)
+			}
+
+			summary, _ = c.XPending(key, "group")
+			if summary.Consumers["carol"] != 1 {
+				t.Errorf("got %+v, want 1 entry pending for carol", summary)
+			}
+
+			if err := c.XGroupCreate(key, "group", "0", false); err == nil {
+				t.Error("expected error creating existing group, got nil")
+			}
+			destroyed, err := c.XGroupDestroy(key, "group")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !destroyed {
+				t.Error("expected true, got false")
+			}
+		})
+
+		t.Run("XInfo describes streams, groups and consumers", func(t *testing.T) {
+			c := factory(t)
+			c.XAdd(key, "1-0", map[string]interface{}{"a": "1"})
+			c.XAdd(key, "2-0", map[string]interface{}{"b": "2"})
+			c.XGroupCreate(key, "group", "0", false)
+			c.XReadGroup("group", "alice", map[string]string{key: ">"}, 1, redis.NoBlock)
+
+			info, err := c.XInfoStream(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.Length != 2 || info.Groups != 1 || info.LastGeneratedID != "2-0" {
+				t.Errorf("got %+v, want 2 entries in 1 group up to 2-0", info)
+			}
+			if info.FirstEntry == nil || info.FirstEntry.ID != "1-0" || info.LastEntry == nil || info.LastEntry.ID != "2-0" {
+				t.Errorf("got %+v, want first entry 1-0 and last entry 2-0", info)
+			}
+
+			groups, err := c.XInfoGroups(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(groups) != 1 || groups[0].Name != "group" || groups[0].Consumers != 1 || groups[0].Pending != 1 || groups[0].LastDeliveredID != "1-0" {
+				t.Errorf("got %+v, want group with 1 consumer and 1 pending", groups)
+			}
+
+			consumers, err := c.XInfoConsumers(key, "group")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(consumers) != 1 || consumers[0].Name != "alice" || consumers[0].Pending != 1 {
+				t.Errorf("got %+v, want alice with 1 pending", consumers)
+			}
+		})
+	})
+}
+
+func runBatchCommands(t *testing.T, factory func(t *testing.T) Target) {
+	key := keyPrefix + "foo"
+
+	t.Run("Pipelined", func(t *testing.T) {
+		t.Run("futures resolve to typed results", func(t *testing.T) {
+			c := factory(t)
+			c.Set(key, "bar")
+			c.HMSet(keyPrefix+"hash", map[string]interface{}{"a": "1", "b": "2"})
+			c.ZAdd(keyPrefix+"zset", 1, "one", 2, "two")
+
+			var get *redis.StringFuture
+			var hgetall *redis.StringMapFuture
+			var zrange *redis.ZFuture
+			var incr *redis.IntFuture
+			replies, err := c.Pipelined(func(p redis.Pipeline) {
+				get = p.Get(key)
+				hgetall = p.HGetAll(keyPrefix + "hash")
+				zrange = p.ZRangeWithScores(keyPrefix+"zset", 0, -1)
+				incr = p.Incr(keyPrefix + "counter")
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(replies) != 4 {
+				t.Fatalf("got len %d, want 4", len(replies))
+			}
+
+			if val, err := get.Result(); err != nil || val != "bar" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "bar")
+			}
+			if hash := hgetall.Val(); len(hash) != 2 || hash["a"] != "1" || hash["b"] != "2" {
+				t.Errorf("got %v, want map[a:1 b:2]", hash)
+			}
+			zs, err := zrange.Result()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(zs) != 2 || zs[0] != (redis.Z{Value: "one", Score: 1}) || zs[1] != (redis.Z{Value: "two", Score: 2}) {
+				t.Errorf("got %v, want [{one 1} {two 2}]", zs)
+			}
+			if incr.Val() != 1 {
+				t.Errorf("got %d, want 1", incr.Val())
+			}
+		})
+
+		t.Run("futures are pending until the pipeline runs", func(t *testing.T) {
+			c := factory(t)
+			var get *redis.StringFuture
+			c.Pipelined(func(p redis.Pipeline) {
+				get = p.Get(key)
+				if err := get.Err(); err != redis.ErrPending {
+					t.Errorf("got %v, want %v", err, redis.ErrPending)
+				}
+			})
+			if err := get.Err(); err != redis.ErrNil {
+				t.Errorf("got %v, want %v", err, redis.ErrNil)
+			}
+		})
+
+		t.Run("a failed command fails only its own future", func(t *testing.T) {
+			c := factory(t)
+			c.Set(key, "bar")
+
+			var hgetall *redis.StringMapFuture
+			var get *redis.StringFuture
+			_, err := c.Pipelined(func(p redis.Pipeline) {
+				hgetall = p.HGetAll(key)
+				get = p.Get(key)
+			})
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !errors.Is(hgetall.Err(), redis.ErrWrongType) {
+				t.Errorf("got %v, want %v", hgetall.Err(), redis.ErrWrongType)
+			}
+			if val, err := get.Result(); err != nil || val != "bar" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "bar")
+			}
+
+			// The target is left ready for further commands.
+			if val, err := c.Get(key); err != nil || val != "bar" {
+				t.Errorf("got %q, %v, want %q, nil", val, err, "bar")
+			}
+		})
+
+		t.Run("pipelined scripts resolve futures", func(t *testing.T) {
+			c := factory(t)
+			c.ScriptFlush()
+
+			var first, second *redis.ReplyFuture
+			_, err := c.Pipelined(func(p redis.Pipeline) {
+				first = p.Eval(incrByScript, []string{keyPrefix + "counter"}, 1)
+				second = p.Eval(incrByScript, []string{keyPrefix + "counter"}, 1)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n, err := redis.Int(first.Result()); err != nil || n != 1 {
+				t.Errorf("got %d, %v, want 1, nil", n, err)
+			}
+			if n, err := redis.Int(second.Result()); err != nil || n != 2 {
+				t.Errorf("got %d, %v, want 2, nil", n, err)
+			}
+		})
+
+		t.Run("pipelined stream commands resolve futures", func(t *testing.T) {
+			c := factory(t)
+			var add *redis.StringFuture
+			var entries *redis.StreamEntriesFuture
+			_, err := c.Pipelined(func(p redis.Pipeline) {
+				add = p.XAdd(keyPrefix+"stream", "1-0", map[string]interface{}{"a": "1"})
+				entries = p.XRange(keyPrefix+"stream", "-", "+", 0)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if add.Val() != "1-0" {
+				t.Errorf("got %q, want %q", add.Val(), "1-0")
+			}
+			if e := entries.Val(); len(e) != 1 || e[0].Fields["a"] != "1" {
+				t.Errorf("got %v, want entry 1-0", e)
+			}
+		})
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		t.Run("futures resolve to the replies of EXEC", func(t *testing.T) {
+			c := factory(t)
+			var set *redis.StatusFuture
+			var incr *redis.IntFuture
+			var get *redis.StringFuture
+			_, err := c.Transaction(func(tx redis.Transaction) {
+				set = tx.Set(key, "bar")
+				incr = tx.Incr(keyPrefix + "counter")
+				get = tx.Get(key)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status, err := set.Result(); err != nil || status != "OK" {
+				t.Errorf("got %q, %v, want %q, nil", status, err, "OK")
+			}
+			if incr.Val() != 1 {
+				t.Errorf("got %d, want 1", incr.Val())
+			}
+			if get.Val() != "bar" {
+				t.Errorf("got %q, want %q", get.Val(), "bar")
+			}
+		})
+	})
+}
+
+func runTransactions(t *testing.T, factory func(t *testing.T) Target) {
+	key := keyPrefix + "foo"
+
+	t.Run("Watch", func(t *testing.T) {
+		t.Run("modified watched key aborts transaction", func(t *testing.T) {
+			target := factory(t)
+			c := connection(t, target)
+			if err := c.Watch(key); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			target.Set(key, "changed")
+
+			var set *redis.StatusFuture
+			replies, err := c.Transaction(func(tx redis.Transaction) {
+				set = tx.Set(key, "bar")
+			})
+			if err != redis.ErrTxAborted {
+				t.Errorf("got %v, want %v", err, redis.ErrTxAborted)
+			}
+			if replies != nil {
+				t.Errorf("expected nil replies, got %v", replies)
+			}
+			if set.Err() != redis.ErrTxAborted {
+				t.Errorf("got %v, want %v", set.Err(), redis.ErrTxAborted)
+			}
+
+			val, _ := c.Get(key)
+			if val != "changed" {
+				t.Errorf("got %q, want %q", val, "changed")
+			}
+		})
+
+		t.Run("unwatched key does not abort transaction", func(t *testing.T) {
+			target := factory(t)
+			c := connection(t, target)
+			c.Watch(key)
+			if err := c.Unwatch(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			target.Set(key, "changed")
+
+			_, err := c.Transaction(func(tx redis.Transaction) {
+				tx.Set(key, "bar")
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			val, _ := c.Get(key)
+			if val != "bar" {
+				t.Errorf("got %q, want %q", val, "bar")
+			}
+		})
+	})
+
+	t.Run("Multi", func(t *testing.T) {
+		t.Run("Exec runs queued commands", func(t *testing.T) {
+			c := connection(t, factory(t))
+			if err := c.Multi(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c.Send("SET", key, "bar")
+			c.Send("GET", key)
+			replies, err := c.Exec()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(replies) != 2 || replies[0] != "OK" || string(replies[1].([]byte)) != "bar" {
+				t.Errorf("got %q, want [OK bar]", replies)
+			}
+		})
+
+		t.Run("Discard discards queued commands", func(t *testing.T) {
+			c := connection(t, factory(t))
+			if err := c.Multi(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c.Send("SET", key, "bar")
+			if err := c.Discard(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			exists, err := c.Exists(key)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if exists {
+				t.Error("expected false, got true")
+			}
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package redistest_test
+
+import (
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestConformance(t *testing.T) {
+	f := redistest.New(redistest.Options{})
+	defer f.Close()
+	p, err := f.NewPool("redis://redistest", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	t.Run("Fake", func(t *testing.T) {
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
+			f.FlushAll()
+			return p
+		})
+	})
+
+	t.Run("Connection of a Fake", func(t *testing.T) {
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
+			f.FlushAll()
+			return c
+		})
+	})
+
+	t.Run("Server speaking RESP3", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		config := redis.DefaultConfig
+		config.Protocol = 3
+		p := newPool(t, s.URL(), config)
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
+			s.FlushAll()
+			return p
+		})
+	})
+}
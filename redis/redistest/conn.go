@@ -0,0 +1,322 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// client is the state of a connection to a fake.
+type client struct {
+	f    *Fake
+	conn net.Conn
+	w    *replyWriter
+	db   *db
+
+	id   int
+	name string
+	// The version of RESP the client speaks, 2 unless it's switched to 3 with HELLO.
+	protocol      int
+	authenticated bool
+
+	// The commands queued since MULTI, nil if it wasn't sent, and whether any failed to be.
+	multi       [][]string
+	multiFailed bool
+	// The keys watched with WATCH, and whether any has been modified since.
+	watched        map[watchKey]bool
+	watchedChanged bool
+	// Set while EXEC runs the commands of a transaction, or a script runs, as their commands
+	// don't block.
+	atomic bool
+
+	channels map[string]bool
+	patterns map[string]bool
+
+	// Closed once the connection is closed by the other end.
+	gone chan struct{}
+	quit bool
+}
+
+// serve runs the commands sent on conn until it's closed.
+func (f *Fake) serve(conn net.Conn) {
+	c := &client{
+		f:        f,
+		conn:     conn,
+		w:        newReplyWriter(conn),
+		db:       f.dbs[0],
+		protocol: 2,
+		watched:  map[watchKey]bool{},
+		channels: map[string]bool{},
+		patterns: map[string]bool{},
+		gone:     make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		conn.Close()
+		return
+	}
+	f.clients[c] = true
+	f.lastClientID++
+	c.id = f.lastClientID
+	c.authenticated = f.password == ""
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		c.unwatch()
+		c.unsubscribeAll()
+		delete(f.clients, c)
+		f.mu.Unlock()
+
+		// Lets the last replies, such as QUIT's, be read before the connection is closed.
+		c.w.close()
+		select {
+		case <-c.w.done:
+		case <-time.After(time.Second):
+		}
+		conn.Close()
+	}()
+
+	// Commands are read by a goroutine of their own, so that a client blocked waiting on a key can
+	// tell if the connection is closed meanwhile.
+	commands := make(chan []string)
+	go func() {
+		defer close(c.gone)
+		r := bufio.NewReader(conn)
+		for {
+			args, err := readCommand(r)
+			if err != nil {
+				if protocolErr, ok := err.(protocolError); ok {
+					c.reply(replyError(protocolErr.Error()))
+				}
+				return
+			}
+			select {
+			case commands <- args:
+			case <-f.done:
+				return
+			}
+		}
+	}()
+
+	for !c.quit {
+		select {
+		case args := <-commands:
+			if len(args) == 0 {
+				continue
+			}
+			failure := f.failure(args)
+			if failure.Delay > 0 {
+				select {
+				case <-time.After(failure.Delay):
+				case <-c.gone:
+					return
+				case <-f.done:
+					return
+				}
+			}
+			switch {
+			case failure.Drop:
+				return
+			case failure.Error != "":
+				c.reply(replyError(failure.Error))
+			default:
+				c.reply(c.run(args))
+			}
+		case <-c.gone:
+			return
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// reply queues a reply to be written to the client, in the version of RESP it speaks.
+func (c *client) reply(v interface{}) {
+	c.w.write(v, c.protocol == 3)
+}
+
+// Commands which may be sent by a client before it authenticates.
+var noAuthCommands = map[string]bool{
+	"AUTH": true, "HELLO": true, "QUIT": true,
+}
+
+// Commands which may be sent by a client subscribed to channels or patterns.
+var subscribedCommands = map[string]bool{
+	"SUBSCRIBE": true, "PSUBSCRIBE": true, "UNSUBSCRIBE": true, "PUNSUBSCRIBE": true, "PING": true, "QUIT": true, "RESET": true,
+}
+
+// Commands which aren't queued by a transaction, but run at once.
+var transactionCommands = map[string]bool{
+	"MULTI": true, "EXEC": true, "DISCARD": true, "WATCH": true, "QUIT": true, "RESET": true,
+}
+
+// run runs a command and returns its reply, or queues it if a transaction has been started.
+func (c *client) run(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	cmd, found := commands[name]
+	if !found {
+		c.multiFailed = c.multi != nil
+		var quoted []string
+		for _, arg := range args[1:] {
+			quoted = append(quoted, "'"+arg+"'")
+		}
+		return replyError(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", args[0], strings.Join(quoted, " ")))
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		c.multiFailed = c.multi != nil
+		return wrongArgs(name)
+	}
+	if !c.authenticated && !noAuthCommands[name] {
+		c.multiFailed = c.multi != nil
+		return replyError("NOAUTH Authentication required.")
+	}
+	if c.subscribed() && !subscribedCommands[name] {
+		return replyError(fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(name)))
+	}
+
+	if c.multi != nil && !transactionCommands[name] {
+		c.multi = append(c.multi, args)
+		return queued
+	}
+
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	return cmd.run(c, args)
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels) > 0 || len(c.patterns) > 0
+}
+
+// blockUntil waits, with the fake unlocked, until a key is modified, and reports whether one was
+// before deadline, or forever if deadline is zero. It gives up at once if a transaction is being
+// executed or a script run, as their commands don't block, and if the connection is closed.
+func (c *client) blockUntil(deadline time.Time) bool {
+	if c.atomic {
+		return false
+	}
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false
+		}
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	changed := c.f.changed
+	c.f.mu.Unlock()
+	defer c.f.mu.Lock()
+
+	select {
+	case <-changed:
+		return true
+	case <-timeout:
+	case <-c.gone:
+	case <-c.f.done:
+	}
+	return false
+}
+
+// deadline returns when a command blocking for timeout gives up waiting, or zero if it waits
+// forever, as it does if timeout is 0.
+func deadline(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// Transactions - https://redis.io/commands#transactions
+
+func multi(c *client, args []string) interface{} {
+	if c.multi != nil {
+		return replyError("ERR MULTI calls can not be nested")
+	}
+	c.multi = [][]string{}
+	c.multiFailed = false
+	return ok
+}
+
+func exec(c *client, args []string) interface{} {
+	if c.multi == nil {
+		return replyError("ERR EXEC without MULTI")
+	}
+	queued, failed := c.multi, c.multiFailed
+	c.multi, c.multiFailed = nil, false
+	defer c.unwatch()
+
+	if failed {
+		return replyError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	// Watched keys which have expired since are modified too.
+	for key := range c.watched {
+		c.f.dbs[key.db].get(key.key)
+	}
+	if c.watchedChanged {
+		return nilArray{}
+	}
+
+	c.atomic = true
+	defer func() { c.atomic = false }()
+
+	replies := make([]interface{}, len(queued))
+	for i, args := range queued {
+		replies[i] = commands[strings.ToUpper(args[0])].run(c, args)
+	}
+	return replies
+}
+
+func discard(c *client, args []string) interface{} {
+	if c.multi == nil {
+		return replyError("ERR DISCARD without MULTI")
+	}
+	c.multi, c.multiFailed = nil, false
+	c.unwatch()
+	return ok
+}
+
+func watch(c *client, args []string) interface{} {
+	if c.multi != nil {
+		c.multiFailed = true
+		return replyError("ERR Command not allowed inside a transaction")
+	}
+	for _, key := range args[1:] {
+		// Expires the key first if it's due to, so that doesn't count as a modification.
+		c.db.get(key)
+
+		k := watchKey{c.db.index, key}
+		if c.watched[k] {
+			continue
+		}
+		c.watched[k] = true
+		if c.f.watchers[k] == nil {
+			c.f.watchers[k] = map[*client]bool{}
+		}
+		c.f.watchers[k][c] = true
+	}
+	return ok
+}
+
+func unwatchCommand(c *client, args []string) interface{} {
+	c.unwatch()
+	return ok
+}
+
+func (c *client) unwatch() {
+	for k := range c.watched {
+		delete(c.f.watchers[k], c)
+		if len(c.f.watchers[k]) == 0 {
+			delete(c.f.watchers, k)
+		}
+	}
+	c.watched = map[watchKey]bool{}
+	c.watchedChanged = false
+}
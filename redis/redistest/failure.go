@@ -0,0 +1,72 @@
+package redistest
+
+import (
+	"strings"
+	"time"
+)
+
+// LoadingError is the error Redis replies with while it loads its dataset, for a Failure's Error.
+const LoadingError = "LOADING Redis is loading the dataset in memory"
+
+// Failure is a failure injected into the commands sent to a Fake, with Inject.
+type Failure struct {
+	// Command is the name of the command which fails, or "" for any command.
+	Command string
+	// Times is the number of commands which fail, or 0 for every one until ClearFailures.
+	Times int
+	// Delay delays the command's reply, or its failure, by as long.
+	Delay time.Duration
+	// Drop closes the connection, in place of replying.
+	Drop bool
+	// Error is replied in place of the command's reply, and without running it, if it isn't "",
+	// e.g. LoadingError.
+	Error string
+}
+
+// Inject injects failures into the commands sent to the fake from now on. Each command fails as
+// the first of the failures injected which it matches, if any.
+func (f *Fake) Inject(failures ...Failure) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, failure := range failures {
+		failure := failure
+		f.failures = append(f.failures, &failure)
+	}
+}
+
+// ClearFailures clears the failures injected which are left, so that commands no longer fail.
+func (f *Fake) ClearFailures() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = nil
+}
+
+// DropConnections closes every connection to the fake, as a server restarting would, but accepts
+// new ones.
+func (f *Fake) DropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.clients {
+		c.conn.Close()
+	}
+}
+
+// failure returns the failure of a command, or a zero Failure if it doesn't fail, and counts it
+// against the failure's Times.
+func (f *Fake) failure(args []string) Failure {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, failure := range f.failures {
+		if failure.Command != "" && !strings.EqualFold(failure.Command, args[0]) {
+			continue
+		}
+		if failure.Times > 0 {
+			failure.Times--
+			if failure.Times == 0 {
+				f.failures = append(f.failures[:i:i], f.failures[i+1:]...)
+			}
+		}
+		return *failure
+	}
+	return Failure{}
+}
@@ -0,0 +1,330 @@
+// Package redistest is an in-memory fake of Redis, for unit testing code which uses the redis
+// package without a Redis server to run against. A Server serves one over a socket, for code which
+// connects to Redis by URL. LeaseDB and LeasePrefix lease each test a namespace of a Redis server of
+// its own, and seed it with fixtures, for tests which run against one.
+package redistest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+)
+
+// Databases is the number of databases of a Fake, as many as Redis has by default.
+const Databases = 16
+
+// Version is the version of Redis a Fake replies to HELLO as.
+const Version = "7.2.0"
+
+// Fake is an in-memory Redis. The pools of its NewPool speak RESP to it over in-memory
+// connections, so that each command of their Connections, Pipelines and Transactions runs as it
+// would against a Redis server, replying as Redis would, errors included. It is safe for
+// concurrent use, and each command, and each transaction, runs atomically.
+//
+// It runs the commands of redis.Commands, and a few more, such as TYPE, KEYS and FLUSHDB. It can't
+// run Lua, so scripts must be registered with a Go function standing in for them, with
+// RegisterScript.
+//
+// Commands which block, such as BLPOP, wait in real time, but keys expire, and stream IDs are
+// generated, by the time of its Options.Now, so that tests can move it on with a Clock.
+type Fake struct {
+	// mu guards everything below, and is held while each command runs.
+	mu  sync.Mutex
+	now func() time.Time
+	dbs [Databases]*db
+	// Numbers keys and members as they're created, for SCAN to iterate them by.
+	seq uint64
+	// Closed, and replaced, whenever a key is modified, to wake the clients blocked on one.
+	changed chan struct{}
+	// The clients watching each key with WATCH.
+	watchers map[watchKey]map[*client]bool
+
+	// The clients subscribed to each channel and pattern.
+	channels map[string]map[*client]bool
+	patterns map[string]map[*client]bool
+
+	// Scripts loaded into the script cache, and the Go functions registered for them, by SHA1.
+	loaded  map[string]bool
+	scripts map[string]ScriptFunc
+
+	// The password clients must authenticate with, as by requirepass, if it isn't empty.
+	password string
+	// The failures injected into commands, in the order they're matched in.
+	failures []*Failure
+
+	clients      map[*client]bool
+	lastClientID int
+	done         chan struct{}
+	closed       bool
+}
+
+// Options configure a Fake.
+type Options struct {
+	// Now is the time keys expire by, and stream IDs are generated from, and defaults to
+	// time.Now. See Clock.
+	Now func() time.Time
+	// Password is required of clients, as requirepass is by Redis, if it isn't empty. It can be
+	// changed with CONFIG SET requirepass.
+	Password string
+}
+
+// New returns a Fake with no keys.
+func New(options Options) *Fake {
+	f := &Fake{
+		now:      options.Now,
+		password: options.Password,
+		changed:  make(chan struct{}),
+		watchers: map[watchKey]map[*client]bool{},
+		channels: map[string]map[*client]bool{},
+		patterns: map[string]map[*client]bool{},
+		loaded:   map[string]bool{},
+		scripts:  map[string]ScriptFunc{},
+		clients:  map[*client]bool{},
+		done:     make(chan struct{}),
+	}
+	if f.now == nil {
+		f.now = time.Now
+	}
+	for i := range f.dbs {
+		f.dbs[i] = &db{f: f, index: i, keys: map[string]*value{}}
+	}
+	registerConformanceScripts(f)
+	return f
+}
+
+// NewPool returns a pool of connections to the fake, like redis.NewPool. The database of url is
+// selected, as it would be by Redis, but its host is ignored, e.g. "redis://redistest/1".
+func (f *Fake) NewPool(url string, config redis.Config) (redis.Pool, error) {
+	config.DialOptions = append(config.DialOptions[:len(config.DialOptions):len(config.DialOptions)],
+		redigo.DialContextFunc(func(context.Context, string, string) (net.Conn, error) {
+			return f.Dial()
+		}))
+	return redis.NewPool(url, config)
+}
+
+// Dial returns a new connection to the fake, which speaks RESP.
+func (f *Fake) Dial() (net.Conn, error) {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return nil, net.ErrClosed
+	}
+
+	client, server := net.Pipe()
+	go f.serve(server)
+	return client, nil
+}
+
+// Close disconnects every connection to the fake, and refuses new ones.
+func (f *Fake) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.done)
+	for c := range f.clients {
+		c.conn.Close()
+	}
+}
+
+// FlushAll deletes every key of every database.
+func (f *Fake) FlushAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.dbs {
+		d.flush()
+	}
+}
+
+// Clock is a time which only moves when it's told to, for the Now of Options.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock on by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindList
+	kindHash
+	kindSet
+	kindZSet
+	kindStream
+)
+
+// String returns the kind as TYPE names it.
+func (k valueKind) String() string {
+	return [...]string{"string", "list", "hash", "set", "zset", "stream"}[k]
+}
+
+// value is the value of a key, of one of the kinds.
+type value struct {
+	kind   valueKind
+	str    string
+	list   []string
+	hash   map[string]string
+	set    map[string]uint64 // Members, numbered as they were added.
+	zset   map[string]zmember
+	stream *stream
+	// The elements added to a HyperLogLog, which is a string, "HYLL", to other commands.
+	hll map[string]bool
+
+	// When the key expires, if it does.
+	expires time.Time
+	// Numbers the key as it was created.
+	seq uint64
+}
+
+// empty reports whether the value is a collection with nothing left in it, which Redis deletes.
+func (v *value) empty() bool {
+	switch v.kind {
+	case kindList:
+		return len(v.list) == 0
+	case kindHash:
+		return len(v.hash) == 0
+	case kindSet:
+		return len(v.set) == 0
+	case kindZSet:
+		return len(v.zset) == 0
+	}
+	return false
+}
+
+// db is one of the databases of a fake, which SELECT chooses between.
+type db struct {
+	f     *Fake
+	index int
+	keys  map[string]*value
+}
+
+type watchKey struct {
+	db  int
+	key string
+}
+
+// get returns the value of key, or nil if it has none, deleting it if it has expired.
+func (d *db) get(key string) *value {
+	v := d.keys[key]
+	if v == nil {
+		return nil
+	}
+	if !v.expires.IsZero() && !d.f.now().Before(v.expires) {
+		delete(d.keys, key)
+		d.touch(key)
+		return nil
+	}
+	return v
+}
+
+// getKind returns the value of key, or nil if it has none, or errWrongType if it's of another kind.
+func (d *db) getKind(key string, kind valueKind) (*value, error) {
+	v := d.get(key)
+	if v != nil && v.kind != kind {
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+// getOrCreate returns the value of key, creating it if it has none, or errWrongType if it's of
+// another kind.
+func (d *db) getOrCreate(key string, kind valueKind) (*value, error) {
+	v, err := d.getKind(key, kind)
+	if err != nil || v != nil {
+		return v, err
+	}
+
+	v = &value{kind: kind}
+	switch kind {
+	case kindHash:
+		v.hash = map[string]string{}
+	case kindSet:
+		v.set = map[string]uint64{}
+	case kindZSet:
+		v.zset = map[string]zmember{}
+	case kindStream:
+		v.stream = newStream()
+	}
+	d.set(key, v)
+	return v, nil
+}
+
+// set sets the value of key, replacing any it had.
+func (d *db) set(key string, v *value) {
+	v.seq = d.f.next()
+	d.keys[key] = v
+	d.touch(key)
+}
+
+// delete deletes key, reporting whether it had a value.
+func (d *db) delete(key string) bool {
+	if d.get(key) == nil {
+		return false
+	}
+	delete(d.keys, key)
+	d.touch(key)
+	return true
+}
+
+// modified records that the value of key was modified in place, deleting it if it's left empty.
+func (d *db) modified(key string, v *value) {
+	if v.empty() {
+		delete(d.keys, key)
+	}
+	d.touch(key)
+}
+
+func (d *db) flush() {
+	for key := range d.keys {
+		d.touch(key)
+	}
+	d.keys = map[string]*value{}
+}
+
+// touch marks the transactions of the clients watching key to be aborted, and wakes the clients
+// blocked waiting for a key to change.
+func (d *db) touch(key string) {
+	for c := range d.f.watchers[watchKey{d.index, key}] {
+		c.watchedChanged = true
+	}
+	close(d.f.changed)
+	d.f.changed = make(chan struct{})
+}
+
+// next returns the next number of a key or member.
+func (f *Fake) next() uint64 {
+	f.seq++
+	return f.seq
+}
@@ -0,0 +1,490 @@
+package redistest_test
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestFake(t *testing.T) {
+	clock := redistest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	f := redistest.New(redistest.Options{Now: clock.Now})
+	defer f.Close()
+
+	p, err := f.NewPool("redis://redistest", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	t.Run("expires keys by its clock", func(t *testing.T) {
+		f.FlushAll()
+		p.SetEx("key", "value", 10)
+		p.Set("other", "value")
+		p.Expire("other", 20)
+
+		if ttl, _ := p.TTL("key"); ttl != 10 {
+			t.Errorf("expected a TTL of 10 but got %d", ttl)
+		}
+		clock.Advance(10*time.Second - time.Millisecond)
+		if value, err := p.Get("key"); err != nil || value != "value" {
+			t.Errorf("expected the key not to have expired yet but got %q, %v", value, err)
+		}
+		clock.Advance(time.Millisecond)
+		if _, err := p.Get("key"); err != redigo.ErrNil {
+			t.Errorf("expected the key to have expired but got %v", err)
+		}
+		if ttl, _ := p.TTL("key"); ttl != -2 {
+			t.Errorf("expected a TTL of -2 for an expired key but got %d", ttl)
+		}
+		if ttl, _ := p.TTL("other"); ttl != 10 {
+			t.Errorf("expected a TTL of 10 left but got %d", ttl)
+		}
+
+		// Setting a key drops its TTL, but renaming it keeps it.
+		p.Set("other", "value")
+		if ttl, _ := p.TTL("other"); ttl != -1 {
+			t.Errorf("expected no TTL but got %d", ttl)
+		}
+		p.Expire("other", 5)
+		p.Rename("other", "renamed")
+		if ttl, _ := p.TTL("renamed"); ttl != 5 {
+			t.Errorf("expected a TTL of 5 but got %d", ttl)
+		}
+	})
+
+	t.Run("fails commands against keys of the wrong type", func(t *testing.T) {
+		f.FlushAll()
+		p.Set("key", "value")
+
+		_, err := p.LPush("key", "value")
+		var cmdErr *redis.Error
+		if !errors.Is(err, redis.ErrWrongType) || !errors.As(err, &cmdErr) || cmdErr.Command != "LPUSH" || cmdErr.Key != "key" {
+			t.Errorf("expected ErrWrongType of LPUSH key but got %#v", err)
+		}
+		if _, err := p.ZCard("key"); !errors.Is(err, redis.ErrWrongType) {
+			t.Errorf("expected ErrWrongType but got %v", err)
+		}
+		if _, err := p.Incr("key"); err == nil || err.Error() != "ERR value is not an integer or out of range" {
+			t.Errorf("expected an error incrementing a string but got %v", err)
+		}
+		if value, _ := p.Get("key"); value != "value" {
+			t.Errorf("expected the key to be left as it was but got %q", value)
+		}
+	})
+
+	t.Run("orders sorted sets by score then member", func(t *testing.T) {
+		f.FlushAll()
+		p.ZAdd("zset", 2, "b", 1, "z", 2, "a", 3, "c", "-inf", "min")
+
+		if members, _ := p.ZRange("zset", 0, -1); !reflect.DeepEqual(members, []string{"min", "z", "a", "b", "c"}) {
+			t.Errorf("expected members ordered by score then member but got %v", members)
+		}
+		if members, _ := p.ZRevRange("zset", 0, 1); !reflect.DeepEqual(members, []string{"c", "b"}) {
+			t.Errorf("expected the top two members but got %v", members)
+		}
+		if members, _ := p.ZRangeByScore("zset", "(1", "+inf"); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+			t.Errorf("expected members scored over 1 but got %v", members)
+		}
+		if members, _ := p.ZRevRangeByScoreWithLimit("zset", "2", "-inf", 1, 2); !reflect.DeepEqual(members, []string{"a", "z"}) {
+			t.Errorf("expected a page of members scored up to 2 but got %v", members)
+		}
+		if z, _ := p.ZRangeWithScores("zset", 1, 1); !reflect.DeepEqual(z, []redis.Z{{Value: "z", Score: 1}}) {
+			t.Errorf("expected z scored 1 but got %v", z)
+		}
+		if rank, _ := p.ZRank("zset", "b"); rank != 3 {
+			t.Errorf("expected b to rank 3rd but got %d", rank)
+		}
+
+		p.ZIncrBy("zset", 10, "a")
+		if members, _ := p.ZRevRange("zset", 0, 0); !reflect.DeepEqual(members, []string{"a"}) {
+			t.Errorf("expected a to be top once incremented but got %v", members)
+		}
+		if score, _ := p.ZScore("zset", "a"); score != 12 {
+			t.Errorf("expected a to be scored 12 but got %v", score)
+		}
+	})
+
+	t.Run("scans every key which exists throughout", func(t *testing.T) {
+		f.FlushAll()
+		for i := 0; i < 100; i++ {
+			p.Set("key:"+strconv.Itoa(i), "value")
+		}
+
+		seen := map[string]bool{}
+		cursor, pages := 0, 0
+		for {
+			next, keys, err := p.Scan(cursor, "key:*", 7)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, key := range keys {
+				seen[key] = true
+			}
+			// Keys deleted and added midway may or may not be returned, but no others may be missed.
+			p.Del("key:" + strconv.Itoa(99-pages))
+			p.Set("new:"+strconv.Itoa(pages), "value")
+			p.Set("key:"+strconv.Itoa(pages), "overwritten")
+
+			pages++
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+		for i := 0; i < 100-pages; i++ {
+			if !seen["key:"+strconv.Itoa(i)] {
+				t.Errorf("expected key:%d to be scanned", i)
+			}
+		}
+		for key := range seen {
+			if key[:4] != "key:" {
+				t.Errorf("expected only keys matching key:* but got %s", key)
+			}
+		}
+		if pages < 100/7 {
+			t.Errorf("expected pages of 7 keys but got %d pages", pages)
+		}
+	})
+
+	t.Run("scans sets and sorted sets", func(t *testing.T) {
+		f.FlushAll()
+		var want []string
+		for i := 0; i < 30; i++ {
+			member := strconv.Itoa(i)
+			p.SAdd("set", member)
+			p.ZAdd("zset", i, member)
+			want = append(want, member)
+		}
+		sort.Strings(want)
+
+		var members, zmembers []string
+		for cursor := -1; cursor != 0; {
+			next, page, err := p.SScan("set", max(cursor, 0), "", 4)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			members, cursor = append(members, page...), next
+		}
+		for cursor := -1; cursor != 0; {
+			next, page, scores, err := p.ZScan("zset", max(cursor, 0), "", 4)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, member := range page {
+				if strconv.Itoa(int(scores[i])) != member {
+					t.Errorf("expected %s to be scored %s but got %v", member, member, scores[i])
+				}
+			}
+			zmembers, cursor = append(zmembers, page...), next
+		}
+		sort.Strings(members)
+		sort.Strings(zmembers)
+		if !reflect.DeepEqual(members, want) || !reflect.DeepEqual(zmembers, want) {
+			t.Errorf("expected every member to be scanned but got %v and %v", members, zmembers)
+		}
+	})
+
+	t.Run("runs transactions atomically", func(t *testing.T) {
+		f.FlushAll()
+		replies, err := p.Transaction(func(t redis.Transaction) {
+			t.Set("key", "value")
+			t.LPush("list", "a", "b")
+			t.Get("key")
+		})
+		if err != nil || !reflect.DeepEqual(replies, []interface{}{"OK", int64(2), []byte("value")}) {
+			t.Errorf("expected the replies of the transaction but got %q, %v", replies, err)
+		}
+
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+		c.Multi()
+		c.Do("SET", "key")
+		if _, err := c.Exec(); !errors.Is(err, redis.ErrExecAbort) {
+			t.Errorf("expected ErrExecAbort but got %v", err)
+		}
+	})
+
+	t.Run("aborts transactions whose watched keys change", func(t *testing.T) {
+		f.FlushAll()
+		p.Set("counter", "0")
+
+		attempts := 0
+		_, err := p.CheckAndSet([]string{"counter"}, 5, func(c redis.Connection) error {
+			attempts++
+			if attempts == 1 {
+				p.Incr("counter")
+			}
+			return nil
+		}, func(t redis.Transaction) {
+			t.Incr("counter")
+		})
+		if err != nil || attempts != 2 {
+			t.Errorf("expected to succeed on the 2nd attempt but got %v after %d", err, attempts)
+		}
+
+		p.Set("expiring", "value")
+		p.Expire("expiring", 1)
+		_, err = p.CheckAndSet([]string{"expiring"}, 0, func(c redis.Connection) error {
+			clock.Advance(time.Second)
+			return nil
+		}, func(t redis.Transaction) {
+			t.Set("expiring", "again")
+		})
+		if !errors.Is(err, redis.ErrTxAborted) {
+			t.Errorf("expected a watched key expiring to abort the transaction but got %v", err)
+		}
+	})
+
+	t.Run("runs pipelines", func(t *testing.T) {
+		f.FlushAll()
+		var push *redis.IntFuture
+		var get *redis.StringFuture
+		p.Pipelined(func(p redis.Pipeline) {
+			for i := 0; i < 1000; i++ {
+				push = p.RPush("list", strconv.Itoa(i))
+			}
+			get = p.Get("list")
+		})
+		if n := push.Val(); n != 1000 {
+			t.Errorf("expected 1000 elements but got %d", n)
+		}
+		if !errors.Is(get.Err(), redis.ErrWrongType) {
+			t.Errorf("expected ErrWrongType but got %v", get.Err())
+		}
+	})
+
+	t.Run("blocks until lists have elements", func(t *testing.T) {
+		f.FlushAll()
+		done := make(chan string)
+		go func() {
+			_, value, _ := p.BLPop(0, "empty", "list")
+			done <- value
+		}()
+		time.Sleep(20 * time.Millisecond)
+		p.RPush("list", "value")
+		select {
+		case value := <-done:
+			if value != "value" {
+				t.Errorf("expected to pop value but got %q", value)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for BLPOP")
+		}
+
+		start := time.Now()
+		if _, _, err := p.BLPop(1, "empty"); err != redigo.ErrNil {
+			t.Errorf("expected ErrNil but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("expected to block for a second but returned after %v", elapsed)
+		}
+	})
+
+	t.Run("keeps databases apart", func(t *testing.T) {
+		f.FlushAll()
+		other, err := f.NewPool("redis://redistest/3", redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer other.Shutdown()
+
+		p.Set("key", "0")
+		other.Set("key", "3")
+		if value, _ := p.Get("key"); value != "0" {
+			t.Errorf("expected 0 in database 0 but got %q", value)
+		}
+		if value, _ := other.Get("key"); value != "3" {
+			t.Errorf("expected 3 in database 3 but got %q", value)
+		}
+	})
+
+	t.Run("runs scripts registered in Go", func(t *testing.T) {
+		f.FlushAll()
+		script := redis.NewScript("return redis.call('INCRBY', KEYS[1], ARGV[1])")
+		f.RegisterScript(script, func(call *redistest.ScriptCall) (interface{}, error) {
+			return call.Call("INCRBY", call.Keys[0], call.Args[0])
+		})
+
+		for want := int64(5); want <= 10; want += 5 {
+			reply, err := p.Eval(script, []string{"counter"}, 5)
+			if err != nil || reply != want {
+				t.Errorf("expected %d but got %v, %v", want, reply, err)
+			}
+		}
+		if _, err := p.Eval(redis.NewScript("return 1"), nil); err == nil {
+			t.Errorf("expected an unregistered script to fail")
+		}
+	})
+
+	t.Run("publishes to subscribers", func(t *testing.T) {
+		ps, err := p.PubSub()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer ps.Close()
+		ps.Subscribe("channel")
+		ps.PSubscribe("pattern:*")
+
+		for _, want := range []redis.Message{
+			{Channel: "channel", Data: "message"},
+			{Channel: "pattern:1", Pattern: "pattern:*", Data: "pmessage"},
+		} {
+			for receivers := 0; receivers == 0; {
+				receivers, _ = p.Publish(want.Channel, want.Data)
+			}
+			select {
+			case m := <-ps.Messages():
+				if m != want {
+					t.Errorf("expected %+v but got %+v", want, m)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for %+v", want)
+			}
+		}
+	})
+
+	t.Run("is safe for concurrent use", func(t *testing.T) {
+		f.FlushAll()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					p.Incr("counter")
+					p.HIncrBy("hash", "field", 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n, _ := p.Incr("counter"); n != 1001 {
+			t.Errorf("expected 1001 but got %d", n)
+		}
+		if n, _ := p.HIncrBy("hash", "field", 0); n != 1000 {
+			t.Errorf("expected 1000 but got %d", n)
+		}
+	})
+}
+
+func TestFakeStreams(t *testing.T) {
+	clock := redistest.NewClock(time.UnixMilli(1000))
+	f := redistest.New(redistest.Options{Now: clock.Now})
+	defer f.Close()
+
+	p, err := f.NewPool("redis://redistest", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	t.Run("generates IDs by its clock", func(t *testing.T) {
+		var ids []string
+		for i := 0; i < 2; i++ {
+			id, err := p.XAdd("stream", "*", map[string]interface{}{"n": strconv.Itoa(i)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		clock.Advance(time.Millisecond)
+		id, _ := p.XAdd("stream", "*", map[string]interface{}{"n": "2"})
+		ids = append(ids, id)
+		if !reflect.DeepEqual(ids, []string{"1000-0", "1000-1", "1001-0"}) {
+			t.Errorf("expected IDs from the clock but got %v", ids)
+		}
+
+		if _, err := p.XAdd("stream", "1000-5", map[string]interface{}{"n": "3"}); err == nil {
+			t.Errorf("expected an ID smaller than the last to fail")
+		}
+		entries, _ := p.XRange("stream", "(1000-0", "+", 0)
+		if len(entries) != 2 || entries[0].ID != "1000-1" || entries[1].Fields["n"] != "2" {
+			t.Errorf("expected the entries after 1000-0 but got %+v", entries)
+		}
+	})
+
+	t.Run("delivers entries to consumer groups", func(t *testing.T) {
+		if err := p.XGroupCreate("stream", "group", "0", false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := p.XGroupCreate("stream", "group", "0", false); err == nil || err.Error()[:9] != "BUSYGROUP" {
+			t.Errorf("expected BUSYGROUP but got %v", err)
+		}
+
+		streams, err := p.XReadGroup("group", "alice", map[string]string{"stream": ">"}, 2, redis.NoBlock)
+		if err != nil || len(streams) != 1 || len(streams[0].Entries) != 2 {
+			t.Fatalf("expected 2 entries but got %+v, %v", streams, err)
+		}
+		streams, _ = p.XReadGroup("group", "bob", map[string]string{"stream": ">"}, 0, redis.NoBlock)
+		if len(streams) != 1 || len(streams[0].Entries) != 1 || streams[0].Entries[0].ID != "1001-0" {
+			t.Errorf("expected bob to get the last entry but got %+v", streams)
+		}
+
+		summary, _ := p.XPending("stream", "group")
+		if summary.Count != 3 || summary.Lowest != "1000-0" || summary.Highest != "1001-0" || summary.Consumers["alice"] != 2 {
+			t.Errorf("unexpected summary %+v", summary)
+		}
+		if n, _ := p.XAck("stream", "group", "1000-0", "1000-0", "9-9"); n != 1 {
+			t.Errorf("expected to acknowledge 1 entry but got %d", n)
+		}
+
+		// Claiming depends on the clock, too.
+		if claimed, _ := p.XClaim("stream", "group", "bob", time.Second, "1000-1"); len(claimed) != 0 {
+			t.Errorf("expected nothing to be idle for long enough but got %+v", claimed)
+		}
+		clock.Advance(time.Second)
+		claimed, err := p.XClaim("stream", "group", "bob", time.Second, "1000-1")
+		if err != nil || len(claimed) != 1 || claimed[0].ID != "1000-1" {
+			t.Errorf("expected to claim 1000-1 but got %+v, %v", claimed, err)
+		}
+		entries, _ := p.XPendingRange("stream", "group", "-", "+", 10)
+		if len(entries) != 2 || entries[0].Consumer != "bob" || entries[0].DeliveryCount != 2 || entries[1].Idle != time.Second {
+			t.Errorf("unexpected pending entries %+v", entries)
+		}
+
+		p.XDel("stream", "1001-0")
+		clock.Advance(time.Second)
+		next, claimed, err := p.XAutoClaim("stream", "group", "alice", time.Second, "0", 10)
+		if err != nil || next != "0-0" || len(claimed) != 1 || claimed[0].ID != "1000-1" {
+			t.Errorf("expected alice to claim 1000-1 alone but got %s %+v, %v", next, claimed, err)
+		}
+
+		groups, _ := p.XInfoGroups("stream")
+		if len(groups) != 1 || groups[0].Pending != 1 || groups[0].Consumers != 2 || groups[0].LastDeliveredID != "1001-0" {
+			t.Errorf("unexpected groups %+v", groups)
+		}
+		info, _ := p.XInfoStream("stream")
+		if info.Length != 2 || info.LastGeneratedID != "1001-0" || info.LastEntry == nil || info.LastEntry.ID != "1000-1" {
+			t.Errorf("unexpected stream info %+v", info)
+		}
+	})
+
+	t.Run("blocks until streams have entries", func(t *testing.T) {
+		done := make(chan []redis.Stream)
+		go func() {
+			streams, _ := p.XRead(map[string]string{"stream": "$"}, 0, 0)
+			done <- streams
+		}()
+		time.Sleep(20 * time.Millisecond)
+		id, _ := p.XAdd("stream", "*", map[string]interface{}{"n": "4"})
+		select {
+		case streams := <-done:
+			if len(streams) != 1 || len(streams[0].Entries) != 1 || streams[0].Entries[0].ID != id {
+				t.Errorf("expected to read %s but got %+v", id, streams)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for XREAD")
+		}
+	})
+}
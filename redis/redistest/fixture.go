@@ -0,0 +1,158 @@
+package redistest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture describes keys to seed a lease with, by their names, which are prefixed by the lease's
+// prefix as they're seeded. It's decoded from JSON, e.g.
+//
+//	{
+//		"strings": {"user:1:name": "Jimmy"},
+//		"hashes": {"user:1": {"name": "Jimmy", "city": "NYC"}},
+//		"lists": {"queue": ["a", "b"]},
+//		"sets": {"tags": ["x", "y"]},
+//		"sortedSets": {"scores": {"a": 1, "b": 2.5}},
+//		"ttls": {"user:1:name": 60}
+//	}
+//
+// or from YAML with the same keys, e.g.
+//
+//	strings:
+//	  user:1:name: Jimmy
+//	sortedSets:
+//	  scores: {a: 1, b: 2.5}
+//	ttls:
+//	  user:1:name: 60
+type Fixture struct {
+	Strings    map[string]string             `json:"strings" yaml:"strings"`
+	Hashes     map[string]map[string]string  `json:"hashes" yaml:"hashes"`
+	Lists      map[string][]string           `json:"lists" yaml:"lists"`
+	Sets       map[string][]string           `json:"sets" yaml:"sets"`
+	SortedSets map[string]map[string]float64 `json:"sortedSets" yaml:"sortedSets"`
+	// TTLs are the times to live of keys, in seconds.
+	TTLs map[string]int `json:"ttls" yaml:"ttls"`
+}
+
+var fixtureFormats = struct {
+	sync.RWMutex
+	unmarshal map[string]func([]byte, interface{}) error
+}{unmarshal: map[string]func([]byte, interface{}) error{
+	".json": json.Unmarshal,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+}}
+
+// RegisterFixtureFormat registers unmarshal to decode fixture files with the extension ext, e.g.
+//
+//	redistest.RegisterFixtureFormat(".toml", toml.Unmarshal)
+//
+// in addition to ".json", ".yaml" and ".yml", which are registered by default.
+func RegisterFixtureFormat(ext string, unmarshal func([]byte, interface{}) error) {
+	fixtureFormats.Lock()
+	defer fixtureFormats.Unlock()
+	fixtureFormats.unmarshal[strings.ToLower(ext)] = unmarshal
+}
+
+// LoadFixture reads the fixture file at path, decoding it by the format registered for its
+// extension.
+func LoadFixture(path string) (Fixture, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	fixtureFormats.RLock()
+	unmarshal, ok := fixtureFormats.unmarshal[ext]
+	fixtureFormats.RUnlock()
+	if !ok {
+		return Fixture{}, fmt.Errorf("redistest: no fixture format registered for %q", ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixture{}, err
+	}
+	var fixture Fixture
+	if err := unmarshal(data, &fixture); err != nil {
+		return Fixture{}, fmt.Errorf("redistest: failed to decode %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// Seed sets the keys of fixture, prefixed by the lease's prefix, in one pipeline, failing t if
+// any of them can't be set. Keys which exist already are added to, and a TTL of a key which the
+// fixture doesn't set fails t.
+func (l *Lease) Seed(t testing.TB, fixture Fixture) {
+	t.Helper()
+	for name := range fixture.TTLs {
+		if !fixture.has(name) {
+			t.Fatalf("redistest: fixture has a TTL for %s, which it doesn't set", name)
+		}
+	}
+
+	_, err := l.Pool.Pipelined(func(p redis.Pipeline) {
+		for name, value := range fixture.Strings {
+			p.Set(l.Key(name), value)
+		}
+		for name, hash := range fixture.Hashes {
+			if len(hash) > 0 {
+				args := make(map[string]interface{}, len(hash))
+				for field, value := range hash {
+					args[field] = value
+				}
+				p.HMSet(l.Key(name), args)
+			}
+		}
+		for name, list := range fixture.Lists {
+			if len(list) > 0 {
+				p.RPush(l.Key(name), list...)
+			}
+		}
+		for name, set := range fixture.Sets {
+			if len(set) > 0 {
+				p.SAdd(l.Key(name), set[0], set[1:]...)
+			}
+		}
+		for name, zset := range fixture.SortedSets {
+			if len(zset) > 0 {
+				args := make([]interface{}, 0, 2*len(zset))
+				for member, score := range zset {
+					args = append(args, score, member)
+				}
+				p.ZAdd(l.Key(name), args...)
+			}
+		}
+		for name, seconds := range fixture.TTLs {
+			p.Expire(l.Key(name), seconds)
+		}
+	})
+	if err != nil {
+		t.Fatalf("redistest: failed to seed fixture: %v", err)
+	}
+}
+
+// SeedFile seeds the lease with the fixture file at path, as Seed does.
+func (l *Lease) SeedFile(t testing.TB, path string) {
+	t.Helper()
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatalf("redistest: %v", err)
+	}
+	l.Seed(t, fixture)
+}
+
+// has returns whether the fixture sets the key named name. Empty hashes, lists, sets and sorted
+// sets aren't set, as Redis has no empty values.
+func (fixture Fixture) has(name string) bool {
+	if _, ok := fixture.Strings[name]; ok {
+		return true
+	}
+	return len(fixture.Hashes[name]) > 0 || len(fixture.Lists[name]) > 0 || len(fixture.Sets[name]) > 0 ||
+		len(fixture.SortedSets[name]) > 0
+}
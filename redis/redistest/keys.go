@@ -0,0 +1,655 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys - https://redis.io/commands#generic
+
+func del(c *client, args []string) interface{} {
+	n := 0
+	for _, key := range args[1:] {
+		if c.db.delete(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func exists(c *client, args []string) interface{} {
+	n := 0
+	for _, key := range args[1:] {
+		if c.db.get(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func expire(c *client, args []string) interface{} {
+	unit := time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+	n, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	var nx, xx, gt, lt bool
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return replyError("ERR Unsupported option " + arg)
+		}
+	}
+	if nx && (xx || gt || lt) || gt && lt {
+		return replyError("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+
+	key := args[1]
+	v := c.db.get(key)
+	if v == nil {
+		return 0
+	}
+	expires := c.f.now().Add(time.Duration(n) * unit)
+	// A key without a TTL has an infinite one, which no TTL is greater than.
+	switch {
+	case nx && !v.expires.IsZero(),
+		xx && v.expires.IsZero(),
+		gt && (v.expires.IsZero() || !expires.After(v.expires)),
+		lt && !v.expires.IsZero() && !expires.Before(v.expires):
+		return 0
+	}
+
+	if n <= 0 {
+		c.db.delete(key)
+		return 1
+	}
+	v.expires = expires
+	c.db.modified(key, v)
+	return 1
+}
+
+func ttl(c *client, args []string) interface{} {
+	v := c.db.get(args[1])
+	if v == nil {
+		return -2
+	}
+	if v.expires.IsZero() {
+		return -1
+	}
+	ms := v.expires.Sub(c.f.now()).Milliseconds()
+	if strings.ToUpper(args[0]) == "PTTL" {
+		return ms
+	}
+	// Rounded, as Redis does.
+	return (ms + 500) / 1000
+}
+
+func persist(c *client, args []string) interface{} {
+	v := c.db.get(args[1])
+	if v == nil || v.expires.IsZero() {
+		return 0
+	}
+	v.expires = time.Time{}
+	c.db.modified(args[1], v)
+	return 1
+}
+
+func rename(c *client, args []string) interface{} {
+	key, newKey := args[1], args[2]
+	nx := strings.ToUpper(args[0]) == "RENAMENX"
+	v := c.db.get(key)
+	if v == nil {
+		return errNoSuchKey
+	}
+	if key == newKey {
+		if nx {
+			return 0
+		}
+		return ok
+	}
+	if nx {
+		if c.db.get(newKey) != nil {
+			return 0
+		}
+	}
+
+	c.db.delete(key)
+	c.db.set(newKey, v)
+	if nx {
+		return 1
+	}
+	return ok
+}
+
+func typeCommand(c *client, args []string) interface{} {
+	v := c.db.get(args[1])
+	if v == nil {
+		return status("none")
+	}
+	return status(v.kind.String())
+}
+
+func keys(c *client, args []string) interface{} {
+	var names []scanned
+	for key := range c.db.keys {
+		if v := c.db.get(key); v != nil && match(args[1], key) {
+			names = append(names, scanned{v.seq, key})
+		}
+	}
+	sortScanned(names)
+
+	reply := make([]interface{}, len(names))
+	for i, name := range names {
+		reply[i] = name.name
+	}
+	return reply
+}
+
+func scan(c *client, args []string) interface{} {
+	options, err := parseScan(args[1:], true)
+	if err != nil {
+		return err
+	}
+
+	var names []scanned
+	for key := range c.db.keys {
+		if v := c.db.get(key); v != nil {
+			names = append(names, scanned{v.seq, key})
+		}
+	}
+	page, next := scanPage(names, options)
+
+	reply := []interface{}{}
+	for _, name := range page {
+		if options.kind == "" || strings.EqualFold(options.kind, c.db.keys[name.name].kind.String()) {
+			reply = append(reply, name.name)
+		}
+	}
+	return []interface{}{strconv.FormatUint(next, 10), reply}
+}
+
+// scanned is a key or member, numbered as it was created, for SCAN and the like to iterate them
+// by. As keys and members are numbered in the order they were created, and the cursor of a page
+// is the number of its last, one which exists throughout an iteration can't be missed.
+type scanned struct {
+	seq  uint64
+	name string
+}
+
+func sortScanned(items []scanned) {
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+}
+
+// scanOptions are the arguments of SCAN, SSCAN and ZSCAN.
+type scanOptions struct {
+	cursor uint64
+	match  string
+	count  int
+	kind   string
+}
+
+// parseScan parses a cursor and the options which follow it, TYPE included if kind is.
+func parseScan(args []string, kind bool) (scanOptions, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return scanOptions{}, replyError("ERR invalid cursor")
+	}
+	options := scanOptions{cursor: cursor, count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return scanOptions{}, errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			options.match = args[i+1]
+		case "COUNT":
+			count, err := parseInt(args[i+1])
+			if err != nil {
+				return scanOptions{}, err
+			}
+			if count < 1 {
+				return scanOptions{}, errSyntax
+			}
+			options.count = int(count)
+		case "TYPE":
+			if !kind {
+				return scanOptions{}, errSyntax
+			}
+			options.kind = args[i+1]
+		default:
+			return scanOptions{}, errSyntax
+		}
+	}
+	return options, nil
+}
+
+// scanPage returns the page of items after the cursor of options, and the cursor of the next, or
+// 0 if it's the last. Like Redis, it counts the items it looks at, not those which match.
+func scanPage(items []scanned, options scanOptions) ([]scanned, uint64) {
+	sortScanned(items)
+	i := sort.Search(len(items), func(i int) bool { return items[i].seq > options.cursor })
+	items = items[i:]
+
+	var next uint64
+	if len(items) > options.count {
+		items = items[:options.count]
+		next = items[len(items)-1].seq
+	}
+
+	page := items[:0:0]
+	for _, item := range items {
+		if options.match == "" || match(options.match, item.name) {
+			page = append(page, item)
+		}
+	}
+	return page, next
+}
+
+// match reports whether s matches the glob-style pattern, as KEYS and SCAN's MATCH do: * matches
+// any characters, ? any one, [abc], [^abc] and [a-c] any one of a set, and \ escapes the next.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) > 1:
+					matched = matched || pattern[1] == s[0]
+					pattern = pattern[2:]
+				case len(pattern) > 2 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || lo <= s[0] && s[0] <= hi
+					pattern = pattern[3:]
+				default:
+					matched = matched || pattern[0] == s[0]
+					pattern = pattern[1:]
+				}
+			}
+			if matched == not {
+				return false
+			}
+			s = s[1:]
+			if len(pattern) == 0 {
+				// An unterminated set ends the pattern.
+				return len(s) == 0
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// Strings - https://redis.io/commands#string
+
+func get(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindString)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return v.str
+}
+
+func mget(c *client, args []string) interface{} {
+	reply := make([]interface{}, len(args)-1)
+	for i, key := range args[1:] {
+		if v := c.db.get(key); v != nil && v.kind == kindString {
+			reply[i] = v.str
+		}
+	}
+	return reply
+}
+
+func set(c *client, args []string) interface{} {
+	key := args[1]
+	var nx, xx, getOld, keepTTL bool
+	var expires time.Time
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			getOld = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 == len(args) || !expires.IsZero() {
+				return errSyntax
+			}
+			i++
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			if n <= 0 {
+				return replyError("ERR invalid expire time in 'set' command")
+			}
+			switch option {
+			case "EX":
+				expires = c.f.now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				expires = c.f.now().Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				expires = time.Unix(n, 0)
+			case "PXAT":
+				expires = time.UnixMilli(n)
+			}
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx || keepTTL && !expires.IsZero() {
+		return errSyntax
+	}
+
+	old := c.db.get(key)
+	var reply interface{} = ok
+	if getOld {
+		if old != nil && old.kind != kindString {
+			return errWrongType
+		}
+		reply = nil
+		if old != nil {
+			reply = old.str
+		}
+	}
+	if nx && old != nil || xx && old == nil {
+		if getOld {
+			return reply
+		}
+		return nil
+	}
+
+	if keepTTL && old != nil {
+		expires = old.expires
+	}
+	c.db.set(key, &value{kind: kindString, str: args[2], expires: expires})
+	return reply
+}
+
+func setex(c *client, args []string) interface{} {
+	n, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return replyError("ERR invalid expire time in 'setex' command")
+	}
+	c.db.set(args[1], &value{kind: kindString, str: args[3], expires: c.f.now().Add(time.Duration(n) * time.Second)})
+	return ok
+}
+
+func setnx(c *client, args []string) interface{} {
+	if c.db.get(args[1]) != nil {
+		return 0
+	}
+	c.db.set(args[1], &value{kind: kindString, str: args[2]})
+	return 1
+}
+
+func mset(c *client, args []string) interface{} {
+	if len(args)%2 == 0 {
+		return wrongArgs(args[0])
+	}
+	for i := 1; i < len(args); i += 2 {
+		c.db.set(args[i], &value{kind: kindString, str: args[i+1]})
+	}
+	return ok
+}
+
+// incr runs INCR, INCRBY, DECR and DECRBY.
+func incr(c *client, args []string) interface{} {
+	by := int64(1)
+	if len(args) == 3 {
+		var err error
+		if by, err = parseInt(args[2]); err != nil {
+			return err
+		}
+	}
+	if name := strings.ToUpper(args[0]); strings.HasPrefix(name, "DECR") {
+		if by == math.MinInt64 {
+			return replyError("ERR decrement would overflow")
+		}
+		by = -by
+	}
+
+	key := args[1]
+	v, err := c.db.getKind(key, kindString)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v != nil {
+		if n, err = parseInt(v.str); err != nil {
+			return err
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		return errOverflow
+	}
+	n += by
+
+	if v == nil {
+		c.db.set(key, &value{kind: kindString, str: strconv.FormatInt(n, 10)})
+	} else {
+		v.str, v.hll = strconv.FormatInt(n, 10), nil
+		c.db.modified(key, v)
+	}
+	return n
+}
+
+// Hashes - https://redis.io/commands#hash
+
+func hget(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if field, found := v.hash[args[2]]; found {
+		return field
+	}
+	return nil
+}
+
+// hgetall replies with the fields of a hash sorted by name, where Redis's order is arbitrary.
+func hgetall(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	reply := respMap{}
+	if v == nil {
+		return reply
+	}
+	fields := make([]string, 0, len(v.hash))
+	for field := range v.hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		reply = append(reply, field, v.hash[field])
+	}
+	return reply
+}
+
+func hincrby(c *client, args []string) interface{} {
+	by, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	key, field := args[1], args[2]
+	v, err := c.db.getOrCreate(key, kindHash)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if s, found := v.hash[field]; found {
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			c.db.modified(key, v)
+			return replyError("ERR hash value is not an integer")
+		}
+	}
+	if by > 0 && n > math.MaxInt64-by || by < 0 && n < math.MinInt64-by {
+		c.db.modified(key, v)
+		return errOverflow
+	}
+	n += by
+	v.hash[field] = strconv.FormatInt(n, 10)
+	c.db.modified(key, v)
+	return n
+}
+
+// hset runs HSET, which replies with the number of fields added, and HMSET, which replies OK.
+func hset(c *client, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return wrongArgs(args[0])
+	}
+	key := args[1]
+	v, err := c.db.getOrCreate(key, kindHash)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, found := v.hash[args[i]]; !found {
+			added++
+		}
+		v.hash[args[i]] = args[i+1]
+	}
+	c.db.modified(key, v)
+
+	if strings.ToUpper(args[0]) == "HMSET" {
+		return ok
+	}
+	return added
+}
+
+func hmget(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	reply := make([]interface{}, len(args)-2)
+	for i, field := range args[2:] {
+		if s, found := v.hashField(field); found {
+			reply[i] = s
+		}
+	}
+	return reply
+}
+
+func hdel(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getKind(key, kindHash)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	n := 0
+	for _, field := range args[2:] {
+		if _, found := v.hash[field]; found {
+			delete(v.hash, field)
+			n++
+		}
+	}
+	if n > 0 {
+		c.db.modified(key, v)
+	}
+	return n
+}
+
+func hexists(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindHash)
+	if err != nil {
+		return err
+	}
+	if _, found := v.hashField(args[2]); found {
+		return 1
+	}
+	return 0
+}
+
+func hlen(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindHash)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	return len(v.hash)
+}
+
+// hashField returns a field of a hash, which may be nil for a key with no value.
+func (v *value) hashField(field string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	s, found := v.hash[field]
+	return s, found
+}
+
+// zeroOr returns err if it isn't nil, for a command to reply with, or else 0.
+func zeroOr(err error) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
@@ -0,0 +1,273 @@
+package redistest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	netURL "net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+// LeaseTTL is how long a database stays leased to a test unless it's renewed, which it is for as
+// long as the test runs. A lease left by a test binary which was killed is given up once it expires.
+const LeaseTTL = 10 * time.Minute
+
+// How often leases are renewed, well before they expire.
+var leaseRenewal = LeaseTTL / 3
+
+// The key which marks a database as leased, in the database itself.
+const leaseKey = "_redistest:lease"
+
+// Lease is a namespace of a Redis server leased to a test, so that tests can run in parallel,
+// against the same server, without seeing each other's keys: either a database of its own, or a
+// prefix for the names of its keys.
+type Lease struct {
+	// Pool is a pool of connections to the leased database, or the pool the prefix was leased
+	// from.
+	Pool redis.Pool
+	// URL is the URL of the leased database, or "" for a prefix.
+	URL string
+	// Prefix is prepended to the names of the test's keys by Key and Seed, or "" for a database.
+	Prefix string
+
+	token string
+}
+
+// Key returns the key of the lease named name.
+func (l *Lease) Key(name string) string {
+	return l.Prefix + name
+}
+
+// Flush deletes the keys of the lease, keeping it leased: it flushes a leased database, in place of
+// FLUSHDB, which would give up the lease, or deletes the keys with a leased prefix.
+func (l *Lease) Flush() error {
+	if l.Prefix != "" {
+		return deletePrefixed(l.Pool, l.Prefix)
+	}
+	c, err := l.Pool.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	if err := c.Multi(); err != nil {
+		return err
+	}
+	c.Send("FLUSHDB")
+	c.Send("SET", leaseKey, l.token, "PX", LeaseTTL.Milliseconds())
+	_, err = c.Exec()
+	return err
+}
+
+// LeaseDB leases one of databases 1 to 15 of the server at url to t, which no other test of any
+// test binary has leased, and returns it with a pool of connections to it, configured by config.
+// The database of url is ignored, as is database 0, which is left to the data of anyone using the
+// server other than tests.
+//
+// The database is flushed as it's leased, and once t and its subtests are done, when the pool is
+// shut down and the lease given up. It fails t if none of the databases is free.
+func LeaseDB(t testing.TB, url string, config redis.Config) *Lease {
+	t.Helper()
+	u, err := netURL.Parse(url)
+	if err != nil {
+		t.Fatalf("redistest: failed to parse %s: %v", url, err)
+	}
+	token := randomToken(t)
+
+	for db := 1; db < Databases; db++ {
+		dbURL := withDatabase(u, db)
+		p, err := redis.NewPool(dbURL, config)
+		if err != nil {
+			t.Fatalf("redistest: failed to create pool: %v", err)
+		}
+		leased, err := lease(p, token)
+		if err != nil {
+			p.Shutdown()
+			t.Fatalf("redistest: failed to lease database %d: %v", db, err)
+		}
+		if !leased {
+			p.Shutdown()
+			continue
+		}
+
+		stop, renewed := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(renewed)
+			renewLease(t, p, db, token, stop)
+		}()
+
+		t.Cleanup(func() {
+			close(stop)
+			<-renewed
+			// Flushing the database gives up the lease too.
+			p.Do(func(c redis.Connection) {
+				if _, err := c.Do("FLUSHDB"); err != nil {
+					t.Errorf("redistest: failed to flush database %d: %v", db, err)
+				}
+			})
+			p.Shutdown()
+		})
+		return &Lease{Pool: p, URL: dbURL, token: token}
+	}
+
+	t.Fatalf("redistest: every database of %s is leased", u.Redacted())
+	return nil
+}
+
+// lease leases the database of p, flushing it, unless it's leased already.
+func lease(p redis.Pool, token string) (bool, error) {
+	c, err := p.GetConnection()
+	if err != nil {
+		return false, err
+	}
+	defer c.Release()
+
+	if err := c.Watch(leaseKey); err != nil {
+		return false, err
+	}
+	if exists, err := c.Exists(leaseKey); err != nil || exists {
+		c.Unwatch()
+		return false, err
+	}
+	if err := c.Multi(); err != nil {
+		return false, err
+	}
+	c.Send("FLUSHDB")
+	c.Send("SET", leaseKey, token, "PX", LeaseTTL.Milliseconds())
+	_, err = c.Exec()
+	if errors.Is(err, redis.ErrTxAborted) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// renewLease renews the lease of database db of p until stop is closed, failing t if it's been
+// leased to another test in the meantime.
+func renewLease(t testing.TB, p redis.Pool, db int, token string, stop <-chan struct{}) {
+	ticker := time.NewTicker(leaseRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		// Failing to renew is retried on the next tick, while the lease is yet to expire.
+		if err := renew(p, token); errors.Is(err, errLeaseLost) {
+			t.Errorf("redistest: database %d was leased to another test", db)
+			return
+		}
+	}
+}
+
+var errLeaseLost = errors.New("redistest: lease lost")
+
+// renew renews the lease of the database of p, setting it again if the test flushed the database.
+func renew(p redis.Pool, token string) error {
+	c, err := p.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	if err := c.Watch(leaseKey); err != nil {
+		return err
+	}
+	holder, err := c.Get(leaseKey)
+	if err != nil && err != redis.ErrNil {
+		c.Unwatch()
+		return err
+	}
+	if holder != "" && holder != token {
+		c.Unwatch()
+		return errLeaseLost
+	}
+	if err := c.Multi(); err != nil {
+		return err
+	}
+	c.Send("SET", leaseKey, token, "PX", LeaseTTL.Milliseconds())
+	_, err = c.Exec()
+	return err
+}
+
+// withDatabase returns u selecting database db: by its path, or by its db query parameter for a
+// unix socket.
+func withDatabase(u *netURL.URL, db int) string {
+	dbURL := *u
+	if u.Scheme == "unix" || u.Scheme == "redis+unix" {
+		query := u.Query()
+		query.Set("db", strconv.Itoa(db))
+		dbURL.RawQuery = query.Encode()
+	} else {
+		dbURL.Path = "/" + strconv.Itoa(db)
+	}
+	return dbURL.String()
+}
+
+// LeasePrefix leases a prefix for the names of keys to t, which is unique to it, and returns it
+// with p, which must be shut down by the caller. The prefix has a hash tag, so that the keys it
+// prefixes are on the same shard of a ShardedPool.
+//
+// The keys with the prefix are deleted once t and its subtests are done, those of every shard of
+// a ShardedPool.
+func LeasePrefix(t testing.TB, p redis.Pool) *Lease {
+	t.Helper()
+	l := &Lease{Pool: p, Prefix: "_redistest:{" + sanitizeName(t.Name()) + ":" + randomToken(t) + "}:"}
+
+	t.Cleanup(func() {
+		if err := deletePrefixed(p, l.Prefix); err != nil {
+			t.Errorf("redistest: failed to delete the keys prefixed %s: %v", l.Prefix, err)
+		}
+	})
+	return l
+}
+
+// deletePrefixed deletes the keys prefixed prefix, those of every shard of a ShardedPool.
+func deletePrefixed(p redis.Pool, prefix string) error {
+	deleteKeys := func(p redis.Pool) error {
+		// The prefix has no characters special to MATCH, as they're sanitized.
+		for cursor := -1; cursor != 0; {
+			next, keys, err := p.Scan(max(cursor, 0), prefix+"*", 100)
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if _, err := p.Del(keys...); err != nil {
+					return err
+				}
+			}
+			cursor = next
+		}
+		return nil
+	}
+
+	if sharded, ok := p.(redis.ShardedPool); ok {
+		return sharded.ForEachShard(deleteKeys)
+	}
+	return deleteKeys(p)
+}
+
+// sanitizeName replaces the characters of a test's name which are special to hash tags or MATCH.
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '{', '}', '*', '?', '[', ']', '\\':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func randomToken(t testing.TB) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("redistest: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
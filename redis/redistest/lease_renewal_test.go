@@ -0,0 +1,50 @@
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestLeaseRenewal(t *testing.T) {
+	s, err := NewServer(ServerOptions{})
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	defer s.Close()
+
+	defer func(renewal time.Duration) { leaseRenewal = renewal }(leaseRenewal)
+	leaseRenewal = 10 * time.Millisecond
+
+	// leaseTTL returns how long the lease of l has left, once it's had time to be renewed.
+	leaseTTL := func(t *testing.T, l *Lease) time.Duration {
+		time.Sleep(5 * leaseRenewal)
+		var ttl int64
+		var err error
+		l.Pool.Do(func(c redis.Connection) {
+			ttl, err = redigo.Int64(c.Do("PTTL", leaseKey))
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return time.Duration(ttl) * time.Millisecond
+	}
+
+	t.Run("renews the lease while the test runs", func(t *testing.T) {
+		l := LeaseDB(t, s.URL(), redis.DefaultConfig)
+		l.Pool.Do(func(c redis.Connection) { c.Do("PEXPIRE", leaseKey, 1000) })
+		if ttl := leaseTTL(t, l); ttl < LeaseTTL-time.Second {
+			t.Errorf("expected the lease to be renewed but it expires in %v", ttl)
+		}
+	})
+
+	t.Run("leases the database again once the test flushes it", func(t *testing.T) {
+		l := LeaseDB(t, s.URL(), redis.DefaultConfig)
+		l.Pool.Do(func(c redis.Connection) { c.Do("FLUSHDB") })
+		if ttl := leaseTTL(t, l); ttl < LeaseTTL-time.Second {
+			t.Errorf("expected the lease to be set again but it expires in %v", ttl)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package redistest_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestLease(t *testing.T) {
+	t.Run("leases a database of its own to each test", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		var urls []string
+		t.Run("leases", func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				l := redistest.LeaseDB(t, s.URL(), redis.DefaultConfig)
+				if l.Prefix != "" || l.Key("key") != "key" {
+					t.Errorf("expected a database to have no prefix but got %q", l.Prefix)
+				}
+				if err := l.Pool.Set("key", l.URL); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				urls = append(urls, l.URL)
+			}
+			if urls[0] == urls[1] {
+				t.Errorf("expected different databases but got %s twice", urls[0])
+			}
+			for _, url := range urls {
+				if value, _ := newPool(t, url, redis.DefaultConfig).Get("key"); value != url {
+					t.Errorf("expected %s to keep its key but got %q", url, value)
+				}
+			}
+		})
+
+		for _, url := range urls {
+			if ok, _ := newPool(t, url, redis.DefaultConfig).Exists("key"); ok {
+				t.Errorf("expected %s to be flushed once the test was done", url)
+			}
+		}
+		// The leases were given up, so the first database is leased again.
+		if l := redistest.LeaseDB(t, s.URL(), redis.DefaultConfig); l.URL != urls[0] {
+			t.Errorf("expected to lease %s again but got %s", urls[0], l.URL)
+		}
+	})
+
+	t.Run("flushes a database keeping it leased", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		l := redistest.LeaseDB(t, s.URL(), redis.DefaultConfig)
+		l.Pool.Set("key", "value")
+		if err := l.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok, _ := l.Pool.Exists("key"); ok {
+			t.Error("expected the database to be flushed")
+		}
+		if other := redistest.LeaseDB(t, s.URL(), redis.DefaultConfig); other.URL == l.URL {
+			t.Errorf("expected %s to stay leased", l.URL)
+		}
+	})
+
+	t.Run("leases databases over unix sockets", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{Socket: filepath.Join(t.TempDir(), "redis.sock")})
+		l := redistest.LeaseDB(t, s.URL(), redis.DefaultConfig)
+		if !strings.HasSuffix(l.URL, "?db=1") {
+			t.Errorf("expected the database to be selected by its db parameter but got %s", l.URL)
+		}
+		l.Pool.Set("key", "value")
+		if ok, _ := newPool(t, s.URL(), redis.DefaultConfig).Exists("key"); ok {
+			t.Error("expected the key to be set in the leased database only")
+		}
+	})
+
+	t.Run("leases a prefix of its own to each test", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		p := newPool(t, s.URL(), redis.DefaultConfig)
+		p.Set("unleased", "value")
+		var prefixes []string
+		t.Run("leases", func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				l := redistest.LeasePrefix(t, p)
+				if err := l.Pool.Set(l.Key("key"), "value"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				prefixes = append(prefixes, l.Prefix)
+			}
+			if prefixes[0] == prefixes[1] {
+				t.Errorf("expected different prefixes but got %s twice", prefixes[0])
+			}
+			if !strings.HasPrefix(prefixes[0], "_redistest:{TestLease/leases_a_prefix_of_its_own_to_each_test/leases:") {
+				t.Errorf("expected the prefix to be hash tagged with the name of the test but got %s", prefixes[0])
+			}
+		})
+
+		for _, prefix := range prefixes {
+			if ok, _ := p.Exists(prefix + "key"); ok {
+				t.Errorf("expected the keys prefixed %s to be deleted once the test was done", prefix)
+			}
+		}
+		if ok, _ := p.Exists("unleased"); !ok {
+			t.Error("expected keys without the prefix to be kept")
+		}
+	})
+
+	fixtures := map[string]string{
+		"fixture.json": `{
+			"strings": {"name": "Jimmy"},
+			"hashes": {"user": {"name": "Jimmy", "city": "NYC"}},
+			"lists": {"queue": ["a", "b", "c"]},
+			"sets": {"tags": ["x", "y"]},
+			"sortedSets": {"scores": {"a": 1, "b": 2.5}},
+			"ttls": {"name": 60, "queue": 120}
+		}`,
+		"fixture.yaml": `
+strings:
+  name: Jimmy
+hashes:
+  user:
+    name: Jimmy
+    city: NYC
+lists:
+  queue: [a, b, c]
+sets:
+  tags:
+    - x
+    - y
+sortedSets:
+  scores: {a: 1, b: 2.5}
+ttls:
+  name: 60
+  queue: 120
+`,
+	}
+	for file, fixture := range fixtures {
+		t.Run("seeds fixtures from "+file, func(t *testing.T) {
+			s := newServer(t, redistest.ServerOptions{})
+			l := redistest.LeasePrefix(t, newPool(t, s.URL(), redis.DefaultConfig))
+			path := filepath.Join(t.TempDir(), file)
+			if err := os.WriteFile(path, []byte(fixture), 0o644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			l.SeedFile(t, path)
+
+			p := l.Pool
+			if value, err := p.Get(l.Key("name")); err != nil || value != "Jimmy" {
+				t.Errorf("expected the string but got %q, %v", value, err)
+			}
+			if hash, err := p.HGetAll(l.Key("user")); err != nil || !reflect.DeepEqual(hash, map[string]string{"name": "Jimmy", "city": "NYC"}) {
+				t.Errorf("expected the hash but got %v, %v", hash, err)
+			}
+			if list, err := p.LRange(l.Key("queue"), 0, -1); err != nil || !reflect.DeepEqual(list, []string{"a", "b", "c"}) {
+				t.Errorf("expected the list but got %v, %v", list, err)
+			}
+			if set, err := p.SMembers(l.Key("tags")); err != nil || len(set) != 2 {
+				t.Errorf("expected the set but got %v, %v", set, err)
+			}
+			if z, err := p.ZRangeWithScores(l.Key("scores"), 0, -1); err != nil || !reflect.DeepEqual(z, []redis.Z{{Value: "a", Score: 1}, {Value: "b", Score: 2.5}}) {
+				t.Errorf("expected the sorted set but got %v, %v", z, err)
+			}
+			for name, want := range map[string]int{"name": 60, "queue": 120, "user": -1} {
+				if ttl, err := p.TTL(l.Key(name)); err != nil || ttl <= want-5 || ttl > want {
+					t.Errorf("expected %s to have a TTL of %d but got %d, %v", name, want, ttl, err)
+				}
+			}
+		})
+	}
+
+	t.Run("seeds fixtures of registered formats", func(t *testing.T) {
+		// A stand in for a package decoding another format, decoding JSON.
+		redistest.RegisterFixtureFormat(".CONF", func(data []byte, v interface{}) error {
+			return json.Unmarshal(data, v)
+		})
+		path := filepath.Join(t.TempDir(), "fixture.conf")
+		os.WriteFile(path, []byte(`{"strings": {"key": "value"}}`), 0o644)
+
+		l := redistest.LeaseDB(t, newServer(t, redistest.ServerOptions{}).URL(), redis.DefaultConfig)
+		l.SeedFile(t, path)
+		if value, err := l.Pool.Get("key"); err != nil || value != "value" {
+			t.Errorf("expected the string but got %q, %v", value, err)
+		}
+
+		if _, err := redistest.LoadFixture(filepath.Join(t.TempDir(), "fixture.toml")); err == nil {
+			t.Error("expected an error for a format which isn't registered")
+		}
+	})
+}
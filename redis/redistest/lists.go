@@ -0,0 +1,216 @@
+package redistest
+
+import (
+	"strings"
+)
+
+// Lists - https://redis.io/commands#list
+
+// lpush runs LPUSH and RPUSH.
+func lpush(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getOrCreate(key, kindList)
+	if err != nil {
+		return err
+	}
+	if strings.ToUpper(args[0]) == "LPUSH" {
+		for _, element := range args[2:] {
+			v.list = append([]string{element}, v.list...)
+		}
+	} else {
+		v.list = append(v.list, args[2:]...)
+	}
+	c.db.modified(key, v)
+	return len(v.list)
+}
+
+// lpop runs LPOP and RPOP, which reply with an element, or an array of them if they're given a
+// count.
+func lpop(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return wrongArgs(args[0])
+	}
+	count := int64(1)
+	if len(args) == 3 {
+		var err error
+		if count, err = parseInt(args[2]); err != nil {
+			return err
+		}
+		if count < 0 {
+			return replyError("ERR value is out of range, must be positive")
+		}
+	}
+
+	key := args[1]
+	v, err := c.db.getKind(key, kindList)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if len(args) == 3 {
+			return nilArray{}
+		}
+		return nil
+	}
+
+	popped := v.pop(strings.ToUpper(args[0]) == "LPOP", int(min(count, int64(len(v.list)))))
+	c.db.modified(key, v)
+	if len(args) == 3 {
+		return popped
+	}
+	return popped[0]
+}
+
+// pop removes n elements from the head or tail of the list.
+func (v *value) pop(head bool, n int) []interface{} {
+	popped := make([]interface{}, n)
+	for i := range popped {
+		if head {
+			popped[i], v.list = v.list[0], v.list[1:]
+		} else {
+			popped[i], v.list = v.list[len(v.list)-1], v.list[:len(v.list)-1]
+		}
+	}
+	return popped
+}
+
+// blpop runs BLPOP and BRPOP, which pop from the first of their lists to have an element, waiting
+// for one to if none has.
+func blpop(c *client, args []string) interface{} {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	keys := args[1 : len(args)-1]
+	head := strings.ToUpper(args[0]) == "BLPOP"
+
+	until := deadline(timeout)
+	for {
+		for _, key := range keys {
+			v, err := c.db.getKind(key, kindList)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				popped := v.pop(head, 1)
+				c.db.modified(key, v)
+				return []interface{}{key, popped[0]}
+			}
+		}
+		if !c.blockUntil(until) {
+			return nilArray{}
+		}
+	}
+}
+
+func llen(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindList)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	return len(v.list)
+}
+
+func lindex(c *client, args []string) interface{} {
+	index, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindList)
+	if err != nil || v == nil {
+		return err
+	}
+	if index < 0 {
+		index += int64(len(v.list))
+	}
+	if index < 0 || index >= int64(len(v.list)) {
+		return nil
+	}
+	return v.list[index]
+}
+
+func lrange(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindList)
+	if err != nil {
+		return err
+	}
+	reply := []interface{}{}
+	if v == nil {
+		return reply
+	}
+	from, to := rangeIndexes(start, stop, len(v.list))
+	for _, element := range v.list[from:to] {
+		reply = append(reply, element)
+	}
+	return reply
+}
+
+func ltrim(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	v, err := c.db.getKind(key, kindList)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return ok
+	}
+	from, to := rangeIndexes(start, stop, len(v.list))
+	v.list = append([]string(nil), v.list[from:to]...)
+	c.db.modified(key, v)
+	return ok
+}
+
+// lrem removes count occurrences of an element: the first if count is positive, the last if it's
+// negative, or all of them if it's 0.
+func lrem(c *client, args []string) interface{} {
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	key, element := args[1], args[3]
+	v, err := c.db.getKind(key, kindList)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+
+	removed := 0
+	kept := make([]string, 0, len(v.list))
+	if count >= 0 {
+		for _, e := range v.list {
+			if e == element && (count == 0 || int64(removed) < count) {
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+	} else {
+		for i := len(v.list) - 1; i >= 0; i-- {
+			if e := v.list[i]; e == element && int64(removed) < -count {
+				removed++
+			} else {
+				kept = append([]string{e}, kept...)
+			}
+		}
+	}
+	if removed > 0 {
+		v.list = kept
+		c.db.modified(key, v)
+	}
+	return removed
+}
@@ -0,0 +1,93 @@
+package redistest
+
+import (
+	"sort"
+	"strings"
+)
+
+// Pub/Sub - https://redis.io/commands#pubsub
+
+func publish(c *client, args []string) interface{} {
+	channel, message := args[1], args[2]
+	n := 0
+	for subscriber := range c.f.channels[channel] {
+		subscriber.reply(push{"message", channel, message})
+		n++
+	}
+	for pattern, subscribers := range c.f.patterns {
+		if !match(pattern, channel) {
+			continue
+		}
+		for subscriber := range subscribers {
+			subscriber.reply(push{"pmessage", pattern, channel, message})
+			n++
+		}
+	}
+	return n
+}
+
+// subscribe runs SUBSCRIBE and PSUBSCRIBE, which reply once for each channel or pattern.
+func subscribe(c *client, args []string) interface{} {
+	kind := strings.ToLower(args[0])
+	subscriptions, all := c.channels, c.f.channels
+	if kind == "psubscribe" {
+		subscriptions, all = c.patterns, c.f.patterns
+	}
+
+	reply := replies{}
+	for _, name := range args[1:] {
+		subscriptions[name] = true
+		if all[name] == nil {
+			all[name] = map[*client]bool{}
+		}
+		all[name][c] = true
+		reply = append(reply, push{kind, name, len(c.channels) + len(c.patterns)})
+	}
+	return reply
+}
+
+// unsubscribe runs UNSUBSCRIBE and PUNSUBSCRIBE, which unsubscribe from every channel or pattern
+// if they're given none, and reply once for each.
+func unsubscribe(c *client, args []string) interface{} {
+	kind := strings.ToLower(args[0])
+	subscriptions, all := c.channels, c.f.channels
+	if kind == "punsubscribe" {
+		subscriptions, all = c.patterns, c.f.patterns
+	}
+
+	names := args[1:]
+	if len(names) == 0 {
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return push{kind, nil, len(c.channels) + len(c.patterns)}
+		}
+	}
+
+	reply := replies{}
+	for _, name := range names {
+		unsubscribeFrom(c, name, subscriptions, all)
+		reply = append(reply, push{kind, name, len(c.channels) + len(c.patterns)})
+	}
+	return reply
+}
+
+func unsubscribeFrom(c *client, name string, subscriptions map[string]bool, all map[string]map[*client]bool) {
+	delete(subscriptions, name)
+	delete(all[name], c)
+	if len(all[name]) == 0 {
+		delete(all, name)
+	}
+}
+
+// unsubscribeAll unsubscribes the client from every channel and pattern, as it disconnects.
+func (c *client) unsubscribeAll() {
+	for name := range c.channels {
+		unsubscribeFrom(c, name, c.channels, c.f.channels)
+	}
+	for name := range c.patterns {
+		unsubscribeFrom(c, name, c.patterns, c.f.patterns)
+	}
+}
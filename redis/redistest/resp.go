@@ -0,0 +1,255 @@
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Replies are built from these types, and Go's, and written as RESP2 or RESP3 by writeReply:
+//   - string and []byte are bulk strings, and nil a null bulk string, or null in RESP3
+//   - int and int64 are integers
+//   - []interface{} is an array
+type (
+	// A simple string, such as OK.
+	status string
+	// An error reply, starting with its code, e.g. "ERR syntax error".
+	replyError string
+	// A null array, such as EXEC's when a watched key changed.
+	nilArray struct{}
+	// A double, written as a bulk string in RESP2.
+	double float64
+	// Alternating keys and values, written as an array in RESP2.
+	respMap []interface{}
+	// Distinct members, written as an array in RESP2.
+	respSet []interface{}
+	// Out of band data, such as a message published to a subscribed channel, written as an array
+	// in RESP2.
+	push []interface{}
+	// Several replies to one command, such as SUBSCRIBE's, one for each channel.
+	replies []interface{}
+)
+
+var (
+	ok     = status("OK")
+	queued = status("QUEUED")
+
+	errSyntax       = replyError("ERR syntax error")
+	errWrongType    = replyError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger   = replyError("ERR value is not an integer or out of range")
+	errNotFloat     = replyError("ERR value is not a valid float")
+	errNoSuchKey    = replyError("ERR no such key")
+	errOverflow     = replyError("ERR increment or decrement would overflow")
+	errInvalidIndex = replyError("ERR index out of range")
+)
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// protocolError is a client sending something other than RESP, which is replied to before the
+// connection is closed.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "ERR Protocol error: " + string(e)
+}
+
+func wrongArgs(name string) replyError {
+	return replyError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// readCommand reads a command, as an array of bulk strings, or inline, as sent by telnet.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > 512*1024*1024 {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writeReply writes v as RESP2, or RESP3 if resp3 is set.
+func writeReply(w *bufio.Writer, v interface{}, resp3 bool) {
+	switch v := v.(type) {
+	case nil:
+		if resp3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case replyError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case double:
+		if resp3 {
+			fmt.Fprintf(w, ",%s\r\n", formatFloat(float64(v)))
+		} else {
+			writeReply(w, formatFloat(float64(v)), resp3)
+		}
+	case nilArray:
+		if resp3 {
+			w.WriteString("_\r\n")
+		} else {
+			w.WriteString("*-1\r\n")
+		}
+	case []interface{}:
+		writeArray(w, '*', len(v), v, resp3)
+	case respMap:
+		if resp3 {
+			writeArray(w, '%', len(v)/2, v, resp3)
+		} else {
+			writeArray(w, '*', len(v), v, resp3)
+		}
+	case respSet:
+		if resp3 {
+			writeArray(w, '~', len(v), v, resp3)
+		} else {
+			writeArray(w, '*', len(v), v, resp3)
+		}
+	case push:
+		if resp3 {
+			writeArray(w, '>', len(v), v, resp3)
+		} else {
+			writeArray(w, '*', len(v), v, resp3)
+		}
+	case replies:
+		for _, reply := range v {
+			writeReply(w, reply, resp3)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: can't reply with %T", v))
+	}
+}
+
+// writeArray writes an aggregate of the kind, such as * for an array, of n elements, which are
+// values, or pairs of them for a map.
+func writeArray(w *bufio.Writer, kind byte, n int, values []interface{}, resp3 bool) {
+	fmt.Fprintf(w, "%c%d\r\n", kind, n)
+	for _, v := range values {
+		writeReply(w, v, resp3)
+	}
+}
+
+// formatFloat formats f as Redis does, e.g. 1.5, 3 or inf.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// replyWriter writes replies to a connection from a goroutine of its own, so that a client which
+// sends a long pipeline before reading any reply doesn't block the commands from being read.
+type replyWriter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending [][]byte
+	closed  bool
+	// Closed once the writer has stopped.
+	done chan struct{}
+}
+
+func newReplyWriter(w io.Writer) *replyWriter {
+	rw := &replyWriter{done: make(chan struct{})}
+	rw.cond = sync.NewCond(&rw.mu)
+	go rw.run(w)
+	return rw
+}
+
+// write queues v to be written, as RESP3 if resp3 is set, or else RESP2.
+func (rw *replyWriter) write(v interface{}, resp3 bool) {
+	var buf strings.Builder
+	w := bufio.NewWriter(&buf)
+	writeReply(w, v, resp3)
+	w.Flush()
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.closed {
+		rw.pending = append(rw.pending, []byte(buf.String()))
+		rw.cond.Signal()
+	}
+}
+
+// close stops writing once what's queued has been written.
+func (rw *replyWriter) close() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.closed = true
+	rw.cond.Signal()
+}
+
+func (rw *replyWriter) run(w io.Writer) {
+	defer close(rw.done)
+	for {
+		rw.mu.Lock()
+		for len(rw.pending) == 0 && !rw.closed {
+			rw.cond.Wait()
+		}
+		pending, closed := rw.pending, rw.closed
+		rw.pending = nil
+		rw.mu.Unlock()
+
+		for _, p := range pending {
+			if _, err := w.Write(p); err != nil {
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+)
+
+// ScriptFunc stands in for a Lua script, which a Fake can't run. It's run by EVAL and EVALSHA, as
+// atomically as the script would be, and replies as the script would: with nil, an integer, a
+// string or []byte, a []interface{} of those, or an error, which is replied as an error reply.
+type ScriptFunc func(call *ScriptCall) (interface{}, error)
+
+// ScriptCall is a script being run, with the keys and arguments it was given.
+type ScriptCall struct {
+	Keys []string
+	Args []string
+
+	c *client
+}
+
+// RegisterScript registers fn to be run in place of script. Like any script, it must be loaded,
+// with EVAL or SCRIPT LOAD, before EVALSHA can run it, as redis.Script's Eval does.
+func (f *Fake) RegisterScript(script *redis.Script, fn ScriptFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[script.Hash()] = fn
+}
+
+// Call runs a command, as redis.call does in Lua, and returns its reply as redigo's Do would: an
+// error reply is returned as a redigo.Error.
+func (s *ScriptCall) Call(command string, args ...interface{}) (interface{}, error) {
+	name := strings.ToUpper(command)
+	cmd, found := commands[name]
+	if !found {
+		return nil, redigo.Error("ERR Unknown Redis command called from script")
+	}
+	if transactionCommands[name] || subscribedCommands[name] && name != "PING" || name == "EVAL" || name == "EVALSHA" || name == "SCRIPT" {
+		return nil, redigo.Error("ERR This Redis command is not allowed from script")
+	}
+
+	cmdArgs := []string{command}
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, argString(arg))
+	}
+	if cmd.arity > 0 && len(cmdArgs) != cmd.arity || cmd.arity < 0 && len(cmdArgs) < -cmd.arity {
+		return nil, redigo.Error("ERR Wrong number of args calling Redis command from script")
+	}
+	return clientReply(cmd.run(s.c, cmdArgs))
+}
+
+// argString formats an argument of a command as redigo does.
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case int:
+		return strconv.Itoa(arg)
+	case int64:
+		return strconv.FormatInt(arg, 10)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(arg)
+}
+
+// clientReply converts a reply to what redigo's Do returns for it.
+func clientReply(reply interface{}) (interface{}, error) {
+	switch reply := reply.(type) {
+	case replyError:
+		return nil, redigo.Error(reply)
+	case status:
+		return string(reply), nil
+	case int:
+		return int64(reply), nil
+	case string:
+		return []byte(reply), nil
+	case double:
+		return []byte(formatFloat(float64(reply))), nil
+	case nilArray:
+		return nil, nil
+	case []interface{}:
+		return clientReplies(reply), nil
+	case respMap:
+		return clientReplies(reply), nil
+	case respSet:
+		return clientReplies(reply), nil
+	}
+	return reply, nil
+}
+
+func clientReplies(replies []interface{}) []interface{} {
+	values := make([]interface{}, len(replies))
+	for i, reply := range replies {
+		v, err := clientReply(reply)
+		if err != nil {
+			v = err
+		}
+		values[i] = v
+	}
+	return values
+}
+
+// scriptReply converts the reply of a ScriptFunc to a reply of the fake.
+func scriptReply(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, int, int64:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		// As Lua's true and false are converted.
+		if v {
+			return 1
+		}
+		return nil
+	case error:
+		return replyError(v.Error())
+	case []interface{}:
+		reply := make([]interface{}, len(v))
+		for i, v := range v {
+			reply[i] = scriptReply(v)
+		}
+		return reply
+	}
+	return replyError(fmt.Sprintf("ERR redistest: a script can't reply with %T", v))
+}
+
+// Scripting - https://redis.io/commands#scripting
+
+// eval runs EVAL and EVALSHA, with the ScriptFunc registered for the script.
+func eval(c *client, args []string) interface{} {
+	hash := strings.ToLower(args[1])
+	if strings.ToUpper(args[0]) == "EVAL" {
+		hash = scriptHash(args[1])
+		c.f.loaded[hash] = true
+	} else if !c.f.loaded[hash] {
+		return replyError("NOSCRIPT No matching script. Please use EVAL.")
+	}
+
+	numKeys, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	switch {
+	case numKeys < 0:
+		return replyError("ERR Number of keys can't be negative")
+	case numKeys > int64(len(args)-3):
+		return replyError("ERR Number of keys can't be greater than number of args")
+	}
+
+	fn := c.f.scripts[hash]
+	if fn == nil {
+		return replyError("ERR redistest: no ScriptFunc is registered for script " + hash)
+	}
+
+	// The commands of a script don't block, as it's run atomically.
+	atomic := c.atomic
+	c.atomic = true
+	defer func() { c.atomic = atomic }()
+
+	reply, err := fn(&ScriptCall{Keys: args[3 : 3+numKeys], Args: args[3+numKeys:], c: c})
+	if err != nil {
+		return replyError(err.Error())
+	}
+	return scriptReply(reply)
+}
+
+func script(c *client, args []string) interface{} {
+	switch subcommand := strings.ToUpper(args[1]); {
+	case subcommand == "LOAD" && len(args) == 3:
+		hash := scriptHash(args[2])
+		c.f.loaded[hash] = true
+		return hash
+	case subcommand == "EXISTS" && len(args) > 2:
+		reply := make([]interface{}, len(args)-2)
+		for i, hash := range args[2:] {
+			reply[i] = 0
+			if c.f.loaded[strings.ToLower(hash)] {
+				reply[i] = 1
+			}
+		}
+		return reply
+	case subcommand == "FLUSH" && len(args) <= 3:
+		c.f.loaded = map[string]bool{}
+		return ok
+	}
+	return replyError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try SCRIPT HELP.", args[1]))
+}
+
+func scriptHash(src string) string {
+	h := sha1.Sum([]byte(src))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,68 @@
+package redistest
+
+import (
+	"net"
+)
+
+// Server is a Fake listening on a loopback TCP port, or a unix socket, so that it can be connected
+// to as a Redis server is, with redis.NewPool or redisurl.ConnectToURL, at its URL. It speaks
+// RESP2, and RESP3 to clients which switch to it with HELLO, and requires clients to authenticate
+// with AUTH or HELLO if it has a password.
+type Server struct {
+	*Fake
+	ln net.Listener
+}
+
+// ServerOptions configure a Server.
+type ServerOptions struct {
+	Options
+	// Socket is the path of a unix socket to listen on, in place of a loopback TCP port.
+	Socket string
+}
+
+// NewServer returns a Server with no keys, which is listening.
+func NewServer(options ServerOptions) (*Server, error) {
+	network, address := "tcp", "127.0.0.1:0"
+	if options.Socket != "" {
+		network, address = "unix", options.Socket
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Fake: New(options.Options), ln: ln}
+	go s.accept()
+	return s, nil
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.Fake.serve(conn)
+	}
+}
+
+// Addr returns the address the server is listening on: its host and port, or the path of its unix
+// socket.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// URL returns the URL of the server, e.g. "redis://127.0.0.1:55555" or "unix:///tmp/redis.sock",
+// which selects database 0 and carries no password.
+func (s *Server) URL() string {
+	if s.ln.Addr().Network() == "unix" {
+		return "unix://" + s.Addr()
+	}
+	return "redis://" + s.Addr()
+}
+
+// Close stops the server listening, and closes the fake.
+func (s *Server) Close() {
+	s.ln.Close()
+	s.Fake.Close()
+}
@@ -0,0 +1,210 @@
+package redistest_test
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+	"github.com/timehop/jimmy/redis/redisurl"
+)
+
+func newServer(t *testing.T, options redistest.ServerOptions) *redistest.Server {
+	s, err := redistest.NewServer(options)
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newPool(t *testing.T, url string, config redis.Config) redis.Pool {
+	p, err := redis.NewPool(url, config)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(p.Shutdown)
+	return p
+}
+
+// withPassword returns the URL of s with password, and username if it isn't "".
+func withPassword(s *redistest.Server, username, password string) string {
+	u, _ := url.Parse(s.URL())
+	if username == "" {
+		u.User = url.UserPassword("", password)
+	} else {
+		u.User = url.UserPassword(username, password)
+	}
+	return u.String()
+}
+
+func TestServer(t *testing.T) {
+	t.Run("selects databases over TCP and unix sockets", func(t *testing.T) {
+		tcp := newServer(t, redistest.ServerOptions{})
+		unix := newServer(t, redistest.ServerOptions{Socket: filepath.Join(t.TempDir(), "redis.sock")})
+
+		for _, s := range []*redistest.Server{tcp, unix} {
+			selected := s.URL() + "/3"
+			if s == unix {
+				selected = s.URL() + "?db=3"
+			}
+			p := newPool(t, selected, redis.DefaultConfig)
+			if err := p.Set("key", "value"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok, _ := newPool(t, s.URL(), redis.DefaultConfig).Exists("key"); ok {
+				t.Errorf("expected the key to be set in database 3 of %s only", s.URL())
+			}
+			if value, _ := p.Get("key"); value != "value" {
+				t.Errorf("expected value but got %q", value)
+			}
+		}
+	})
+
+	t.Run("speaks RESP3", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		config := redis.DefaultConfig
+		config.Protocol = 3
+		p := newPool(t, s.URL(), config)
+
+		p.HSet("hash", "field", "value")
+		p.ZAdd("zset", 1.5, "a", 2, "b")
+		if hash, err := p.HGetAll("hash"); err != nil || !reflect.DeepEqual(hash, map[string]string{"field": "value"}) {
+			t.Errorf("expected the hash but got %v, %v", hash, err)
+		}
+		if z, err := p.ZRangeWithScores("zset", 0, -1); err != nil || !reflect.DeepEqual(z, []redis.Z{{Value: "a", Score: 1.5}, {Value: "b", Score: 2}}) {
+			t.Errorf("expected the sorted set but got %v, %v", z, err)
+		}
+		if _, err := p.Get("missing"); err != redis.ErrNil {
+			t.Errorf("expected ErrNil but got %v", err)
+		}
+
+		ps, err := p.PubSub()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer ps.Close()
+		ps.Subscribe("channel")
+		for receivers := 0; receivers == 0; {
+			receivers, _ = p.Publish("channel", "message")
+		}
+		select {
+		case m := <-ps.Messages():
+			if m.Channel != "channel" || m.Data != "message" {
+				t.Errorf("unexpected message %+v", m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the message")
+		}
+	})
+
+	t.Run("requires a password", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{Options: redistest.Options{Password: "secret"}})
+
+		if err := newPool(t, s.URL(), redis.DefaultConfig).Set("key", "value"); !errors.Is(err, redis.ErrNoAuth) {
+			t.Errorf("expected ErrNoAuth but got %v", err)
+		}
+		if err := newPool(t, withPassword(s, "", "wrong"), redis.DefaultConfig).Set("key", "value"); !errors.Is(err, redis.ErrWrongPass) {
+			t.Errorf("expected ErrWrongPass but got %v", err)
+		}
+
+		resp3 := redis.DefaultConfig
+		resp3.Protocol = 3
+		for _, url := range []string{withPassword(s, "", "secret"), withPassword(s, "default", "secret"), withPassword(s, "h", "secret")} {
+			for _, config := range []redis.Config{redis.DefaultConfig, resp3} {
+				if err := newPool(t, url, config).Set("key", "value"); err != nil {
+					t.Errorf("expected %s to authenticate with protocol %d but got %v", url, config.Protocol, err)
+				}
+			}
+		}
+	})
+
+	t.Run("falls back to connecting without a password", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		p := newPool(t, withPassword(s, "", "secret"), redis.DefaultConfig)
+		for i := 0; i < 2; i++ {
+			if err := p.Set("key", "value"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+
+		c, err := redisurl.ConnectToURL(withPassword(s, "h", "secret"))
+		if err == nil || err.Error()[:3] != "ERR" {
+			t.Errorf("expected AUTH to fail as no password is set but got %v", err)
+		}
+		if c != nil {
+			c.Close()
+		}
+	})
+
+	t.Run("sets its password with CONFIG SET", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		c, err := newPool(t, s.URL(), redis.DefaultConfig).GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+		if _, err := c.Do("CONFIG", "SET", "requirepass", "testpass"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := c.Do("PING"); err != nil {
+			t.Errorf("expected the connection to stay authenticated but got %v", err)
+		}
+
+		if err := newPool(t, s.URL(), redis.DefaultConfig).Set("key", "value"); !errors.Is(err, redis.ErrNoAuth) {
+			t.Errorf("expected ErrNoAuth but got %v", err)
+		}
+		if err := newPool(t, withPassword(s, "", "testpass"), redis.DefaultConfig).Set("key", "value"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		c.Do("CONFIG", "SET", "requirepass", "")
+		if err := newPool(t, s.URL(), redis.DefaultConfig).Set("key", "value"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("injects failures", func(t *testing.T) {
+		s := newServer(t, redistest.ServerOptions{})
+		p := newPool(t, s.URL(), redis.DefaultConfig)
+		retrying := redis.DefaultConfig
+		retrying.Retry = redis.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+		r := newPool(t, s.URL(), retrying)
+		p.Set("key", "value")
+
+		s.Inject(redistest.Failure{Command: "get", Times: 1, Drop: true})
+		if _, err := p.Get("key"); !errors.Is(err, redis.ErrConnection) {
+			t.Errorf("expected ErrConnection but got %v", err)
+		}
+		if value, err := p.Get("key"); err != nil || value != "value" {
+			t.Errorf("expected the failure to be used up but got %q, %v", value, err)
+		}
+
+		s.Inject(redistest.Failure{Command: "GET", Times: 2, Error: redistest.LoadingError})
+		if _, err := p.Get("key"); !errors.Is(err, redis.ErrLoading) {
+			t.Errorf("expected ErrLoading but got %v", err)
+		}
+		if value, err := r.Get("key"); err != nil || value != "value" {
+			t.Errorf("expected to retry until the server had loaded but got %q, %v", value, err)
+		}
+
+		s.Inject(redistest.Failure{Delay: 50 * time.Millisecond})
+		start := time.Now()
+		if err := p.Set("key", "delayed"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("expected the reply to be delayed but got it after %v", elapsed)
+		}
+		s.ClearFailures()
+
+		s.DropConnections()
+		if value, err := r.Get("key"); err != nil || value != "delayed" {
+			t.Errorf("expected to reconnect but got %q, %v", value, err)
+		}
+	})
+}
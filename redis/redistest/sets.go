@@ -0,0 +1,365 @@
+package redistest
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sets - https://redis.io/commands#set
+
+func sadd(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getOrCreate(key, kindSet)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, member := range args[2:] {
+		if _, found := v.set[member]; !found {
+			v.set[member] = c.f.next()
+			added++
+		}
+	}
+	c.db.modified(key, v)
+	return added
+}
+
+func srem(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getKind(key, kindSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	removed := 0
+	for _, member := range args[2:] {
+		if _, found := v.set[member]; found {
+			delete(v.set, member)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.db.modified(key, v)
+	}
+	return removed
+}
+
+func scard(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	return len(v.set)
+}
+
+// spop pops a random member, or an array of up to count of them if it's given one.
+func spop(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	count := int64(1)
+	if len(args) == 3 {
+		var err error
+		if count, err = parseInt(args[2]); err != nil {
+			return err
+		}
+		if count < 0 {
+			return replyError("ERR value is out of range, must be positive")
+		}
+	}
+
+	key := args[1]
+	v, err := c.db.getKind(key, kindSet)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		if len(args) == 3 {
+			return []interface{}{}
+		}
+		return nil
+	}
+
+	members := v.members()
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	popped := []interface{}{}
+	for _, member := range members[:min(count, int64(len(members)))] {
+		delete(v.set, member)
+		popped = append(popped, member)
+	}
+	c.db.modified(key, v)
+	if len(args) == 3 {
+		return popped
+	}
+	return popped[0]
+}
+
+// smembers replies with the members of a set sorted, where Redis's order is arbitrary.
+func smembers(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+	reply := respSet{}
+	for _, member := range v.members() {
+		reply = append(reply, member)
+	}
+	return reply
+}
+
+// srandmember replies with a random member, or an array of count distinct ones, or of -count
+// members which may repeat if count is negative.
+func srandmember(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	v, err := c.db.getKind(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+	members := v.members()
+	if len(args) == 2 {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[rand.Intn(len(members))]
+	}
+
+	count, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	reply := []interface{}{}
+	if len(members) == 0 {
+		return reply
+	}
+	if count < 0 {
+		for i := int64(0); i < -count; i++ {
+			reply = append(reply, members[rand.Intn(len(members))])
+		}
+		return reply
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	for _, member := range members[:min(count, int64(len(members)))] {
+		reply = append(reply, member)
+	}
+	return reply
+}
+
+// sdiff runs SDIFF, SINTER and SUNION, whose members are sorted.
+func sdiff(c *client, args []string) interface{} {
+	sets := make([]*value, len(args)-1)
+	for i, key := range args[1:] {
+		v, err := c.db.getKind(key, kindSet)
+		if err != nil {
+			return err
+		}
+		sets[i] = v
+	}
+
+	name := strings.ToUpper(args[0])
+	reply := respSet{}
+	if name == "SUNION" {
+		union := map[string]bool{}
+		for _, set := range sets {
+			for _, member := range set.members() {
+				union[member] = true
+			}
+		}
+		members := make([]string, 0, len(union))
+		for member := range union {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		for _, member := range members {
+			reply = append(reply, member)
+		}
+		return reply
+	}
+
+	for _, member := range sets[0].members() {
+		in := true
+		for _, set := range sets[1:] {
+			_, found := set.setMember(member)
+			if name == "SDIFF" && found || name == "SINTER" && !found {
+				in = false
+				break
+			}
+		}
+		if in {
+			reply = append(reply, member)
+		}
+	}
+	return reply
+}
+
+func sismember(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+	if _, found := v.setMember(args[2]); found {
+		return 1
+	}
+	return 0
+}
+
+func smove(c *client, args []string) interface{} {
+	source, destination, member := args[1], args[2], args[3]
+	from, err := c.db.getKind(source, kindSet)
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.getKind(destination, kindSet); err != nil {
+		return err
+	}
+	if _, found := from.setMember(member); !found {
+		return 0
+	}
+	if source == destination {
+		return 1
+	}
+
+	delete(from.set, member)
+	c.db.modified(source, from)
+	to, _ := c.db.getOrCreate(destination, kindSet)
+	if _, found := to.set[member]; !found {
+		to.set[member] = c.f.next()
+	}
+	c.db.modified(destination, to)
+	return 1
+}
+
+func sscan(c *client, args []string) interface{} {
+	options, err := parseScan(args[2:], false)
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindSet)
+	if err != nil {
+		return err
+	}
+
+	var members []scanned
+	if v != nil {
+		for member, seq := range v.set {
+			members = append(members, scanned{seq, member})
+		}
+	}
+	page, next := scanPage(members, options)
+
+	reply := []interface{}{}
+	for _, member := range page {
+		reply = append(reply, member.name)
+	}
+	return []interface{}{strconv.FormatUint(next, 10), reply}
+}
+
+// members returns the members of a set, sorted, which may be nil for a key with no value.
+func (v *value) members() []string {
+	if v == nil {
+		return nil
+	}
+	members := make([]string, 0, len(v.set))
+	for member := range v.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// setMember returns the number of a member of a set, which may be nil for a key with no value.
+func (v *value) setMember(member string) (uint64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	seq, found := v.set[member]
+	return seq, found
+}
+
+// HyperLogLogs - https://redis.io/commands#hyperloglog
+//
+// A HyperLogLog keeps the elements added to it, so that it counts them exactly, where Redis
+// estimates.
+
+var errNotHLL = replyError("WRONGTYPE Key is not a valid HyperLogLog string value.")
+
+// getHLL returns the HyperLogLog of key, or nil if it has no value.
+func (d *db) getHLL(key string) (*value, error) {
+	v, err := d.getKind(key, kindString)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil && v.hll == nil {
+		return nil, errNotHLL
+	}
+	return v, nil
+}
+
+func pfadd(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getHLL(key)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		v = &value{kind: kindString, str: "HYLL", hll: map[string]bool{}}
+		c.db.set(key, v)
+	} else if len(args) == 2 {
+		return 0
+	}
+
+	changed := len(args) == 2
+	for _, element := range args[2:] {
+		if !v.hll[element] {
+			v.hll[element] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return 0
+	}
+	c.db.modified(key, v)
+	return 1
+}
+
+func pfcount(c *client, args []string) interface{} {
+	union := map[string]bool{}
+	for _, key := range args[1:] {
+		v, err := c.db.getHLL(key)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			for element := range v.hll {
+				union[element] = true
+			}
+		}
+	}
+	return len(union)
+}
+
+func pfmerge(c *client, args []string) interface{} {
+	merged := map[string]bool{}
+	for _, key := range args[1:] {
+		v, err := c.db.getHLL(key)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			for element := range v.hll {
+				merged[element] = true
+			}
+		}
+	}
+
+	destination := args[1]
+	if v := c.db.get(destination); v != nil {
+		v.hll = merged
+		c.db.modified(destination, v)
+	} else {
+		c.db.set(destination, &value{kind: kindString, str: "HYLL", hll: merged})
+	}
+	return ok
+}
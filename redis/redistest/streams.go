@@ -0,0 +1,1071 @@
+package redistest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Streams - https://redis.io/commands#stream
+
+var (
+	errInvalidStreamID = replyError("ERR Invalid stream ID specified as stream command argument")
+	errNoStream        = replyError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// streamID is the ID of a stream entry, e.g. 1526919030474-55.
+type streamID struct {
+	ms, seq uint64
+}
+
+var maxStreamID = streamID{math.MaxUint64, math.MaxUint64}
+
+// parseStreamID parses an ID, whose sequence number, if it's left out, is seq.
+func parseStreamID(arg string, seq uint64) (streamID, error) {
+	msArg, seqArg, hasSeq := strings.Cut(arg, "-")
+	ms, err := strconv.ParseUint(msArg, 10, 64)
+	if err != nil {
+		return streamID{}, errInvalidStreamID
+	}
+	if hasSeq {
+		if seq, err = strconv.ParseUint(seqArg, 10, 64); err != nil {
+			return streamID{}, errInvalidStreamID
+		}
+	}
+	return streamID{ms, seq}, nil
+}
+
+// parseRangeID parses the start or end of a range of IDs, which may be - or +, or exclusive if
+// it starts with (. It reports false if the range can't have any entries, as an exclusive bound
+// can't be moved past the first or last possible ID.
+func parseRangeID(arg string, start bool) (streamID, bool, error) {
+	switch arg {
+	case "-":
+		return streamID{}, true, nil
+	case "+":
+		return maxStreamID, true, nil
+	}
+	exclusive := strings.HasPrefix(arg, "(")
+	arg = strings.TrimPrefix(arg, "(")
+	var seq uint64
+	if !start {
+		seq = math.MaxUint64
+	}
+	id, err := parseStreamID(arg, seq)
+	if err != nil || !exclusive {
+		return id, true, err
+	}
+	var ok bool
+	if start {
+		id, ok = id.next()
+	} else {
+		id, ok = id.prev()
+	}
+	return id, ok, nil
+}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || id.ms == other.ms && id.seq < other.seq
+}
+
+// next returns the ID after id, or false if there's none.
+func (id streamID) next() (streamID, bool) {
+	switch {
+	case id.seq < math.MaxUint64:
+		return streamID{id.ms, id.seq + 1}, true
+	case id.ms < math.MaxUint64:
+		return streamID{id.ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// prev returns the ID before id, or false if there's none.
+func (id streamID) prev() (streamID, bool) {
+	switch {
+	case id.seq > 0:
+		return streamID{id.ms, id.seq - 1}, true
+	case id.ms > 0:
+		return streamID{id.ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+// stream is the value of a stream key, which isn't deleted once it's empty.
+type stream struct {
+	// Ordered by ID.
+	entries []streamEntry
+	lastID  streamID
+	groups  map[string]*streamGroup
+}
+
+type streamGroup struct {
+	lastDelivered streamID
+	// The entries delivered to consumers of the group, and not yet acknowledged.
+	pending   map[streamID]*pendingEntry
+	consumers map[string]*streamConsumer
+}
+
+type pendingEntry struct {
+	consumer  string
+	delivered time.Time
+	count     int
+}
+
+type streamConsumer struct {
+	// When the consumer last read or claimed entries.
+	seen time.Time
+}
+
+func newStream() *stream {
+	return &stream{groups: map[string]*streamGroup{}}
+}
+
+func newStreamGroup(lastDelivered streamID) *streamGroup {
+	return &streamGroup{lastDelivered: lastDelivered, pending: map[streamID]*pendingEntry{}, consumers: map[string]*streamConsumer{}}
+}
+
+// search returns the index of the first entry with an ID no less than id.
+func (s *stream) search(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].id.less(id) })
+}
+
+// entry returns the entry with an ID, if it hasn't been deleted.
+func (s *stream) entry(id streamID) (streamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].id == id {
+		return s.entries[i], true
+	}
+	return streamEntry{}, false
+}
+
+// between returns up to count of the entries with IDs from start to end, or all of them if count
+// isn't positive.
+func (s *stream) between(start, end streamID, count int) []streamEntry {
+	i := s.search(start)
+	var entries []streamEntry
+	for ; i < len(s.entries) && !end.less(s.entries[i].id); i++ {
+		if count > 0 && len(entries) == count {
+			break
+		}
+		entries = append(entries, s.entries[i])
+	}
+	return entries
+}
+
+// after returns up to count of the entries with IDs greater than id.
+func (s *stream) after(id streamID, count int) []streamEntry {
+	start, ok := id.next()
+	if !ok {
+		return nil
+	}
+	return s.between(start, maxStreamID, count)
+}
+
+// nextID returns the ID for an entry to be added with the ID argument of XADD: *, ms-* or an
+// explicit ID, which must be greater than the last.
+func (s *stream) nextID(arg string, now time.Time) (streamID, error) {
+	var id streamID
+	switch {
+	case arg == "*":
+		ms := uint64(now.UnixMilli())
+		if ms > s.lastID.ms {
+			return streamID{ms, 0}, nil
+		}
+		id, _ = s.lastID.next()
+		return id, nil
+	case strings.HasSuffix(arg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(arg, "-*"), 10, 64)
+		if err != nil {
+			return streamID{}, errInvalidStreamID
+		}
+		id = streamID{ms, 0}
+		if ms == s.lastID.ms && s.lastID.seq < math.MaxUint64 {
+			id.seq = s.lastID.seq + 1
+		}
+	default:
+		var err error
+		if id, err = parseStreamID(arg, 0); err != nil {
+			return streamID{}, err
+		}
+		if id == (streamID{}) {
+			return streamID{}, replyError("ERR The ID specified in XADD must be greater than 0-0")
+		}
+	}
+	if !s.lastID.less(id) {
+		return streamID{}, replyError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	return id, nil
+}
+
+// trimOptions are the MAXLEN and MINID options of XADD and XTRIM.
+type trimOptions struct {
+	maxLen int64
+	minID  *streamID
+}
+
+// parseTrim parses MAXLEN or MINID at args[i], if it's either, and returns the index of the
+// argument after it.
+func parseTrim(args []string, i int, options *trimOptions) (int, bool, error) {
+	strategy := strings.ToUpper(args[i])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return i, false, nil
+	}
+	i++
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		i++
+	}
+	if i == len(args) {
+		return i, false, errSyntax
+	}
+	if strategy == "MAXLEN" {
+		n, err := parseInt(args[i])
+		if err != nil {
+			return i, false, err
+		}
+		if n < 0 {
+			return i, false, replyError("ERR The MAXLEN argument must be >= 0.")
+		}
+		options.maxLen = n
+	} else {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			return i, false, err
+		}
+		options.minID = &id
+	}
+	i++
+	// LIMIT only bounds the work of trimming approximately, which a fake needn't.
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		if _, err := parseInt(args[i+1]); err != nil {
+			return i, false, err
+		}
+		i += 2
+	}
+	return i, true, nil
+}
+
+// trim removes the entries which options trim, exactly, and returns how many it removed.
+func (s *stream) trim(options trimOptions) int {
+	n := 0
+	if options.minID != nil {
+		n = s.search(*options.minID)
+	} else if int64(len(s.entries)) > options.maxLen {
+		n = len(s.entries) - int(options.maxLen)
+	}
+	s.entries = s.entries[n:]
+	return n
+}
+
+func entryReply(e streamEntry) []interface{} {
+	fields := make([]interface{}, len(e.fields))
+	for i, field := range e.fields {
+		fields[i] = field
+	}
+	return []interface{}{e.id.String(), fields}
+}
+
+func entriesReply(entries []streamEntry) []interface{} {
+	reply := []interface{}{}
+	for _, e := range entries {
+		reply = append(reply, entryReply(e))
+	}
+	return reply
+}
+
+func xadd(c *client, args []string) interface{} {
+	key := args[1]
+	noMkStream := false
+	trimmed := false
+	var options trimOptions
+	i := 2
+	for ; i < len(args); i++ {
+		if strings.ToUpper(args[i]) == "NOMKSTREAM" {
+			noMkStream = true
+			continue
+		}
+		next, isTrim, err := parseTrim(args, i, &options)
+		if err != nil {
+			return err
+		}
+		if !isTrim {
+			break
+		}
+		trimmed, i = true, next-1
+	}
+	if i == len(args) || (len(args)-i-1)%2 != 0 || len(args)-i-1 == 0 {
+		return wrongArgs(args[0])
+	}
+
+	v, err := c.db.getKind(key, kindStream)
+	if err != nil {
+		return err
+	}
+	if v == nil && noMkStream {
+		return nil
+	}
+	s := newStream()
+	if v != nil {
+		s = v.stream
+	}
+	id, err := s.nextID(args[i], c.f.now())
+	if err != nil {
+		return err
+	}
+
+	if v == nil {
+		v, _ = c.db.getOrCreate(key, kindStream)
+		s = v.stream
+	}
+	s.entries = append(s.entries, streamEntry{id, append([]string(nil), args[i+1:]...)})
+	s.lastID = id
+	if trimmed {
+		s.trim(options)
+	}
+	c.db.modified(key, v)
+	return id.String()
+}
+
+func xlen(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindStream)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	return len(v.stream.entries)
+}
+
+func xdel(c *client, args []string) interface{} {
+	ids := make([]streamID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	key := args[1]
+	v, err := c.db.getKind(key, kindStream)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		s := v.stream
+		if i := s.search(id); i < len(s.entries) && s.entries[i].id == id {
+			s.entries = append(s.entries[:i:i], s.entries[i+1:]...)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		c.db.modified(key, v)
+	}
+	return deleted
+}
+
+// xrange runs XRANGE, and XREVRANGE, which takes its end before its start.
+func xrange(c *client, args []string) interface{} {
+	rev := strings.ToUpper(args[0]) == "XREVRANGE"
+	startArg, endArg := args[2], args[3]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	count := -1
+	switch {
+	case len(args) == 6 && strings.ToUpper(args[4]) == "COUNT":
+		n, err := parseInt(args[5])
+		if err != nil {
+			return err
+		}
+		count = int(n)
+	case len(args) != 4:
+		return errSyntax
+	}
+
+	start, startOK, err := parseRangeID(startArg, true)
+	if err != nil {
+		return err
+	}
+	end, endOK, err := parseRangeID(endArg, false)
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindStream)
+	if err != nil {
+		return err
+	}
+	if v == nil || !startOK || !endOK || count == 0 {
+		return []interface{}{}
+	}
+
+	entries := v.stream.between(start, end, 0)
+	if rev {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if count > 0 && count < len(entries) {
+		entries = entries[:count]
+	}
+	return entriesReply(entries)
+}
+
+func xtrim(c *client, args []string) interface{} {
+	var options trimOptions
+	i, isTrim, err := parseTrim(args, 2, &options)
+	if err != nil {
+		return err
+	}
+	if !isTrim || i != len(args) {
+		return errSyntax
+	}
+	key := args[1]
+	v, err := c.db.getKind(key, kindStream)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	n := v.stream.trim(options)
+	if n > 0 {
+		c.db.modified(key, v)
+	}
+	return n
+}
+
+// xread runs XREAD, and XREADGROUP, which reads as a consumer of a group.
+func xread(c *client, args []string) interface{} {
+	i := 1
+	var group, consumer string
+	grouped := strings.ToUpper(args[0]) == "XREADGROUP"
+	if grouped {
+		if strings.ToUpper(args[1]) != "GROUP" {
+			return errSyntax
+		}
+		group, consumer, i = args[2], args[3], 4
+	}
+
+	count, block, noAck := 0, time.Duration(-1), false
+	for ; i < len(args) && strings.ToUpper(args[i]) != "STREAMS"; i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "COUNT" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil {
+				return err
+			}
+			count, i = int(max(n, 0)), i+1
+		case option == "BLOCK" && i+1 < len(args):
+			ms, err := parseInt(args[i+1])
+			if err != nil {
+				return replyError("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return replyError("ERR timeout is negative")
+			}
+			block, i = time.Duration(ms)*time.Millisecond, i+1
+		case option == "NOACK" && grouped:
+			noAck = true
+		default:
+			return errSyntax
+		}
+	}
+	streams := args[min(i+1, len(args)):]
+	if i == len(args) || len(streams) == 0 || len(streams)%2 != 0 {
+		return replyError(fmt.Sprintf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified.",
+			strings.ToLower(args[0]), map[bool]string{false: "$", true: ">"}[grouped]))
+	}
+	keys, idArgs := streams[:len(streams)/2], streams[len(streams)/2:]
+
+	// The IDs to read after, of which $ is the last ID of the stream as the command is run, and >
+	// the last delivered to the group.
+	ids := make([]streamID, len(keys))
+	for i, arg := range idArgs {
+		switch {
+		case arg == "$" && !grouped:
+			v, err := c.db.getKind(keys[i], kindStream)
+			if err != nil {
+				return err
+			}
+			if v != nil {
+				ids[i] = v.stream.lastID
+			}
+		case arg == ">" && grouped:
+		default:
+			id, err := parseStreamID(arg, 0)
+			if err != nil {
+				return err
+			}
+			ids[i] = id
+		}
+	}
+
+	until := deadline(block)
+	for {
+		// Streams read from the history of the consumer are replied with even if they have no
+		// entries, so they're never waited for.
+		reply := []interface{}{}
+		for i, key := range keys {
+			v, err := c.db.getKind(key, kindStream)
+			if err != nil {
+				return err
+			}
+			if !grouped {
+				if v != nil {
+					if entries := v.stream.after(ids[i], count); len(entries) > 0 {
+						reply = append(reply, []interface{}{key, entriesReply(entries)})
+					}
+				}
+				continue
+			}
+
+			var g *streamGroup
+			if v != nil {
+				g = v.stream.groups[group]
+			}
+			if g == nil {
+				return replyError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group))
+			}
+			now := c.f.now()
+			g.consumer(consumer, now)
+			if idArgs[i] != ">" {
+				reply = append(reply, []interface{}{key, g.history(v.stream, consumer, ids[i], count, now)})
+				continue
+			}
+
+			entries := v.stream.after(g.lastDelivered, count)
+			if len(entries) == 0 {
+				continue
+			}
+			for _, e := range entries {
+				if !noAck {
+					g.pending[e.id] = &pendingEntry{consumer: consumer, delivered: now, count: 1}
+				}
+			}
+			g.lastDelivered = entries[len(entries)-1].id
+			reply = append(reply, []interface{}{key, entriesReply(entries)})
+		}
+
+		if len(reply) > 0 {
+			return reply
+		}
+		if block < 0 || !c.blockUntil(until) {
+			return nilArray{}
+		}
+	}
+}
+
+// consumer returns a consumer of the group, creating it if it doesn't exist, as it's seen now.
+func (g *streamGroup) consumer(name string, now time.Time) *streamConsumer {
+	sc := g.consumers[name]
+	if sc == nil {
+		sc = &streamConsumer{}
+		g.consumers[name] = sc
+	}
+	sc.seen = now
+	return sc
+}
+
+// pendingIDs returns the IDs of the group's pending entries, in order.
+func (g *streamGroup) pendingIDs() []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+// history delivers again up to count of the entries pending for a consumer, with IDs greater than
+// after. Entries deleted since are replied with no fields.
+func (g *streamGroup) history(s *stream, consumer string, after streamID, count int, now time.Time) []interface{} {
+	reply := []interface{}{}
+	for _, id := range g.pendingIDs() {
+		p := g.pending[id]
+		if p.consumer != consumer || !after.less(id) {
+			continue
+		}
+		if count > 0 && len(reply) == count {
+			break
+		}
+		p.delivered = now
+		p.count++
+		if e, found := s.entry(id); found {
+			reply = append(reply, entryReply(e))
+		} else {
+			reply = append(reply, []interface{}{id.String(), nilArray{}})
+		}
+	}
+	return reply
+}
+
+// getGroup returns the group of a stream, or a NOGROUP error if there's no such stream or group.
+func (d *db) getGroup(key, group string) (*value, *streamGroup, error) {
+	v, err := d.getKind(key, kindStream)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v == nil || v.stream.groups[group] == nil {
+		return nil, nil, replyError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+	}
+	return v, v.stream.groups[group], nil
+}
+
+func xgroup(c *client, args []string) interface{} {
+	subcommand := strings.ToUpper(args[1])
+	arities := map[string][2]int{"CREATE": {5, 8}, "SETID": {5, 7}, "DESTROY": {4, 4}, "CREATECONSUMER": {5, 5}, "DELCONSUMER": {5, 5}}
+	arity, found := arities[subcommand]
+	if !found || len(args) < arity[0] || len(args) > arity[1] {
+		return replyError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try XGROUP HELP.", args[1]))
+	}
+
+	key, group := args[2], args[3]
+	v, err := c.db.getKind(key, kindStream)
+	if err != nil {
+		return err
+	}
+	if v == nil && !(subcommand == "CREATE" && len(args) > 5 && strings.ToUpper(args[5]) == "MKSTREAM") {
+		return errNoStream
+	}
+
+	// The ID a group is created or set to, which may be $, the last ID of the stream.
+	lastDelivered := func(arg string, s *stream) (streamID, error) {
+		if arg == "$" {
+			return s.lastID, nil
+		}
+		return parseStreamID(arg, 0)
+	}
+
+	switch subcommand {
+	case "CREATE":
+		for i := 5; i < len(args); i++ {
+			switch option := strings.ToUpper(args[i]); {
+			case option == "MKSTREAM":
+			case option == "ENTRIESREAD" && i+1 < len(args):
+				// It's for the lag of XINFO GROUPS, which a fake doesn't tell.
+				if _, err := parseInt(args[i+1]); err != nil {
+					return err
+				}
+				i++
+			default:
+				return errSyntax
+			}
+		}
+		s := newStream()
+		if v != nil {
+			s = v.stream
+		}
+		id, err := lastDelivered(args[4], s)
+		if err != nil {
+			return err
+		}
+		if s.groups[group] != nil {
+			return replyError("BUSYGROUP Consumer Group name already exists")
+		}
+		if v == nil {
+			v, _ = c.db.getOrCreate(key, kindStream)
+		}
+		v.stream.groups[group] = newStreamGroup(id)
+		c.db.modified(key, v)
+		return ok
+	case "DESTROY":
+		if v.stream.groups[group] == nil {
+			return 0
+		}
+		delete(v.stream.groups, group)
+		c.db.modified(key, v)
+		return 1
+	}
+
+	g := v.stream.groups[group]
+	if g == nil {
+		return replyError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+	}
+	defer c.db.modified(key, v)
+	switch subcommand {
+	case "SETID":
+		id, err := lastDelivered(args[4], v.stream)
+		if err != nil {
+			return err
+		}
+		g.lastDelivered = id
+		return ok
+	case "CREATECONSUMER":
+		if g.consumers[args[4]] != nil {
+			return 0
+		}
+		g.consumer(args[4], c.f.now())
+		return 1
+	}
+
+	// DELCONSUMER deletes the consumer and its pending entries.
+	pending := 0
+	for id, p := range g.pending {
+		if p.consumer == args[4] {
+			delete(g.pending, id)
+			pending++
+		}
+	}
+	delete(g.consumers, args[4])
+	return pending
+}
+
+func xack(c *client, args []string) interface{} {
+	ids := make([]streamID, len(args)-3)
+	for i, arg := range args[3:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	// Unlike other commands of groups, XACK doesn't mind there being no such stream or group.
+	key := args[1]
+	v, err := c.db.getKind(key, kindStream)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	g := v.stream.groups[args[2]]
+	if g == nil {
+		return 0
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if g.pending[id] != nil {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	if acked > 0 {
+		c.db.modified(key, v)
+	}
+	return acked
+}
+
+// xpending runs the summary form of XPENDING, and the extended form, given a range of IDs.
+func xpending(c *client, args []string) interface{} {
+	_, g, err := c.db.getGroup(args[1], args[2])
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 3 {
+		ids := g.pendingIDs()
+		if len(ids) == 0 {
+			return []interface{}{0, nil, nil, nilArray{}}
+		}
+		counts := map[string]int{}
+		for _, p := range g.pending {
+			counts[p.consumer]++
+		}
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		consumers := []interface{}{}
+		for _, name := range names {
+			consumers = append(consumers, []interface{}{name, strconv.Itoa(counts[name])})
+		}
+		return []interface{}{len(ids), ids[0].String(), ids[len(ids)-1].String(), consumers}
+	}
+
+	i := 3
+	var minIdle time.Duration
+	if strings.ToUpper(args[i]) == "IDLE" && i+1 < len(args) {
+		ms, err := parseInt(args[i+1])
+		if err != nil {
+			return err
+		}
+		minIdle, i = time.Duration(ms)*time.Millisecond, i+2
+	}
+	if len(args)-i != 3 && len(args)-i != 4 {
+		return errSyntax
+	}
+	start, startOK, err := parseRangeID(args[i], true)
+	if err != nil {
+		return err
+	}
+	end, endOK, err := parseRangeID(args[i+1], false)
+	if err != nil {
+		return err
+	}
+	count, err := parseInt(args[i+2])
+	if err != nil {
+		return err
+	}
+	consumer := ""
+	if len(args)-i == 4 {
+		consumer = args[i+3]
+	}
+
+	reply := []interface{}{}
+	if !startOK || !endOK {
+		return reply
+	}
+	now := c.f.now()
+	for _, id := range g.pendingIDs() {
+		if int64(len(reply)) >= count {
+			break
+		}
+		p := g.pending[id]
+		idle := now.Sub(p.delivered)
+		if id.less(start) || end.less(id) || consumer != "" && p.consumer != consumer || idle < minIdle {
+			continue
+		}
+		reply = append(reply, []interface{}{id.String(), p.consumer, idle.Milliseconds(), p.count})
+	}
+	return reply
+}
+
+// claimOptions are the options of XCLAIM and XAUTOCLAIM.
+type claimOptions struct {
+	minIdle    time.Duration
+	idle       time.Duration
+	retryCount int
+	force      bool
+	justID     bool
+}
+
+// claim claims a pending entry for consumer, if it's been idle for long enough, reporting whether
+// it did, and deletes it from the PEL if it has been deleted from the stream, reporting false.
+func (g *streamGroup) claim(s *stream, id streamID, consumer string, options claimOptions, now time.Time) (streamEntry, bool, bool) {
+	p := g.pending[id]
+	e, exists := s.entry(id)
+	if p == nil && options.force && exists {
+		p = &pendingEntry{delivered: now}
+		g.pending[id] = p
+	}
+	if p == nil {
+		return streamEntry{}, false, false
+	}
+	if !exists {
+		delete(g.pending, id)
+		return streamEntry{}, false, true
+	}
+	if now.Sub(p.delivered) < options.minIdle {
+		return streamEntry{}, false, false
+	}
+
+	p.consumer, p.delivered = consumer, now.Add(-options.idle)
+	switch {
+	case options.retryCount >= 0:
+		p.count = options.retryCount
+	case !options.justID:
+		p.count++
+	}
+	return e, true, false
+}
+
+func claimedReply(e streamEntry, justID bool) interface{} {
+	if justID {
+		return e.id.String()
+	}
+	return entryReply(e)
+}
+
+func xclaim(c *client, args []string) interface{} {
+	key, group, consumer := args[1], args[2], args[3]
+	ms, err := parseInt(args[4])
+	if err != nil {
+		return replyError("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	options := claimOptions{minIdle: time.Duration(ms) * time.Millisecond, retryCount: -1}
+
+	var ids []streamID
+	i := 5
+	for ; i < len(args); i++ {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	now := c.f.now()
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "FORCE":
+			options.force = true
+		case option == "JUSTID":
+			options.justID = true
+		case (option == "IDLE" || option == "TIME" || option == "RETRYCOUNT" || option == "LASTID") && i+1 < len(args):
+			i++
+			if option == "LASTID" {
+				continue
+			}
+			n, err := parseInt(args[i])
+			if err != nil {
+				return err
+			}
+			switch option {
+			case "IDLE":
+				options.idle = time.Duration(n) * time.Millisecond
+			case "TIME":
+				options.idle = now.Sub(time.UnixMilli(n))
+			case "RETRYCOUNT":
+				options.retryCount = int(n)
+			}
+		default:
+			return replyError("ERR Unrecognized XCLAIM option '" + args[i] + "'")
+		}
+	}
+	if len(ids) == 0 {
+		return errInvalidStreamID
+	}
+
+	v, g, err := c.db.getGroup(key, group)
+	if err != nil {
+		return err
+	}
+	g.consumer(consumer, now)
+	reply := []interface{}{}
+	for _, id := range ids {
+		if e, claimed, _ := g.claim(v.stream, id, consumer, options, now); claimed {
+			reply = append(reply, claimedReply(e, options.justID))
+		}
+	}
+	c.db.modified(key, v)
+	return reply
+}
+
+// xautoclaim claims up to COUNT, 100 by default, of the pending entries from start on, which have
+// been idle for long enough, and replies with the cursor to claim the rest from, the entries, and
+// the IDs of those since deleted, which are dropped from the PEL.
+func xautoclaim(c *client, args []string) interface{} {
+	key, group, consumer := args[1], args[2], args[3]
+	ms, err := parseInt(args[4])
+	if err != nil {
+		return replyError("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	options := claimOptions{minIdle: time.Duration(ms) * time.Millisecond, retryCount: -1}
+	start, _, err := parseRangeID(args[5], true)
+	if err != nil {
+		return err
+	}
+	count := 100
+	for i := 6; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "COUNT" && i+1 < len(args):
+			n, err := parseInt(args[i+1])
+			if err != nil || n < 1 {
+				return replyError("ERR COUNT must be > 0")
+			}
+			count, i = int(n), i+1
+		case option == "JUSTID":
+			options.justID = true
+		default:
+			return errSyntax
+		}
+	}
+
+	v, g, err := c.db.getGroup(key, group)
+	if err != nil {
+		return err
+	}
+	now := c.f.now()
+	g.consumer(consumer, now)
+	claimed, deleted := []interface{}{}, []interface{}{}
+	next := streamID{}
+	for _, id := range g.pendingIDs() {
+		if id.less(start) {
+			continue
+		}
+		if len(claimed)+len(deleted) == count {
+			next = id
+			break
+		}
+		e, ok, gone := g.claim(v.stream, id, consumer, options, now)
+		switch {
+		case ok:
+			claimed = append(claimed, claimedReply(e, options.justID))
+		case gone:
+			deleted = append(deleted, id.String())
+		}
+	}
+	c.db.modified(key, v)
+	return []interface{}{next.String(), claimed, deleted}
+}
+
+func xinfo(c *client, args []string) interface{} {
+	subcommand := strings.ToUpper(args[1])
+	if !(subcommand == "STREAM" && len(args) == 3 || subcommand == "GROUPS" && len(args) == 3 || subcommand == "CONSUMERS" && len(args) == 4) {
+		return replyError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try XINFO HELP.", args[1]))
+	}
+	v, err := c.db.getKind(args[2], kindStream)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return errNoSuchKey
+	}
+	s := v.stream
+
+	switch subcommand {
+	case "STREAM":
+		var first, last interface{}
+		if len(s.entries) > 0 {
+			first, last = entryReply(s.entries[0]), entryReply(s.entries[len(s.entries)-1])
+		}
+		return respMap{
+			"length", len(s.entries),
+			"radix-tree-keys", 1,
+			"radix-tree-nodes", 2,
+			"last-generated-id", s.lastID.String(),
+			"groups", len(s.groups),
+			"first-entry", first,
+			"last-entry", last,
+		}
+	case "GROUPS":
+		names := make([]string, 0, len(s.groups))
+		for name := range s.groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		reply := []interface{}{}
+		for _, name := range names {
+			g := s.groups[name]
+			reply = append(reply, respMap{
+				"name", name,
+				"consumers", len(g.consumers),
+				"pending", len(g.pending),
+				"last-delivered-id", g.lastDelivered.String(),
+			})
+		}
+		return reply
+	}
+
+	g := s.groups[args[3]]
+	if g == nil {
+		return replyError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", args[3], args[2]))
+	}
+	names := make([]string, 0, len(g.consumers))
+	for name := range g.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := c.f.now()
+	reply := []interface{}{}
+	for _, name := range names {
+		pending := 0
+		for _, p := range g.pending {
+			if p.consumer == name {
+				pending++
+			}
+		}
+		reply = append(reply, respMap{
+			"name", name,
+			"pending", pending,
+			"idle", now.Sub(g.consumers[name].seen).Milliseconds(),
+		})
+	}
+	return reply
+}
@@ -0,0 +1,467 @@
+package redistest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sorted sets - https://redis.io/commands#sorted-set
+
+// zmember is a member of a sorted set.
+type zmember struct {
+	score float64
+	// Numbers the member as it was added, for ZSCAN.
+	seq uint64
+}
+
+// zentry is a member of a sorted set and its score, as ranked by sorted.
+type zentry struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members of a sorted set ordered by score, and members with the same score
+// lexicographically, as Redis orders them. v may be nil for a key with no value.
+func (v *value) sorted() []zentry {
+	if v == nil {
+		return nil
+	}
+	entries := make([]zentry, 0, len(v.zset))
+	for member, m := range v.zset {
+		entries = append(entries, zentry{member, m.score})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].score != entries[j].score {
+			return entries[i].score < entries[j].score
+		}
+		return entries[i].member < entries[j].member
+	})
+	return entries
+}
+
+// scoreBound is the min or max of a range of scores, such as 1, (1 or +inf.
+type scoreBound struct {
+	score     float64
+	exclusive bool
+}
+
+func parseScoreBound(arg string) (scoreBound, error) {
+	var b scoreBound
+	if strings.HasPrefix(arg, "(") {
+		b.exclusive, arg = true, arg[1:]
+	}
+	var err error
+	if b.score, err = parseFloat(arg); err != nil {
+		return scoreBound{}, replyError("ERR min or max is not a float")
+	}
+	return b, nil
+}
+
+// inRange reports whether score is within min and max.
+func inRange(score float64, min, max scoreBound) bool {
+	return (score > min.score || !min.exclusive && score == min.score) &&
+		(score < max.score || !max.exclusive && score == max.score)
+}
+
+func zadd(c *client, args []string) interface{} {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return errSyntax
+	}
+	if nx && xx {
+		return replyError("ERR XX and NX options at the same time are not compatible")
+	}
+	if gt && lt || nx && (gt || lt) {
+		return replyError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return replyError("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for i := range scores {
+		score, err := parseFloat(pairs[2*i])
+		if err != nil {
+			return err
+		}
+		scores[i] = score
+	}
+
+	key := args[1]
+	v, err := c.db.getKind(key, kindZSet)
+	if err != nil {
+		return err
+	}
+	if v == nil && xx {
+		if incr {
+			return nil
+		}
+		return 0
+	}
+	if v == nil {
+		v, _ = c.db.getOrCreate(key, kindZSet)
+	}
+
+	added, changed := 0, 0
+	var incremented interface{}
+	for i, score := range scores {
+		member := pairs[2*i+1]
+		m, found := v.zset[member]
+		if incr && found {
+			score += m.score
+			if math.IsNaN(score) {
+				c.db.modified(key, v)
+				return replyError("ERR resulting score is not a number (NaN)")
+			}
+		}
+		switch {
+		case nx && found, xx && !found,
+			found && gt && score <= m.score,
+			found && lt && score >= m.score:
+			continue
+		case !found:
+			v.zset[member] = zmember{score, c.f.next()}
+			added++
+		case score != m.score:
+			m.score = score
+			v.zset[member] = m
+			changed++
+		}
+		incremented = double(score)
+	}
+	c.db.modified(key, v)
+
+	switch {
+	case incr:
+		return incremented
+	case ch:
+		return added + changed
+	}
+	return added
+}
+
+func zcard(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	return len(v.zset)
+}
+
+func zcount(c *client, args []string) interface{} {
+	min, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, e := range v.sorted() {
+		if inRange(e.score, min, max) {
+			n++
+		}
+	}
+	return n
+}
+
+func zincrby(c *client, args []string) interface{} {
+	by, err := parseFloat(args[2])
+	if err != nil {
+		return err
+	}
+	key, member := args[1], args[3]
+	v, err := c.db.getOrCreate(key, kindZSet)
+	if err != nil {
+		return err
+	}
+	m, found := v.zset[member]
+	if !found {
+		m.seq = c.f.next()
+	}
+	score := m.score + by
+	if math.IsNaN(score) {
+		c.db.modified(key, v)
+		return replyError("ERR resulting score is not a number (NaN)")
+	}
+	m.score = score
+	v.zset[member] = m
+	c.db.modified(key, v)
+	return double(score)
+}
+
+// zrange runs ZRANGE, ZREVRANGE, ZRANGEBYSCORE and ZREVRANGEBYSCORE.
+func zrange(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	rev := strings.HasPrefix(name, "ZREV")
+	byScore := strings.HasSuffix(name, "BYSCORE")
+	var withScores, limited bool
+	var offset, count int64
+	for i := 4; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "WITHSCORES":
+			withScores = true
+		case option == "BYSCORE" && name == "ZRANGE":
+			byScore = true
+		case option == "REV" && name == "ZRANGE":
+			rev = true
+		case option == "LIMIT" && i+2 < len(args):
+			var err error
+			if offset, err = parseInt(args[i+1]); err != nil {
+				return err
+			}
+			if count, err = parseInt(args[i+2]); err != nil {
+				return err
+			}
+			limited = true
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	if limited && !byScore {
+		return replyError("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+	entries := v.sorted()
+	if rev {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	if byScore {
+		// The reverse commands take max before min.
+		minArg, maxArg := args[2], args[3]
+		if rev {
+			minArg, maxArg = maxArg, minArg
+		}
+		min, err := parseScoreBound(minArg)
+		if err != nil {
+			return err
+		}
+		max, err := parseScoreBound(maxArg)
+		if err != nil {
+			return err
+		}
+		var inScores []zentry
+		for _, e := range entries {
+			if inRange(e.score, min, max) {
+				inScores = append(inScores, e)
+			}
+		}
+		entries = inScores
+		if limited {
+			if offset < 0 || offset >= int64(len(entries)) {
+				entries = nil
+			} else {
+				entries = entries[offset:]
+				if count >= 0 && count < int64(len(entries)) {
+					entries = entries[:count]
+				}
+			}
+		}
+	} else {
+		start, err := parseInt(args[2])
+		if err != nil {
+			return err
+		}
+		stop, err := parseInt(args[3])
+		if err != nil {
+			return err
+		}
+		from, to := rangeIndexes(start, stop, len(entries))
+		entries = entries[from:to]
+	}
+	return zentriesReply(entries, withScores, c.protocol == 3)
+}
+
+// zentriesReply replies with the members of a sorted set, each followed by its score if
+// withScores is set, or paired with it in an array of their own in RESP3, as Redis 7 replies.
+func zentriesReply(entries []zentry, withScores, resp3 bool) []interface{} {
+	reply := []interface{}{}
+	for _, e := range entries {
+		switch {
+		case withScores && resp3:
+			reply = append(reply, []interface{}{e.member, double(e.score)})
+		case withScores:
+			reply = append(reply, e.member, double(e.score))
+		default:
+			reply = append(reply, e.member)
+		}
+	}
+	return reply
+}
+
+// zrank runs ZRANK and ZREVRANK.
+func zrank(c *client, args []string) interface{} {
+	withScore := false
+	switch {
+	case len(args) == 4 && strings.EqualFold(args[3], "WITHSCORE"):
+		withScore = true
+	case len(args) > 3:
+		return errSyntax
+	}
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+	entries := v.sorted()
+	for i, e := range entries {
+		if e.member != args[2] {
+			continue
+		}
+		rank := i
+		if strings.ToUpper(args[0]) == "ZREVRANK" {
+			rank = len(entries) - 1 - i
+		}
+		if withScore {
+			return []interface{}{rank, double(e.score)}
+		}
+		return rank
+	}
+	if withScore {
+		return nilArray{}
+	}
+	return nil
+}
+
+func zrem(c *client, args []string) interface{} {
+	key := args[1]
+	v, err := c.db.getKind(key, kindZSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	removed := 0
+	for _, member := range args[2:] {
+		if _, found := v.zset[member]; found {
+			delete(v.zset, member)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.db.modified(key, v)
+	}
+	return removed
+}
+
+func zremrangebyrank(c *client, args []string) interface{} {
+	start, err := parseInt(args[2])
+	if err != nil {
+		return err
+	}
+	stop, err := parseInt(args[3])
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	v, err := c.db.getKind(key, kindZSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	entries := v.sorted()
+	from, to := rangeIndexes(start, stop, len(entries))
+	return v.zremEntries(c.db, key, entries[from:to])
+}
+
+func zremrangebyscore(c *client, args []string) interface{} {
+	min, err := parseScoreBound(args[2])
+	if err != nil {
+		return err
+	}
+	max, err := parseScoreBound(args[3])
+	if err != nil {
+		return err
+	}
+	key := args[1]
+	v, err := c.db.getKind(key, kindZSet)
+	if err != nil || v == nil {
+		return zeroOr(err)
+	}
+	var removed []zentry
+	for _, e := range v.sorted() {
+		if inRange(e.score, min, max) {
+			removed = append(removed, e)
+		}
+	}
+	return v.zremEntries(c.db, key, removed)
+}
+
+// zremEntries removes entries from the sorted set of key, and returns how many it removed.
+func (v *value) zremEntries(d *db, key string, entries []zentry) int {
+	for _, e := range entries {
+		delete(v.zset, e.member)
+	}
+	if len(entries) > 0 {
+		d.modified(key, v)
+	}
+	return len(entries)
+}
+
+func zscore(c *client, args []string) interface{} {
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil || v == nil {
+		return err
+	}
+	m, found := v.zset[args[2]]
+	if !found {
+		return nil
+	}
+	return double(m.score)
+}
+
+func zscan(c *client, args []string) interface{} {
+	options, err := parseScan(args[2:], false)
+	if err != nil {
+		return err
+	}
+	v, err := c.db.getKind(args[1], kindZSet)
+	if err != nil {
+		return err
+	}
+
+	var members []scanned
+	if v != nil {
+		for member, m := range v.zset {
+			members = append(members, scanned{m.seq, member})
+		}
+	}
+	page, next := scanPage(members, options)
+
+	reply := []interface{}{}
+	for _, member := range page {
+		reply = append(reply, member.name, double(v.zset[member.name].score))
+	}
+	return []interface{}{strconv.FormatUint(next, 10), reply}
+}
@@ -1,6 +1,8 @@
 package redisurl_test
 
 import (
+	"crypto/tls"
+	"net/url"
 	"testing"
 
 	"github.com/gomodule/redigo/redis"
@@ -67,3 +69,46 @@ func TestConnectToURL_WithAuth(t *testing.T) {
 		defer c.Close()
 	}
 }
+
+func TestTLSConfig(t *testing.T) {
+	u, _ := url.Parse("rediss://localhost:6380/0?tls_server_name=redis.test&tls_skip_verify=true")
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	config, err := redisurl.TLSConfig(u, base)
+	if err != nil {
+		t.Fatalf("Error returned: %v", err)
+	}
+	if config.ServerName != "redis.test" || !config.InsecureSkipVerify || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Wanted query applied to base, got %+v", config)
+	}
+	if base.ServerName != "" || base.InsecureSkipVerify {
+		t.Error("Expected base to be left unchanged")
+	}
+}
+
+func TestTLSConfig_InvalidQuery(t *testing.T) {
+	for _, query := range []string{
+		"tls_skip_verify=maybe",
+		"tls_cert_file=client.pem",
+		"tls_ca_file=/nonexistent/ca.pem",
+	} {
+		u, _ := url.Parse("rediss://localhost:6380?" + query)
+		if _, err := redisurl.TLSConfig(u, nil); err == nil {
+			t.Errorf("Expected error for %s, got nil", query)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	for s, want := range map[string][2]string{
+		"redis://localhost:6379/3":              {"tcp", "localhost:6379"},
+		"rediss://:pw@localhost:6380":           {"tcp", "localhost:6380"},
+		"unix:///run/redis.sock?db=3":           {"unix", "/run/redis.sock"},
+		"redis+unix://:pw@/run/redis.sock?db=3": {"unix", "/run/redis.sock"},
+	} {
+		u, _ := url.Parse(s)
+		if network, address := redisurl.Address(u); network != want[0] || address != want[1] {
+			t.Errorf("Wanted %v for %s, got %s %s", want, s, network, address)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package redisurl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// resp3Conn is a net.Conn to a server speaking RESP3, which presents what the server sends as
+// RESP2, the only protocol redigo reads. Maps and sets are read as arrays, null as a nil bulk
+// string, booleans as 1 and 0, doubles, big numbers and verbatim strings as bulk strings, blob
+// errors as errors, and push messages, such as those of a subscription, as arrays. Attributes are
+// dropped.
+type resp3Conn struct {
+	net.Conn
+
+	r *bufio.Reader
+	// RESP2 translated from the server's replies, not yet read.
+	buf bytes.Buffer
+}
+
+func newRESP3Conn(c net.Conn) *resp3Conn {
+	return &resp3Conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+func (c *resp3Conn) Read(p []byte) (int, error) {
+	if c.buf.Len() == 0 {
+		if err := translateRESP3(c.r, &c.buf); err != nil {
+			return 0, err
+		}
+	}
+	return c.buf.Read(p)
+}
+
+// translateRESP3 reads a reply in RESP3 from r, and writes it to w in RESP2.
+func translateRESP3(r *bufio.Reader, w *bytes.Buffer) error {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return err
+	}
+	if line == "" {
+		return fmt.Errorf("redisurl: empty RESP3 reply")
+	}
+
+	kind, value := line[0], line[1:]
+	switch kind {
+	case '+', '-', ':':
+		w.WriteString(line + "\r\n")
+	case '_':
+		w.WriteString("$-1\r\n")
+	case '#':
+		if value == "t" {
+			w.WriteString(":1\r\n")
+		} else {
+			w.WriteString(":0\r\n")
+		}
+	case ',', '(':
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+	case '$', '=', '!':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("redisurl: malformed RESP3 length %q", line)
+		}
+		if n < 0 {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		data = data[:n]
+
+		switch kind {
+		case '$':
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(data), data)
+		case '=':
+			// Verbatim strings start with their format, e.g. "txt:".
+			if len(data) >= 4 && data[3] == ':' {
+				data = data[4:]
+			}
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(data), data)
+		case '!':
+			w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(string(data)) + "\r\n")
+		}
+	case '*', '~', '>', '%', '|':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("redisurl: malformed RESP3 length %q", line)
+		}
+		if n < 0 {
+			w.WriteString("*-1\r\n")
+			return nil
+		}
+		if kind == '%' || kind == '|' {
+			n *= 2
+		}
+
+		if kind == '|' {
+			// Attributes precede the reply they describe, which is all that's kept.
+			var discard bytes.Buffer
+			for i := 0; i < n; i++ {
+				if err := translateRESP3(r, &discard); err != nil {
+					return err
+				}
+			}
+			return translateRESP3(r, w)
+		}
+
+		fmt.Fprintf(w, "*%d\r\n", n)
+		for i := 0; i < n; i++ {
+			if err := translateRESP3(r, w); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("redisurl: unsupported RESP3 reply %q", line)
+	}
+	return nil
+}
+
+// readRESPLine reads a line terminated by CRLF, and returns it without the CRLF.
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("redisurl: malformed RESP3 line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
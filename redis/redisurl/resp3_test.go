@@ -0,0 +1,49 @@
+package redisurl
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTranslateRESP3(t *testing.T) {
+	for resp3, want := range map[string]string{
+		"+OK\r\n":                         "+OK\r\n",
+		"-ERR bad\r\n":                    "-ERR bad\r\n",
+		":42\r\n":                         ":42\r\n",
+		"$3\r\nfoo\r\n":                   "$3\r\nfoo\r\n",
+		"$-1\r\n":                         "$-1\r\n",
+		"_\r\n":                           "$-1\r\n",
+		"#t\r\n":                          ":1\r\n",
+		"#f\r\n":                          ":0\r\n",
+		",2.5\r\n":                        "$3\r\n2.5\r\n",
+		"(12345678901234567890\r\n":       "$20\r\n12345678901234567890\r\n",
+		"=7\r\ntxt:foo\r\n":               "$3\r\nfoo\r\n",
+		"!9\r\nERR\r\nbad!\r\n":           "-ERR  bad!\r\n",
+		"*2\r\n:1\r\n_\r\n":               "*2\r\n:1\r\n$-1\r\n",
+		"*-1\r\n":                         "*-1\r\n",
+		"~1\r\n+a\r\n":                    "*1\r\n+a\r\n",
+		"%1\r\n+key\r\n*1\r\n#t\r\n":      "*2\r\n+key\r\n*1\r\n:1\r\n",
+		">2\r\n+message\r\n+m\r\n":        "*2\r\n+message\r\n+m\r\n",
+		"|1\r\n+ttl\r\n:3\r\n$1\r\nv\r\n": "$1\r\nv\r\n",
+	} {
+		var got bytes.Buffer
+		if err := translateRESP3(bufio.NewReader(strings.NewReader(resp3)), &got); err != nil {
+			t.Errorf("Error returned for %q: %v", resp3, err)
+			continue
+		}
+		if got.String() != want {
+			t.Errorf("Wanted %q for %q, got %q", want, resp3, got.String())
+		}
+	}
+}
+
+func TestTranslateRESP3_Malformed(t *testing.T) {
+	for _, resp3 := range []string{"\r\n", "?\r\n", "$x\r\n", "$3\r\nfo", "+OK\n"} {
+		var got bytes.Buffer
+		if err := translateRESP3(bufio.NewReader(strings.NewReader(resp3)), &got); err == nil {
+			t.Errorf("Expected error for %q, got nil", resp3)
+		}
+	}
+}
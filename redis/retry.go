@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy is how a pool retries the commands of its own methods, such as Get or HSet, which
+// fail transiently, e.g. as the connection was reset or the server is loading its data. Commands
+// are retried on a connection taken afresh from the pool, after a backoff. Commands sent on a
+// Connection, such as those of Do, or queued in a pipeline or transaction, aren't retried.
+//
+// Taking a connection for a method is retried too, e.g. when the pool is exhausted or the server
+// can't be dialed.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a command is tried at most, including the first. Commands
+	// aren't retried if it's 1 or less.
+	MaxAttempts int
+
+	// MinBackoff is how long is waited before the first retry, and doubles for each retry after
+	// it, up to MaxBackoff. They default to 10 milliseconds and a second. Each wait is jittered,
+	// to between half and the whole of it, so that clients don't retry in lockstep.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable reports whether a command which failed with err may succeed if it's retried, and
+	// defaults to IsRetryable.
+	Retryable func(err error) bool
+
+	// Idempotent are the commands which are safe to retry, by name, and defaults to
+	// IdempotentCommands.
+	Idempotent map[string]bool
+}
+
+// DefaultRetryPolicy tries commands 3 times.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3}
+
+// Errors replied by servers electing a master, or moving keys, which have no kind of their own.
+var retryableErrors = []string{"TRYAGAIN", "MASTERDOWN", "CLUSTERDOWN"}
+
+// IsRetryable reports whether err is transient: the connection failing (ErrConnection), the pool
+// being exhausted, or the server replying that it's loading its data (ErrLoading), has become a
+// replica after a failover (ErrReadOnly), or is in the midst of moving keys (TRYAGAIN) or electing
+// a master (MASTERDOWN, CLUSTERDOWN). A context which is done isn't transient.
+func IsRetryable(err error) bool {
+	switch errorKind(err) {
+	case ErrConnection, ErrLoading, ErrReadOnly:
+		return true
+	}
+	if errors.Is(err, ErrPoolExhausted) {
+		return true
+	}
+	for _, prefix := range retryableErrors {
+		if isErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdempotentCommands are the commands which leave the same data whether they're run once or more,
+// and so can be retried: those which only read, and writes such as Set, Del, HSet, SAdd and ZAdd.
+// Their replies may differ though, e.g. Del retried after deleting a key replies that it deleted
+// none. Commands such as Incr, LPush and RPop are not idempotent.
+var IdempotentCommands = idempotentCommands()
+
+func idempotentCommands() map[string]bool {
+	commands := map[string]bool{
+		"DEL":         true,
+		"ECHO":        true,
+		"EXPIRE":      true,
+		"EXPIREAT":    true,
+		"HDEL":        true,
+		"HMSET":       true,
+		"HSET":        true,
+		"LTRIM":       true,
+		"MSET":        true,
+		"PERSIST":     true,
+		"PEXPIRE":     true,
+		"PFADD":       true,
+		"PING":        true,
+		"PSETEX":      true,
+		"SADD":        true,
+		"SCRIPT LOAD": true,
+		"SELECT":      true,
+		"SET":         true,
+		"SETEX":       true,
+		"SREM":        true,
+		"UNLINK":      true,
+		"XACK":        true,
+		"ZADD":        true,
+		"ZREM":        true,
+	}
+	for command := range readOnlyCommands {
+		commands[command] = true
+	}
+	return commands
+}
+
+// retries reports whether a command which has been tried attempts times, and failed with err,
+// should be tried again. command is "" for taking a connection.
+func (p RetryPolicy) retries(attempts int, command string, args []interface{}, err error) bool {
+	if attempts >= p.MaxAttempts || err == nil {
+		return false
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	if !retryable(err) {
+		return false
+	}
+
+	if command == "" {
+		return true
+	}
+	idempotent := p.Idempotent
+	if idempotent == nil {
+		idempotent = IdempotentCommands
+	}
+	return idempotent[commandName(command, args)]
+}
+
+// wait waits before retrying a command which has been tried attempts times, unless ctx is done
+// first, in which case it returns the context's error.
+func (p RetryPolicy) wait(ctx context.Context, attempts int) error {
+	backoff, max := p.MinBackoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = 10 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	t := time.NewTimer(backoff)
+	defer t.Stop()
+
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	select {
+	case <-t.C:
+		return nil
+	case <-done:
+		return ctx.Err()
+	}
+}
+
+// commandConnection takes a connection for one of the pool's own methods, retrying if taking it
+// fails, as the pool's RetryPolicy allows. The connection retries its commands likewise.
+func (s *pool) commandConnection() (PooledConnection, error) {
+	if s.retry.MaxAttempts <= 1 {
+		return s.GetConnection()
+	}
+
+	for attempts := 1; ; attempts++ {
+		c, err := s.getConnection(s.ctx)
+		if err == nil {
+			c.(*connection).retryPool = s
+			return c, nil
+		}
+		if !s.retry.retries(attempts, "", nil, err) {
+			return nil, err
+		}
+		if err := s.retry.wait(s.ctx, attempts); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// doRetrying runs a command like Do, retrying it on a connection taken afresh from the pool as
+// the pool's RetryPolicy allows.
+func (s *connection) doRetrying(command string, args ...interface{}) (interface{}, error) {
+	policy := s.retryPool.retry
+
+	val, err := s.doHooked(command, args...)
+	for attempts := 1; policy.retries(attempts, command, args, err); attempts++ {
+		if waitErr := policy.wait(s.ctx, attempts); waitErr != nil {
+			return nil, waitErr
+		}
+		if err = s.reconnect(); err != nil {
+			// The reply of the failed attempt mustn't be returned with the error.
+			val = nil
+			continue
+		}
+		val, err = s.doHooked(command, args...)
+	}
+	return val, err
+}
+
+// reconnect returns the connection's underlying connection to the pool, which closes it if it has
+// failed, and takes another.
+func (s *connection) reconnect() error {
+	s.c.Close()
+	c, err := s.retryPool.get(s.ctx)
+	if err != nil {
+		// Left closed, so that its commands fail until it's released.
+		return err
+	}
+	s.c = c
+	return nil
+}
@@ -0,0 +1,164 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestRetry(t *testing.T) {
+	retrying := redis.DefaultConfig
+	retrying.Retry = redis.RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+
+	newPool := func(url string, config redis.Config) redis.Pool {
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	key := "_tests:jimmy:redis:retry"
+	cleanup := newPool("redis://localhost:6379/10", redis.DefaultConfig)
+	defer cleanup.Del(key)
+
+	// newLoadingServer starts a server with key set to "value", which replies LOADING to its first
+	// loading commands, as a server which has just started does.
+	newLoadingServer := func(t *testing.T, loading int) *redistest.Server {
+		s, err := redistest.NewServer(redistest.ServerOptions{})
+		if err != nil {
+			t.Fatalf("failed to start server: %v", err)
+		}
+		t.Cleanup(s.Close)
+		if err := newPool(s.URL(), redis.DefaultConfig).Set(key, "value"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.Inject(redistest.Failure{Times: loading, Error: redistest.LoadingError})
+		return s
+	}
+
+	t.Run("retries idempotent commands on a fresh connection once theirs drops", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p := newPool("redis://"+proxy.addr+"/10", retrying)
+		if err := p.Set(key, "value"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		proxy.drop()
+		if val, err := p.Get(key); err != nil || val != "value" {
+			t.Errorf("expected value but got %q, %v", val, err)
+		}
+		if n := proxy.dials(); n != 2 {
+			t.Errorf("expected a connection to be dialed again but got %d dials", n)
+		}
+	})
+
+	t.Run("doesn't retry without a policy", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p := newPool("redis://"+proxy.addr+"/10", redis.DefaultConfig)
+		p.Set(key, "value")
+
+		proxy.drop()
+		if _, err := p.Get(key); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("doesn't retry commands which aren't idempotent", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		p := newPool("redis://"+proxy.addr+"/10", retrying)
+		p.Del(key)
+
+		proxy.drop()
+		if _, err := p.Incr(key); err == nil {
+			t.Error("expected error")
+		}
+		if n := proxy.dials(); n != 1 {
+			t.Errorf("expected no connection to be dialed again but got %d dials", n)
+		}
+	})
+
+	t.Run("retries the commands it's told are idempotent", func(t *testing.T) {
+		config := retrying
+		config.Retry.Idempotent = map[string]bool{"INCR": true}
+		proxy := newDroppingProxy(t)
+		p := newPool("redis://"+proxy.addr+"/10", config)
+		p.Del(key)
+
+		proxy.drop()
+		if n, err := p.Incr(key); err != nil || n != 1 {
+			t.Errorf("expected 1 but got %d, %v", n, err)
+		}
+	})
+
+	t.Run("retries while the server loads its data, backing off", func(t *testing.T) {
+		config := retrying
+		config.Retry.MinBackoff = 40 * time.Millisecond
+		p := newPool(newLoadingServer(t, 2).URL(), config)
+
+		start := time.Now()
+		if val, err := p.Get(key); err != nil || val != "value" {
+			t.Errorf("expected value but got %q, %v", val, err)
+		}
+		// Waits of 20-40ms, then 40-80ms.
+		if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+			t.Errorf("expected to back off for at least 60ms but took %v", elapsed)
+		}
+	})
+
+	t.Run("gives up after its attempts", func(t *testing.T) {
+		p := newPool(newLoadingServer(t, 3).URL(), retrying)
+
+		if _, err := p.Get(key); err == nil || !strings.HasPrefix(err.Error(), "LOADING") {
+			t.Errorf("expected LOADING but got %v", err)
+		}
+	})
+
+	t.Run("retries taking a connection from an exhausted pool", func(t *testing.T) {
+		config := retrying
+		config.MaxOpenConnections = 1
+		config.Wait = false
+		config.Retry.MinBackoff = 20 * time.Millisecond
+		p := newPool("redis://localhost:6379/10", config)
+
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.AfterFunc(10*time.Millisecond, c.Release)
+
+		if _, err := p.Exists(key); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("classifies transient errors", func(t *testing.T) {
+		for _, test := range []struct {
+			err  error
+			want bool
+		}{
+			{nil, false},
+			{io.EOF, true},
+			{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+			{redis.ErrPoolExhausted, true},
+			{redigo.Error("LOADING Redis is loading the dataset in memory"), true},
+			{redigo.Error("READONLY You can't write against a read only replica."), true},
+			{redigo.Error("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+			{context.Canceled, false},
+			{context.DeadlineExceeded, false},
+		} {
+			if got := redis.IsRetryable(test.err); got != test.want {
+				t.Errorf("expected IsRetryable(%v) to be %v", test.err, test.want)
+			}
+		}
+	})
+}
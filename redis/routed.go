@@ -0,0 +1,578 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// ErrCrossShard is returned for a command whose keys are on different shards of a ShardedPool,
+// or in different hash slots of a ClusterPool, unless it can be split between them. Exec returns
+// it for a transaction whose keys are.
+var ErrCrossShard = errors.New("redis: keys are on different shards")
+
+var (
+	// Commands which are sent to every node, rather than to a single one.
+	broadcastCommands = map[string]bool{
+		"FLUSHALL":     true,
+		"FLUSHDB":      true,
+		"SCRIPT FLUSH": true,
+		"SCRIPT LOAD":  true,
+	}
+
+	// Commands which take no key, and so can be sent to any node.
+	keylessCommands = map[string]bool{
+		"ASKING":    true,
+		"AUTH":      true,
+		"CLIENT":    true,
+		"CLUSTER":   true,
+		"CONFIG":    true,
+		"DBSIZE":    true,
+		"DISCARD":   true,
+		"ECHO":      true,
+		"EXEC":      true,
+		"HELLO":     true,
+		"INFO":      true,
+		"KEYS":      true,
+		"MULTI":     true,
+		"PING":      true,
+		"PUBLISH":   true,
+		"RANDOMKEY": true,
+		"SCAN":      true,
+		"SCRIPT":    true,
+		"SELECT":    true,
+		"TIME":      true,
+		"UNWATCH":   true,
+	}
+
+	// Commands whose arguments are all keys.
+	multiKeyCommands = map[string]bool{
+		"DEL":         true,
+		"EXISTS":      true,
+		"MGET":        true,
+		"PFCOUNT":     true,
+		"PFMERGE":     true,
+		"SDIFF":       true,
+		"SDIFFSTORE":  true,
+		"SINTER":      true,
+		"SINTERSTORE": true,
+		"SUNION":      true,
+		"SUNIONSTORE": true,
+		"TOUCH":       true,
+		"UNLINK":      true,
+		"WATCH":       true,
+	}
+
+	// Commands which are split between shards when their keys are on more than one. Each shard
+	// is sent the command with its keys, and the replies, which count keys, are summed.
+	fanOutCommands = map[string]bool{
+		"DEL":    true,
+		"EXISTS": true,
+		"TOUCH":  true,
+		"UNLINK": true,
+	}
+)
+
+// router picks the nodes a routedConn sends commands to, by the shards of their keys.
+type router interface {
+	// shard returns the shard of key.
+	shard(key string) int
+	// addr returns the address of the node serving shard.
+	addr(shard int) string
+	// anyAddr returns the address of the node commands without keys are sent to.
+	anyAddr() string
+	// addrs returns the address of every node, which broadcast commands are sent to.
+	addrs() []string
+	// node returns the pool of the node at addr.
+	node(addr string) (*pool, error)
+
+	// follow is passed the reply to each command sent outside a transaction, and returns the reply
+	// to return for it, e.g. after retrying the command elsewhere.
+	follow(ctx context.Context, reply interface{}, err error, command string, args []interface{}) (interface{}, error)
+	// queued is passed the error replied to each command queued in a transaction.
+	queued(err error)
+}
+
+// routedConn is a redigo.Conn to a set of nodes, which sends each command to the node serving the
+// shard of its keys. It takes a connection to each node as commands are sent to it, and holds them
+// until closed.
+type routedConn struct {
+	router router
+	// Bounds waiting on the nodes' pools, when it is not nil.
+	ctx context.Context
+
+	conns map[string]redigo.Conn
+
+	// Commands sent but not yet flushed to the nodes.
+	pending []routedCommand
+	// Commands flushed to the nodes whose replies haven't been received yet, in the order they
+	// were sent.
+	flushed []routedCommand
+
+	// The node keys are being watched on, which a following transaction must be sent to.
+	watching string
+	// The node the current transaction is being sent to, if MULTI has been sent, and the shard of
+	// its keys, or -1 until a command with keys is queued.
+	multi      string
+	multiShard int
+	// Set once a command queued in the current transaction couldn't be sent, so that the
+	// transaction is discarded rather than executed.
+	aborted error
+}
+
+func newRoutedConn(ctx context.Context, r router) *routedConn {
+	return &routedConn{router: r, ctx: ctx, conns: map[string]redigo.Conn{}}
+}
+
+type routedCommand struct {
+	name string
+	args []interface{}
+	// The commands sent to the nodes for it: one, or one per shard if it was fanned out.
+	parts []routedPart
+	// Whether the command is queued in a transaction, so it can't be retried on its own.
+	queued bool
+	// Set if the command couldn't be sent, in place of its reply.
+	err error
+}
+
+type routedPart struct {
+	addr string
+	name string
+	args []interface{}
+	// Whether the part was sent, so has a reply to receive.
+	sent bool
+}
+
+func (c *routedConn) Close() error {
+	var err error
+	for addr, conn := range c.conns {
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		delete(c.conns, addr)
+	}
+	c.pending, c.flushed = nil, nil
+	c.watching, c.multi, c.aborted = "", "", nil
+	return err
+}
+
+func (c *routedConn) Err() error {
+	for _, conn := range c.conns {
+		if err := conn.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *routedConn) Do(command string, args ...interface{}) (interface{}, error) {
+	return c.DoContext(nil, command, args...)
+}
+
+// DoContext follows redigo: it sends the command, then receives the replies of every command sent
+// before it, returning the reply of the command and the first error reply.
+func (c *routedConn) DoContext(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	if command == "" {
+		if err := c.flush(ctx); err != nil {
+			return nil, err
+		}
+
+		replies := make([]interface{}, 0, len(c.flushed))
+		for len(c.flushed) > 0 {
+			reply, err := c.ReceiveContext(ctx)
+			if _, ok := err.(redigo.Error); err != nil && !ok {
+				c.flushed = nil
+				return nil, err
+			}
+			replies = append(replies, reply)
+		}
+		return replies, nil
+	}
+
+	if len(c.pending) == 0 && len(c.flushed) == 0 && c.multi == "" && broadcastCommands[commandName(command, args)] {
+		return c.broadcast(ctx, command, args...)
+	}
+
+	c.Send(command, args...)
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	var reply interface{}
+	var firstErr error
+	for len(c.flushed) > 0 {
+		var err error
+		reply, err = c.ReceiveContext(ctx)
+		if _, ok := err.(redigo.Error); err != nil && !ok {
+			c.flushed = nil
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return reply, firstErr
+}
+
+// broadcast runs a command on every node, and returns the reply of the first.
+func (c *routedConn) broadcast(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	var first interface{}
+	for i, addr := range c.router.addrs() {
+		node, err := c.router.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := node.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := do(ctx, conn, command, args...)
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			first = reply
+		}
+	}
+	return first, nil
+}
+
+func (c *routedConn) Send(command string, args ...interface{}) error {
+	c.pending = append(c.pending, routedCommand{name: command, args: args})
+	return nil
+}
+
+func (c *routedConn) Flush() error {
+	return c.flush(c.ctx)
+}
+
+// flush routes the pending commands, then sends each node the commands routed to it.
+func (c *routedConn) flush(ctx context.Context) error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = c.ctx
+	}
+
+	c.route(c.pending)
+
+	sent := map[string]redigo.Conn{}
+	for i := range c.pending {
+		cmd := &c.pending[i]
+		for j := range cmd.parts {
+			part := &cmd.parts[j]
+
+			conn, err := c.conn(ctx, part.addr)
+			if err == nil {
+				err = conn.Send(part.name, part.args...)
+			}
+			if err != nil {
+				if cmd.err == nil {
+					cmd.err = err
+				}
+				continue
+			}
+			part.sent = true
+			sent[part.addr] = conn
+		}
+	}
+
+	c.flushed = append(c.flushed, c.pending...)
+	c.pending = nil
+
+	var err error
+	for _, conn := range sent {
+		if flushErr := conn.Flush(); err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// route picks the nodes each command is sent to.
+func (c *routedConn) route(cmds []routedCommand) {
+	for i := range cmds {
+		cmd := &cmds[i]
+		name := strings.ToUpper(cmd.name)
+		keys := commandKeys(cmd.name, cmd.args)
+
+		if c.multi != "" {
+			c.routeQueued(cmd, name, keys)
+			continue
+		}
+
+		if name == "MULTI" {
+			c.multi, c.multiShard = c.watching, -1
+			if c.multi == "" {
+				c.multi = c.transactionAddr(cmds[i+1:])
+			}
+			cmd.parts = []routedPart{{addr: c.multi, name: cmd.name, args: cmd.args}}
+			continue
+		}
+
+		shards, shardKeys := c.shards(keys)
+		switch {
+		case len(shards) == 0:
+			addr := c.watching
+			if addr == "" {
+				addr = c.router.anyAddr()
+			}
+			cmd.parts = []routedPart{{addr: addr, name: cmd.name, args: cmd.args}}
+		case len(shards) == 1:
+			cmd.parts = []routedPart{{addr: c.router.addr(shards[0]), name: cmd.name, args: cmd.args}}
+		case fanOutCommands[name]:
+			for j, shard := range shards {
+				cmd.parts = append(cmd.parts, routedPart{addr: c.router.addr(shard), name: cmd.name, args: redigo.Args{}.AddFlat(shardKeys[j])})
+			}
+		default:
+			cmd.err = ErrCrossShard
+		}
+
+		switch {
+		case name == "WATCH" && cmd.err == nil:
+			c.watching = cmd.parts[0].addr
+		case name == "UNWATCH":
+			c.watching = ""
+		}
+	}
+}
+
+// routeQueued routes a command sent after MULTI to the transaction's node, or aborts the
+// transaction if the command's keys are in another shard.
+func (c *routedConn) routeQueued(cmd *routedCommand, name string, keys []string) {
+	if name != "EXEC" && name != "DISCARD" {
+		cmd.queued = true
+
+		shards, _ := c.shards(keys)
+		switch {
+		case len(shards) > 1:
+			cmd.err = ErrCrossShard
+		case len(shards) == 1 && c.multiShard == -1 && c.router.addr(shards[0]) != c.multi:
+			cmd.err = ErrCrossShard
+		case len(shards) == 1 && c.multiShard != -1 && shards[0] != c.multiShard:
+			cmd.err = ErrCrossShard
+		case len(shards) == 1:
+			c.multiShard = shards[0]
+		}
+
+		if cmd.err != nil {
+			c.aborted = cmd.err
+			return
+		}
+		cmd.parts = []routedPart{{addr: c.multi, name: cmd.name, args: cmd.args}}
+		return
+	}
+
+	if name == "EXEC" && c.aborted != nil {
+		cmd.err = c.aborted
+		cmd.parts = []routedPart{{addr: c.multi, name: "DISCARD"}}
+	} else {
+		cmd.parts = []routedPart{{addr: c.multi, name: cmd.name, args: cmd.args}}
+	}
+	c.multi, c.watching, c.aborted = "", "", nil
+}
+
+// shards returns the distinct shards of keys, in the order they first appear, and the keys in
+// each.
+func (c *routedConn) shards(keys []string) ([]int, [][]string) {
+	var shards []int
+	var shardKeys [][]string
+	for _, key := range keys {
+		shard := c.router.shard(key)
+
+		i := 0
+		for i < len(shards) && shards[i] != shard {
+			i++
+		}
+		if i == len(shards) {
+			shards = append(shards, shard)
+			shardKeys = append(shardKeys, nil)
+		}
+		shardKeys[i] = append(shardKeys[i], key)
+	}
+	return shards, shardKeys
+}
+
+// transactionAddr returns the address of the node serving the first key queued in a transaction.
+func (c *routedConn) transactionAddr(queued []routedCommand) string {
+	for _, cmd := range queued {
+		name := strings.ToUpper(cmd.name)
+		if name == "EXEC" || name == "DISCARD" {
+			break
+		}
+		if keys := commandKeys(cmd.name, cmd.args); len(keys) > 0 {
+			return c.router.addr(c.router.shard(keys[0]))
+		}
+	}
+	return c.router.anyAddr()
+}
+
+// conn returns the connection held to the node at addr, taking one from its pool if needed.
+func (c *routedConn) conn(ctx context.Context, addr string) (redigo.Conn, error) {
+	if conn := c.conns[addr]; conn != nil {
+		return conn, nil
+	}
+
+	node, err := c.router.node(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := node.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+func (c *routedConn) Receive() (interface{}, error) {
+	return c.ReceiveContext(nil)
+}
+
+// ReceiveContext receives the reply of the first command flushed but not yet received. The
+// replies of a command fanned out over shards are summed.
+func (c *routedConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if err := c.flush(ctx); err != nil {
+		return nil, err
+	}
+	if len(c.flushed) == 0 {
+		return nil, errors.New("redis: no replies pending on routed connection")
+	}
+
+	cmd := c.flushed[0]
+	c.flushed = c.flushed[1:]
+
+	replies := make([]interface{}, len(cmd.parts))
+	var firstErr error
+	for i, part := range cmd.parts {
+		if !part.sent {
+			continue
+		}
+
+		reply, err := receive(ctx, c.conns[part.addr])
+		if cmd.queued {
+			c.router.queued(err)
+		} else {
+			reply, err = c.router.follow(ctx, reply, err, part.name, part.args)
+		}
+
+		replies[i] = reply
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	switch {
+	case cmd.err != nil:
+		return nil, cmd.err
+	case firstErr != nil:
+		return nil, firstErr
+	case len(replies) == 1:
+		return replies[0], nil
+	}
+
+	var sum int64
+	for _, reply := range replies {
+		n, err := redigo.Int64(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		sum += n
+	}
+	return sum, nil
+}
+
+// commandKeys returns the keys of a command.
+func commandKeys(command string, args []interface{}) []string {
+	name := strings.ToUpper(command)
+	if multiKeyCommands[name] {
+		return argStrings(args)
+	}
+
+	switch name {
+	case "BLPOP", "BRPOP":
+		if len(args) > 1 {
+			return argStrings(args[:len(args)-1])
+		}
+		return nil
+	case "RENAME", "RENAMENX", "RPOPLPUSH", "SMOVE":
+		if len(args) > 1 {
+			return argStrings(args[:2])
+		}
+	case "EVAL", "EVALSHA":
+		if len(args) > 2 {
+			if n, err := strconv.Atoi(argString(args[1])); err == nil && n > 0 && 2+n <= len(args) {
+				return argStrings(args[2 : 2+n])
+			}
+		}
+		return nil
+	case "XREAD", "XREADGROUP":
+		for i := 0; i < len(args)-1; i++ {
+			if name == "XREADGROUP" && i < 3 {
+				continue
+			}
+			if strings.EqualFold(argString(args[i]), "STREAMS") {
+				streams := args[i+1:]
+				return argStrings(streams[:len(streams)/2])
+			}
+		}
+		return nil
+	case "OBJECT", "XGROUP", "XINFO":
+		if len(args) > 1 {
+			return []string{argString(args[1])}
+		}
+		return nil
+	}
+
+	if keylessCommands[name] || len(args) == 0 {
+		return nil
+	}
+	return []string{argString(args[0])}
+}
+
+// commandName returns the name of a command, including its subcommand for the commands which have
+// one, e.g. "SCRIPT LOAD".
+func commandName(command string, args []interface{}) string {
+	name := strings.ToUpper(command)
+	if name == "SCRIPT" && len(args) > 0 {
+		name += " " + strings.ToUpper(argString(args[0]))
+	}
+	return name
+}
+
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+func argStrings(args []interface{}) []string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = argString(arg)
+	}
+	return strs
+}
+
+// hashTag returns the part of a key which is hashed to pick its shard: its hash tag, a non-empty
+// substring between its first { and the next }, if it has one, otherwise the whole key.
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Script is a Lua script, run with Eval. It is identified to the server by the SHA1 digest of its
+// source, so once loaded it can be run with EVALSHA rather than sending its source every time.
+type Script struct {
+	src  string
+	hash string
+}
+
+func NewScript(src string) *Script {
+	h := sha1.Sum([]byte(src))
+	return &Script{src: src, hash: hex.EncodeToString(h[:])}
+}
+
+// Scripts are scripts keyed by name, as parsed by ParseScripts.
+type Scripts map[string]*Script
+
+// List returns the scripts sorted by name, e.g. to be loaded with Config.Scripts.
+func (scripts Scripts) List() []*Script {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]*Script, len(names))
+	for i, name := range names {
+		list[i] = scripts[name]
+	}
+	return list
+}
+
+// ParseScripts reads the Lua scripts in fsys whose names match any of the patterns, as understood
+// by fs.Glob. It is intended for scripts in an embed.FS, which can then be loaded with
+// Config.Scripts by their List. The scripts are keyed by file name, without directory or extension.
+func ParseScripts(fsys fs.FS, patterns ...string) (Scripts, error) {
+	scripts := Scripts{}
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			src, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+
+			base := path.Base(name)
+			scripts[strings.TrimSuffix(base, path.Ext(base))] = NewScript(string(src))
+		}
+	}
+	return scripts, nil
+}
+
+// Hash returns the hex-encoded SHA1 digest of the script's source.
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+func (s *Script) Source() string {
+	return s.src
+}
+
+// Returns the arguments to EVALSHA (if hash is true) or EVAL to run the script.
+func (s *Script) args(hash bool, keys []string, args []interface{}) redigo.Args {
+	a := redigo.Args{s.src}
+	if hash {
+		a = redigo.Args{s.hash}
+	}
+	return a.Add(len(keys)).AddFlat(keys).Add(args...)
+}
+
+func isNoScript(err error) bool {
+	return errors.Is(err, ErrNoScript)
+}
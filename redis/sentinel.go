@@ -0,0 +1,447 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	netURL "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var (
+	// How often a sentinel pool asks the sentinels for the master and its replicas, in case it
+	// missed the announcement of a change.
+	sentinelRefreshInterval = 30 * time.Second
+
+	// Channels on which sentinels announce changes to masters and replicas.
+	sentinelChannels = []string{"+switch-master", "+slave", "+sdown", "-sdown"}
+)
+
+// SentinelPool is a Pool of connections to the master that Redis Sentinel reports for a name. It
+// listens for the failovers the sentinels announce: once the master changes, connections are to
+// the new master, and those to the old master are closed as they are returned.
+type SentinelPool interface {
+	Pool
+
+	// Master returns the address of the current master.
+	Master() string
+
+	// Replicas returns a pool of connections to the master's replicas, for reads which can tolerate
+	// replication lag. Each connection is to the next replica in turn, or to the master if it has
+	// no replicas which are up. The pool is shut down along with the SentinelPool.
+	Replicas() Pool
+}
+
+// NewSentinelPool asks the sentinels at sentinelURLs in turn for the address of the master named
+// masterName, until one knows it. Connections to the master are dialed with url, whose host is
+// replaced by the master's, e.g. "redis://:password@/3", and pooled according to config.
+func NewSentinelPool(sentinelURLs []string, masterName, url string, config Config) (SentinelPool, error) {
+	if len(sentinelURLs) == 0 {
+		return nil, errors.New("redis: sentinel pool needs the URL of at least one sentinel")
+	}
+
+	s := &sentinel{name: masterName, config: config, done: make(chan struct{})}
+	for _, sentinelURL := range sentinelURLs {
+		parsedURL, err := netURL.Parse(sentinelURL)
+		if err != nil {
+			return nil, err
+		}
+		s.sentinels = append(s.sentinels, parsedURL)
+	}
+
+	parsedURL, err := netURL.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	s.url = parsedURL
+
+	addr, err := s.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+	s.setMaster(addr)
+
+	// A sentinel which can't be reached now is still asked for the master by refresh.
+	for _, sentinelURL := range s.sentinels {
+		sub, err := newPubSub(sentinelURL, config.urlOptions())
+		if err != nil {
+			continue
+		}
+		sub.Subscribe(sentinelChannels...)
+		s.subs = append(s.subs, sub)
+		go s.listen(sub)
+	}
+	go s.poll()
+
+	username, password := credentials(parsedURL)
+	p := &sentinelPool{pool: &pool{p: s, url: parsedURL, username: username, password: password, options: config.urlOptions()}, sentinel: s}
+	if err := p.setUp(config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type sentinelPool struct {
+	*pool
+
+	sentinel *sentinel
+}
+
+func (s *sentinelPool) WithContext(ctx context.Context) Pool {
+	p := *s
+	p.pool = s.pool.WithContext(ctx).(*pool)
+	return &p
+}
+
+func (s *sentinelPool) Master() string {
+	s.sentinel.mu.RLock()
+	defer s.sentinel.mu.RUnlock()
+	return s.sentinel.addr
+}
+
+func (s *sentinelPool) Replicas() Pool {
+	s.sentinel.mu.Lock()
+	created := s.sentinel.replicaPool == nil
+	if created {
+		p := &pool{p: sentinelReplicas{s.sentinel}, url: s.url, username: s.username, password: s.password, options: s.options}
+		// Its spans are traced with the pool's URL, as the replica each connection reads from isn't
+		// known until it's taken.
+		p.hooks = s.sentinel.config.hooks(func() *netURL.URL { return p.url })
+		p.retry = s.sentinel.config.Retry
+		s.sentinel.replicaPool = p
+	}
+	replicaPool := s.sentinel.replicaPool
+	s.sentinel.mu.Unlock()
+
+	// Look the replicas up now, rather than sending the first reads to the master.
+	if created {
+		s.sentinel.refreshReplicas()
+	}
+	return replicaPool
+}
+
+// sentinel is the connSource of a SentinelPool.
+type sentinel struct {
+	sentinels []*netURL.URL
+	name      string
+	url       *netURL.URL
+	config    Config
+
+	mu     sync.RWMutex
+	addr   string
+	master *pool
+	// The replicas are only looked up once replicaPool has been created by Replicas.
+	replicaPool  *pool
+	replicas     []string
+	replicaPools map[string]*pool
+	nextReplica  int
+	shutdown     bool
+
+	subs []PubSub
+	done chan struct{}
+}
+
+// Get takes a connection from the pool of the current master. The lock isn't held while it's
+// taken, as that may wait for a connection to be returned, so setMaster may shut the pool down in
+// between: the connection is then taken from the new master's pool.
+func (s *sentinel) Get() redigo.Conn {
+	c := s.current().p.Get()
+	if isPoolClosed(c.Err()) {
+		c.Close()
+		c = s.current().p.Get()
+	}
+	return c
+}
+
+func (s *sentinel) GetContext(ctx context.Context) (redigo.Conn, error) {
+	c, err := s.current().p.GetContext(ctx)
+	if isPoolClosed(err) {
+		c, err = s.current().p.GetContext(ctx)
+	}
+	return c, err
+}
+
+// isPoolClosed reports whether err is redigo's for taking a connection from a pool which has been
+// closed, which it doesn't export.
+func isPoolClosed(err error) bool {
+	return err != nil && err.Error() == "redigo: get on closed pool"
+}
+
+func (s *sentinel) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown {
+		return nil
+	}
+	s.shutdown = true
+	close(s.done)
+
+	for _, sub := range s.subs {
+		sub.Close()
+	}
+	s.master.Shutdown()
+	for _, replica := range s.replicaPools {
+		replica.Shutdown()
+	}
+	return nil
+}
+
+// stats are those of the current master's pool. The replicas' are those of Replicas.
+func (s *sentinel) stats() PoolStats {
+	return s.current().Stats()
+}
+
+func (s *sentinel) currentURL() *netURL.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master.url
+}
+
+func (s *sentinel) current() *pool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+// setMaster switches to the master at addr, and shuts the old master's pool down: its idle
+// connections are closed, those in use are closed as they're returned, and Get and GetContext take
+// those waited on from the new master's pool instead.
+func (s *sentinel) setMaster(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown || addr == s.addr {
+		return
+	}
+
+	old := s.master
+	s.addr = addr
+	s.master = NewPoolWithURL(s.nodeURL(addr), s.config).(*pool)
+	if old != nil {
+		old.Shutdown()
+	}
+}
+
+func (s *sentinel) nodeURL(addr string) *netURL.URL {
+	url := *s.url
+	url.Host = addr
+	return &url
+}
+
+// ask runs f on a connection to each sentinel in turn, until it succeeds.
+func (s *sentinel) ask(f func(c redigo.Conn) error) error {
+	var err error
+	for _, url := range s.sentinels {
+		var c redigo.Conn
+		c, err = generateConnection(url, s.config.urlOptions())
+		if err != nil {
+			continue
+		}
+		err = f(c)
+		c.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (s *sentinel) masterAddr() (string, error) {
+	var addr string
+	err := s.ask(func(c redigo.Conn) error {
+		hostAndPort, err := redigo.Strings(c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", s.name))
+		if err == ErrNil {
+			return fmt.Errorf("redis: sentinel doesn't know master %q", s.name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(hostAndPort) != 2 {
+			return fmt.Errorf("redis: expected master address of 2 values but got %d", len(hostAndPort))
+		}
+		addr = net.JoinHostPort(hostAndPort[0], hostAndPort[1])
+		return nil
+	})
+	return addr, err
+}
+
+// refresh asks the sentinels for the master, and its replicas if they're in use.
+func (s *sentinel) refresh() {
+	if addr, err := s.masterAddr(); err == nil {
+		s.setMaster(addr)
+	}
+	s.refreshReplicas()
+}
+
+func (s *sentinel) refreshReplicas() {
+	s.mu.RLock()
+	wanted := s.replicaPool != nil
+	s.mu.RUnlock()
+	if !wanted {
+		return
+	}
+
+	var replicas []string
+	err := s.ask(func(c redigo.Conn) error {
+		reply, err := c.Do("SENTINEL", "REPLICAS", s.name)
+		if _, ok := err.(redigo.Error); ok {
+			// Sentinels older than Redis 5 only know replicas as slaves.
+			reply, err = c.Do("SENTINEL", "SLAVES", s.name)
+		}
+		replicas, err = sentinelReplicaAddrs(reply, err)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown {
+		return
+	}
+	s.replicas = replicas
+	if s.replicaPools == nil {
+		s.replicaPools = map[string]*pool{}
+	}
+
+	up := map[string]bool{}
+	for _, addr := range replicas {
+		up[addr] = true
+	}
+	for addr, replica := range s.replicaPools {
+		if !up[addr] {
+			replica.Shutdown()
+			delete(s.replicaPools, addr)
+		}
+	}
+}
+
+// replica returns the pool of the next replica in turn, or of the master if there are none.
+func (s *sentinel) replica() *pool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.replicas) == 0 || s.shutdown {
+		return s.master
+	}
+
+	addr := s.replicas[s.nextReplica%len(s.replicas)]
+	s.nextReplica++
+
+	replica := s.replicaPools[addr]
+	if replica == nil {
+		replica = NewPoolWithURL(s.nodeURL(addr), s.config).(*pool)
+		s.replicaPools[addr] = replica
+	}
+	return replica
+}
+
+// listen handles the announcements of a sentinel until it's closed.
+func (s *sentinel) listen(sub PubSub) {
+	for m := range sub.Messages() {
+		fields := strings.Fields(m.Data)
+
+		if m.Channel == "+switch-master" {
+			// <master name> <old ip> <old port> <new ip> <new port>
+			if len(fields) == 5 && fields[0] == s.name {
+				s.setMaster(net.JoinHostPort(fields[3], fields[4]))
+				s.refreshReplicas()
+			}
+			continue
+		}
+
+		// Events about replicas end with "@ <master name> <ip> <port>".
+		for i, field := range fields {
+			if field == "@" && i+1 < len(fields) && fields[i+1] == s.name {
+				s.refreshReplicas()
+				break
+			}
+		}
+	}
+}
+
+func (s *sentinel) poll() {
+	ticker := time.NewTicker(sentinelRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.refresh()
+		}
+	}
+}
+
+// sentinelReplicas is the connSource of a SentinelPool's replica pool.
+type sentinelReplicas struct {
+	s *sentinel
+}
+
+func (r sentinelReplicas) Get() redigo.Conn {
+	return r.s.replica().p.Get()
+}
+
+func (r sentinelReplicas) GetContext(ctx context.Context) (redigo.Conn, error) {
+	return r.s.replica().p.GetContext(ctx)
+}
+
+// Close does nothing, as the replicas' pools are shut down with the SentinelPool.
+func (r sentinelReplicas) Close() error {
+	return nil
+}
+
+func (r sentinelReplicas) stats() PoolStats {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var stats PoolStats
+	for _, replica := range r.s.replicaPools {
+		stats = stats.add(replica.Stats())
+	}
+	return stats
+}
+
+// currentURL is that of the next replica, which any PubSub can subscribe to, as messages are
+// replicated from the master.
+func (r sentinelReplicas) currentURL() *netURL.URL {
+	return r.s.replica().url
+}
+
+// sentinelReplicaAddrs converts a SENTINEL REPLICAS reply into the sorted addresses of the
+// replicas which are up.
+func sentinelReplicaAddrs(reply interface{}, err error) ([]string, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, v := range values {
+		info, err := infoMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		flags, _ := redigo.String(info["flags"], nil)
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+
+		ip, _ := redigo.String(info["ip"], nil)
+		port, _ := redigo.String(info["port"], nil)
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
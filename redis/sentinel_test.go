@@ -0,0 +1,259 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestSentinelPool(t *testing.T) {
+	fs := newFakeSentinel(t, "mymaster", "localhost", "6379")
+	p, err := redis.NewSentinelPool([]string{"redis://" + fs.addr}, "mymaster", "redis:///10", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create sentinel pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	eventually := func(cond func() bool) bool {
+		for i := 0; i < 100; i++ {
+			if cond() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	t.Run("connects to the master the sentinels report", func(t *testing.T) {
+		if p.Master() != "localhost:6379" {
+			t.Errorf("expected master localhost:6379 but got %v", p.Master())
+		}
+		if err := p.Set("_tests:jimmy:redis:sentinel", "1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v, _ := p.Get("_tests:jimmy:redis:sentinel"); v != "1" {
+			t.Errorf("expected 1 but got %q", v)
+		}
+	})
+
+	t.Run("is a SentinelPool bound to a context", func(t *testing.T) {
+		sp, ok := p.WithContext(context.Background()).(redis.SentinelPool)
+		if !ok {
+			t.Fatal("expected a SentinelPool")
+		}
+		if sp.Master() != p.Master() {
+			t.Errorf("expected master %v but got %v", p.Master(), sp.Master())
+		}
+	})
+
+	t.Run("fails for a master the sentinels don't know", func(t *testing.T) {
+		_, err := redis.NewSentinelPool([]string{"redis://" + fs.addr}, "unknown", "redis:///10", redis.DefaultConfig)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("switches to the new master on failover", func(t *testing.T) {
+		if !eventually(func() bool { return fs.subscribed(1) }) {
+			t.Fatal("timed out waiting for the pool to subscribe")
+		}
+
+		// A connection taken before the failover carries on until it's returned.
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		fs.failover("127.0.0.1", "6379")
+		if !eventually(func() bool { return p.Master() == "127.0.0.1:6379" }) {
+			t.Fatalf("expected master 127.0.0.1:6379 but got %v", p.Master())
+		}
+
+		if _, err := c.Get("_tests:jimmy:redis:sentinel"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		c.Release()
+
+		if v, err := p.Get("_tests:jimmy:redis:sentinel"); err != nil || v != "1" {
+			t.Errorf("expected 1 but got %q, %v", v, err)
+		}
+	})
+
+	t.Run("doesn't fail commands racing a failover", func(t *testing.T) {
+		done := make(chan struct{})
+		failed := make(chan error, 1)
+		go func() {
+			defer close(failed)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := p.Get("_tests:jimmy:redis:sentinel"); err != nil {
+					failed <- err
+					return
+				}
+			}
+		}()
+
+		for i := 0; i < 20; i++ {
+			host := []string{"localhost", "127.0.0.1"}[i%2]
+			fs.failover(host, "6379")
+			if !eventually(func() bool { return p.Master() == host+":6379" }) {
+				t.Fatalf("expected master %s:6379 but got %v", host, p.Master())
+			}
+		}
+		close(done)
+		if err := <-failed; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails over while commands wait on an exhausted pool", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.MaxOpenConnections = 1
+		config.Wait = true
+		q, err := redis.NewSentinelPool([]string{"redis://" + fs.addr}, "mymaster", "redis:///10", config)
+		if err != nil {
+			t.Fatalf("failed to create sentinel pool: %v", err)
+		}
+		defer q.Shutdown()
+		if !eventually(func() bool { return fs.subscribed(2) }) {
+			t.Fatal("timed out waiting for the pool to subscribe")
+		}
+
+		c, err := q.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+		waited := make(chan error, 1)
+		go func() {
+			_, err := q.Get("_tests:jimmy:redis:sentinel")
+			waited <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		master := "localhost"
+		if q.Master() == "localhost:6379" {
+			master = "127.0.0.1"
+		}
+		fs.failover(master, "6379")
+		if !eventually(func() bool { return q.Master() == master+":6379" }) {
+			t.Fatalf("expected master %s:6379 but got %v", master, q.Master())
+		}
+		select {
+		case err := <-waited:
+			if err != nil {
+				t.Errorf("expected the command to be sent to the new master but got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("timed out waiting for the command")
+		}
+	})
+
+	t.Run("reads from replicas which are up", func(t *testing.T) {
+		host, port, _ := net.SplitHostPort(fs.addr)
+		fs.setReplicas(
+			[]interface{}{"name", fs.addr, "ip", host, "port", port, "flags", "slave"},
+			// Nothing listens on port 1, so reads sent to it would fail.
+			[]interface{}{"name", "127.0.0.1:1", "ip", "127.0.0.1", "port", "1", "flags", "s_down,slave"},
+		)
+
+		r := p.Replicas()
+		for i := 0; i < 4; i++ {
+			if v, err := r.Get("_tests:jimmy:redis:sentinel"); err != nil || v != "replica" {
+				t.Errorf("expected replica but got %q, %v", v, err)
+			}
+		}
+	})
+}
+
+// fakeSentinel is a stand-in for Redis Sentinel, serving a single master's address and replicas
+// and announcing failovers. It also answers GET with "replica", so it can stand in for a replica.
+type fakeSentinel struct {
+	addr string
+	name string
+
+	mu          sync.Mutex
+	master      []interface{}
+	replicas    []interface{}
+	subscribers []*fakeConn
+}
+
+func newFakeSentinel(t *testing.T, name, host, port string) *fakeSentinel {
+	fs := &fakeSentinel{name: name, master: []interface{}{host, port}}
+	fs.addr = newFakeServer(t, fs.serve)
+	return fs
+}
+
+// serve returns the handler of the commands of a connection.
+func (fs *fakeSentinel) serve(c *fakeConn) func([]string) {
+	return func(args []string) {
+		fs.mu.Lock()
+		var replies []interface{}
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			replies = append(replies, respStatus("PONG"))
+		case "SELECT":
+			replies = append(replies, respStatus("OK"))
+		case "GET":
+			replies = append(replies, "replica")
+		case "SUBSCRIBE":
+			fs.subscribers = append(fs.subscribers, c)
+			for i, channel := range args[1:] {
+				replies = append(replies, []interface{}{"subscribe", channel, i + 1})
+			}
+		case "SENTINEL":
+			switch {
+			case len(args) != 3 || args[2] != fs.name:
+				replies = append(replies, nil)
+			case strings.EqualFold(args[1], "GET-MASTER-ADDR-BY-NAME"):
+				replies = append(replies, fs.master)
+			case strings.EqualFold(args[1], "REPLICAS"):
+				replies = append(replies, fs.replicas)
+			default:
+				replies = append(replies, respError("ERR unknown sentinel subcommand"))
+			}
+		default:
+			replies = append(replies, respError("ERR unknown command"))
+		}
+		fs.mu.Unlock()
+
+		for _, reply := range replies {
+			c.write(reply)
+		}
+	}
+}
+
+// subscribed reports whether at least n connections have subscribed to announcements.
+func (fs *fakeSentinel) subscribed(n int) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return len(fs.subscribers) >= n
+}
+
+func (fs *fakeSentinel) setReplicas(replicas ...interface{}) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.replicas = replicas
+}
+
+// failover switches the master, and announces it on +switch-master.
+func (fs *fakeSentinel) failover(host, port string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	old := fs.master
+	fs.master = []interface{}{host, port}
+	data := strings.Join([]string{fs.name, old[0].(string), old[1].(string), host, port}, " ")
+	for _, c := range fs.subscribers {
+		c.write([]interface{}{"message", "+switch-master", data})
+	}
+}
@@ -0,0 +1,189 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	netURL "net/url"
+	"sort"
+	"strconv"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// The number of points each shard has on the hash ring. The more there are, the more evenly keys
+// are spread between shards.
+const shardVirtualNodes = 160
+
+// ShardedPool is a Pool which spreads keys over several Redis servers, each a shard, by consistent
+// hashing: each shard owns the keys whose hashes fall in its arcs of a hash ring. Adding or removing
+// a shard only moves the keys of the arcs it gains or loses. If a key contains a hash tag, a
+// non-empty substring between its first { and the next }, only the tag is hashed, so keys with the
+// same tag are on the same shard.
+//
+// Del, Exists, Touch and Unlink are split between the shards of their keys, and the counts they
+// reply with summed. The keys of other multi-key commands, such as SDiff, PFMerge and Rename, and
+// of a transaction, must be on the same shard, or the command fails with ErrCrossShard. Pipelines
+// are split into a pipeline per shard, and their replies merged back in the order the commands
+// were queued.
+//
+// Commands without keys, such as Scan and Publish, and PubSub, go to the first shard. FLUSHDB,
+// FLUSHALL and SCRIPT LOAD and FLUSH are sent to every shard.
+type ShardedPool interface {
+	Pool
+
+	// ForEachShard calls f with the Pool of each shard, in the order of their URLs, stopping at the
+	// first error, e.g. to scan the keys of every shard. The pools must not be shut down.
+	ForEachShard(f func(Pool) error) error
+}
+
+// NewShardedPool returns a ShardedPool over the servers at urls, each pooled according to config.
+// A shard's place on the ring depends on the host and path of its URL, not on its position in
+// urls, so the URLs may be reordered without moving keys.
+func NewShardedPool(urls []string, config Config) (ShardedPool, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("redis: sharded pool needs the URL of at least one shard")
+	}
+
+	s := &shards{nodes: map[string]*pool{}}
+	for _, url := range urls {
+		parsedURL, err := netURL.Parse(url)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+
+		// Each shard is known by its host and path, which needn't be a network address.
+		addr := parsedURL.Host + parsedURL.Path
+		if s.nodes[addr] != nil {
+			s.Close()
+			return nil, fmt.Errorf("redis: sharded pool has shard %q twice", addr)
+		}
+		s.addrList = append(s.addrList, addr)
+		s.nodes[addr] = NewPoolWithURL(parsedURL, config).(*pool)
+	}
+	s.ring = newHashRing(s.addrList)
+
+	first := s.nodes[s.addrList[0]]
+	p := &shardedPool{pool: &pool{p: s, url: first.url, username: first.username, password: first.password, options: first.options}, shards: s}
+	if err := p.setUp(config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type shardedPool struct {
+	*pool
+
+	shards *shards
+}
+
+func (s *shardedPool) WithContext(ctx context.Context) Pool {
+	p := *s
+	p.pool = s.pool.WithContext(ctx).(*pool)
+	return &p
+}
+
+func (s *shardedPool) ForEachShard(f func(Pool) error) error {
+	for _, addr := range s.shards.addrList {
+		if err := f(s.shards.nodes[addr]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shards is the connSource of a ShardedPool. Its shards don't change once created, so it needs no
+// locking.
+type shards struct {
+	// The identifier of each shard, in the order of their URLs.
+	addrList []string
+	nodes    map[string]*pool
+	ring     hashRing
+}
+
+func (s *shards) Get() redigo.Conn {
+	return newRoutedConn(nil, s)
+}
+
+func (s *shards) GetContext(ctx context.Context) (redigo.Conn, error) {
+	return newRoutedConn(ctx, s), nil
+}
+
+func (s *shards) stats() PoolStats {
+	var stats PoolStats
+	for _, node := range s.nodes {
+		stats = stats.add(node.Stats())
+	}
+	return stats
+}
+
+func (s *shards) Close() error {
+	for _, node := range s.nodes {
+		node.Shutdown()
+	}
+	return nil
+}
+
+func (s *shards) shard(key string) int {
+	return s.ring.shard(key)
+}
+
+func (s *shards) addr(shard int) string {
+	return s.addrList[shard]
+}
+
+func (s *shards) anyAddr() string {
+	return s.addrList[0]
+}
+
+func (s *shards) addrs() []string {
+	return s.addrList
+}
+
+func (s *shards) node(addr string) (*pool, error) {
+	node := s.nodes[addr]
+	if node == nil {
+		return nil, fmt.Errorf("redis: sharded pool has no shard %q", addr)
+	}
+	return node, nil
+}
+
+// follow returns replies as they are, as shards don't redirect commands.
+func (s *shards) follow(ctx context.Context, reply interface{}, err error, command string, args []interface{}) (interface{}, error) {
+	return reply, err
+}
+
+func (s *shards) queued(err error) {}
+
+// hashRing is a consistent hash ring, sorted by hash.
+type hashRing []hashRingPoint
+
+type hashRingPoint struct {
+	hash  uint32
+	shard int
+}
+
+// newHashRing returns a ring with shardVirtualNodes points for each of the shards named by names.
+func newHashRing(names []string) hashRing {
+	ring := make(hashRing, 0, len(names)*shardVirtualNodes)
+	for shard, name := range names {
+		for i := 0; i < shardVirtualNodes; i++ {
+			ring = append(ring, hashRingPoint{hash: crc32.ChecksumIEEE([]byte(name + "-" + strconv.Itoa(i))), shard: shard})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+// shard returns the shard owning key: that of the first point at or after the key's hash, wrapping
+// around to the first point.
+func (r hashRing) shard(key string) int {
+	hash := crc32.ChecksumIEEE([]byte(hashTag(key)))
+	i := sort.Search(len(r), func(i int) bool { return r[i].hash >= hash })
+	if i == len(r) {
+		i = 0
+	}
+	return r[i].shard
+}
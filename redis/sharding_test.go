@@ -0,0 +1,225 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+	"github.com/timehop/jimmy/redis/redistest"
+)
+
+func TestShardedPool(t *testing.T) {
+	// The shards are databases of the same server, so which shard a key was written to can be told
+	// from the databases it's in.
+	urls := []string{"redis://localhost:6379/10", "redis://localhost:6379/11", "redis://localhost:6379/12"}
+	p, err := redis.NewShardedPool(urls, redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create sharded pool: %v", err)
+	}
+	defer p.Shutdown()
+
+	var shards []redis.Pool
+	p.ForEachShard(func(shard redis.Pool) error {
+		shards = append(shards, shard)
+		return nil
+	})
+
+	// shardOf returns the index of the shard key is on, or -1.
+	shardOf := func(key string) int {
+		for i, shard := range shards {
+			if ok, _ := shard.Exists(key); ok {
+				return i
+			}
+		}
+		return -1
+	}
+
+	flush := func() {
+		p.Do(func(c redis.Connection) { c.Do("FLUSHDB") })
+	}
+
+	// Keys on different shards.
+	var keys []string
+	flush()
+	for i := 0; len(keys) < len(shards) && i < 100; i++ {
+		key := fmt.Sprintf("_tests:jimmy:redis:sharding:%d", i)
+		p.Set(key, "1")
+		if shardOf(key) == len(keys) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) != len(shards) {
+		t.Fatalf("expected a key on each shard but got %v", keys)
+	}
+
+	reset := func() {
+		flush()
+		for _, key := range keys {
+			p.Set(key, "1")
+		}
+	}
+
+	t.Run("spreads keys over every shard", func(t *testing.T) {
+		reset()
+		for i, key := range keys {
+			if v, err := p.Get(key); err != nil || v != "1" {
+				t.Errorf("expected 1 but got %q, %v", v, err)
+			}
+			var n int
+			shards[i].Do(func(c redis.Connection) { n, _ = redis.Int(c.Do("DBSIZE")) })
+			if n != 1 {
+				t.Errorf("expected shard %d to have 1 key but got %d", i, n)
+			}
+		}
+	})
+
+	t.Run("is a ShardedPool bound to a context", func(t *testing.T) {
+		sp, ok := p.WithContext(context.Background()).(redis.ShardedPool)
+		if !ok {
+			t.Fatal("expected a ShardedPool")
+		}
+		var n int
+		sp.ForEachShard(func(redis.Pool) error { n++; return nil })
+		if n != len(urls) {
+			t.Errorf("expected %d shards but got %d", len(urls), n)
+		}
+	})
+
+	t.Run("places keys independently of the order of URLs", func(t *testing.T) {
+		reversed := []string{urls[2], urls[1], urls[0]}
+		other, err := redis.NewShardedPool(reversed, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create sharded pool: %v", err)
+		}
+		defer other.Shutdown()
+
+		reset()
+		for _, key := range keys {
+			if v, err := other.Get(key); err != nil || v != "1" {
+				t.Errorf("expected 1 but got %q, %v", v, err)
+			}
+		}
+	})
+
+	t.Run("keeps keys with the same hash tag together", func(t *testing.T) {
+		reset()
+		for i := 0; i < 10; i++ {
+			p.Set(fmt.Sprintf("{_tests:jimmy:redis:sharding}:%d", i), "1")
+		}
+		first := shardOf("{_tests:jimmy:redis:sharding}:0")
+		for i := 1; i < 10; i++ {
+			if shard := shardOf(fmt.Sprintf("{_tests:jimmy:redis:sharding}:%d", i)); shard != first {
+				t.Errorf("expected key %d on shard %d but got %d", i, first, shard)
+			}
+		}
+	})
+
+	t.Run("splits Del between shards and sums the keys deleted", func(t *testing.T) {
+		reset()
+		n, err := p.Del(append(keys, "_tests:jimmy:redis:sharding:missing")...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n != len(keys) {
+			t.Errorf("expected %d keys deleted but got %d", len(keys), n)
+		}
+		for _, key := range keys {
+			if shardOf(key) != -1 {
+				t.Errorf("expected %s to have been deleted", key)
+			}
+		}
+	})
+
+	t.Run("fails multi-key commands across shards", func(t *testing.T) {
+		reset()
+		if _, err := p.SDiff(keys[0], keys[1]); !errors.Is(err, redis.ErrCrossShard) {
+			t.Errorf("expected ErrCrossShard from SDiff but got %v", err)
+		}
+		if _, err := p.PFMerge(keys[0], keys[1]); !errors.Is(err, redis.ErrCrossShard) {
+			t.Errorf("expected ErrCrossShard from PFMerge but got %v", err)
+		}
+		if err := p.Rename(keys[0], keys[1]); !errors.Is(err, redis.ErrCrossShard) {
+			t.Errorf("expected ErrCrossShard from Rename but got %v", err)
+		}
+		if shardOf(keys[0]) != 0 {
+			t.Error("expected the key not to have been renamed")
+		}
+	})
+
+	t.Run("runs multi-key commands on a single shard", func(t *testing.T) {
+		reset()
+		a, b := "{_tests:jimmy:redis:sharding}:a", "{_tests:jimmy:redis:sharding}:b"
+		p.SAdd(a, "1", "2")
+		p.SAdd(b, "2")
+		diff, err := p.SDiff(a, b)
+		if err != nil || len(diff) != 1 || diff[0] != "1" {
+			t.Errorf("expected [1] but got %v, %v", diff, err)
+		}
+	})
+
+	t.Run("splits pipelines and merges their replies in order", func(t *testing.T) {
+		reset()
+		var incrs []*redis.IntFuture
+		var del *redis.IntFuture
+		_, err := p.Pipelined(func(p redis.Pipeline) {
+			for _, key := range keys {
+				incrs = append(incrs, p.Incr(key))
+			}
+			del = p.Del(keys...)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i, incr := range incrs {
+			if incr.Val() != 2 {
+				t.Errorf("expected reply %d to be 2 but got %d", i, incr.Val())
+			}
+		}
+		if del.Val() != len(keys) {
+			t.Errorf("expected %d keys deleted but got %d", len(keys), del.Val())
+		}
+	})
+
+	t.Run("runs transactions on the shard of their keys", func(t *testing.T) {
+		reset()
+		replies, err := p.Transaction(func(t redis.Transaction) {
+			t.Incr(keys[1])
+			t.Incr(keys[1])
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n, _ := redis.Int(replies[1], nil); n != 3 {
+			t.Errorf("expected 3 but got %d", n)
+		}
+	})
+
+	t.Run("discards transactions across shards", func(t *testing.T) {
+		reset()
+		_, err := p.Transaction(func(t redis.Transaction) {
+			t.Incr(keys[0])
+			t.Incr(keys[1])
+		})
+		if !errors.Is(err, redis.ErrCrossShard) {
+			t.Errorf("expected ErrCrossShard but got %v", err)
+		}
+		if v, _ := p.Get(keys[0]); v != "1" {
+			t.Errorf("expected the transaction to have been discarded but got %q", v)
+		}
+	})
+
+	t.Run("conformance", func(t *testing.T) {
+		redistest.RunConformance(t, func(t *testing.T) redistest.Target {
+			flush()
+			return p
+		})
+	})
+
+	t.Run("fails to be created with the same shard twice", func(t *testing.T) {
+		if _, err := redis.NewShardedPool([]string{urls[0], urls[0]}, redis.DefaultConfig); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// PoolStats is a snapshot of a Pool's connections, and counts of what has happened to them since
+// the pool was created. The stats of a pool of several servers, such as a ClusterPool, are the sums
+// of those of each server's pool. Those of a SentinelPool's master start again from zero when the
+// master changes.
+type PoolStats struct {
+	// Connections open, whether in use or idle.
+	ActiveCount int
+	// Connections idle in the pool.
+	IdleCount int
+	// Callers taking a connection from the pool at the moment, whether waiting for one to be
+	// returned to it, or dialed.
+	Waiting int
+
+	// Connections dialed, and dials which failed.
+	Dials      int64
+	DialErrors int64
+	// Connections taken from the pool.
+	Borrows int64
+	// Times a caller waited for a connection to be returned to the pool, and how long they waited
+	// altogether.
+	Waits        int64
+	WaitDuration time.Duration
+	// Times a connection couldn't be taken as the pool had MaxOpenConnections open, and didn't wait.
+	Exhausted int64
+	// Connections closed after failing, e.g. as the server went away, or a health check failed.
+	ClosedBad int64
+}
+
+func (s PoolStats) add(o PoolStats) PoolStats {
+	s.ActiveCount += o.ActiveCount
+	s.IdleCount += o.IdleCount
+	s.Waiting += o.Waiting
+	s.Dials += o.Dials
+	s.DialErrors += o.DialErrors
+	s.Borrows += o.Borrows
+	s.Waits += o.Waits
+	s.WaitDuration += o.WaitDuration
+	s.Exhausted += o.Exhausted
+	s.ClosedBad += o.ClosedBad
+	return s
+}
+
+// Implemented by connSources which keep stats, or sum those of the pools they route between.
+type statsSource interface {
+	stats() PoolStats
+}
+
+func (s *pool) Stats() PoolStats {
+	if source, ok := s.p.(statsSource); ok {
+		return source.stats()
+	}
+	return PoolStats{}
+}
+
+// countedPool is the connSource of a pool of a single server: a redigo.Pool, counting what happens
+// to its connections.
+type countedPool struct {
+	*redigo.Pool
+
+	waiting    atomic.Int64
+	dials      atomic.Int64
+	dialErrors atomic.Int64
+	borrows    atomic.Int64
+	exhausted  atomic.Int64
+	closedBad  atomic.Int64
+}
+
+// dial wraps the dial func of the pool, counting the connections it dials.
+func (p *countedPool) dial(dial func() (redigo.Conn, error)) func() (redigo.Conn, error) {
+	return func() (redigo.Conn, error) {
+		p.dials.Add(1)
+		c, err := dial()
+		if err != nil {
+			p.dialErrors.Add(1)
+			return nil, err
+		}
+		return countedConn{Conn: c, p: p}, nil
+	}
+}
+
+func (p *countedPool) Get() redigo.Conn {
+	p.waiting.Add(1)
+	c := p.Pool.Get()
+	p.waiting.Add(-1)
+
+	p.count(c.Err())
+	return c
+}
+
+func (p *countedPool) GetContext(ctx context.Context) (redigo.Conn, error) {
+	p.waiting.Add(1)
+	c, err := p.Pool.GetContext(ctx)
+	p.waiting.Add(-1)
+
+	p.count(err)
+	return c, err
+}
+
+// count counts a connection taken from the pool, or the error taking it failed with.
+func (p *countedPool) count(err error) {
+	switch {
+	case err == nil:
+		p.borrows.Add(1)
+	case errors.Is(err, redigo.ErrPoolExhausted):
+		p.exhausted.Add(1)
+	}
+}
+
+func (p *countedPool) stats() PoolStats {
+	s := p.Pool.Stats()
+	return PoolStats{
+		ActiveCount:  s.ActiveCount,
+		IdleCount:    s.IdleCount,
+		Waiting:      int(p.waiting.Load()),
+		Dials:        p.dials.Load(),
+		DialErrors:   p.dialErrors.Load(),
+		Borrows:      p.borrows.Load(),
+		Waits:        s.WaitCount,
+		WaitDuration: s.WaitDuration,
+		Exhausted:    p.exhausted.Load(),
+		ClosedBad:    p.closedBad.Load(),
+	}
+}
+
+// countedConn is a connection dialed by a countedPool, which counts it if it's closed after failing.
+// The pool closes connections which fail while they're in use, or when tested as they're taken.
+type countedConn struct {
+	redigo.Conn
+	p *countedPool
+}
+
+func (c countedConn) Close() error {
+	if c.Conn.Err() != nil {
+		c.p.closedBad.Add(1)
+	}
+	return c.Conn.Close()
+}
+
+// The pool's connections only support deadlines if the connections they wrap do.
+
+func (c countedConn) DoContext(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	return redigo.DoContext(c.Conn, ctx, command, args...)
+}
+
+func (c countedConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redigo.ReceiveContext(c.Conn, ctx)
+}
+
+func (c countedConn) DoWithTimeout(timeout time.Duration, command string, args ...interface{}) (interface{}, error) {
+	return redigo.DoWithTimeout(c.Conn, timeout, command, args...)
+}
+
+func (c countedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redigo.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// PublishExpvar publishes the stats of p as the expvar name, e.g. to be served at /debug/vars. Like
+// expvar.Publish, it panics if name is already published.
+func PublishExpvar(name string, p Pool) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return p.Stats()
+	}))
+}
+
+// The metrics served by StatsHandler, in the order they're written.
+var poolMetrics = []struct {
+	name, kind, help string
+	value            func(PoolStats) float64
+}{
+	{"redis_pool_active_connections", "gauge", "Connections open, whether in use or idle.",
+		func(s PoolStats) float64 { return float64(s.ActiveCount) }},
+	{"redis_pool_idle_connections", "gauge", "Connections idle in the pool.",
+		func(s PoolStats) float64 { return float64(s.IdleCount) }},
+	{"redis_pool_waiting", "gauge", "Callers taking a connection from the pool.",
+		func(s PoolStats) float64 { return float64(s.Waiting) }},
+	{"redis_pool_dials_total", "counter", "Connections dialed.",
+		func(s PoolStats) float64 { return float64(s.Dials) }},
+	{"redis_pool_dial_errors_total", "counter", "Dials which failed.",
+		func(s PoolStats) float64 { return float64(s.DialErrors) }},
+	{"redis_pool_borrows_total", "counter", "Connections taken from the pool.",
+		func(s PoolStats) float64 { return float64(s.Borrows) }},
+	{"redis_pool_waits_total", "counter", "Times a caller waited for a connection.",
+		func(s PoolStats) float64 { return float64(s.Waits) }},
+	{"redis_pool_wait_seconds_total", "counter", "Time spent waiting for connections.",
+		func(s PoolStats) float64 { return s.WaitDuration.Seconds() }},
+	{"redis_pool_exhausted_total", "counter", "Times the pool had no connection to give.",
+		func(s PoolStats) float64 { return float64(s.Exhausted) }},
+	{"redis_pool_closed_bad_total", "counter", "Connections closed after failing.",
+		func(s PoolStats) float64 { return float64(s.ClosedBad) }},
+}
+
+// StatsHandler returns an http.Handler which serves the stats of pools in the Prometheus text
+// format, each labelled with its name in pools, e.g. pool="sessions".
+func StatsHandler(pools map[string]Pool) http.Handler {
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := make([]PoolStats, len(names))
+		for i, name := range names {
+			stats[i] = pools[name].Stats()
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, metric := range poolMetrics {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+			for i, name := range names {
+				fmt.Fprintf(w, "%s{pool=\"%s\"} %g\n", metric.name, escape.Replace(name), metric.value(stats[i]))
+			}
+		}
+	})
+}
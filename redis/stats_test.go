@@ -0,0 +1,179 @@
+package redis_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestStats(t *testing.T) {
+	newPool := func(url string, config redis.Config) redis.Pool {
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	t.Run("counts dials and borrows", func(t *testing.T) {
+		p := newPool("redis://localhost:6379/10", redis.DefaultConfig)
+		for i := 0; i < 3; i++ {
+			p.Exists("key")
+		}
+
+		stats := p.Stats()
+		if stats.Dials != 1 || stats.Borrows != 3 || stats.ActiveCount != 1 || stats.IdleCount != 1 {
+			t.Errorf("expected 1 dial, 3 borrows and 1 idle connection but got %+v", stats)
+		}
+	})
+
+	t.Run("counts dial errors", func(t *testing.T) {
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		ln.Close()
+
+		p := newPool("redis://"+addr, redis.DefaultConfig)
+		if _, err := p.Exists("key"); err == nil {
+			t.Fatal("expected error")
+		}
+		if stats := p.Stats(); stats.Dials != 1 || stats.DialErrors != 1 || stats.Borrows != 0 {
+			t.Errorf("expected 1 failed dial but got %+v", stats)
+		}
+	})
+
+	t.Run("counts exhaustion", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.MaxOpenConnections = 1
+		config.Wait = false
+		p := newPool("redis://localhost:6379/10", config)
+
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Release()
+
+		if _, err := p.GetConnection(); err != redis.ErrPoolExhausted {
+			t.Fatalf("expected ErrPoolExhausted but got %v", err)
+		}
+		if stats := p.Stats(); stats.Exhausted != 1 {
+			t.Errorf("expected to be exhausted once but got %+v", stats)
+		}
+	})
+
+	t.Run("counts waits", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.MaxOpenConnections = 1
+		p := newPool("redis://localhost:6379/10", config)
+
+		c, err := p.GetConnection()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.Exists("key")
+		}()
+
+		if !eventually(func() bool { return p.Stats().Waiting == 1 }) {
+			t.Errorf("expected 1 waiting but got %+v", p.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+		c.Release()
+		<-done
+
+		stats := p.Stats()
+		if stats.Waits != 1 || stats.WaitDuration < 10*time.Millisecond || stats.Waiting != 0 {
+			t.Errorf("expected to wait once for at least 10ms but got %+v", stats)
+		}
+	})
+
+	t.Run("counts connections closed after failing", func(t *testing.T) {
+		proxy := newDroppingProxy(t)
+		config := redis.DefaultConfig
+		config.HealthCheckAfter = time.Millisecond
+		p := newPool("redis://"+proxy.addr+"/10", config)
+
+		p.Exists("key")
+		proxy.drop()
+		time.Sleep(5 * time.Millisecond)
+		p.Exists("key")
+
+		if stats := p.Stats(); stats.ClosedBad != 1 || stats.Dials != 2 {
+			t.Errorf("expected 1 connection closed as bad but got %+v", stats)
+		}
+	})
+
+	t.Run("sums the stats of each shard", func(t *testing.T) {
+		p, err := redis.NewShardedPool([]string{"redis://localhost:6379/10", "redis://localhost:6379/11"}, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+
+		for i := 0; i < 20; i++ {
+			p.Exists("key" + string(rune('a'+i)))
+		}
+		if stats := p.Stats(); stats.Dials != 2 || stats.Borrows != 20 {
+			t.Errorf("expected 2 dials and 20 borrows but got %+v", stats)
+		}
+	})
+
+	t.Run("publishes stats with expvar", func(t *testing.T) {
+		p := newPool("redis://localhost:6379/10", redis.DefaultConfig)
+		p.Exists("key")
+
+		// Names can't be published twice, even when the test is run again.
+		name := "jimmy_test_pool_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		redis.PublishExpvar(name, p)
+		var stats redis.PoolStats
+		if err := json.Unmarshal([]byte(expvar.Get(name).String()), &stats); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Borrows != 1 {
+			t.Errorf("expected 1 borrow but got %+v", stats)
+		}
+	})
+
+	t.Run("serves stats in the Prometheus text format", func(t *testing.T) {
+		sessions := newPool("redis://localhost:6379/10", redis.DefaultConfig)
+		cache := newPool("redis://localhost:6379/11", redis.DefaultConfig)
+		sessions.Exists("key")
+		sessions.Exists("key")
+
+		server := httptest.NewServer(redis.StatsHandler(map[string]redis.Pool{"sessions": sessions, "cache": cache}))
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+			t.Errorf("expected the Prometheus text format but got %q", got)
+		}
+		for _, line := range []string{
+			"# TYPE redis_pool_borrows_total counter",
+			`redis_pool_borrows_total{pool="cache"} 0`,
+			`redis_pool_borrows_total{pool="sessions"} 2`,
+			`redis_pool_idle_connections{pool="sessions"} 1`,
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("expected %q in:\n%s", line, body)
+			}
+		}
+	})
+}
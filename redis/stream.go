@@ -0,0 +1,340 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// NoBlock tells XRead and XReadGroup not to block waiting for entries.
+const NoBlock time.Duration = -1
+
+type StreamEntry struct {
+	ID string
+	// Fields is nil for an entry which was deleted while pending.
+	Fields map[string]string
+}
+
+// Stream holds the entries read from one stream by XRead or XReadGroup.
+type Stream struct {
+	Name    string
+	Entries []StreamEntry
+}
+
+// PendingSummary is the summary form of XPENDING.
+type PendingSummary struct {
+	Count int
+	// Lowest and Highest are the smallest and greatest pending IDs, empty if there are none.
+	Lowest  string
+	Highest string
+	// Consumers maps each consumer with pending entries to their number.
+	Consumers map[string]int
+}
+
+// PendingEntry is an entry of the extended form of XPENDING.
+type PendingEntry struct {
+	ID            string
+	Consumer      string
+	Idle          time.Duration
+	DeliveryCount int
+}
+
+type StreamInfo struct {
+	Length          int
+	RadixTreeKeys   int
+	RadixTreeNodes  int
+	Groups          int
+	LastGeneratedID string
+	// FirstEntry and LastEntry are nil if the stream is empty.
+	FirstEntry *StreamEntry
+	LastEntry  *StreamEntry
+}
+
+type StreamGroupInfo struct {
+	Name            string
+	Consumers       int
+	Pending         int
+	LastDeliveredID string
+}
+
+type StreamConsumerInfo struct {
+	Name    string
+	Pending int
+	Idle    time.Duration
+}
+
+// Returns the arguments shared by XREAD and XREADGROUP, with streams sorted by name.
+func streamReadArgs(streams map[string]string, count int, block time.Duration) redigo.Args {
+	args := redigo.Args{}
+	if count > 0 {
+		args = args.Add("COUNT", count)
+	}
+	if block >= 0 {
+		args = args.Add("BLOCK", int64(block/time.Millisecond))
+	}
+	args = args.Add("STREAMS")
+
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args = args.AddFlat(names)
+	for _, name := range names {
+		args = args.Add(streams[name])
+	}
+	return args
+}
+
+func streamEntry(reply interface{}) (StreamEntry, error) {
+	values, err := redigo.Values(reply, nil)
+	if err != nil {
+		return StreamEntry{}, err
+	}
+	if len(values) != 2 {
+		return StreamEntry{}, fmt.Errorf("redis: expected stream entry of 2 values but got %d", len(values))
+	}
+
+	id, err := redigo.String(values[0], nil)
+	if err != nil {
+		return StreamEntry{}, err
+	}
+
+	entry := StreamEntry{ID: id}
+	if values[1] != nil {
+		entry.Fields, err = stringMapReply(values[1], nil)
+		if err != nil {
+			return StreamEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// Converts a reply such as XRANGE's into stream entries. Entries deleted while pending, which
+// some versions of Redis return as nil, are skipped.
+func streamEntries(reply interface{}, err error) ([]StreamEntry, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]StreamEntry, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		entry, err := streamEntry(v)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Converts a reply such as XREAD's into streams.
+func streamsReply(reply interface{}, err error) ([]Stream, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make([]Stream, len(values))
+	for i, v := range values {
+		stream, err := redigo.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(stream) != 2 {
+			return nil, fmt.Errorf("redis: expected stream of 2 values but got %d", len(stream))
+		}
+
+		streams[i].Name, err = redigo.String(stream[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		streams[i].Entries, err = streamEntries(stream[1], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return streams, nil
+}
+
+func pendingSummary(reply interface{}, err error) (PendingSummary, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	if len(values) != 4 {
+		return PendingSummary{}, fmt.Errorf("redis: expected pending summary of 4 values but got %d", len(values))
+	}
+
+	summary := PendingSummary{Consumers: map[string]int{}}
+	if summary.Count, err = redigo.Int(values[0], nil); err != nil {
+		return PendingSummary{}, err
+	}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+	if summary.Lowest, err = redigo.String(values[1], nil); err != nil {
+		return PendingSummary{}, err
+	}
+	if summary.Highest, err = redigo.String(values[2], nil); err != nil {
+		return PendingSummary{}, err
+	}
+
+	consumers, err := redigo.Values(values[3], nil)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	for _, c := range consumers {
+		consumer, err := redigo.Values(c, nil)
+		if err != nil {
+			return PendingSummary{}, err
+		}
+
+		var name string
+		var count int
+		if _, err := redigo.Scan(consumer, &name, &count); err != nil {
+			return PendingSummary{}, err
+		}
+		summary.Consumers[name] = count
+	}
+	return summary, nil
+}
+
+func pendingEntries(reply interface{}, err error) ([]PendingEntry, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]PendingEntry, len(values))
+	for i, v := range values {
+		fields, err := redigo.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var idle int64
+		if _, err := redigo.Scan(fields, &entries[i].ID, &entries[i].Consumer, &idle, &entries[i].DeliveryCount); err != nil {
+			return nil, err
+		}
+		entries[i].Idle = time.Duration(idle) * time.Millisecond
+	}
+	return entries, nil
+}
+
+func autoClaimed(reply interface{}, err error) (string, []StreamEntry, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return "", nil, err
+	}
+	// Redis 7 adds a third value, the IDs of claimed entries which no longer exist.
+	if len(values) < 2 {
+		return "", nil, fmt.Errorf("redis: expected XAUTOCLAIM reply of at least 2 values but got %d", len(values))
+	}
+
+	next, err := redigo.String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	entries, err := streamEntries(values[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return next, entries, nil
+}
+
+// XINFO replies are lists of alternating field names and values, whose fields vary between
+// versions of Redis. This converts such a list into a map, so fields can be picked by name.
+func infoMap(reply interface{}, err error) (map[string]interface{}, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("redis: cannot convert info reply to map as it has an odd number of values")
+	}
+
+	info := map[string]interface{}{}
+	for i := 0; i < len(values); i += 2 {
+		name, err := redigo.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		info[name] = values[i+1]
+	}
+	return info, nil
+}
+
+func streamInfo(reply interface{}, err error) (StreamInfo, error) {
+	info, err := infoMap(reply, err)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+
+	var s StreamInfo
+	s.Length, _ = redigo.Int(info["length"], nil)
+	s.RadixTreeKeys, _ = redigo.Int(info["radix-tree-keys"], nil)
+	s.RadixTreeNodes, _ = redigo.Int(info["radix-tree-nodes"], nil)
+	s.Groups, _ = redigo.Int(info["groups"], nil)
+	s.LastGeneratedID, _ = redigo.String(info["last-generated-id"], nil)
+
+	for field, entry := range map[string]**StreamEntry{"first-entry": &s.FirstEntry, "last-entry": &s.LastEntry} {
+		if info[field] == nil {
+			continue
+		}
+		e, err := streamEntry(info[field])
+		if err != nil {
+			return StreamInfo{}, err
+		}
+		*entry = &e
+	}
+	return s, nil
+}
+
+func streamGroupInfos(reply interface{}, err error) ([]StreamGroupInfo, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]StreamGroupInfo, len(values))
+	for i, v := range values {
+		info, err := infoMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].Name, _ = redigo.String(info["name"], nil)
+		groups[i].Consumers, _ = redigo.Int(info["consumers"], nil)
+		groups[i].Pending, _ = redigo.Int(info["pending"], nil)
+		groups[i].LastDeliveredID, _ = redigo.String(info["last-delivered-id"], nil)
+	}
+	return groups, nil
+}
+
+func streamConsumerInfos(reply interface{}, err error) ([]StreamConsumerInfo, error) {
+	values, err := redigo.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers := make([]StreamConsumerInfo, len(values))
+	for i, v := range values {
+		info, err := infoMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		consumers[i].Name, _ = redigo.String(info["name"], nil)
+		consumers[i].Pending, _ = redigo.Int(info["pending"], nil)
+		idle, _ := redigo.Int64(info["idle"], nil)
+		consumers[i].Idle = time.Duration(idle) * time.Millisecond
+	}
+	return consumers, nil
+}
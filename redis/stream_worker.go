@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+var (
+	DefaultStreamWorkerCount = 10
+	DefaultStreamWorkerBlock = 5 * time.Second
+
+	// How long a StreamWorker waits before reading again after Redis returns an error.
+	streamWorkerErrorDelay = 1 * time.Second
+)
+
+// StreamHandler processes an entry delivered to a StreamWorker. The entry is acknowledged if the
+// handler returns nil. Otherwise it stays pending, and is retried once it has been pending for
+// StreamWorkerConfig.ClaimMinIdle.
+type StreamHandler func(ctx context.Context, entry StreamEntry) error
+
+type StreamWorkerConfig struct {
+	Stream   string
+	Group    string
+	Consumer string
+
+	// Count is the maximum number of entries read at a time. Defaults to DefaultStreamWorkerCount.
+	Count int
+
+	// Block is how long a read waits for new entries before the worker looks for abandoned ones.
+	// Defaults to DefaultStreamWorkerBlock.
+	Block time.Duration
+
+	// ClaimMinIdle is how long an entry must have been pending before the worker claims it with
+	// XAUTOCLAIM, presuming the consumer it was delivered to has died. Zero disables claiming.
+	ClaimMinIdle time.Duration
+
+	// OnError, if set, is called with the errors returned by Redis and by the handler. The worker
+	// carries on regardless.
+	OnError func(error)
+}
+
+// StreamWorker consumes a stream as a member of a consumer group.
+type StreamWorker struct {
+	pool    Pool
+	config  StreamWorkerConfig
+	handler StreamHandler
+}
+
+func NewStreamWorker(p Pool, config StreamWorkerConfig, handler StreamHandler) *StreamWorker {
+	if config.Count < 1 {
+		config.Count = DefaultStreamWorkerCount
+	}
+	if config.Block <= 0 {
+		config.Block = DefaultStreamWorkerBlock
+	}
+
+	return &StreamWorker{pool: p, config: config, handler: handler}
+}
+
+// Run creates the consumer group if it doesn't exist, then handles entries until ctx is done, and
+// returns ctx's error. Entries delivered to the consumer before it last stopped are handled first.
+func (w *StreamWorker) Run(ctx context.Context) error {
+	p := w.pool.WithContext(ctx)
+
+	err := p.XGroupCreate(w.config.Stream, w.config.Group, "0", true)
+	if err != nil && !isBusyGroup(err) {
+		return err
+	}
+
+	// The consumer's own pending entries are read from pendingID until there are none left.
+	pendingID := "0"
+	claimStart := "0-0"
+
+	for ctx.Err() == nil {
+		if w.config.ClaimMinIdle > 0 {
+			next, entries, err := p.XAutoClaim(w.config.Stream, w.config.Group, w.config.Consumer, w.config.ClaimMinIdle, claimStart, w.config.Count)
+			// Claiming failing, e.g. as the server predates XAUTOCLAIM, mustn't hold up new entries.
+			if err != nil {
+				w.report(err)
+			} else {
+				claimStart = next
+				w.handle(ctx, p, entries)
+			}
+		}
+
+		id, block := ">", w.config.Block
+		if pendingID != "" {
+			id, block = pendingID, NoBlock
+		}
+
+		streams, err := p.XReadGroup(w.config.Group, w.config.Consumer, map[string]string{w.config.Stream: id}, w.config.Count, block)
+		if err == ErrNil {
+			continue
+		}
+		if err != nil {
+			w.fail(ctx, err)
+			continue
+		}
+
+		var entries []StreamEntry
+		if len(streams) > 0 {
+			entries = streams[0].Entries
+		}
+		if pendingID != "" {
+			pendingID = ""
+			if len(entries) > 0 {
+				pendingID = entries[len(entries)-1].ID
+			}
+		}
+
+		w.handle(ctx, p, entries)
+	}
+
+	return ctx.Err()
+}
+
+func (w *StreamWorker) handle(ctx context.Context, p Pool, entries []StreamEntry) {
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Entries deleted while pending have nothing left to handle.
+		if entry.Fields != nil {
+			if err := w.handler(ctx, entry); err != nil {
+				w.report(fmt.Errorf("redis: stream worker failed to handle entry %v: %w", entry.ID, err))
+				continue
+			}
+		}
+
+		if _, err := p.XAck(w.config.Stream, w.config.Group, entry.ID); err != nil {
+			w.report(err)
+		}
+	}
+}
+
+// fail reports an error from Redis, then waits a little before the worker tries again.
+func (w *StreamWorker) fail(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	w.report(err)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(streamWorkerErrorDelay):
+	}
+}
+
+func (w *StreamWorker) report(err error) {
+	if w.config.OnError != nil {
+		w.config.OnError(err)
+	}
+}
+
+func isBusyGroup(err error) bool {
+	var redisErr redigo.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "BUSYGROUP ")
+}
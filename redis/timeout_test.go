@@ -0,0 +1,96 @@
+package redis_test
+
+import (
+	"errors"
+	"net"
+	netURL "net/url"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestTimeouts(t *testing.T) {
+	// A server which accepts connections but never replies, like a blackholed host.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	addr := ln.Addr().String()
+
+	isTimeout := func(err error) bool {
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}
+
+	t.Run("gives up waiting on replies after the read timeout of Config", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.ReadTimeout = 50 * time.Millisecond
+		p, err := redis.NewPool("redis://"+addr, config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+
+		start := time.Now()
+		if _, err := p.Get("key"); !isTimeout(err) {
+			t.Errorf("expected timeout but got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected to give up after 50ms but took %v", elapsed)
+		}
+	})
+
+	t.Run("gives up waiting on replies after the read timeout of the URL", func(t *testing.T) {
+		// The database is selected while connecting, which times out.
+		url, _ := netURL.Parse("redis://" + addr + "/10?read_timeout=50ms")
+		if _, err := redis.NewConnection(url); !isTimeout(err) {
+			t.Errorf("expected timeout but got %v", err)
+		}
+	})
+
+	t.Run("gives up waiting on replies after the read timeout of Config, without a pool", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.ReadTimeout = 50 * time.Millisecond
+		url, _ := netURL.Parse("redis://" + addr + "/10")
+		if _, err := redis.NewConnectionWithConfig(url, config); !isTimeout(err) {
+			t.Errorf("expected timeout but got %v", err)
+		}
+	})
+
+	t.Run("connects to responsive servers with every timeout set", func(t *testing.T) {
+		url := "redis://localhost:6379/10?dial_timeout=1s&read_timeout=1s&write_timeout=1s&keepalive=-1s"
+		p, err := redis.NewPool(url, redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+
+		if _, err := p.Exists("key"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails to connect with an invalid timeout", func(t *testing.T) {
+		url, _ := netURL.Parse("redis://localhost:6379?dial_timeout=soon")
+		if _, err := redis.NewConnection(url); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -0,0 +1,256 @@
+package redis_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	netURL "net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server := ca.issue(t, "redis.test")
+	client := ca.issue(t, "client")
+
+	dir := t.TempDir()
+	caFile := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := client.writePEM(t, dir, "client")
+
+	// The server's certificate is only valid for redis.test, not for the address it's dialed at.
+	proxy := newTLSProxy(t, &tls.Config{Certificates: []tls.Certificate{server.tlsCertificate()}})
+	mutualProxy := newTLSProxy(t, &tls.Config{
+		Certificates: []tls.Certificate{server.tlsCertificate()},
+		ClientCAs:    ca.pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+
+	ping := func(url string, config redis.Config) error {
+		p, err := redis.NewPool(url, config)
+		if err != nil {
+			return err
+		}
+		defer p.Shutdown()
+
+		if doErr := p.Do(func(c redis.Connection) { _, err = c.Do("PING") }); doErr != nil {
+			return doErr
+		}
+		return err
+	}
+
+	t.Run("connects with the CA and server name in the URL", func(t *testing.T) {
+		url := "rediss://" + proxy.addr + "/10?tls_server_name=redis.test&tls_ca_file=" + caFile
+		if err := ping(url, redis.DefaultConfig); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := proxy.serverName(); got != "redis.test" {
+			t.Errorf("expected SNI redis.test but got %q", got)
+		}
+	})
+
+	t.Run("connects with an unpooled connection", func(t *testing.T) {
+		url := "rediss://" + proxy.addr + "/10?tls_server_name=redis.test&tls_ca_file=" + caFile
+		parsedURL, _ := netURL.Parse(url)
+		c, err := redis.NewConnection(parsedURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Close()
+		if _, err := c.Do("PING"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails to verify a server signed by an unknown CA", func(t *testing.T) {
+		if err := ping("rediss://"+proxy.addr+"?tls_server_name=redis.test", redis.DefaultConfig); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("fails to verify a server whose certificate is for another name", func(t *testing.T) {
+		if err := ping("rediss://"+proxy.addr+"?tls_ca_file="+caFile, redis.DefaultConfig); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("skips verifying the server when asked to", func(t *testing.T) {
+		if err := ping("rediss://"+proxy.addr+"?tls_skip_verify=true", redis.DefaultConfig); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("presents a client certificate", func(t *testing.T) {
+		url := "rediss://" + mutualProxy.addr + "?tls_server_name=redis.test&tls_ca_file=" + caFile
+		if err := ping(url, redis.DefaultConfig); err == nil {
+			t.Error("expected error without a client certificate")
+		}
+		if err := ping(url+"&tls_cert_file="+certFile+"&tls_key_file="+keyFile, redis.DefaultConfig); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("connects with the TLS config of Config", func(t *testing.T) {
+		config := redis.DefaultConfig
+		config.TLSConfig = &tls.Config{
+			RootCAs:      ca.pool(),
+			ServerName:   "redis.test",
+			Certificates: []tls.Certificate{client.tlsCertificate()},
+		}
+		if err := ping("rediss://"+mutualProxy.addr, config); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails to dial with a missing CA file", func(t *testing.T) {
+		if err := ping("rediss://"+proxy.addr+"?tls_ca_file="+filepath.Join(dir, "missing.pem"), redis.DefaultConfig); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+// testCertificate is a certificate and its key, signed by a testCA.
+type testCertificate struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// writePEM writes the certificate and key to name.pem and name-key.pem in dir, and returns their
+// paths.
+func (c *testCertificate) writePEM(t *testing.T, dir, name string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: c.der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", file, err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// testCA is a certificate authority generated for a test.
+type testCA struct {
+	testCertificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jimmy test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return &testCA{*newTestCertificate(t, template, nil)}
+}
+
+// issue returns a certificate for name, valid for both servers and clients.
+func (ca *testCA) issue(t *testing.T, name string) *testCertificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	return newTestCertificate(t, template, &ca.testCertificate)
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// writePEM writes the CA's certificate to name.pem in dir, and returns its path.
+func (ca *testCA) writePEM(t *testing.T, dir, name string) string {
+	certFile, _ := ca.testCertificate.writePEM(t, dir, name)
+	return certFile
+}
+
+// newTestCertificate generates a key, and a certificate for it from template, signed by parent, or
+// self-signed if parent is nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &testCertificate{cert: cert, der: der, key: key}
+}
+
+// tlsProxy terminates TLS in front of the Redis server at localhost:6379.
+type tlsProxy struct {
+	addr string
+
+	mu  sync.Mutex
+	sni string
+}
+
+func newTLSProxy(t *testing.T, config *tls.Config) *tlsProxy {
+	proxy := &tlsProxy{}
+
+	config = config.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		proxy.mu.Lock()
+		proxy.sni = hello.ServerName
+		proxy.mu.Unlock()
+		return nil, nil
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	proxy.addr = ln.Addr().String()
+
+	go proxyToRedis(ln)
+	return proxy
+}
+
+// serverName returns the name the last client sent with SNI.
+func (p *tlsProxy) serverName() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sni
+}
@@ -0,0 +1,179 @@
+package redis
+
+import (
+	"context"
+	"net"
+	netURL "net/url"
+	"strconv"
+	"sync"
+
+	"github.com/timehop/jimmy/redis/redisurl"
+)
+
+// Tracer starts the spans of a pool's calls, e.g. by adapting an OpenTelemetry tracer. See
+// Config.Tracer.
+type Tracer interface {
+	// Start starts a span named name, as a child of any span in ctx, and returns a context
+	// carrying it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	End()
+}
+
+// Redactor returns the arguments of a command as they're shown in the db.statement of its span, and
+// in logs.
+// See RedactValues, RedactArgs and RedactNothing.
+type Redactor func(name string, args []interface{}) []string
+
+// RedactValues shows the keys of a command, and replaces its other arguments with "?".
+func RedactValues(name string, args []interface{}) []string {
+	keys := map[string]bool{}
+	for _, key := range commandKeys(name, args) {
+		keys[key] = true
+	}
+
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if s := argString(arg); keys[s] {
+			redacted[i] = s
+		} else {
+			redacted[i] = "?"
+		}
+	}
+	return redacted
+}
+
+// RedactArgs replaces every argument of a command with "?".
+func RedactArgs(name string, args []interface{}) []string {
+	redacted := make([]string, len(args))
+	for i := range args {
+		redacted[i] = "?"
+	}
+	return redacted
+}
+
+// RedactNothing shows the arguments of a command as they are.
+func RedactNothing(name string, args []interface{}) []string {
+	return argStrings(args)
+}
+
+// traceHook returns a Hook which starts a span for each call: named after the command for a single
+// command, or PIPELINE or TRANSACTION with the number of commands they batch.
+func traceHook(tracer Tracer, redact Redactor, url func() *netURL.URL) Hook {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) error {
+			var name string
+			switch call.Kind {
+			case CallPipeline:
+				name = "PIPELINE"
+			case CallTransaction:
+				name = "TRANSACTION"
+			default:
+				name = commandName(call.Cmds[0].Name, call.Cmds[0].Args)
+			}
+
+			ctx, span := tracer.Start(ctx, name)
+			defer span.End()
+
+			span.SetAttribute("db.system", "redis")
+			span.SetAttribute("db.statement", statement(call, redact))
+			if call.Kind != CallCommand {
+				span.SetAttribute("db.operation.batch.size", len(call.Cmds))
+			}
+
+			network, addr := redisurl.Address(url())
+			if host, port, err := net.SplitHostPort(addr); network == "tcp" && err == nil {
+				span.SetAttribute("server.address", host)
+				if n, err := strconv.Atoi(port); err == nil {
+					span.SetAttribute("server.port", n)
+				}
+			} else {
+				span.SetAttribute("server.address", addr)
+			}
+
+			err := next(ctx, call)
+			if err != nil {
+				span.RecordError(err)
+			}
+			return err
+		}
+	}
+}
+
+// SpanRecorder is a Tracer which records spans in memory, for tests.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span recorded by a SpanRecorder.
+type RecordedSpan struct {
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	Ended      bool
+	// The span that was in the context it was started with, if any.
+	Parent *RecordedSpan
+
+	r *SpanRecorder
+}
+
+type recordedSpanKey struct{}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &RecordedSpan{Name: name, Attributes: map[string]interface{}{}, r: r}
+	span.Parent, _ = ctx.Value(recordedSpanKey{}).(*RecordedSpan)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+// Spans returns copies of the spans started since the recorder was created or reset, in the order
+// they were started.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, span := range r.spans {
+		spans[i] = *span
+		spans[i].Attributes = map[string]interface{}{}
+		for k, v := range span.Attributes {
+			spans[i].Attributes[k] = v
+		}
+	}
+	return spans
+}
+
+// Reset forgets the spans recorded so far.
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Err = err
+}
+
+func (s *RecordedSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.Ended = true
+}
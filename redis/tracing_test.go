@@ -0,0 +1,122 @@
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := &redis.SpanRecorder{}
+	newPool := func(redactor redis.Redactor) redis.Pool {
+		config := redis.DefaultConfig
+		config.Tracer = recorder
+		config.Redactor = redactor
+		p, err := redis.NewPool("redis://localhost:6379/10", config)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		t.Cleanup(p.Shutdown)
+		return p
+	}
+
+	p := newPool(nil)
+	key := "_tests:jimmy:redis:tracing"
+	defer p.Del(key)
+
+	t.Run("traces each command", func(t *testing.T) {
+		recorder.Reset()
+		p.Set(key, "secret")
+
+		spans := recorder.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("expected 1 span but got %+v", spans)
+		}
+		want := map[string]interface{}{
+			"db.system":      "redis",
+			"db.statement":   "SET " + key + " ?",
+			"server.address": "localhost",
+			"server.port":    6379,
+		}
+		if span := spans[0]; span.Name != "SET" || !reflect.DeepEqual(span.Attributes, want) || span.Err != nil || !span.Ended {
+			t.Errorf("expected an ended SET span with %v but got %+v", want, span)
+		}
+	})
+
+	t.Run("traces pipelines and transactions as a span each", func(t *testing.T) {
+		recorder.Reset()
+		p.Pipelined(func(p redis.Pipeline) {
+			p.Set(key, "secret")
+			p.Get(key)
+		})
+		p.Transaction(func(t redis.Transaction) {
+			t.Incr(key + ":count")
+			t.Del(key + ":count")
+			t.Expire(key, 60)
+		})
+
+		spans := recorder.Spans()
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans but got %+v", spans)
+		}
+		if span := spans[0]; span.Name != "PIPELINE" || span.Attributes["db.operation.batch.size"] != 2 ||
+			span.Attributes["db.statement"] != "SET "+key+" ?\nGET "+key {
+			t.Errorf("expected a PIPELINE span of 2 commands but got %+v", span)
+		}
+		if span := spans[1]; span.Name != "TRANSACTION" || span.Attributes["db.operation.batch.size"] != 3 {
+			t.Errorf("expected a TRANSACTION span of 3 commands but got %+v", span)
+		}
+	})
+
+	t.Run("records errors", func(t *testing.T) {
+		recorder.Reset()
+		p.Set(key, "value")
+		p.LPush(key, "value")
+
+		spans := recorder.Spans()
+		if len(spans) != 2 || spans[1].Name != "LPUSH" || spans[1].Err == nil {
+			t.Errorf("expected an LPUSH span with an error but got %+v", spans)
+		}
+	})
+
+	t.Run("starts spans under the span of the connection's context", func(t *testing.T) {
+		recorder.Reset()
+		ctx, parent := recorder.Start(context.Background(), "request")
+		p.WithContext(ctx).Exists(key)
+		parent.End()
+
+		spans := recorder.Spans()
+		if len(spans) != 2 || spans[1].Parent == nil || spans[1].Parent.Name != "request" {
+			t.Errorf("expected an EXISTS span under the request span but got %+v", spans)
+		}
+	})
+
+	t.Run("redacts arguments as configured", func(t *testing.T) {
+		for _, test := range []struct {
+			redactor redis.Redactor
+			want     string
+		}{
+			{redis.RedactArgs, "HSET ? ? ?"},
+			{redis.RedactNothing, "HSET " + key + " field secret"},
+		} {
+			p := newPool(test.redactor)
+			recorder.Reset()
+			p.Del(key)
+			p.HSet(key, "field", "secret")
+
+			spans := recorder.Spans()
+			if len(spans) != 2 || spans[1].Attributes["db.statement"] != test.want {
+				t.Errorf("expected %q but got %+v", test.want, spans)
+			}
+		}
+	})
+
+	t.Run("shows the keys of commands with several", func(t *testing.T) {
+		got := redis.RedactValues("EVAL", []interface{}{"return 1", 2, "a", "b", "secret"})
+		if want := []string{"?", "?", "a", "b", "?"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q but got %q", want, got)
+		}
+	})
+}
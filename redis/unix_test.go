@@ -0,0 +1,108 @@
+package redis_test
+
+import (
+	"net"
+	netURL "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timehop/jimmy/redis"
+)
+
+func TestUnixSocket(t *testing.T) {
+	sock := newUnixProxy(t)
+
+	tcp, err := redis.NewPool("redis://localhost:6379/11", redis.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	defer tcp.Shutdown()
+
+	key := "_tests:jimmy:redis:unix"
+
+	t.Run("connects to the socket and selects the database", func(t *testing.T) {
+		for _, url := range []string{"unix://" + sock + "?db=11", "redis+unix://" + sock + "?db=11"} {
+			tcp.Del(key)
+
+			p, err := redis.NewPool(url, redis.DefaultConfig)
+			if err != nil {
+				t.Fatalf("failed to create pool: %v", err)
+			}
+			if err := p.Set(key, url); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			p.Shutdown()
+
+			if v, _ := tcp.Get(key); v != url {
+				t.Errorf("expected %q in database 11 but got %q", url, v)
+			}
+		}
+	})
+
+	t.Run("falls back to connecting without auth", func(t *testing.T) {
+		p, err := redis.NewPool("unix://:testpass@"+sock+"?db=11", redis.DefaultConfig)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+		defer p.Shutdown()
+
+		for i := 0; i < 2; i++ {
+			if _, err := p.Exists(key); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("connects unpooled", func(t *testing.T) {
+		url, _ := netURL.Parse("unix://" + sock)
+		c, err := redis.NewConnection(url)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer c.Close()
+		if _, err := c.Do("PING"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails to connect to a missing socket", func(t *testing.T) {
+		url, _ := netURL.Parse("unix://" + sock + ".missing")
+		if _, err := redis.NewConnection(url); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+// newUnixProxy listens on a unix socket in front of the Redis server at localhost:6379, and
+// returns the socket's path.
+func newUnixProxy(t *testing.T) string {
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed.
+	dir, err := os.MkdirTemp("", "jimmy")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sock := filepath.Join(dir, "redis.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go proxyToRedis(ln)
+	return sock
+}
+
+// proxyToRedis relays the connections accepted by ln to the Redis server at localhost:6379, until
+// ln is closed.
+func proxyToRedis(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go relayToRedis(conn)
+	}
+}